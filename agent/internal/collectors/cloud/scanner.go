@@ -19,14 +19,14 @@ const (
 )
 
 type Finding struct {
-	Provider    Provider
-	Resource    string
-	ResourceID  string
-	Category    string
-	Severity    string
-	Description string
-	Remediation string
-	Metadata    map[string]interface{}
+	Provider    Provider               `json:"provider"`
+	Resource    string                 `json:"resource"`
+	ResourceID  string                 `json:"resource_id"`
+	Category    string                 `json:"category"`
+	Severity    string                 `json:"severity"`
+	Description string                 `json:"description"`
+	Remediation string                 `json:"remediation"`
+	Metadata    map[string]interface{} `json:"metadata"`
 }
 
 type ScanRule struct {
@@ -45,6 +45,7 @@ type CloudCollector struct {
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
 	mu         sync.RWMutex
+	scanMu     sync.Mutex
 	lastScan   time.Time
 	findings   []Finding
 }
@@ -121,6 +122,10 @@ func (c *CloudCollector) scanLoop(ctx context.Context) {
 }
 
 func (c *CloudCollector) runScan(ctx context.Context) {
+	// Scheduled and on-demand scans take turns.
+	c.scanMu.Lock()
+	defer c.scanMu.Unlock()
+
 	log.Printf("cloud collector: starting %s scan", c.provider)
 
 	var allFindings []Finding
@@ -167,6 +172,12 @@ func findingToEvent(f Finding) core.Event {
 	}
 }
 
+// ScanNow runs a scan outside the schedule and returns its findings.
+func (c *CloudCollector) ScanNow(ctx context.Context) []Finding {
+	c.runScan(ctx)
+	return c.GetFindings()
+}
+
 func (c *CloudCollector) GetFindings() []Finding {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package host
+
+import "errors"
+
+func diskUsage(path string) (total, free uint64, err error) {
+	return 0, 0, errors.New("disk usage not supported on this platform")
+}
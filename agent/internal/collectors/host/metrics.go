@@ -0,0 +1,368 @@
+package host
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/ml"
+)
+
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+}
+
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+type MetricsCollector struct {
+	procRoot string
+	diskPath string
+	interval time.Duration
+	detector *ml.AnomalyDetector
+	hostname string
+	eventCh  chan<- core.Event
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	prevCPU *cpuTimes
+}
+
+func NewMetricsCollector(procRoot, diskPath string, interval time.Duration, detector *ml.AnomalyDetector) *MetricsCollector {
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+	if diskPath == "" {
+		diskPath = "/"
+	}
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if detector == nil {
+		detector = ml.NewAnomalyDetector(0, 0, 0, 0)
+	}
+	hostname, _ := os.Hostname()
+	return &MetricsCollector{
+		procRoot: procRoot,
+		diskPath: diskPath,
+		interval: interval,
+		detector: detector,
+		hostname: hostname,
+	}
+}
+
+func (c *MetricsCollector) Name() string {
+	return "metrics"
+}
+
+func (c *MetricsCollector) Start(ctx context.Context, eventCh chan<- core.Event) error {
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.eventCh = eventCh
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run(ctx)
+	}()
+
+	c.wg.Wait()
+	return nil
+}
+
+func (c *MetricsCollector) Stop() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+	return nil
+}
+
+func (c *MetricsCollector) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	log.Printf("metrics collector: sampling %s every %s", c.procRoot, c.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.collect(time.Now())
+		}
+	}
+}
+
+func (c *MetricsCollector) collect(now time.Time) {
+	metrics := c.Sample()
+	if len(metrics) == 0 {
+		return
+	}
+
+	c.emitEvent(core.Event{
+		Time:     now,
+		Source:   "host",
+		Category: "metrics",
+		Severity: "info",
+		Summary:  fmt.Sprintf("Host metrics sample (%d series)", len(metrics)),
+		Payload: map[string]interface{}{
+			"metrics": metrics,
+			"tags":    map[string]interface{}{"host": c.hostname},
+		},
+	})
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		anomalies := c.detector.Record(name, now, metrics[name])
+		if len(anomalies) == 0 {
+			continue
+		}
+		c.emitEvent(anomalyEvent(c.hostname, anomalies))
+	}
+}
+
+// Sample reads the current value of every host series. Series whose source
+// is unavailable are omitted; CPU usage needs two samples to compute a delta.
+func (c *MetricsCollector) Sample() map[string]float64 {
+	metrics := make(map[string]float64)
+
+	if cpu, ok := c.readCPU(); ok {
+		metrics["cpu_percent"] = cpu
+	}
+	c.readMemory(metrics)
+	c.readLoad(metrics)
+	c.readDisk(metrics)
+
+	if n, err := c.countProcesses(); err == nil {
+		metrics["process_count"] = float64(n)
+	}
+
+	states, ok := c.countTCPStates()
+	if ok {
+		for _, state := range tcpStates {
+			metrics["tcp_"+state] = float64(states[state])
+		}
+	}
+
+	return metrics
+}
+
+func (c *MetricsCollector) readCPU() (float64, bool) {
+	file, err := os.Open(filepath.Join(c.procRoot, "stat"))
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return 0, false
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, false
+	}
+
+	var cur cpuTimes
+	for i, f := range fields[1:] {
+		if i >= 8 { // guest time is already counted in user/nice
+			break
+		}
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		cur.total += v
+		if i == 3 || i == 4 { // idle, iowait
+			cur.idle += v
+		}
+	}
+
+	c.mu.Lock()
+	prev := c.prevCPU
+	c.prevCPU = &cur
+	c.mu.Unlock()
+
+	if prev == nil || cur.total <= prev.total {
+		return 0, false
+	}
+	dTotal := float64(cur.total - prev.total)
+	dIdle := float64(cur.idle - prev.idle)
+	return (1 - dIdle/dTotal) * 100, true
+}
+
+func (c *MetricsCollector) readMemory(metrics map[string]float64) {
+	file, err := os.Open(filepath.Join(c.procRoot, "meminfo"))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = v * 1024
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok || total == 0 {
+		return
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	metrics["mem_used_percent"] = (total - available) / total * 100
+	metrics["mem_available_bytes"] = available
+
+	if swapTotal := values["SwapTotal"]; swapTotal > 0 {
+		metrics["swap_used_percent"] = (swapTotal - values["SwapFree"]) / swapTotal * 100
+	}
+}
+
+func (c *MetricsCollector) readLoad(metrics map[string]float64) {
+	data, err := os.ReadFile(filepath.Join(c.procRoot, "loadavg"))
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 1 {
+		return
+	}
+	if v, err := strconv.ParseFloat(fields[0], 64); err == nil {
+		metrics["load1"] = v
+	}
+}
+
+func (c *MetricsCollector) readDisk(metrics map[string]float64) {
+	total, free, err := diskUsage(c.diskPath)
+	if err != nil || total == 0 {
+		return
+	}
+	metrics["disk_used_percent"] = float64(total-free) / float64(total) * 100
+	metrics["disk_free_bytes"] = float64(free)
+}
+
+func (c *MetricsCollector) countProcesses() (int, error) {
+	entries, err := os.ReadDir(c.procRoot)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := strconv.Atoi(e.Name()); err == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c *MetricsCollector) countTCPStates() (map[string]int, bool) {
+	counts := make(map[string]int)
+	found := false
+
+	for _, name := range []string{"tcp", "tcp6"} {
+		file, err := os.Open(filepath.Join(c.procRoot, "net", name))
+		if err != nil {
+			continue
+		}
+		found = true
+
+		scanner := bufio.NewScanner(file)
+		scanner.Scan() // skip header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 {
+				continue
+			}
+			if state, ok := tcpStates[fields[3]]; ok {
+				counts[state]++
+			}
+		}
+		file.Close()
+	}
+
+	return counts, found
+}
+
+func anomalyEvent(hostname string, anomalies []ml.Anomaly) core.Event {
+	primary := anomalies[0]
+	checks := make([]string, 0, len(anomalies))
+	for _, a := range anomalies {
+		checks = append(checks, string(a.Type))
+		if a.Score > primary.Score {
+			primary = a
+		}
+	}
+
+	severity := "medium"
+	if primary.Score >= 2*primary.Threshold {
+		severity = "high"
+	}
+
+	return core.Event{
+		Time:     primary.Time,
+		Source:   "host",
+		Category: "anomaly",
+		Severity: severity,
+		Summary:  fmt.Sprintf("Anomalous %s on %s: %.2f (%s)", primary.MetricName, hostname, primary.Value, primary.Message),
+		Payload: map[string]interface{}{
+			"metric":    primary.MetricName,
+			"value":     primary.Value,
+			"score":     primary.Score,
+			"type":      string(primary.Type),
+			"threshold": primary.Threshold,
+			"checks":    checks,
+			"host":      hostname,
+		},
+	}
+}
+
+func (c *MetricsCollector) emitEvent(event core.Event) {
+	if c.eventCh == nil {
+		return
+	}
+	select {
+	case c.eventCh <- event:
+	default:
+		log.Println("metrics collector: event channel full, dropping event")
+	}
+}
@@ -0,0 +1,177 @@
+package host_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/host"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/ml"
+)
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 100 0 0 10 0
+   2: 0A00000A:0016 0200000A:D431 01 00000000:00000000 02:000A7B2C 00000000     0        0 1003 4 0000000000000000 20 4 31 10 -1
+   3: 0A00000A:C350 08080808:01BB 06 00000000:00000000 03:00001770 00000000  1000        0 0 3 0000000000000000
+`
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeMeminfo(t *testing.T, root string, totalKB, availableKB int) {
+	t.Helper()
+	writeFile(t, filepath.Join(root, "meminfo"),
+		"MemTotal:       "+strconv.Itoa(totalKB)+" kB\n"+
+			"MemFree:          100000 kB\n"+
+			"MemAvailable:   "+strconv.Itoa(availableKB)+" kB\n"+
+			"SwapTotal:             0 kB\n")
+}
+
+func fakeProc(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "stat"), "cpu  100 0 100 800 0 0 0 0 0 0\ncpu0 100 0 100 800 0 0 0 0 0 0\n")
+	writeMeminfo(t, root, 1000000, 800000)
+	writeFile(t, filepath.Join(root, "loadavg"), "0.50 0.40 0.30 1/123 4567\n")
+	writeFile(t, filepath.Join(root, "net", "tcp"), procNetTCP)
+	for _, pid := range []string{"1", "42", "1337"} {
+		os.MkdirAll(filepath.Join(root, pid), 0o755)
+	}
+	os.MkdirAll(filepath.Join(root, "sys"), 0o755)
+	return root
+}
+
+func TestMetricsCollectorName(t *testing.T) {
+	c := host.NewMetricsCollector("", "", 0, nil)
+	if c.Name() != "metrics" {
+		t.Errorf("expected name 'metrics', got %s", c.Name())
+	}
+}
+
+func TestMetricsCollectorSample(t *testing.T) {
+	root := fakeProc(t)
+	c := host.NewMetricsCollector(root, t.TempDir(), time.Hour, nil)
+
+	first := c.Sample()
+	if _, ok := first["cpu_percent"]; ok {
+		t.Error("expected no cpu_percent on first sample")
+	}
+
+	writeFile(t, filepath.Join(root, "stat"), "cpu  150 0 150 900 0 0 0 0 0 0\n")
+	m := c.Sample()
+
+	if got := m["cpu_percent"]; got != 50 {
+		t.Errorf("expected cpu_percent 50, got %v", got)
+	}
+	if got := m["mem_used_percent"]; got != 20 {
+		t.Errorf("expected mem_used_percent 20, got %v", got)
+	}
+	if got := m["mem_available_bytes"]; got != 800000*1024 {
+		t.Errorf("expected mem_available_bytes %d, got %v", 800000*1024, got)
+	}
+	if got := m["load1"]; got != 0.5 {
+		t.Errorf("expected load1 0.5, got %v", got)
+	}
+	if got := m["process_count"]; got != 3 {
+		t.Errorf("expected process_count 3, got %v", got)
+	}
+	if got := m["tcp_listen"]; got != 2 {
+		t.Errorf("expected tcp_listen 2, got %v", got)
+	}
+	if got := m["tcp_established"]; got != 1 {
+		t.Errorf("expected tcp_established 1, got %v", got)
+	}
+	if got, ok := m["tcp_close_wait"]; !ok || got != 0 {
+		t.Errorf("expected tcp_close_wait reported as 0, got %v (present=%v)", got, ok)
+	}
+	if _, ok := m["disk_used_percent"]; !ok {
+		t.Error("expected disk_used_percent")
+	}
+}
+
+func TestMetricsCollectorEmitsSamples(t *testing.T) {
+	eventCh := make(chan core.Event, 100)
+	c := host.NewMetricsCollector(fakeProc(t), t.TempDir(), 10*time.Millisecond, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx, eventCh)
+	defer c.Stop()
+
+	select {
+	case event := <-eventCh:
+		if event.Category != "metrics" || event.Source != "host" {
+			t.Fatalf("expected host metrics event, got %s/%s", event.Source, event.Category)
+		}
+		metrics, ok := event.Payload["metrics"].(map[string]float64)
+		if !ok {
+			t.Fatalf("expected metrics map in payload, got %T", event.Payload["metrics"])
+		}
+		if metrics["process_count"] != 3 {
+			t.Errorf("expected process_count 3, got %v", metrics["process_count"])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for metrics event")
+	}
+}
+
+func TestMetricsCollectorEmitsAnomaly(t *testing.T) {
+	root := fakeProc(t)
+	eventCh := make(chan core.Event, 1000)
+	detector := ml.NewAnomalyDetector(3.0, 1.5, 10, 50)
+	c := host.NewMetricsCollector(root, t.TempDir(), 5*time.Millisecond, detector)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx, eventCh)
+	defer c.Stop()
+
+	samples := 0
+	deadline := time.After(3 * time.Second)
+	for samples < 15 {
+		select {
+		case event := <-eventCh:
+			if event.Category == "metrics" {
+				samples++
+			}
+		case <-deadline:
+			t.Fatal("timeout collecting baseline samples")
+		}
+	}
+
+	writeMeminfo(t, root, 1000000, 20000)
+
+	for {
+		select {
+		case event := <-eventCh:
+			if event.Category != "anomaly" || event.Payload["metric"] != "mem_used_percent" {
+				continue
+			}
+			if event.Payload["value"].(float64) != 98 {
+				t.Errorf("expected anomalous value 98, got %v", event.Payload["value"])
+			}
+			if event.Severity != "high" && event.Severity != "medium" {
+				t.Errorf("unexpected severity %s", event.Severity)
+			}
+			return
+		case <-deadline:
+			t.Fatal("timeout waiting for anomaly event")
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 var (
 	nginxPattern = regexp.MustCompile(`^(\S+) - (\S+) \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d+) (\d+)`)
 	authPattern  = regexp.MustCompile(`^(\w+\s+\d+\s+[\d:]+)\s+(\S+)\s+(\S+?)(?:\[\d+\])?: (.+)`)
+	sshdPattern  = regexp.MustCompile(`for (?:invalid user )?(\S+) from (\S+) port (\d+)`)
 )
 
 func ParseSyslog(line string) core.Event {
@@ -86,6 +87,11 @@ func ParseAuthLog(line string) core.Event {
 		payload["service"] = matches[3]
 		payload["message"] = matches[4]
 	}
+	if m := sshdPattern.FindStringSubmatch(line); m != nil {
+		payload["user"] = m[1]
+		payload["src_ip"] = m[2]
+		payload["src_port"] = m[3]
+	}
 
 	lower := strings.ToLower(line)
 	if strings.Contains(lower, "failed") || strings.Contains(lower, "invalid") {
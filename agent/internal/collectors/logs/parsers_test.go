@@ -93,6 +93,23 @@ func TestParseAuthLogSuccess(t *testing.T) {
 	}
 }
 
+func TestParseAuthLogExtractsUserAndSource(t *testing.T) {
+	cases := []struct {
+		line, user, ip string
+	}{
+		{"Jan 14 12:00:00 server1 sshd[1234]: Failed password for root from 10.0.0.1 port 22 ssh2", "root", "10.0.0.1"},
+		{"Jan 14 12:00:00 server1 sshd[1234]: Failed password for invalid user oracle from 203.0.113.9 port 50122 ssh2", "oracle", "203.0.113.9"},
+		{"Jan 14 12:00:00 server1 sshd[1234]: Accepted publickey for admin from 2001:db8::1 port 22 ssh2", "admin", "2001:db8::1"},
+	}
+	for _, tc := range cases {
+		event := logs.ParseAuthLog(tc.line)
+		if event.Payload["user"] != tc.user || event.Payload["src_ip"] != tc.ip {
+			t.Errorf("%q: expected user=%s src_ip=%s, got user=%v src_ip=%v",
+				tc.line, tc.user, tc.ip, event.Payload["user"], event.Payload["src_ip"])
+		}
+	}
+}
+
 func TestParseAuthLogBruteForce(t *testing.T) {
 	line := "Jan 14 12:00:00 server1 sshd[1234]: message repeated 5 times: Failed password for root"
 	event := logs.ParseAuthLog(line)
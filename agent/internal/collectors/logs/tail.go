@@ -0,0 +1,83 @@
+package logs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	MaxTailLines = 1000
+	// maxTailBytes bounds how far back Tail reads for very long lines.
+	maxTailBytes = 1 << 20
+)
+
+var ErrUnknownSource = errors.New("not a configured log file")
+
+// Tail returns up to the last n lines of one of the collector's file
+// sources. Only configured sources can be read, so a caller cannot use it
+// to fetch arbitrary files from the host.
+func (c *LogCollector) Tail(source string, n int) ([]string, error) {
+	for _, src := range c.sources {
+		path := strings.TrimPrefix(src, "file://")
+		if strings.HasPrefix(src, "syslog://") || (source != src && source != path) {
+			continue
+		}
+		return TailFile(path, n)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSource, source)
+}
+
+// TailFile returns up to the last n lines of the file at path, oldest
+// first.
+func TailFile(path string, n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+	if n > MaxTailLines {
+		n = MaxTailLines
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read backwards one chunk at a time until there are enough lines.
+	const chunk = 16 << 10
+	end := info.Size()
+	var data []byte
+	for end > 0 && bytes.Count(data, []byte{'\n'}) <= n && int64(len(data)) < maxTailBytes {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		buf := make([]byte, end-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, err
+		}
+		data = append(buf, data...)
+		end = start
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if end > 0 && len(lines) > 0 {
+		// The first line is cut off at the chunk boundary.
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}, nil
+	}
+	return lines, nil
+}
@@ -0,0 +1,53 @@
+package logs_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/logs"
+)
+
+func TestTailFileReturnsLastLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	var b strings.Builder
+	for i := 1; i <= 5000; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	os.WriteFile(path, []byte(b.String()), 0o644)
+
+	lines, err := logs.TailFile(path, 3)
+	if err != nil {
+		t.Fatalf("tail failed: %v", err)
+	}
+	if len(lines) != 3 || lines[0] != "line 4998" || lines[2] != "line 5000" {
+		t.Errorf("unexpected lines %v", lines)
+	}
+
+	lines, _ = logs.TailFile(path, 5000)
+	if len(lines) != logs.MaxTailLines || lines[0] != "line 4001" {
+		t.Errorf("expected the last %d lines, got %d starting %q", logs.MaxTailLines, len(lines), lines[0])
+	}
+
+	short := filepath.Join(t.TempDir(), "short.log")
+	os.WriteFile(short, []byte("only\n"), 0o644)
+	if lines, _ := logs.TailFile(short, 10); len(lines) != 1 || lines[0] != "only" {
+		t.Errorf("expected the single line, got %v", lines)
+	}
+}
+
+func TestTailOnlyReadsConfiguredSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.log")
+	os.WriteFile(path, []byte("a\nb\n"), 0o644)
+	c := logs.NewLogCollector([]string{"file://" + path}, "")
+
+	if lines, err := c.Tail(path, 1); err != nil || len(lines) != 1 || lines[0] != "b" {
+		t.Errorf("expected the last line of a configured source, got %v, %v", lines, err)
+	}
+	if _, err := c.Tail("/etc/shadow", 1); !errors.Is(err, logs.ErrUnknownSource) {
+		t.Errorf("expected ErrUnknownSource for an unconfigured file, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"syscall"
+	"time"
+)
+
+// afPacketSource reads packets from an AF_PACKET socket. SOCK_DGRAM has
+// the kernel strip the link header, so every interface type, VLAN tags
+// included, yields bare IP packets.
+type afPacketSource struct {
+	fd       int
+	buf      []byte
+	loopback map[int]bool
+}
+
+// openAFPacket binds to iface, or to every interface when iface is empty
+// or "any". It needs CAP_NET_RAW. The filter is attached to the socket
+// before it is bound, so no unfiltered packet is queued; one too large for
+// the kernel is left to the agent.
+func openAFPacket(iface string, filter *Filter) (packetSource, error) {
+	proto := htons(syscall.ETH_P_ALL)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(proto))
+	if err != nil {
+		return nil, fmt.Errorf("open packet socket: %w", err)
+	}
+
+	prog, err := filter.BPF()
+	if err != nil {
+		log.Printf("network collector: %v; filtering in the agent only", err)
+	} else if len(prog) > 0 {
+		insns := make([]syscall.SockFilter, len(prog))
+		for i, in := range prog {
+			insns[i] = syscall.SockFilter{Code: in.Code, Jt: in.Jt, Jf: in.Jf, K: in.K}
+		}
+		if err := syscall.AttachLsf(fd, insns); err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("attach capture filter: %w", err)
+		}
+	}
+
+	ifindex := 0
+	if iface != "" && iface != "any" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("capture interface %s: %w", iface, err)
+		}
+		ifindex = ifi.Index
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: ifindex}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("bind packet socket: %w", err)
+	}
+	// Time out reads so the capture loop notices cancellation.
+	tv := syscall.NsecToTimeval(int64(captureReadTimeout))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("set packet socket timeout: %w", err)
+	}
+
+	loopback := make(map[int]bool)
+	if ifaces, err := net.Interfaces(); err == nil {
+		for _, ifi := range ifaces {
+			if ifi.Flags&net.FlagLoopback != 0 {
+				loopback[ifi.Index] = true
+			}
+		}
+	}
+	return &afPacketSource{fd: fd, buf: make([]byte, captureSnaplen), loopback: loopback}, nil
+}
+
+func (s *afPacketSource) Next() (Packet, bool, error) {
+	// MSG_TRUNC makes recvfrom report the packet's full length even though
+	// only the headers fit in the buffer.
+	n, from, err := syscall.Recvfrom(s.fd, s.buf, syscall.MSG_TRUNC)
+	if err != nil {
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			return Packet{}, false, nil
+		}
+		return Packet{}, false, fmt.Errorf("read packet socket: %w", err)
+	}
+	// Loopback traffic is seen once leaving and once arriving.
+	if ll, ok := from.(*syscall.SockaddrLinklayer); ok && ll.Pkttype == syscall.PACKET_OUTGOING && s.loopback[ll.Ifindex] {
+		return Packet{}, false, nil
+	}
+	pkt, err := DecodeIP(s.buf[:min(n, len(s.buf))], n)
+	if err != nil {
+		return Packet{}, false, nil
+	}
+	pkt.Time = time.Now()
+	return pkt, true, nil
+}
+
+func (s *afPacketSource) Close() error {
+	return syscall.Close(s.fd)
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
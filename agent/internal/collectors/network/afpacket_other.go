@@ -0,0 +1,9 @@
+//go:build !linux
+
+package network
+
+import "errors"
+
+func openAFPacket(iface string, filter *Filter) (packetSource, error) {
+	return nil, errors.New("afpacket capture is only supported on linux")
+}
@@ -0,0 +1,185 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BPFInstruction is one classic BPF instruction, laid out as the kernel's
+// struct sock_filter.
+type BPFInstruction struct {
+	Code   uint16
+	Jt, Jf uint8
+	K      uint32
+}
+
+// Classic BPF opcodes used by the filter compiler. Loads are relative to
+// the IP header, which is where an AF_PACKET SOCK_DGRAM packet starts.
+const (
+	bpfLdW    = 0x20 // ld [k]
+	bpfLdH    = 0x28 // ldh [k]
+	bpfLdB    = 0x30 // ldb [k]
+	bpfLdHInd = 0x48 // ldh [x+k]
+	bpfLdImm  = 0x00 // ld #k
+	bpfLdLen  = 0x80 // ld len
+	bpfLdXMsh = 0xb1 // ldxb 4*([k]&0xf)
+	bpfAndK   = 0x54 // and #k
+	bpfAddX   = 0x0c // add x
+	bpfTax    = 0x07 // tax
+	bpfJa     = 0x05 // ja k
+	bpfJEq    = 0x15 // jeq #k
+	bpfJGt    = 0x25 // jgt #k
+	bpfJGe    = 0x35 // jge #k
+	bpfJSet   = 0x45 // jset #k
+	bpfJGeX   = 0x3d // jge x
+	bpfRet    = 0x06 // ret #k
+
+	// bpfSnaplen is returned for accepted packets; it is above any packet
+	// the kernel hands the socket, so none are cut short.
+	bpfSnaplen = 0x40000
+	// bpfMaxInsns is the kernel's BPF_MAXINSNS.
+	bpfMaxInsns = 4096
+)
+
+// BPF compiles the filter for the kernel. The program accepts exactly the
+// packets Match accepts, except IPv6 packets with extension headers or
+// IPv4-mapped addresses, which it passes on for Match to decide. It fails
+// when the expression is too large for classic BPF's jumps; the filter
+// then only runs in the agent.
+func (f *Filter) BPF() ([]BPFInstruction, error) {
+	if f == nil {
+		return nil, nil
+	}
+	c := &bpfCompiler{}
+	accept, reject := c.label(), c.label()
+
+	v4, v6, body := c.label(), c.label(), c.label()
+	c.emit(bpfLdB, 0)
+	c.emit(bpfAndK, 0xf0)
+	c.jump(bpfJEq, 0x40, v4, v6)
+	c.place(v6)
+	next := c.label()
+	c.jump(bpfJEq, 0x60, next, reject)
+	c.place(next)
+	c.emit(bpfLdB, 6)
+	for _, ext := range []uint32{0, 43, 60, 44} {
+		next := c.label()
+		c.jump(bpfJEq, ext, accept, next)
+		c.place(next)
+	}
+	for _, off := range []uint32{8, 24} {
+		other := c.label()
+		for i, word := range []uint32{0, 0, 0xffff} {
+			match := accept
+			if i < 2 {
+				match = c.label()
+			}
+			c.emit(bpfLdW, off+uint32(4*i))
+			c.jump(bpfJEq, word, match, other)
+			if i < 2 {
+				c.place(match)
+			}
+		}
+		c.place(other)
+	}
+	c.jumpTo(body)
+	c.place(v4)
+	c.place(body)
+	f.root.compile(c, accept, reject)
+
+	c.place(accept)
+	c.emit(bpfRet, bpfSnaplen)
+	c.place(reject)
+	c.emit(bpfRet, 0)
+
+	if err := c.resolve(); err != nil {
+		return nil, fmt.Errorf("capture filter %q: %w", f.expr, err)
+	}
+	return c.prog, nil
+}
+
+// bpfLabel names a program position. Jumps are only ever forward, so a
+// label is placed after every jump to it and resolved once the program
+// is complete.
+type bpfLabel int
+
+type bpfFixup struct {
+	at     int
+	jt, jf bpfLabel
+}
+
+type bpfCompiler struct {
+	prog   []BPFInstruction
+	labels []int
+	fixups []bpfFixup
+}
+
+func (c *bpfCompiler) label() bpfLabel {
+	c.labels = append(c.labels, -1)
+	return bpfLabel(len(c.labels) - 1)
+}
+
+func (c *bpfCompiler) place(l bpfLabel) {
+	c.labels[l] = len(c.prog)
+}
+
+func (c *bpfCompiler) emit(code uint16, k uint32) {
+	c.prog = append(c.prog, BPFInstruction{Code: code, K: k})
+}
+
+// jump emits a conditional jump to jt when the test holds and jf when it
+// does not.
+func (c *bpfCompiler) jump(code uint16, k uint32, jt, jf bpfLabel) {
+	c.fixups = append(c.fixups, bpfFixup{at: len(c.prog), jt: jt, jf: jf})
+	c.emit(code, k)
+}
+
+func (c *bpfCompiler) jumpTo(l bpfLabel) {
+	c.fixups = append(c.fixups, bpfFixup{at: len(c.prog), jt: l, jf: -1})
+	c.emit(bpfJa, 0)
+}
+
+// ifVersion continues when the packet is IP version v and jumps to
+// otherwise when it is not.
+func (c *bpfCompiler) ifVersion(v uint32, otherwise bpfLabel) {
+	next := c.label()
+	c.emit(bpfLdB, 0)
+	c.emit(bpfAndK, 0xf0)
+	c.jump(bpfJEq, v<<4, next, otherwise)
+	c.place(next)
+}
+
+// header4 jumps to ok when an IPv4 packet holds need bytes of transport
+// header, and to short when it does not or is a later fragment.
+func (c *bpfCompiler) header4(need uint32, ok, short bpfLabel) {
+	next := c.label()
+	c.emit(bpfLdH, 6)
+	c.jump(bpfJSet, 0x1fff, short, next)
+	c.place(next)
+	c.emit(bpfLdXMsh, 0)
+	c.emit(bpfLdImm, need)
+	c.emit(bpfAddX, 0)
+	c.emit(bpfTax, 0)
+	c.emit(bpfLdLen, 0)
+	c.jump(bpfJGeX, 0, ok, short)
+}
+
+func (c *bpfCompiler) resolve() error {
+	if len(c.prog) > bpfMaxInsns {
+		return fmt.Errorf("%d instructions is over the kernel's limit of %d", len(c.prog), bpfMaxInsns)
+	}
+	for _, f := range c.fixups {
+		insn := &c.prog[f.at]
+		jt := c.labels[f.jt] - f.at - 1
+		if f.jf < 0 {
+			insn.K = uint32(jt)
+			continue
+		}
+		jf := c.labels[f.jf] - f.at - 1
+		if jt < 0 || jt > 255 || jf < 0 || jf > 255 {
+			return errors.New("too large to compile to BPF")
+		}
+		insn.Jt, insn.Jf = uint8(jt), uint8(jf)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package network_test
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+)
+
+// runBPF interprets the subset of classic BPF the filter compiler emits
+// and returns the snap length, zero meaning the packet is dropped. As in
+// the kernel, a load past the end of the packet drops it.
+func runBPF(t *testing.T, prog []network.BPFInstruction, pkt []byte) uint32 {
+	t.Helper()
+	var a, x uint32
+	load := func(off uint32, size int) (uint32, bool) {
+		if int(off)+size > len(pkt) {
+			return 0, false
+		}
+		switch size {
+		case 1:
+			return uint32(pkt[off]), true
+		case 2:
+			return uint32(binary.BigEndian.Uint16(pkt[off:])), true
+		default:
+			return binary.BigEndian.Uint32(pkt[off:]), true
+		}
+	}
+	for pc := 0; pc < len(prog); pc++ {
+		in := prog[pc]
+		ok := true
+		cond := false
+		switch in.Code {
+		case 0x20:
+			a, ok = load(in.K, 4)
+		case 0x28:
+			a, ok = load(in.K, 2)
+		case 0x30:
+			a, ok = load(in.K, 1)
+		case 0x48:
+			a, ok = load(x+in.K, 2)
+		case 0x00:
+			a = in.K
+		case 0x80:
+			a = uint32(len(pkt))
+		case 0xb1:
+			x, ok = load(in.K, 1)
+			x = 4 * (x & 0xf)
+		case 0x54:
+			a &= in.K
+		case 0x0c:
+			a += x
+		case 0x07:
+			x = a
+		case 0x05:
+			pc += int(in.K)
+			continue
+		case 0x06:
+			return in.K
+		case 0x15:
+			cond = a == in.K
+		case 0x25:
+			cond = a > in.K
+		case 0x35:
+			cond = a >= in.K
+		case 0x45:
+			cond = a&in.K != 0
+		case 0x3d:
+			cond = a >= x
+		default:
+			t.Fatalf("unexpected opcode %#x at %d", in.Code, pc)
+		}
+		if !ok {
+			return 0
+		}
+		if in.Code&0x07 == 0x05 {
+			if cond {
+				pc += int(in.Jt)
+			} else {
+				pc += int(in.Jf)
+			}
+		}
+	}
+	t.Fatal("program ran off its end")
+	return 0
+}
+
+func ipv4Packet(src, dst string, proto byte, frag uint16, options int, transport []byte) []byte {
+	ihl := 20 + options
+	pkt := make([]byte, ihl, ihl+len(transport))
+	pkt[0] = 0x40 | byte(ihl/4)
+	binary.BigEndian.PutUint16(pkt[2:], uint16(ihl+len(transport)))
+	binary.BigEndian.PutUint16(pkt[6:], frag)
+	pkt[8] = 64
+	pkt[9] = proto
+	copy(pkt[12:], net.ParseIP(src).To4())
+	copy(pkt[16:], net.ParseIP(dst).To4())
+	return append(pkt, transport...)
+}
+
+func ipv6Packet(src, dst string, next byte, transport []byte) []byte {
+	pkt := make([]byte, 40, 40+len(transport))
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:], uint16(len(transport)))
+	pkt[6] = next
+	pkt[7] = 64
+	copy(pkt[8:], net.ParseIP(src).To16())
+	copy(pkt[24:], net.ParseIP(dst).To16())
+	return append(pkt, transport...)
+}
+
+func transport(src, dst uint16, size int) []byte {
+	b := make([]byte, size)
+	binary.BigEndian.PutUint16(b[0:], src)
+	binary.BigEndian.PutUint16(b[2:], dst)
+	return b
+}
+
+func TestFilterBPFAgreesWithMatch(t *testing.T) {
+	hopByHop := append([]byte{17, 0, 0, 0, 0, 0, 0, 0}, transport(5353, 53, 8)...)
+	packets := []struct {
+		name string
+		data []byte
+		// passed packets are left to Match whatever the expression.
+		passed bool
+	}{
+		{"ipv4 tcp", ipv4Packet("10.0.0.5", "93.184.216.34", 6, 0, 0, transport(51000, 443, 20)), false},
+		{"ipv4 tcp with options", ipv4Packet("10.0.0.5", "93.184.216.34", 6, 0, 8, transport(51000, 443, 20)), false},
+		{"ipv4 udp", ipv4Packet("10.0.0.5", "10.0.0.1", 17, 0, 0, transport(5353, 53, 8)), false},
+		{"ipv4 icmp", ipv4Packet("203.0.113.9", "10.0.0.5", 1, 0, 0, make([]byte, 8)), false},
+		{"ipv4 later fragment", ipv4Packet("10.0.0.5", "93.184.216.34", 6, 185, 0, transport(51000, 443, 20)), false},
+		{"ipv4 first fragment", ipv4Packet("10.0.0.5", "93.184.216.34", 6, 0x2000, 0, transport(51000, 443, 20)), false},
+		{"ipv4 short tcp header", ipv4Packet("10.0.0.5", "93.184.216.34", 6, 0, 0, transport(51000, 443, 8)), false},
+		{"ipv4 gre", ipv4Packet("10.0.0.5", "10.0.0.9", 47, 0, 0, transport(0, 0x0800, 4)), false},
+		{"ipv6 udp", ipv6Packet("2001:db8::1", "2001:db8::53", 17, transport(5353, 53, 8)), false},
+		{"ipv6 tcp", ipv6Packet("2001:db8::1", "2001:db8:1::80", 6, transport(40000, 80, 20)), false},
+		{"ipv6 short udp header", ipv6Packet("2001:db8::1", "2001:db8::53", 17, transport(5353, 53, 4)[:2]), false},
+		{"ipv6 icmp6", ipv6Packet("fe80::1", "ff02::1", 58, make([]byte, 8)), false},
+		{"ipv6 hop-by-hop", ipv6Packet("2001:db8::1", "2001:db8::53", 0, hopByHop), true},
+		{"ipv6 mapped source", ipv6Packet("::ffff:10.0.0.5", "2001:db8::53", 17, transport(5353, 53, 8)), true},
+		{"ipv6 mapped destination", ipv6Packet("2001:db8::1", "::ffff:10.0.0.1", 17, transport(5353, 53, 8)), true},
+	}
+	exprs := []string{
+		"tcp", "udp", "icmp", "icmp6", "ip", "ip6", "ip and not ip6",
+		"port 443", "src port 443", "dst port 53", "tcp dst port 443", "udp port 5353",
+		"port 0", "not port 53", "portrange 0-100", "portrange 50000-52000", "src portrange 1024-65535",
+		"host 93.184.216.34", "src 10.0.0.5", "dst host 10.0.0.1", "host ::ffff:10.0.0.5",
+		"net 10.0.0.0/8", "dst net 10.0.0.0/8", "src net 10.0.0.0/30", "net 0.0.0.0/0", "net ::ffff:0:0/96",
+		"host 2001:db8::53", "net 2001:db8::/32", "src net 2001:db8::/48", "dst net ff00::/8", "net ::/0",
+		"net 10.0.0.0/8 && portrange 50000-52000",
+		"udp or (tcp and port 80)",
+		"! (udp || icmp)",
+		"not (host 10.0.0.5 or ip6) and not icmp",
+		"(tcp or udp) and not (port 22 or port 53 or portrange 8000-8100)",
+	}
+	nonIP := []byte{0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x01}
+
+	for _, expr := range exprs {
+		f, err := network.CompileFilter(expr)
+		if err != nil {
+			t.Fatalf("%q: %v", expr, err)
+		}
+		prog, err := f.BPF()
+		if err != nil {
+			t.Fatalf("%q: %v", expr, err)
+		}
+		if got := runBPF(t, prog, nonIP); got != 0 {
+			t.Errorf("%q: kernel accepted a packet that is not IP", expr)
+		}
+		for _, pkt := range packets {
+			decoded, err := network.DecodeIP(pkt.data, len(pkt.data))
+			if err != nil {
+				t.Fatalf("%s: %v", pkt.name, err)
+			}
+			want := f.Match(decoded) || pkt.passed
+			if got := runBPF(t, prog, pkt.data) != 0; got != want {
+				t.Errorf("%q on %s: kernel verdict %v, agent verdict %v", expr, pkt.name, got, want)
+			}
+		}
+	}
+}
+
+func TestFilterBPF(t *testing.T) {
+	var f *network.Filter
+	if prog, err := f.BPF(); err != nil || prog != nil {
+		t.Errorf("expected no program for an empty filter, got %v, %v", prog, err)
+	}
+
+	terms := make([]string, 200)
+	for i := range terms {
+		terms[i] = "port " + strings.Repeat("1", 1+i%4)
+	}
+	big, err := network.CompileFilter(strings.Join(terms, " or "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := big.BPF(); err == nil {
+		t.Error("expected a filter too large for BPF jumps to fail to compile")
+	}
+}
@@ -2,9 +2,12 @@ package network
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -24,6 +27,43 @@ type FlowStats struct {
 	Bytes     int64
 	FirstSeen time.Time
 	LastSeen  time.Time
+	// Process owns the local socket, when it could be found.
+	Process *ProcessInfo
+	// Direction is inbound or outbound, or empty for captured traffic
+	// between other hosts.
+	Direction string
+	// TCPFlags accumulates the flags seen in either direction. Only
+	// packet capture sees them.
+	TCPFlags uint8
+}
+
+// Capture modes. Polling reads the socket tables every few seconds, so it
+// sees connections but not their packets or bytes; the capture modes
+// count every packet.
+const (
+	CapturePoll     = "poll"
+	CaptureAFPacket = "afpacket"
+	CapturePcap     = "pcap"
+)
+
+const (
+	captureSnaplen     = 512
+	captureReadTimeout = 500 * time.Millisecond
+)
+
+type CaptureConfig struct {
+	Mode string
+	// File is the pcap file replayed in pcap mode.
+	File string
+	// Filter selects the packets counted; see Filter.
+	Filter string
+}
+
+// packetSource yields captured packets. ok is false when a read timed out
+// or the packet was not IP.
+type packetSource interface {
+	Next() (pkt Packet, ok bool, err error)
+	Close() error
 }
 
 type NetworkCollector struct {
@@ -35,29 +75,71 @@ type NetworkCollector struct {
 	flows      map[FlowKey]*FlowStats
 	listenPort int
 	listener   net.Listener
+	capture    CaptureConfig
+	procRoot   string
+	processes  *ProcessResolver
+
+	listeners     map[listenerKey]*Listener
+	baselinePorts map[int]bool
+	expectedPorts map[int]bool
+	localAddrs    map[string]bool
+	ephemeral     [2]int
 }
 
 func NewNetworkCollector(iface string) *NetworkCollector {
+	return NewCaptureCollector(iface, CaptureConfig{Mode: CapturePoll})
+}
+
+// NewCaptureCollector builds a collector that counts flows with the given
+// capture mode instead of polling, bound to iface in afpacket mode.
+func NewCaptureCollector(iface string, capture CaptureConfig) *NetworkCollector {
 	return &NetworkCollector{
-		iface: iface,
-		flows: make(map[FlowKey]*FlowStats),
+		iface:     iface,
+		flows:     make(map[FlowKey]*FlowStats),
+		capture:   capture,
+		procRoot:  "/proc",
+		processes: NewProcessResolver("/proc"),
+
+		baselinePorts: make(map[int]bool),
 	}
 }
 
+// SetProcRoot reads sockets and processes from a procfs mounted at root
+// instead of /proc. Call before Start.
+func (c *NetworkCollector) SetProcRoot(root string) {
+	c.procRoot = root
+	c.processes = NewProcessResolver(root)
+}
+
 func (c *NetworkCollector) Name() string {
 	return "network"
 }
 
 func (c *NetworkCollector) Start(ctx context.Context, eventCh chan<- core.Event) error {
+	src, filter, err := c.openCapture()
+	if err != nil {
+		return err
+	}
+
 	ctx, c.cancel = context.WithCancel(ctx)
 	c.eventCh = eventCh
+	c.ephemeral = ephemeralPorts(c.procRoot)
 
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
-		c.monitorConnections(ctx)
+		c.monitorConnections(ctx, src == nil)
 	}()
 
+	if src != nil {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer src.Close()
+			c.capturePackets(ctx, src, filter)
+		}()
+	}
+
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
@@ -85,18 +167,28 @@ func (c *NetworkCollector) Stop() error {
 	return nil
 }
 
-func (c *NetworkCollector) monitorConnections(ctx context.Context) {
+// monitorConnections polls the socket tables. When packets are captured
+// the poll only attributes the captured flows to processes.
+func (c *NetworkCollector) monitorConnections(ctx context.Context, record bool) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	log.Printf("network collector: monitoring connections on interface %s", c.iface)
+	if record {
+		log.Printf("network collector: monitoring connections on interface %s", c.iface)
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			connections := c.getActiveConnections()
+			c.refreshLocalAddrs()
+			connections, listeners := SplitListeners(c.getActiveSockets())
+			c.updateListeners(listeners)
+			if !record {
+				c.attributeFlows(connections)
+				continue
+			}
 			for _, conn := range connections {
 				c.recordFlow(conn)
 			}
@@ -104,6 +196,95 @@ func (c *NetworkCollector) monitorConnections(ctx context.Context) {
 	}
 }
 
+// openCapture returns the packet source for the configured mode, or nil
+// when polling.
+func (c *NetworkCollector) openCapture() (packetSource, *Filter, error) {
+	var open func(*Filter) (packetSource, error)
+	switch c.capture.Mode {
+	case "", CapturePoll:
+		return nil, nil, nil
+	case CaptureAFPacket:
+		open = func(filter *Filter) (packetSource, error) { return openAFPacket(c.iface, filter) }
+	case CapturePcap:
+		if c.capture.File == "" {
+			return nil, nil, errors.New("pcap capture needs a capture file")
+		}
+		open = func(*Filter) (packetSource, error) { return openPcap(c.capture.File) }
+	default:
+		return nil, nil, fmt.Errorf("unknown capture mode %q", c.capture.Mode)
+	}
+
+	filter, err := CompileFilter(c.capture.Filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := open(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, filter, nil
+}
+
+// capturePackets counts packets into flows until ctx is done or, when
+// replaying a file, the file ends.
+func (c *NetworkCollector) capturePackets(ctx context.Context, src packetSource, filter *Filter) {
+	log.Printf("network collector: capturing packets (%s) on interface %s", c.capture.Mode, c.iface)
+
+	for ctx.Err() == nil {
+		pkt, ok, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			log.Printf("network collector: finished replaying %s", c.capture.File)
+			return
+		}
+		if err != nil {
+			log.Printf("network collector: capture stopped: %v", err)
+			return
+		}
+		if ok && filter.Match(pkt) {
+			c.recordPacket(pkt)
+		}
+	}
+}
+
+// recordPacket counts pkt into its flow. Both directions of a connection
+// count toward one flow, keyed from the side that opened it.
+func (c *NetworkCollector) recordPacket(pkt Packet) {
+	src, dst := normalizeIP(pkt.SrcIP), normalizeIP(pkt.DstIP)
+	key := FlowKey{SrcIP: src, DstIP: dst, DstPort: pkt.DstPort, Protocol: pkt.Protocol}
+	reverse := FlowKey{SrcIP: dst, DstIP: src, DstPort: pkt.SrcPort, Protocol: pkt.Protocol}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flow := c.flows[key]
+	if flow == nil {
+		flow = c.flows[reverse]
+	}
+	if flow == nil {
+		if openedByDst(pkt) {
+			key = reverse
+		}
+		flow = &FlowStats{Key: key, FirstSeen: pkt.Time, Direction: c.flowDirection(key)}
+		c.flows[key] = flow
+	}
+	flow.Packets++
+	flow.Bytes += int64(pkt.Length)
+	flow.TCPFlags |= pkt.TCPFlags
+	if pkt.Time.After(flow.LastSeen) {
+		flow.LastSeen = pkt.Time
+	}
+}
+
+// openedByDst guesses whether the first packet seen of a flow was sent by
+// the side that accepted the connection: a SYN-ACK answers a SYN, and
+// otherwise the lower port is taken to be the service.
+func openedByDst(pkt Packet) bool {
+	if pkt.Protocol == "tcp" && pkt.TCPFlags&TCPSyn != 0 {
+		return pkt.TCPFlags&TCPAck != 0
+	}
+	return pkt.SrcPort != 0 && pkt.SrcPort < pkt.DstPort
+}
+
 type ConnectionInfo struct {
 	LocalAddr  string
 	RemoteAddr string
@@ -111,27 +292,66 @@ type ConnectionInfo struct {
 	RemotePort int
 	Protocol   string
 	State      string
+	// Inode and Process are only known on linux.
+	Inode   uint64
+	Process *ProcessInfo
 }
 
-func (c *NetworkCollector) getActiveConnections() []ConnectionInfo {
-	return getSystemConnections()
+func (c *NetworkCollector) getActiveSockets() []ConnectionInfo {
+	sockets := getSystemSockets(c.procRoot)
+	c.processes.Attribute(sockets)
+	return sockets
 }
 
+// attributeFlows sets the owning process on captured flows that match a
+// socket, in either direction.
+func (c *NetworkCollector) attributeFlows(conns []ConnectionInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range conns {
+		if conn.Process == nil {
+			continue
+		}
+		out := FlowKey{SrcIP: conn.LocalAddr, DstIP: conn.RemoteAddr, DstPort: conn.RemotePort, Protocol: conn.Protocol}
+		in := FlowKey{SrcIP: conn.RemoteAddr, DstIP: conn.LocalAddr, DstPort: conn.LocalPort, Protocol: conn.Protocol}
+		for _, key := range []FlowKey{out, in} {
+			if flow, ok := c.flows[key]; ok && flow.Process == nil {
+				flow.Process = conn.Process
+			}
+		}
+	}
+}
+
+// recordFlow keys an outbound connection from the local address and an
+// inbound one from the remote peer, so sources are always the side that
+// connected.
 func (c *NetworkCollector) recordFlow(conn ConnectionInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	direction := c.direction(conn.Protocol, conn.LocalAddr, conn.LocalPort)
 	key := FlowKey{
 		SrcIP:    conn.LocalAddr,
 		DstIP:    conn.RemoteAddr,
 		DstPort:  conn.RemotePort,
 		Protocol: conn.Protocol,
 	}
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if direction == DirectionInbound {
+		key = FlowKey{
+			SrcIP:    conn.RemoteAddr,
+			DstIP:    conn.LocalAddr,
+			DstPort:  conn.LocalPort,
+			Protocol: conn.Protocol,
+		}
+	}
 
 	now := time.Now()
 	if flow, exists := c.flows[key]; exists {
 		flow.Packets++
 		flow.LastSeen = now
+		if conn.Process != nil {
+			flow.Process = conn.Process
+		}
 	} else {
 		c.flows[key] = &FlowStats{
 			Key:       key,
@@ -139,6 +359,8 @@ func (c *NetworkCollector) recordFlow(conn ConnectionInfo) {
 			Bytes:     0,
 			FirstSeen: now,
 			LastSeen:  now,
+			Process:   conn.Process,
+			Direction: direction,
 		}
 	}
 }
@@ -176,7 +398,7 @@ func (c *NetworkCollector) analyzeFlows() {
 				Source:   "network",
 				Category: "high_traffic",
 				Severity: "medium",
-				Summary:  fmt.Sprintf("High traffic flow: %s -> %s:%d (%d packets)", key.SrcIP, key.DstIP, key.DstPort, flow.Packets),
+				Summary:  fmt.Sprintf("High traffic flow: %s -> %s (%d packets)", key.SrcIP, hostPort(key.DstIP, key.DstPort), flow.Packets),
 				Payload: map[string]interface{}{
 					"src_ip":    key.SrcIP,
 					"dst_ip":    key.DstIP,
@@ -187,6 +409,11 @@ func (c *NetworkCollector) analyzeFlows() {
 					"duration":  flow.LastSeen.Sub(flow.FirstSeen).Seconds(),
 				},
 			}
+			if flow.TCPFlags != 0 {
+				event.Payload["tcp_flags"] = FormatTCPFlags(flow.TCPFlags)
+			}
+			addDirection(event.Payload, flow.Direction)
+			addProcess(event.Payload, flow.Process)
 			c.emitEvent(event)
 		}
 
@@ -196,7 +423,7 @@ func (c *NetworkCollector) analyzeFlows() {
 				Source:   "network",
 				Category: "suspicious_port",
 				Severity: "high",
-				Summary:  fmt.Sprintf("Connection to suspicious port: %s -> %s:%d", key.SrcIP, key.DstIP, key.DstPort),
+				Summary:  fmt.Sprintf("Connection to suspicious port: %s -> %s", key.SrcIP, hostPort(key.DstIP, key.DstPort)),
 				Payload: map[string]interface{}{
 					"src_ip":   key.SrcIP,
 					"dst_ip":   key.DstIP,
@@ -204,6 +431,8 @@ func (c *NetworkCollector) analyzeFlows() {
 					"protocol": key.Protocol,
 				},
 			}
+			addDirection(event.Payload, flow.Direction)
+			addProcess(event.Payload, flow.Process)
 			c.emitEvent(event)
 		}
 	}
@@ -223,43 +452,72 @@ func (c *NetworkCollector) portScanDetector(ctx context.Context) {
 	}
 }
 
+// detectPortScans counts the ports each source contacted. IPv6 sources
+// are grouped by /64, since a host can cycle through the addresses of its
+// prefix.
 func (c *NetworkCollector) detectPortScans() {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	portsBySource := make(map[string]map[int]bool)
+	addrsBySource := make(map[string]map[string]bool)
 
 	for key := range c.flows {
-		if _, exists := portsBySource[key.SrcIP]; !exists {
-			portsBySource[key.SrcIP] = make(map[int]bool)
+		src := scanSource(key.SrcIP)
+		if _, exists := portsBySource[src]; !exists {
+			portsBySource[src] = make(map[int]bool)
+			addrsBySource[src] = make(map[string]bool)
 		}
-		portsBySource[key.SrcIP][key.DstPort] = true
+		portsBySource[src][key.DstPort] = true
+		addrsBySource[src][key.SrcIP] = true
 	}
 
-	for srcIP, ports := range portsBySource {
+	for src, ports := range portsBySource {
 		if len(ports) > 20 {
 			portList := make([]int, 0, len(ports))
 			for p := range ports {
 				portList = append(portList, p)
 			}
+			addrs := make([]string, 0, len(addrsBySource[src]))
+			for a := range addrsBySource[src] {
+				addrs = append(addrs, a)
+			}
+			sort.Strings(addrs)
 
+			from := addrs[0]
+			if len(addrs) > 1 {
+				from = fmt.Sprintf("%s (%d addresses)", src, len(addrs))
+			}
 			event := core.Event{
 				Time:     time.Now(),
 				Source:   "network",
 				Category: "port_scan",
 				Severity: "high",
-				Summary:  fmt.Sprintf("Potential port scan from %s: %d unique ports contacted", srcIP, len(ports)),
+				Summary:  fmt.Sprintf("Potential port scan from %s: %d unique ports contacted", from, len(ports)),
 				Payload: map[string]interface{}{
-					"src_ip":      srcIP,
+					"src_ip":       addrs[0],
 					"unique_ports": len(ports),
 					"sample_ports": portList[:min(10, len(portList))],
 				},
 			}
+			if src != addrs[0] {
+				event.Payload["src_prefix"] = src
+				event.Payload["src_addresses"] = len(addrs)
+			}
 			c.emitEvent(event)
 		}
 	}
 }
 
+// scanSource returns the address itself for IPv4 and its /64 for IPv6.
+func scanSource(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.To4() != nil {
+		return addr
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
 func (c *NetworkCollector) emitEvent(event core.Event) {
 	if c.eventCh == nil {
 		return
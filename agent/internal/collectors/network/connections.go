@@ -2,20 +2,23 @@ package network
 
 import (
 	"bufio"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 )
 
-func getSystemConnections() []ConnectionInfo {
+// getSystemSockets returns every socket, listening ones included.
+func getSystemSockets(procRoot string) []ConnectionInfo {
 	switch runtime.GOOS {
 	case "linux":
-		return getLinuxConnections()
+		return ReadProcSockets(procRoot)
 	case "windows":
 		return getWindowsConnections()
 	case "darwin":
@@ -25,15 +28,42 @@ func getSystemConnections() []ConnectionInfo {
 	}
 }
 
-func getLinuxConnections() []ConnectionInfo {
-	var connections []ConnectionInfo
+// ReadProcNet returns the connected sockets under procRoot/net.
+func ReadProcNet(procRoot string) []ConnectionInfo {
+	conns, _ := SplitListeners(ReadProcSockets(procRoot))
+	return conns
+}
 
-	tcpConns := parseLinuxProcNet("/proc/net/tcp", "tcp")
-	connections = append(connections, tcpConns...)
+// SplitListeners separates the listening sockets, TCP sockets in LISTEN
+// and UDP sockets with no peer, from the connections. Other sockets with
+// no peer are dropped.
+func SplitListeners(sockets []ConnectionInfo) (conns, listeners []ConnectionInfo) {
+	for _, s := range sockets {
+		switch {
+		case !isUnspecified(s.RemoteAddr):
+			conns = append(conns, s)
+		case s.Protocol == "udp" || s.State == "LISTEN" || s.State == "LISTENING":
+			listeners = append(listeners, s)
+		}
+	}
+	return conns, listeners
+}
 
-	udpConns := parseLinuxProcNet("/proc/net/udp", "udp")
-	connections = append(connections, udpConns...)
+func isUnspecified(addr string) bool {
+	return addr == "" || addr == "*" || addr == "0.0.0.0" || addr == "::"
+}
 
+// ReadProcSockets reads the IPv4 and IPv6 socket tables under
+// procRoot/net. Sockets of either family report their protocol as plain
+// tcp or udp.
+func ReadProcSockets(procRoot string) []ConnectionInfo {
+	var connections []ConnectionInfo
+	for _, table := range []struct{ file, protocol string }{
+		{"tcp", "tcp"}, {"tcp6", "tcp"}, {"udp", "udp"}, {"udp6", "udp"},
+	} {
+		conns := parseLinuxProcNet(filepath.Join(procRoot, "net", table.file), table.protocol)
+		connections = append(connections, conns...)
+	}
 	return connections
 }
 
@@ -58,9 +88,9 @@ func parseLinuxProcNet(path, protocol string) []ConnectionInfo {
 		localAddr, localPort := parseHexAddr(fields[1])
 		remoteAddr, remotePort := parseHexAddr(fields[2])
 		state := parseConnState(fields[3])
-
-		if remoteAddr == "0.0.0.0" || remoteAddr == "::" {
-			continue
+		var inode uint64
+		if len(fields) > 9 {
+			inode, _ = strconv.ParseUint(fields[9], 10, 64)
 		}
 
 		connections = append(connections, ConnectionInfo{
@@ -70,6 +100,7 @@ func parseLinuxProcNet(path, protocol string) []ConnectionInfo {
 			RemotePort: remotePort,
 			Protocol:   protocol,
 			State:      state,
+			Inode:      inode,
 		})
 	}
 
@@ -84,17 +115,39 @@ func parseHexAddr(s string) (string, int) {
 
 	port, _ := strconv.ParseInt(parts[1], 16, 32)
 
-	addrHex := parts[0]
-	if len(addrHex) == 8 {
-		bytes, err := hex.DecodeString(addrHex)
-		if err != nil || len(bytes) != 4 {
-			return "", int(port)
-		}
-		ip := net.IPv4(bytes[3], bytes[2], bytes[1], bytes[0])
-		return ip.String(), int(port)
+	ip := decodeProcAddr(parts[0], binary.NativeEndian)
+	if ip == nil {
+		return "", int(port)
+	}
+	return normalizeIP(ip), int(port)
+}
+
+// decodeProcAddr decodes an address from /proc/net. The kernel prints it
+// as 32-bit words in host byte order: one word for IPv4, four for IPv6.
+func decodeProcAddr(s string, order binary.ByteOrder) net.IP {
+	raw, err := hex.DecodeString(s)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil
 	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		order.PutUint32(ip[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+	return ip
+}
+
+// normalizeIP renders ip the way flows key it, with IPv4-mapped IPv6
+// addresses as plain IPv4.
+func normalizeIP(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String()
+	}
+	return ip.String()
+}
 
-	return addrHex, int(port)
+// hostPort joins an address and port, bracketing IPv6 addresses.
+func hostPort(addr string, port int) string {
+	return net.JoinHostPort(addr, strconv.Itoa(port))
 }
 
 func parseConnState(s string) string {
@@ -156,10 +209,6 @@ func parseNetstatOutput(output string) []ConnectionInfo {
 		localAddr, localPort := splitAddrPort(fields[1])
 		remoteAddr, remotePort := splitAddrPort(fields[2])
 
-		if remoteAddr == "0.0.0.0" || remoteAddr == "*" || remoteAddr == "::" {
-			continue
-		}
-
 		state := ""
 		if len(fields) > 3 {
 			state = fields[3]
@@ -186,11 +235,20 @@ func splitAddrPort(s string) (string, int) {
 	addr := s[:lastColon]
 	portStr := s[lastColon+1:]
 	port, _ := strconv.Atoi(portStr)
+
+	// netstat brackets IPv6 addresses and may add a zone.
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if zone := strings.IndexByte(addr, '%'); zone >= 0 {
+		addr = addr[:zone]
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		addr = normalizeIP(ip)
+	}
 	return addr, port
 }
 
 func FormatConnection(c ConnectionInfo) string {
-	return fmt.Sprintf("%s %s:%d -> %s:%d [%s]",
-		c.Protocol, c.LocalAddr, c.LocalPort,
-		c.RemoteAddr, c.RemotePort, c.State)
+	return fmt.Sprintf("%s %s -> %s [%s]",
+		c.Protocol, hostPort(c.LocalAddr, c.LocalPort),
+		hostPort(c.RemoteAddr, c.RemotePort), c.State)
 }
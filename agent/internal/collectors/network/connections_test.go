@@ -0,0 +1,90 @@
+package network_test
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+)
+
+func TestReadProcNetIPv6(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixtures were captured on a little-endian host")
+	}
+	conns := network.ReadProcNet("testdata/procfs")
+
+	want := []struct {
+		local, remote string
+		lport, rport  int
+		proto, state  string
+	}{
+		{"10.0.0.5", "93.184.216.34", 51000, 443, "tcp", "ESTABLISHED"},
+		{"2001:db8::1", "2606:4700::6810:84e5", 51514, 443, "tcp", "ESTABLISHED"},
+		{"10.0.0.5", "198.51.100.7", 8080, 40222, "tcp", "ESTABLISHED"},
+		{"::1", "::1", 5432, 41000, "tcp", "ESTABLISHED"},
+		{"fe80::1c2b:3aff:fe4d:5e6f", "fe80::aa:bbff:fecc:ddee", 22, 50000, "tcp", "TIME_WAIT"},
+		{"2001:db8::1", "2001:db8::53", 40001, 53, "udp", "ESTABLISHED"},
+	}
+	if len(conns) != len(want) {
+		t.Fatalf("expected %d connections, got %d: %+v", len(want), len(conns), conns)
+	}
+	for i, w := range want {
+		c := conns[i]
+		if c.LocalAddr != w.local || c.RemoteAddr != w.remote || c.LocalPort != w.lport || c.RemotePort != w.rport || c.Protocol != w.proto || c.State != w.state {
+			t.Errorf("connection %d: expected %+v, got %+v", i, w, c)
+		}
+	}
+}
+
+func TestFormatConnectionIPv6(t *testing.T) {
+	got := network.FormatConnection(network.ConnectionInfo{
+		LocalAddr:  "2001:db8::1",
+		RemoteAddr: "2606:4700::6810:84e5",
+		LocalPort:  51514,
+		RemotePort: 443,
+		Protocol:   "tcp",
+		State:      "ESTABLISHED",
+	})
+	if want := "tcp [2001:db8::1]:51514 -> [2606:4700::6810:84e5]:443 [ESTABLISHED]"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPortScanGroupsIPv6Prefix(t *testing.T) {
+	eventCh := make(chan core.Event, 100)
+	c := network.NewNetworkCollector("eth0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx, eventCh)
+
+	// The scanner rotates through addresses of its /64.
+	now := time.Now()
+	srcs := []string{"2001:db8:bad:1::10", "2001:db8:bad:1::11", "2001:db8:bad:1:ffff::1"}
+	for i := 1; i <= 24; i++ {
+		key := network.FlowKey{SrcIP: srcs[i%len(srcs)], DstIP: "2001:db8::1", DstPort: i, Protocol: "tcp"}
+		c.InjectFlow(key, &network.FlowStats{Key: key, Packets: 1, Bytes: 80, FirstSeen: now, LastSeen: now})
+	}
+
+	timeout := time.After(20 * time.Second)
+	for {
+		select {
+		case event := <-eventCh:
+			if event.Category != "port_scan" {
+				continue
+			}
+			if event.Payload["src_prefix"] != "2001:db8:bad:1::/64" || event.Payload["src_addresses"] != 3 || event.Payload["unique_ports"] != 24 {
+				t.Errorf("unexpected payload %v", event.Payload)
+			}
+			if event.Payload["src_ip"] != "2001:db8:bad:1::10" {
+				t.Errorf("expected a source address, got %v", event.Payload["src_ip"])
+			}
+			return
+		case <-timeout:
+			t.Fatal("timeout waiting for port scan event")
+		}
+	}
+}
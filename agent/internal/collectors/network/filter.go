@@ -0,0 +1,424 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Filter selects captured packets with a tcpdump (BPF) style expression.
+// It supports the primitives the collector can act on:
+//
+//	tcp, udp, icmp, icmp6, ip, ip6
+//	[src|dst] host ADDR, [src|dst] net CIDR
+//	[src|dst] port N, [src|dst] portrange N-M
+//
+// combined with and/&&, or/||, not/! and parentheses. As in tcpdump,
+// adjacent primitives are joined with and, so "tcp port 443" works.
+// In afpacket mode the filter is also compiled to classic BPF and
+// attached to the socket, so the kernel drops unwanted packets before
+// they are copied to the agent. The agent still matches every decoded
+// packet, which is all a pcap replay gets.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// CompileFilter parses expr. An empty expression yields a nil filter,
+// which matches every packet.
+func CompileFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	p := &filterParser{tokens: tokenizeFilter(expr)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("capture filter %q: %w", expr, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("capture filter %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+func (f *Filter) Match(p Packet) bool {
+	return f == nil || f.root.match(p)
+}
+
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+func tokenizeFilter(expr string) []string {
+	for _, op := range []string{"(", ")", "&&", "||", "!"} {
+		expr = strings.ReplaceAll(expr, op, " "+op+" ")
+	}
+	return strings.Fields(expr)
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() string {
+	t := p.peek()
+	if t != "" {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case "", ")", "or", "||":
+			return left, nil
+		case "and", "&&":
+			p.next()
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	switch t := p.next(); t {
+	case "not", "!":
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	case "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return inner, nil
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		p.pos--
+		return p.parsePrimitive()
+	}
+}
+
+func (p *filterParser) parsePrimitive() (filterNode, error) {
+	t := p.next()
+	switch t {
+	case "tcp":
+		return protoNode{name: t, num: 6}, nil
+	case "udp":
+		return protoNode{name: t, num: 17}, nil
+	case "icmp":
+		return protoNode{name: t, num: 1}, nil
+	case "icmp6":
+		return protoNode{name: t, num: 58}, nil
+	case "ip":
+		return familyNode{}, nil
+	case "ip6":
+		return familyNode{v6: true}, nil
+	}
+
+	dir := ""
+	if t == "src" || t == "dst" {
+		dir, t = t, p.next()
+	}
+	kind := t
+	if kind != "host" && kind != "net" && kind != "port" && kind != "portrange" {
+		if dir == "" {
+			return nil, fmt.Errorf("unknown primitive %q", t)
+		}
+		// "src 10.0.0.1" is short for "src host 10.0.0.1".
+		kind = "host"
+		p.pos--
+	}
+	arg := p.next()
+	if arg == "" {
+		return nil, fmt.Errorf("%s needs an argument", kind)
+	}
+
+	switch kind {
+	case "host":
+		ip := net.ParseIP(arg)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid host %q", arg)
+		}
+		return newHostNode(dir, ip), nil
+	case "net":
+		_, cidr, err := net.ParseCIDR(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid net %q", arg)
+		}
+		return newNetNode(dir, cidr), nil
+	case "port":
+		port, err := strconv.Atoi(arg)
+		if err != nil || port < 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", arg)
+		}
+		return portNode{dir: dir, from: port, to: port}, nil
+	default:
+		lo, hi, ok := strings.Cut(arg, "-")
+		from, err1 := strconv.Atoi(lo)
+		to, err2 := strconv.Atoi(hi)
+		if !ok || err1 != nil || err2 != nil || from < 0 || to > 65535 || from > to {
+			return nil, fmt.Errorf("invalid portrange %q", arg)
+		}
+		return portNode{dir: dir, from: from, to: to}, nil
+	}
+}
+
+// filterNode is one term of a parsed filter. match evaluates it on a
+// decoded packet; compile emits classic BPF that jumps to yes or no on the
+// raw IP packet and must agree with match.
+type filterNode interface {
+	match(Packet) bool
+	compile(c *bpfCompiler, yes, no bpfLabel)
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) match(pkt Packet) bool { return n.left.match(pkt) && n.right.match(pkt) }
+
+func (n andNode) compile(c *bpfCompiler, yes, no bpfLabel) {
+	right := c.label()
+	n.left.compile(c, right, no)
+	c.place(right)
+	n.right.compile(c, yes, no)
+}
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) match(pkt Packet) bool { return n.left.match(pkt) || n.right.match(pkt) }
+
+func (n orNode) compile(c *bpfCompiler, yes, no bpfLabel) {
+	right := c.label()
+	n.left.compile(c, yes, right)
+	c.place(right)
+	n.right.compile(c, yes, no)
+}
+
+type notNode struct{ inner filterNode }
+
+func (n notNode) match(pkt Packet) bool { return !n.inner.match(pkt) }
+
+func (n notNode) compile(c *bpfCompiler, yes, no bpfLabel) {
+	n.inner.compile(c, no, yes)
+}
+
+// protoNode matches the transport protocol, num being its IP protocol
+// number.
+type protoNode struct {
+	name string
+	num  uint8
+}
+
+func (n protoNode) match(pkt Packet) bool { return pkt.Protocol == n.name }
+
+func (n protoNode) compile(c *bpfCompiler, yes, no bpfLabel) {
+	v4 := c.label()
+	c.ifVersion(6, v4)
+	c.emit(bpfLdB, 6)
+	c.jump(bpfJEq, uint32(n.num), yes, no)
+	c.place(v4)
+	c.emit(bpfLdB, 9)
+	c.jump(bpfJEq, uint32(n.num), yes, no)
+}
+
+type familyNode struct{ v6 bool }
+
+func (n familyNode) match(pkt Packet) bool { return (pkt.SrcIP.To4() == nil) == n.v6 }
+
+func (n familyNode) compile(c *bpfCompiler, yes, no bpfLabel) {
+	if n.v6 {
+		yes, no = no, yes
+	}
+	c.emit(bpfLdB, 0)
+	c.emit(bpfAndK, 0xf0)
+	c.jump(bpfJEq, 0x40, yes, no)
+}
+
+// addrNode matches a host or a network. addr and mask hold 4 bytes for
+// IPv4 (IPv4-mapped IPv6 included, as net.IP compares them) and 16 for
+// IPv6.
+type addrNode struct {
+	dir        string
+	test       func(net.IP) bool
+	addr, mask []byte
+}
+
+func newHostNode(dir string, ip net.IP) addrNode {
+	n := addrNode{dir: dir, test: ip.Equal, addr: ip.To4()}
+	if n.addr == nil {
+		n.addr = ip.To16()
+	}
+	n.mask = net.CIDRMask(8*len(n.addr), 8*len(n.addr))
+	return n
+}
+
+func newNetNode(dir string, cidr *net.IPNet) addrNode {
+	n := addrNode{dir: dir, test: cidr.Contains, addr: cidr.IP.To4(), mask: cidr.Mask}
+	if n.addr == nil {
+		n.addr = cidr.IP.To16()
+	} else if len(n.mask) == net.IPv6len {
+		n.mask = n.mask[12:]
+	}
+	return n
+}
+
+func (n addrNode) match(pkt Packet) bool {
+	src := n.dir != "dst" && n.test(pkt.SrcIP)
+	dst := n.dir != "src" && n.test(pkt.DstIP)
+	return src || dst
+}
+
+func (n addrNode) compile(c *bpfCompiler, yes, no bpfLabel) {
+	if n.dir == "" {
+		src, dst := n, n
+		src.dir, dst.dir = "src", "dst"
+		orNode{src, dst}.compile(c, yes, no)
+		return
+	}
+	var off uint32
+	if len(n.addr) == net.IPv4len {
+		c.ifVersion(4, no)
+		off = 12
+	} else {
+		c.ifVersion(6, no)
+		off = 8
+	}
+	if n.dir == "dst" {
+		off += uint32(len(n.addr))
+	}
+	for i := 0; i < len(n.addr); i += 4 {
+		mask := binary.BigEndian.Uint32(n.mask[i:])
+		if mask == 0 {
+			continue
+		}
+		c.emit(bpfLdW, off+uint32(i))
+		if mask != 0xffffffff {
+			c.emit(bpfAndK, mask)
+		}
+		next := c.label()
+		c.jump(bpfJEq, binary.BigEndian.Uint32(n.addr[i:])&mask, next, no)
+		c.place(next)
+	}
+	c.jumpTo(yes)
+}
+
+// portNode matches a tcp or udp port in [from, to]. As in DecodeIP, a
+// packet without a whole transport header, such as a later IPv4 fragment,
+// has both ports zero.
+type portNode struct {
+	dir      string
+	from, to int
+}
+
+func (n portNode) match(pkt Packet) bool {
+	if pkt.Protocol != "tcp" && pkt.Protocol != "udp" {
+		return false
+	}
+	src := n.dir != "dst" && pkt.SrcPort >= n.from && pkt.SrcPort <= n.to
+	dst := n.dir != "src" && pkt.DstPort >= n.from && pkt.DstPort <= n.to
+	return src || dst
+}
+
+func (n portNode) compile(c *bpfCompiler, yes, no bpfLabel) {
+	if n.dir == "" {
+		src, dst := n, n
+		src.dir, dst.dir = "src", "dst"
+		orNode{src, dst}.compile(c, yes, no)
+		return
+	}
+	var off uint32
+	if n.dir == "dst" {
+		off = 2
+	}
+	zero := no
+	if n.from == 0 {
+		zero = yes
+	}
+	inRange := func() {
+		if n.from > 0 {
+			next := c.label()
+			c.jump(bpfJGe, uint32(n.from), next, no)
+			c.place(next)
+		}
+		c.jump(bpfJGt, uint32(n.to), no, yes)
+	}
+
+	// IPv4: the header length is only known at run time, so the port is
+	// loaded relative to X.
+	v4, load4 := c.label(), c.label()
+	c.ifVersion(6, v4)
+	v6tcp, v6udp, load6 := c.label(), c.label(), c.label()
+	c.emit(bpfLdB, 6)
+	c.jump(bpfJEq, 6, v6tcp, v6udp)
+	c.place(v6udp)
+	next := c.label()
+	c.jump(bpfJEq, 17, next, no)
+	c.place(next)
+	c.emit(bpfLdLen, 0)
+	c.jump(bpfJGe, 40+4, load6, zero)
+	c.place(v6tcp)
+	c.emit(bpfLdLen, 0)
+	c.jump(bpfJGe, 40+14, load6, zero)
+	c.place(load6)
+	c.emit(bpfLdH, 40+off)
+	inRange()
+
+	c.place(v4)
+	v4tcp, v4udp := c.label(), c.label()
+	c.emit(bpfLdB, 9)
+	c.jump(bpfJEq, 6, v4tcp, v4udp)
+	c.place(v4udp)
+	next = c.label()
+	c.jump(bpfJEq, 17, next, no)
+	c.place(next)
+	c.header4(4, load4, zero)
+	c.place(v4tcp)
+	c.header4(14, load4, zero)
+	c.place(load4)
+	c.emit(bpfLdXMsh, 0)
+	c.emit(bpfLdHInd, off)
+	inRange()
+}
@@ -0,0 +1,208 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+)
+
+// Flow directions, as seen from this host.
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+// Listener is a listening socket in the inventory.
+type Listener struct {
+	Protocol  string
+	Address   string
+	Port      int
+	Process   *ProcessInfo
+	FirstSeen time.Time
+}
+
+type listenerKey struct {
+	protocol string
+	address  string
+	port     int
+}
+
+// SetExpectedPorts lists the ports services may listen on for every
+// address. A listener bound to all addresses on another port raises an
+// unexpected_listener event. Without a list, the ports listening when
+// the collector starts are the expected ones. Call before Start.
+func (c *NetworkCollector) SetExpectedPorts(ports []int) {
+	c.expectedPorts = make(map[int]bool, len(ports))
+	for _, p := range ports {
+		c.expectedPorts[p] = true
+	}
+}
+
+// Listeners returns the listening sockets found by the last poll.
+func (c *NetworkCollector) Listeners() []Listener {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]Listener, 0, len(c.listeners))
+	for _, l := range c.listeners {
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Port != out[j].Port {
+			return out[i].Port < out[j].Port
+		}
+		if out[i].Protocol != out[j].Protocol {
+			return out[i].Protocol < out[j].Protocol
+		}
+		return out[i].Address < out[j].Address
+	})
+	return out
+}
+
+// updateListeners replaces the inventory with the listening sockets of a
+// poll. The first poll is the baseline and only reports listeners on
+// unexpected ports; later polls report every listener that appears.
+func (c *NetworkCollector) updateListeners(found []ConnectionInfo) {
+	now := time.Now()
+	var events []core.Event
+
+	c.mu.Lock()
+	baseline := c.listeners == nil
+	current := make(map[listenerKey]*Listener, len(found))
+	for _, s := range found {
+		// Unconnected UDP client sockets sit on ephemeral ports.
+		if s.Protocol == "udp" && s.LocalPort >= c.ephemeral[0] && s.LocalPort <= c.ephemeral[1] {
+			continue
+		}
+		key := listenerKey{s.Protocol, s.LocalAddr, s.LocalPort}
+		if _, dup := current[key]; dup {
+			continue
+		}
+		if l, ok := c.listeners[key]; ok {
+			if s.Process != nil {
+				l.Process = s.Process
+			}
+			current[key] = l
+			continue
+		}
+		l := &Listener{Protocol: s.Protocol, Address: s.LocalAddr, Port: s.LocalPort, Process: s.Process, FirstSeen: now}
+		current[key] = l
+		if baseline && len(c.expectedPorts) == 0 {
+			c.baselinePorts[l.Port] = true
+		}
+	}
+	for key, l := range current {
+		if _, known := c.listeners[key]; known {
+			continue
+		}
+		if event, ok := c.listenerEvent(l, baseline); ok {
+			events = append(events, event)
+		}
+	}
+	c.listeners = current
+	c.mu.Unlock()
+
+	for _, event := range events {
+		c.emitEvent(event)
+	}
+}
+
+func (c *NetworkCollector) listenerEvent(l *Listener, baseline bool) (core.Event, bool) {
+	expected := c.expectedPorts[l.Port] || (len(c.expectedPorts) == 0 && c.baselinePorts[l.Port])
+	exposed := isUnspecified(l.Address) && !expected
+
+	category, severity, summary := "new_listener", "low", "New %s listener on %s"
+	switch {
+	case exposed && (!baseline || len(c.expectedPorts) > 0):
+		category, severity, summary = "unexpected_listener", "medium", "Unexpected %s listener on %s"
+	case baseline:
+		return core.Event{}, false
+	}
+
+	name := ""
+	if l.Process != nil {
+		name = " (" + l.Process.Name + ")"
+	}
+	event := core.Event{
+		Time:     time.Now(),
+		Source:   "network",
+		Category: category,
+		Severity: severity,
+		Summary:  fmt.Sprintf(summary, l.Protocol, hostPort(l.Address, l.Port)) + name,
+		Payload: map[string]interface{}{
+			"protocol":     l.Protocol,
+			"bind_address": l.Address,
+			"port":         l.Port,
+		},
+	}
+	addProcess(event.Payload, l.Process)
+	return event, true
+}
+
+// direction classifies a connection as inbound when its local port is
+// one we listen on. The caller holds c.mu.
+func (c *NetworkCollector) direction(protocol, localAddr string, localPort int) string {
+	for _, addr := range []string{localAddr, "0.0.0.0", "::"} {
+		if _, ok := c.listeners[listenerKey{protocol, addr, localPort}]; ok {
+			return DirectionInbound
+		}
+	}
+	return DirectionOutbound
+}
+
+// flowDirection classifies a captured flow, keyed from the side that
+// opened it, by which end is this host. Traffic between other hosts has
+// no direction. The caller holds c.mu.
+func (c *NetworkCollector) flowDirection(key FlowKey) string {
+	switch {
+	case c.localAddrs[key.DstIP] && c.direction(key.Protocol, key.DstIP, key.DstPort) == DirectionInbound:
+		return DirectionInbound
+	case c.localAddrs[key.SrcIP]:
+		return DirectionOutbound
+	case c.localAddrs[key.DstIP]:
+		return DirectionInbound
+	}
+	return ""
+}
+
+func addDirection(payload map[string]interface{}, direction string) {
+	if direction != "" {
+		payload["direction"] = direction
+	}
+}
+
+// refreshLocalAddrs records the host's own addresses.
+func (c *NetworkCollector) refreshLocalAddrs() {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return
+	}
+	local := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			local[normalizeIP(ipnet.IP)] = true
+		}
+	}
+	c.mu.Lock()
+	c.localAddrs = local
+	c.mu.Unlock()
+}
+
+// ephemeralPorts reads the kernel's local port range, defaulting to
+// Linux's 32768-60999.
+func ephemeralPorts(procRoot string) [2]int {
+	ports := [2]int{32768, 60999}
+	data, err := os.ReadFile(filepath.Join(procRoot, "sys", "net", "ipv4", "ip_local_port_range"))
+	if err != nil {
+		return ports
+	}
+	var lo, hi int
+	if n, _ := fmt.Sscan(string(data), &lo, &hi); n == 2 && lo > 0 && lo <= hi {
+		ports = [2]int{lo, hi}
+	}
+	return ports
+}
@@ -0,0 +1,125 @@
+package network_test
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+)
+
+func TestSplitListeners(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixtures were captured on a little-endian host")
+	}
+	conns, listeners := network.SplitListeners(network.ReadProcSockets("testdata/procfs"))
+	if len(conns) != 6 {
+		t.Errorf("expected 6 connections, got %d", len(conns))
+	}
+	if len(listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %+v", listeners)
+	}
+	if l := listeners[0]; l.Protocol != "tcp" || l.LocalAddr != "::" || l.LocalPort != 22 || l.State != "LISTEN" {
+		t.Errorf("unexpected tcp listener %+v", l)
+	}
+	if l := listeners[1]; l.Protocol != "udp" || l.LocalAddr != "::" || l.LocalPort != 5353 {
+		t.Errorf("unexpected udp listener %+v", l)
+	}
+}
+
+const listenerTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5002 1 0000000000000000 100 0 0 10 0
+   2: 0500000A:1F90 076433C6:9D1E 01 00000000:00000000 00:00000000 00000000     0        0 5003 1 0000000000000000 20 4 30 10 -1
+   3: 0500000A:C738 22D8B85D:01BB 01 00000000:00000000 00:00000000 00000000     0        0 5004 1 0000000000000000 20 4 30 10 -1
+`
+
+const listenerTCPAdded = `   4: 0100007F:2328 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5005 1 0000000000000000 100 0 0 10 0
+`
+
+func TestListenerInventory(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("socket tables are only read from procfs on linux")
+	}
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixtures are written for a little-endian host")
+	}
+	root := t.TempDir()
+	tcp := filepath.Join(root, "net", "tcp")
+	if err := os.MkdirAll(filepath.Dir(tcp), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tcp, []byte(listenerTCP), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	eventCh := make(chan core.Event, 100)
+	c := network.NewNetworkCollector("eth0")
+	c.SetProcRoot(root)
+	c.SetExpectedPorts([]int{22})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Start(ctx, eventCh)
+
+	// The baseline poll reports only the wildcard bind on an unexpected port.
+	event := waitForListenerEvent(t, eventCh)
+	if event.Category != "unexpected_listener" || event.Severity != "medium" {
+		t.Errorf("expected an unexpected_listener event, got %s/%s", event.Category, event.Severity)
+	}
+	if event.Payload["bind_address"] != "0.0.0.0" || event.Payload["port"] != 8080 {
+		t.Errorf("unexpected payload %v", event.Payload)
+	}
+
+	listeners := c.Listeners()
+	if len(listeners) != 2 || listeners[0].Port != 22 || listeners[1].Port != 8080 {
+		t.Errorf("unexpected inventory %+v", listeners)
+	}
+
+	flows := c.GetFlows()
+	in := network.FlowKey{SrcIP: "198.51.100.7", DstIP: "10.0.0.5", DstPort: 8080, Protocol: "tcp"}
+	out := network.FlowKey{SrcIP: "10.0.0.5", DstIP: "93.184.216.34", DstPort: 443, Protocol: "tcp"}
+	if f, ok := flows[in]; !ok || f.Direction != network.DirectionInbound {
+		t.Errorf("expected an inbound flow keyed from the client, got %+v", flows)
+	}
+	if f, ok := flows[out]; !ok || f.Direction != network.DirectionOutbound {
+		t.Errorf("expected an outbound flow, got %+v", flows)
+	}
+
+	// A listener that appears later is reported even on loopback.
+	f, err := os.OpenFile(tcp, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(listenerTCPAdded)
+	f.Close()
+
+	event = waitForListenerEvent(t, eventCh)
+	if event.Category != "new_listener" || event.Severity != "low" {
+		t.Errorf("expected a new_listener event, got %s/%s", event.Category, event.Severity)
+	}
+	if event.Payload["bind_address"] != "127.0.0.1" || event.Payload["port"] != 9000 {
+		t.Errorf("unexpected payload %v", event.Payload)
+	}
+}
+
+func waitForListenerEvent(t *testing.T, eventCh <-chan core.Event) core.Event {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event := <-eventCh:
+			if event.Category == "unexpected_listener" || event.Category == "new_listener" {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for listener event")
+			return core.Event{}
+		}
+	}
+}
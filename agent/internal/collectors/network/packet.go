@@ -0,0 +1,198 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// TCP header flags.
+const (
+	TCPFin uint8 = 1 << iota
+	TCPSyn
+	TCPRst
+	TCPPsh
+	TCPAck
+	TCPUrg
+	TCPEce
+	TCPCwr
+)
+
+// Link types, as numbered in pcap files.
+const (
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLinuxSLL = 113
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+)
+
+var errNotIP = errors.New("not an IP packet")
+
+// Packet is the part of a captured packet the collector keeps: addresses,
+// ports, TCP flags and the length of the IP packet on the wire.
+type Packet struct {
+	Time     time.Time
+	SrcIP    net.IP
+	DstIP    net.IP
+	SrcPort  int
+	DstPort  int
+	Protocol string
+	TCPFlags uint8
+	Length   int
+}
+
+// DecodePacket decodes a frame of the given link type. wireLen is the
+// frame's original length, which may exceed len(data) when the capture
+// was truncated.
+func DecodePacket(linkType int, data []byte, wireLen int) (Packet, error) {
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return Packet{}, errors.New("short ethernet header")
+		}
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		offset := 14
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < offset+4 {
+				return Packet{}, errors.New("short vlan header")
+			}
+			etherType = binary.BigEndian.Uint16(data[offset+2 : offset+4])
+			offset += 4
+		}
+		if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+			return Packet{}, errNotIP
+		}
+		return DecodeIP(data[offset:], wireLen-offset)
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return Packet{}, errors.New("short linux cooked header")
+		}
+		etherType := binary.BigEndian.Uint16(data[14:16])
+		if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+			return Packet{}, errNotIP
+		}
+		return DecodeIP(data[16:], wireLen-16)
+	case LinkTypeRaw:
+		return DecodeIP(data, wireLen)
+	}
+	return Packet{}, errors.New("unsupported link type")
+}
+
+// DecodeIP decodes an IPv4 or IPv6 packet and its TCP or UDP header.
+// Packets of other protocols keep their addresses with no ports.
+func DecodeIP(data []byte, wireLen int) (Packet, error) {
+	if len(data) < 1 {
+		return Packet{}, errNotIP
+	}
+	var (
+		p       Packet
+		proto   uint8
+		payload []byte
+	)
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return Packet{}, errors.New("short ipv4 header")
+		}
+		ihl := int(data[0]&0x0f) * 4
+		if ihl < 20 || len(data) < ihl {
+			return Packet{}, errors.New("bad ipv4 header length")
+		}
+		p.SrcIP = net.IP(append([]byte(nil), data[12:16]...))
+		p.DstIP = net.IP(append([]byte(nil), data[16:20]...))
+		p.Length = int(binary.BigEndian.Uint16(data[2:4]))
+		proto = data[9]
+		// Only the first fragment carries the transport header.
+		if binary.BigEndian.Uint16(data[6:8])&0x1fff == 0 {
+			payload = data[ihl:]
+		}
+	case 6:
+		if len(data) < 40 {
+			return Packet{}, errors.New("short ipv6 header")
+		}
+		p.SrcIP = net.IP(append([]byte(nil), data[8:24]...))
+		p.DstIP = net.IP(append([]byte(nil), data[24:40]...))
+		if n := int(binary.BigEndian.Uint16(data[4:6])); n > 0 {
+			p.Length = 40 + n
+		}
+		proto, payload = skipIPv6Extensions(data[6], data[40:])
+	default:
+		return Packet{}, errNotIP
+	}
+	// The header's length excludes ethernet padding. Jumbograms and
+	// TSO-coalesced frames leave it zero, so fall back to the wire length.
+	if p.Length == 0 {
+		p.Length = wireLen
+	}
+
+	switch proto {
+	case 6:
+		p.Protocol = "tcp"
+		if len(payload) >= 14 {
+			p.SrcPort = int(binary.BigEndian.Uint16(payload[0:2]))
+			p.DstPort = int(binary.BigEndian.Uint16(payload[2:4]))
+			p.TCPFlags = payload[13]
+		}
+	case 17:
+		p.Protocol = "udp"
+		if len(payload) >= 4 {
+			p.SrcPort = int(binary.BigEndian.Uint16(payload[0:2]))
+			p.DstPort = int(binary.BigEndian.Uint16(payload[2:4]))
+		}
+	case 1:
+		p.Protocol = "icmp"
+	case 58:
+		p.Protocol = "icmp6"
+	default:
+		p.Protocol = "other"
+	}
+	return p, nil
+}
+
+// skipIPv6Extensions follows the next-header chain to the upper-layer
+// protocol. A fragment that is not the first has no transport header.
+func skipIPv6Extensions(next uint8, data []byte) (uint8, []byte) {
+	for {
+		switch next {
+		case 0, 43, 60: // hop-by-hop, routing, destination options
+			if len(data) < 8 {
+				return next, nil
+			}
+			n := 8 + int(data[1])*8
+			if len(data) < n {
+				return next, nil
+			}
+			next, data = data[0], data[n:]
+		case 44: // fragment
+			if len(data) < 8 {
+				return next, nil
+			}
+			if binary.BigEndian.Uint16(data[2:4])&0xfff8 != 0 {
+				return data[0], nil
+			}
+			next, data = data[0], data[8:]
+		default:
+			return next, data
+		}
+	}
+}
+
+// FormatTCPFlags renders flags as "SYN,ACK".
+func FormatTCPFlags(flags uint8) string {
+	names := []string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR"}
+	var set []string
+	for i, name := range names {
+		if flags&(1<<i) != 0 {
+			set = append(set, name)
+		}
+	}
+	return strings.Join(set, ",")
+}
@@ -0,0 +1,156 @@
+package network_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+)
+
+// replay runs a collector over a pcap file and returns its flows once
+// want of them exist.
+func replay(t *testing.T, file, filter string, want int) map[network.FlowKey]*network.FlowStats {
+	t.Helper()
+	c := network.NewCaptureCollector("", network.CaptureConfig{Mode: network.CapturePcap, File: file, Filter: filter})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Start(ctx, make(chan core.Event, 100)) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.FlowCount() < want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give a wrong count a chance to overshoot.
+	time.Sleep(50 * time.Millisecond)
+	flows := c.GetFlows()
+	if len(flows) != want {
+		t.Fatalf("expected %d flows, got %d: %v", want, len(flows), flows)
+	}
+	return flows
+}
+
+func TestPcapReplayCountsPacketsAndBytes(t *testing.T) {
+	flows := replay(t, "testdata/flows.pcap", "", 4)
+
+	cases := []struct {
+		key     network.FlowKey
+		packets int64
+		bytes   int64
+		flags   string
+	}{
+		{network.FlowKey{SrcIP: "10.0.0.5", DstIP: "93.184.216.34", DstPort: 443, Protocol: "tcp"}, 6, 1740, "FIN,SYN,PSH,ACK"},
+		{network.FlowKey{SrcIP: "10.0.0.5", DstIP: "198.51.100.7", DstPort: 22, Protocol: "tcp"}, 1, 140, "ACK"},
+		{network.FlowKey{SrcIP: "10.0.0.5", DstIP: "10.0.0.1", DstPort: 53, Protocol: "udp"}, 1, 58, ""},
+		{network.FlowKey{SrcIP: "2001:db8::1", DstIP: "2001:db8::53", DstPort: 53, Protocol: "udp"}, 2, 176, ""},
+	}
+	for _, tc := range cases {
+		flow, ok := flows[tc.key]
+		if !ok {
+			t.Errorf("missing flow %+v", tc.key)
+			continue
+		}
+		if flow.Packets != tc.packets || flow.Bytes != tc.bytes {
+			t.Errorf("%+v: expected %d packets and %d bytes, got %d and %d", tc.key, tc.packets, tc.bytes, flow.Packets, flow.Bytes)
+		}
+		if got := network.FormatTCPFlags(flow.TCPFlags); got != tc.flags {
+			t.Errorf("%+v: expected flags %q, got %q", tc.key, tc.flags, got)
+		}
+		if time.Since(flow.LastSeen) > time.Minute {
+			t.Errorf("%+v: replayed flow was not shifted to the present: %s", tc.key, flow.LastSeen)
+		}
+	}
+}
+
+func TestPcapReplayScanIsKeyedByScanner(t *testing.T) {
+	flows := replay(t, "testdata/scan.pcap", "", 30)
+	for key, flow := range flows {
+		if key.SrcIP != "203.0.113.9" || key.DstIP != "10.0.0.5" {
+			t.Fatalf("expected flows from the scanner, got %+v", key)
+		}
+		if flow.Packets != 2 || flow.TCPFlags&network.TCPRst == 0 {
+			t.Errorf("%+v: expected the SYN and its RST, got %d packets with %s", key, flow.Packets, network.FormatTCPFlags(flow.TCPFlags))
+		}
+	}
+}
+
+func TestPcapReplayFilter(t *testing.T) {
+	flows := replay(t, "testdata/flows.pcap", "tcp and not port 22", 1)
+	if _, ok := flows[network.FlowKey{SrcIP: "10.0.0.5", DstIP: "93.184.216.34", DstPort: 443, Protocol: "tcp"}]; !ok {
+		t.Errorf("expected only the https flow, got %v", flows)
+	}
+}
+
+func TestCaptureStartErrors(t *testing.T) {
+	cases := map[string]network.CaptureConfig{
+		"unknown mode": {Mode: "netflow"},
+		"no file":      {Mode: network.CapturePcap},
+		"missing file": {Mode: network.CapturePcap, File: "testdata/missing.pcap"},
+		"bad filter":   {Mode: network.CapturePcap, File: "testdata/flows.pcap", Filter: "port http"},
+	}
+	for name, capture := range cases {
+		c := network.NewCaptureCollector("", capture)
+		if err := c.Start(context.Background(), nil); err == nil {
+			t.Errorf("%s: expected Start to fail", name)
+		}
+	}
+}
+
+func TestPcapReaderRejectsOtherFiles(t *testing.T) {
+	f, err := os.Open("packet_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := network.NewPcapReader(f); err == nil {
+		t.Error("expected an error for a file that is not a pcap")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	pkt := network.Packet{
+		SrcIP:    net.ParseIP("10.0.0.5").To4(),
+		DstIP:    net.ParseIP("93.184.216.34").To4(),
+		SrcPort:  51000,
+		DstPort:  443,
+		Protocol: "tcp",
+	}
+	cases := map[string]bool{
+		"":                   true,
+		"tcp":                true,
+		"udp":                false,
+		"ip and not ip6":     true,
+		"port 443":           true,
+		"src port 443":       false,
+		"tcp dst port 443":   true,
+		"host 93.184.216.34": true,
+		"src 10.0.0.5":       true,
+		"dst net 10.0.0.0/8": false,
+		"net 10.0.0.0/8 && portrange 50000-52000": true,
+		"udp or (tcp and port 80)":                false,
+		"! (udp || icmp)":                         true,
+	}
+	for expr, want := range cases {
+		f, err := network.CompileFilter(expr)
+		if err != nil {
+			t.Errorf("%q: %v", expr, err)
+			continue
+		}
+		if got := f.Match(pkt); got != want {
+			t.Errorf("%q: expected %v, got %v", expr, want, got)
+		}
+	}
+
+	for _, bad := range []string{"port", "host example", "tcp and", "(tcp", "portrange 9-1", "frobnicate"} {
+		if _, err := network.CompileFilter(bad); err == nil {
+			t.Errorf("%q: expected a compile error", bad)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const maxPcapRecord = 256 << 10
+
+// PcapReader reads packets from a classic libpcap file, in either byte
+// order and with microsecond or nanosecond timestamps. pcapng is not
+// supported.
+type PcapReader struct {
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	linkType int
+	hdr      [16]byte
+}
+
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	br := bufio.NewReader(r)
+	var hdr [24]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, fmt.Errorf("read pcap header: %w", err)
+	}
+
+	p := &PcapReader{r: br}
+	switch magic := binary.LittleEndian.Uint32(hdr[0:4]); magic {
+	case 0xa1b2c3d4:
+		p.order = binary.LittleEndian
+	case 0xd4c3b2a1:
+		p.order = binary.BigEndian
+	case 0xa1b23c4d:
+		p.order, p.nanos = binary.LittleEndian, true
+	case 0x4d3cb2a1:
+		p.order, p.nanos = binary.BigEndian, true
+	case 0x0a0d0d0a:
+		return nil, errors.New("pcapng files are not supported; convert with editcap -F pcap")
+	default:
+		return nil, fmt.Errorf("not a pcap file (magic %#x)", magic)
+	}
+	p.linkType = int(p.order.Uint32(hdr[20:24]) & 0x0fffffff)
+	return p, nil
+}
+
+func (p *PcapReader) LinkType() int {
+	return p.linkType
+}
+
+// ReadPacket returns the next record's timestamp, captured bytes and
+// original length. It returns io.EOF at the end of the file.
+func (p *PcapReader) ReadPacket() (time.Time, []byte, int, error) {
+	if _, err := io.ReadFull(p.r, p.hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errors.New("truncated pcap record header")
+		}
+		return time.Time{}, nil, 0, err
+	}
+	sec := int64(p.order.Uint32(p.hdr[0:4]))
+	frac := int64(p.order.Uint32(p.hdr[4:8]))
+	capLen := p.order.Uint32(p.hdr[8:12])
+	wireLen := int(p.order.Uint32(p.hdr[12:16]))
+	if capLen > maxPcapRecord {
+		return time.Time{}, nil, 0, fmt.Errorf("pcap record of %d bytes is too large", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return time.Time{}, nil, 0, errors.New("truncated pcap record")
+	}
+	if !p.nanos {
+		frac *= int64(time.Microsecond)
+	}
+	return time.Unix(sec, frac), data, wireLen, nil
+}
+
+// pcapSource replays a pcap file, shifting its timestamps so the first
+// packet appears to arrive when the replay starts.
+type pcapSource struct {
+	f      *os.File
+	r      *PcapReader
+	offset time.Duration
+}
+
+func openPcap(path string) (packetSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open capture file: %w", err)
+	}
+	r, err := NewPcapReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &pcapSource{f: f, r: r}, nil
+}
+
+func (s *pcapSource) Next() (Packet, bool, error) {
+	ts, data, wireLen, err := s.r.ReadPacket()
+	if err != nil {
+		return Packet{}, false, err
+	}
+	pkt, err := DecodePacket(s.r.LinkType(), data, wireLen)
+	if err != nil {
+		return Packet{}, false, nil
+	}
+	if s.offset == 0 {
+		s.offset = time.Since(ts)
+	}
+	pkt.Time = ts.Add(s.offset)
+	return pkt, true, nil
+}
+
+func (s *pcapSource) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,187 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProcessInfo identifies the process holding a socket.
+type ProcessInfo struct {
+	PID     int
+	Name    string
+	Exe     string
+	Cmdline string
+	User    string
+}
+
+// ProcessResolver maps socket inodes to the processes holding them by
+// reading <root>/<pid>/fd. The fd tables are only walked again when a poll
+// turns up an inode not seen before, and each process is read once.
+type ProcessResolver struct {
+	root string
+
+	mu     sync.Mutex
+	owners map[uint64]int // inode to pid; 0 when no process holds it
+	procs  map[int]*ProcessInfo
+	users  map[string]string
+}
+
+func NewProcessResolver(procRoot string) *ProcessResolver {
+	return &ProcessResolver{
+		root:   procRoot,
+		owners: make(map[uint64]int),
+		procs:  make(map[int]*ProcessInfo),
+		users:  make(map[string]string),
+	}
+}
+
+// Attribute sets Process on each connection whose socket a process holds,
+// and clears it on the rest. The cache is trimmed to the inodes in conns,
+// so pass every connection of a poll at once.
+func (r *ProcessResolver) Attribute(conns []ConnectionInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	live := make(map[uint64]bool, len(conns))
+	rescan := false
+	for _, c := range conns {
+		if c.Inode == 0 {
+			continue
+		}
+		live[c.Inode] = true
+		if _, ok := r.owners[c.Inode]; !ok {
+			rescan = true
+		}
+	}
+	if rescan {
+		r.scan(live)
+	}
+	for inode := range r.owners {
+		if !live[inode] {
+			delete(r.owners, inode)
+		}
+	}
+
+	for i := range conns {
+		conns[i].Process = nil
+		if pid := r.owners[conns[i].Inode]; pid != 0 {
+			conns[i].Process = r.process(pid)
+		}
+	}
+}
+
+// scan rebuilds the inode map from every process's fd table. Processes we
+// may not inspect are skipped.
+func (r *ProcessResolver) scan(live map[uint64]bool) {
+	entries, err := os.ReadDir(r.root)
+	if err != nil {
+		return
+	}
+	owners := make(map[uint64]int, len(live))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join(r.root, e.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(target[len("socket:["):], "]"), 10, 64)
+			if err == nil && live[inode] {
+				owners[inode] = pid
+			}
+		}
+	}
+	for inode := range live {
+		if _, ok := owners[inode]; !ok {
+			owners[inode] = 0
+		}
+	}
+	r.owners = owners
+
+	// Forget processes that hold none of our sockets, so a reused pid is
+	// read afresh.
+	held := make(map[int]bool, len(owners))
+	for _, pid := range owners {
+		held[pid] = true
+	}
+	for pid := range r.procs {
+		if !held[pid] {
+			delete(r.procs, pid)
+		}
+	}
+}
+
+func (r *ProcessResolver) process(pid int) *ProcessInfo {
+	if p, ok := r.procs[pid]; ok {
+		return p
+	}
+	dir := filepath.Join(r.root, strconv.Itoa(pid))
+	p := &ProcessInfo{PID: pid}
+	if comm, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		p.Name = strings.TrimSpace(string(comm))
+	}
+	p.Exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		p.Cmdline = string(bytes.TrimSpace(bytes.ReplaceAll(bytes.TrimRight(cmdline, "\x00"), []byte{0}, []byte{' '})))
+	}
+	if uid := processUID(filepath.Join(dir, "status")); uid != "" {
+		p.User = r.userName(uid)
+	}
+	r.procs[pid] = p
+	return p
+}
+
+// processUID returns the real uid from a /proc/<pid>/status file.
+func processUID(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 1 && fields[0] == "Uid:" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// userName resolves uid to a login name, falling back to the number.
+func (r *ProcessResolver) userName(uid string) string {
+	if name, ok := r.users[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	r.users[uid] = name
+	return name
+}
+
+// addProcess adds the process owning a connection to an event payload.
+func addProcess(payload map[string]interface{}, p *ProcessInfo) {
+	if p == nil {
+		return
+	}
+	payload["pid"] = p.PID
+	payload["process_name"] = p.Name
+	payload["exe"] = p.Exe
+	payload["cmdline"] = p.Cmdline
+	payload["user"] = p.User
+}
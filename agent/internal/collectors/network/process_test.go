@@ -0,0 +1,98 @@
+package network_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+)
+
+const fakeTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0500000A:C738 22D8B85D:01BB 01 00000000:00000000 00:00000000 00000000  4242        0 31337 1 0000000000000000 20 4 30 10 -1
+   1: 0500000A:9C40 0964C6C6:115C 01 00000000:00000000 00:00000000 00000000     0        0 40404 1 0000000000000000 20 4 30 10 -1
+   2: 0500000A:A000 0A00000A:0016 06 00000000:00000000 03:00000DB2 00000000     0        0 0 3 0000000000000000
+`
+
+// fakeProc lays out a procfs with the tcp table above and one process,
+// pid 812, holding the first socket.
+func fakeProc(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(target, name string) {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, path); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+
+	write("net/tcp", fakeTCP)
+	write("812/comm", "curl\n")
+	write("812/cmdline", "curl\x00-s\x00https://example.com\x00")
+	write("812/status", "Name:\tcurl\nUid:\t4242\t4242\t4242\t4242\nGid:\t4242\t4242\t4242\t4242\n")
+	link("/usr/bin/curl", "812/exe")
+	link("/dev/null", "812/fd/0")
+	link("socket:[31337]", "812/fd/3")
+	write("self/comm", "not a pid\n")
+	return root
+}
+
+func TestReadProcNetAttributesProcesses(t *testing.T) {
+	root := fakeProc(t)
+	conns := network.ReadProcNet(root)
+	if len(conns) != 3 {
+		t.Fatalf("expected 3 connections, got %d", len(conns))
+	}
+	network.NewProcessResolver(root).Attribute(conns)
+
+	c := conns[0]
+	if c.RemoteAddr != "93.184.216.34" || c.RemotePort != 443 || c.Inode != 31337 {
+		t.Fatalf("unexpected connection %+v", c)
+	}
+	if c.Process == nil {
+		t.Fatal("expected the connection to be attributed")
+	}
+	want := network.ProcessInfo{PID: 812, Name: "curl", Exe: "/usr/bin/curl", Cmdline: "curl -s https://example.com", User: "4242"}
+	if *c.Process != want {
+		t.Errorf("expected %+v, got %+v", want, *c.Process)
+	}
+	if conns[1].Process != nil || conns[2].Process != nil {
+		t.Error("sockets no process holds should not be attributed")
+	}
+}
+
+func TestProcessResolverCaches(t *testing.T) {
+	root := fakeProc(t)
+	r := network.NewProcessResolver(root)
+	conns := network.ReadProcNet(root)
+	r.Attribute(conns)
+
+	// With every inode already known the fd tables are not read again.
+	if err := os.RemoveAll(filepath.Join(root, "812", "fd")); err != nil {
+		t.Fatal(err)
+	}
+	conns = network.ReadProcNet(root)
+	r.Attribute(conns)
+	if conns[0].Process == nil || conns[0].Process.PID != 812 {
+		t.Errorf("expected the cached owner, got %+v", conns[0].Process)
+	}
+
+	// A new inode triggers a rescan, which notices the socket is gone.
+	conns = append(conns, network.ConnectionInfo{Inode: 55555})
+	r.Attribute(conns)
+	if conns[0].Process != nil {
+		t.Errorf("expected no owner after the rescan, got %+v", conns[0].Process)
+	}
+}
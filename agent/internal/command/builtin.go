@@ -0,0 +1,143 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/cloud"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/logs"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+)
+
+const defaultFlowLimit = 500
+
+// Restarter restarts a collector by name, as supervisor.Supervisor does.
+type Restarter interface {
+	Restart(name string) error
+}
+
+var errNotEnabled = errors.New("collector is not enabled")
+
+// RegisterBuiltins adds the standard commands: status, rescan, flows,
+// tail_log and restart_collector.
+func RegisterBuiltins(s *Server, agent *core.Agent, sup Restarter) {
+	s.Handle("status", func(ctx context.Context, _ json.RawMessage) (interface{}, error) {
+		return agent.Status(), nil
+	})
+
+	s.Handle("rescan", func(ctx context.Context, _ json.RawMessage) (interface{}, error) {
+		c, ok := agent.Collector("cloud").(*cloud.CloudCollector)
+		if !ok {
+			return nil, fmt.Errorf("cloud %w", errNotEnabled)
+		}
+		findings := c.ScanNow(ctx)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"scanned_at": c.LastScanTime(),
+			"findings":   findings,
+		}, nil
+	})
+
+	s.Handle("flows", func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+		var args struct {
+			Limit int `json:"limit"`
+		}
+		if err := decode(raw, &args); err != nil {
+			return nil, err
+		}
+		if args.Limit <= 0 {
+			args.Limit = defaultFlowLimit
+		}
+		c, ok := agent.Collector("network").(*network.NetworkCollector)
+		if !ok {
+			return nil, fmt.Errorf("network %w", errNotEnabled)
+		}
+		return flowList(c.GetFlows(), args.Limit), nil
+	})
+
+	s.Handle("tail_log", func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+		var args struct {
+			Source string `json:"source"`
+			Lines  int    `json:"lines"`
+		}
+		if err := decode(raw, &args); err != nil {
+			return nil, err
+		}
+		if args.Source == "" {
+			return nil, errors.New("source is required")
+		}
+		if args.Lines <= 0 {
+			args.Lines = 100
+		}
+		c, ok := agent.Collector("logs").(*logs.LogCollector)
+		if !ok {
+			return nil, fmt.Errorf("logs %w", errNotEnabled)
+		}
+		lines, err := c.Tail(args.Source, args.Lines)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"source": args.Source, "lines": lines}, nil
+	})
+
+	s.Handle("restart_collector", func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+		var args struct {
+			Name string `json:"name"`
+		}
+		if err := decode(raw, &args); err != nil {
+			return nil, err
+		}
+		if args.Name == "" {
+			return nil, errors.New("name is required")
+		}
+		if err := sup.Restart(args.Name); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"name": args.Name, "restarted_at": time.Now()}, nil
+	})
+}
+
+func decode(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid args: %w", err)
+	}
+	return nil
+}
+
+type flow struct {
+	SrcIP     string    `json:"src_ip"`
+	DstIP     string    `json:"dst_ip"`
+	DstPort   int       `json:"dst_port"`
+	Protocol  string    `json:"protocol"`
+	Packets   int64     `json:"packets"`
+	Bytes     int64     `json:"bytes"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// flowList returns the limit flows that moved the most bytes.
+func flowList(flows map[network.FlowKey]*network.FlowStats, limit int) map[string]interface{} {
+	list := make([]flow, 0, len(flows))
+	for k, s := range flows {
+		list = append(list, flow{
+			SrcIP: k.SrcIP, DstIP: k.DstIP, DstPort: k.DstPort, Protocol: k.Protocol,
+			Packets: s.Packets, Bytes: s.Bytes, FirstSeen: s.FirstSeen, LastSeen: s.LastSeen,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Bytes > list[j].Bytes })
+	total := len(list)
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return map[string]interface{}{"total": total, "flows": list}
+}
@@ -0,0 +1,158 @@
+// Package command runs on-demand actions the API sends to the agent over
+// NATS request/reply, such as an immediate cloud scan or a log tail.
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	DefaultTimeout = 30 * time.Second
+	MaxTimeout     = 2 * time.Minute
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+// Request is a command as the API sends it.
+type Request struct {
+	ID        string          `json:"id"`
+	Command   string          `json:"command"`
+	Args      json.RawMessage `json:"args,omitempty"`
+	TimeoutMS int64           `json:"timeout_ms"`
+	// RequestedBy names who sent the command, for the agent's own audit
+	// records.
+	RequestedBy string `json:"requested_by,omitempty"`
+}
+
+// Result is the agent's reply to a Request.
+type Result struct {
+	ID         string      `json:"id"`
+	Command    string      `json:"command"`
+	Status     string      `json:"status"`
+	Output     interface{} `json:"output,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+}
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusTimedOut  = "timed_out"
+)
+
+// Handler runs one command. args is the raw JSON the API passed, which may
+// be empty.
+type Handler func(ctx context.Context, args json.RawMessage) (interface{}, error)
+
+type requesterKey struct{}
+
+// RequestedBy returns who sent the command a handler is running.
+func RequestedBy(ctx context.Context) string {
+	by, _ := ctx.Value(requesterKey{}).(string)
+	return by
+}
+
+func Subject(orgID, agentID string) string {
+	return fmt.Sprintf("agents.%s.%s.cmd", orgID, agentID)
+}
+
+type Server struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewServer() *Server {
+	return &Server{handlers: make(map[string]Handler)}
+}
+
+func (s *Server) Handle(name string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = h
+}
+
+// Execute runs req within its timeout. A handler still running when the
+// timeout passes is abandoned; it sees its context cancelled.
+func (s *Server) Execute(ctx context.Context, req Request) Result {
+	res := Result{ID: req.ID, Command: req.Command, StartedAt: time.Now()}
+
+	s.mu.RLock()
+	h, ok := s.handlers[req.Command]
+	s.mu.RUnlock()
+	if !ok {
+		res.Status, res.Error = StatusFailed, fmt.Sprintf("%v: %s", ErrUnknownCommand, req.Command)
+		return finish(res)
+	}
+
+	timeout := time.Duration(req.TimeoutMS) * time.Millisecond
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if timeout > MaxTimeout {
+		timeout = MaxTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, requesterKey{}, req.RequestedBy), timeout)
+	defer cancel()
+
+	type outcome struct {
+		output interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		output, err := h(ctx, req.Args)
+		done <- outcome{output, err}
+	}()
+
+	select {
+	case o := <-done:
+		res.Output = o.output
+		res.Status = StatusSucceeded
+		if o.err != nil {
+			res.Status, res.Error = StatusFailed, o.err.Error()
+		}
+	case <-ctx.Done():
+		res.Status, res.Error = StatusTimedOut, fmt.Sprintf("no result within %s", timeout)
+	}
+	return finish(res)
+}
+
+func finish(res Result) Result {
+	res.FinishedAt = time.Now()
+	log.Printf("command %s (%s): %s %s", res.Command, res.ID, res.Status, res.Error)
+	return res
+}
+
+// Subscribe serves requests on subject until ctx is done. Each command runs
+// in its own goroutine so a slow scan does not hold up a status request.
+func (s *Server) Subscribe(ctx context.Context, nc *nats.Conn, subject string) (*nats.Subscription, error) {
+	return nc.Subscribe(subject, func(msg *nats.Msg) {
+		go func() {
+			var req Request
+			res := Result{Status: StatusFailed, StartedAt: time.Now()}
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				res.Error = fmt.Sprintf("invalid request: %v", err)
+				res = finish(res)
+			} else {
+				res = s.Execute(ctx, req)
+			}
+			data, err := json.Marshal(res)
+			if err != nil {
+				data, _ = json.Marshal(Result{ID: req.ID, Command: req.Command, Status: StatusFailed,
+					Error: fmt.Sprintf("encode result: %v", err), StartedAt: res.StartedAt, FinishedAt: res.FinishedAt})
+			}
+			if err := msg.Respond(data); err != nil {
+				log.Printf("failed to reply to command %s: %v", req.ID, err)
+			}
+		}()
+	})
+}
@@ -0,0 +1,128 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/command"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/response"
+)
+
+func TestExecuteReportsOutcome(t *testing.T) {
+	s := command.NewServer()
+	s.Handle("echo", func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		return string(args), nil
+	})
+	s.Handle("fail", func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	s.Handle("hang", func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return nil, ctx.Err()
+	})
+
+	res := s.Execute(context.Background(), command.Request{ID: "1", Command: "echo", Args: json.RawMessage(`{"x":1}`)})
+	if res.Status != command.StatusSucceeded || res.Output != `{"x":1}` || res.ID != "1" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if res := s.Execute(context.Background(), command.Request{Command: "fail"}); res.Status != command.StatusFailed || res.Error != "boom" {
+		t.Errorf("expected the handler error, got %+v", res)
+	}
+	if res := s.Execute(context.Background(), command.Request{Command: "rm -rf"}); res.Status != command.StatusFailed {
+		t.Errorf("expected an unknown command to fail, got %+v", res)
+	}
+
+	start := time.Now()
+	res = s.Execute(context.Background(), command.Request{Command: "hang", TimeoutMS: 20})
+	if res.Status != command.StatusTimedOut || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected a prompt timeout, got %+v after %s", res, time.Since(start))
+	}
+}
+
+type restarts []string
+
+func (r *restarts) Restart(name string) error {
+	*r = append(*r, name)
+	return nil
+}
+
+func TestBuiltins(t *testing.T) {
+	agent := core.New("agent-1", "org-1", "http://localhost:8080", nil, 30)
+	net := network.NewNetworkCollector("eth0")
+	net.InjectFlow(network.FlowKey{SrcIP: "10.0.0.1", DstIP: "1.1.1.1", DstPort: 443, Protocol: "tcp"}, &network.FlowStats{Bytes: 10})
+	net.InjectFlow(network.FlowKey{SrcIP: "10.0.0.1", DstIP: "8.8.8.8", DstPort: 53, Protocol: "udp"}, &network.FlowStats{Bytes: 900})
+	agent.Register(net)
+
+	var r restarts
+	s := command.NewServer()
+	command.RegisterBuiltins(s, agent, &r)
+	run := func(name, args string) command.Result {
+		res := s.Execute(context.Background(), command.Request{Command: name, Args: json.RawMessage(args)})
+		data, _ := json.Marshal(res)
+		var out command.Result
+		json.Unmarshal(data, &out)
+		return out
+	}
+
+	res := run("flows", `{"limit":1}`)
+	out, _ := res.Output.(map[string]interface{})
+	flows, _ := out["flows"].([]interface{})
+	if res.Status != command.StatusSucceeded || out["total"] != float64(2) || len(flows) != 1 {
+		t.Fatalf("unexpected flows result %+v", res)
+	}
+	if top := flows[0].(map[string]interface{}); top["dst_ip"] != "8.8.8.8" {
+		t.Errorf("expected the busiest flow first, got %v", top)
+	}
+
+	if res := run("status", ""); res.Status != command.StatusSucceeded {
+		t.Errorf("status failed: %+v", res)
+	}
+	if res := run("rescan", ""); res.Status != command.StatusFailed || res.Error != "cloud collector is not enabled" {
+		t.Errorf("expected rescan to fail without a cloud collector, got %+v", res)
+	}
+	if res := run("tail_log", `{"source":"/var/log/auth.log"}`); res.Status != command.StatusFailed {
+		t.Errorf("expected tail_log to fail without a log collector, got %+v", res)
+	}
+	if res := run("restart_collector", `{"name":"network"}`); res.Status != command.StatusSucceeded || len(r) != 1 || r[0] != "network" {
+		t.Errorf("expected the network collector to restart, got %+v, %v", res, r)
+	}
+	if res := run("restart_collector", `{}`); res.Status != command.StatusFailed {
+		t.Errorf("expected restart_collector to require a name, got %+v", res)
+	}
+}
+
+func TestResponseCommands(t *testing.T) {
+	s := command.NewServer()
+	command.RegisterResponse(s, nil)
+	if res := s.Execute(context.Background(), command.Request{Command: "block_ip", Args: json.RawMessage(`{"ip":"203.0.113.9"}`)}); res.Status != command.StatusFailed {
+		t.Errorf("expected block_ip to fail when response is disabled, got %+v", res)
+	}
+
+	r, err := response.New(response.Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = command.NewServer()
+	command.RegisterResponse(s, r)
+	res := s.Execute(context.Background(), command.Request{
+		Command:     "block_ip",
+		Args:        json.RawMessage(`{"ip":"203.0.113.9","ttl_seconds":60,"reason":"brute_force_attack"}`),
+		RequestedBy: "alice@example.com",
+	})
+	b, ok := res.Output.(response.Block)
+	if res.Status != command.StatusSucceeded || !ok || b.RequestedBy != "alice@example.com" || b.ExpiresAt.Sub(b.CreatedAt) != time.Minute {
+		t.Errorf("unexpected block result %+v", res)
+	}
+	if res := s.Execute(context.Background(), command.Request{Command: "block_ip", Args: json.RawMessage(`{"ip":"127.0.0.1"}`)}); res.Status != command.StatusFailed {
+		t.Errorf("expected loopback to be refused, got %+v", res)
+	}
+	if res := s.Execute(context.Background(), command.Request{Command: "unblock_ip", Args: json.RawMessage(`{"ip":"203.0.113.9"}`)}); res.Status != command.StatusSucceeded || len(r.Blocks()) != 0 {
+		t.Errorf("expected the block to be lifted, got %+v", res)
+	}
+}
@@ -0,0 +1,56 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/response"
+)
+
+// RegisterResponse adds block_ip, unblock_ip and list_blocks. Without a
+// responder the commands report that response actions are disabled, so the
+// API can tell a disabled agent from an old one.
+func RegisterResponse(s *Server, r *response.Responder) {
+	disabled := errors.New("response actions are disabled on this agent")
+
+	s.Handle("block_ip", func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+		if r == nil {
+			return nil, disabled
+		}
+		var args struct {
+			IP         string `json:"ip"`
+			TTLSeconds int64  `json:"ttl_seconds"`
+			Reason     string `json:"reason"`
+		}
+		if err := decode(raw, &args); err != nil {
+			return nil, err
+		}
+		return r.Block(ctx, args.IP, time.Duration(args.TTLSeconds)*time.Second, args.Reason, RequestedBy(ctx))
+	})
+
+	s.Handle("unblock_ip", func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+		if r == nil {
+			return nil, disabled
+		}
+		var args struct {
+			IP     string `json:"ip"`
+			Reason string `json:"reason"`
+		}
+		if err := decode(raw, &args); err != nil {
+			return nil, err
+		}
+		if err := r.Unblock(ctx, args.IP, args.Reason, RequestedBy(ctx)); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"ip": args.IP, "unblocked_at": time.Now()}, nil
+	})
+
+	s.Handle("list_blocks", func(ctx context.Context, _ json.RawMessage) (interface{}, error) {
+		if r == nil {
+			return nil, disabled
+		}
+		return map[string]interface{}{"blocks": r.Blocks()}, nil
+	})
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -15,9 +19,35 @@ type Config struct {
 	EnableLogs        bool
 	EnableNetwork     bool
 	EnableCloud       bool
+	EnableMetrics     bool
 	CloudProvider     string
 	LogSources        []string
 	NetworkInterface  string
+	SpoolDir          string
+	SpoolMaxBytes     int64
+	SpoolMaxAge       time.Duration
+	MetricsInterval   time.Duration
+	ProcRoot          string
+	EnrollmentToken   string
+	CredentialsFile   string
+	AgentName         string
+	// Response actions change the host firewall, so they are only enabled
+	// locally and cannot be switched on from the API.
+	ResponseEnabled    bool
+	ResponseDryRun     bool
+	ResponseBackend    string
+	ResponseAllowlist  []string
+	ResponseDefaultTTL time.Duration
+	ResponseMaxTTL     time.Duration
+	ResponseAuditLog   string
+
+	// CaptureMode is poll, afpacket or pcap; see network.CaptureConfig.
+	CaptureMode   string
+	CaptureFile   string
+	CaptureFilter string
+	// ExpectedPorts are the ports services may listen on for all
+	// addresses; see network.NetworkCollector.SetExpectedPorts.
+	ExpectedPorts []int
 }
 
 func Load() *Config {
@@ -31,9 +61,31 @@ func Load() *Config {
 		EnableLogs:        getEnv("ENABLE_LOGS", "true") == "true",
 		EnableNetwork:     getEnv("ENABLE_NETWORK", "true") == "true",
 		EnableCloud:       getEnv("ENABLE_CLOUD", "false") == "true",
+		EnableMetrics:     getEnv("ENABLE_METRICS", "true") == "true",
 		CloudProvider:     getEnv("CLOUD_PROVIDER", ""),
 		LogSources:        parseList(getEnv("LOG_SOURCES", "")),
 		NetworkInterface:  getEnv("NETWORK_INTERFACE", ""),
+		SpoolDir:          getEnv("SPOOL_DIR", "/var/lib/shield-agent/spool"),
+		SpoolMaxBytes:     getEnvInt64("SPOOL_MAX_BYTES", 256<<20),
+		SpoolMaxAge:       getEnvDuration("SPOOL_MAX_AGE", 72*time.Hour),
+		MetricsInterval:   getEnvDuration("METRICS_INTERVAL", 30*time.Second),
+		ProcRoot:          getEnv("PROC_ROOT", "/proc"),
+		EnrollmentToken:   getEnv("ENROLLMENT_TOKEN", ""),
+		CredentialsFile:   getEnv("CREDENTIALS_FILE", "/var/lib/shield-agent/credentials.json"),
+		AgentName:         getEnv("AGENT_NAME", ""),
+
+		ResponseEnabled:    getEnv("RESPONSE_ENABLED", "false") == "true",
+		ResponseDryRun:     getEnv("RESPONSE_DRY_RUN", "false") == "true",
+		ResponseBackend:    getEnv("RESPONSE_BACKEND", "auto"),
+		ResponseAllowlist:  parseList(getEnv("RESPONSE_ALLOWLIST", "")),
+		ResponseDefaultTTL: getEnvDuration("RESPONSE_DEFAULT_TTL", time.Hour),
+		ResponseMaxTTL:     getEnvDuration("RESPONSE_MAX_TTL", 24*time.Hour),
+		ResponseAuditLog:   getEnv("RESPONSE_AUDIT_LOG", "/var/lib/shield-agent/response-audit.log"),
+
+		CaptureMode:   getEnv("CAPTURE_MODE", "poll"),
+		CaptureFile:   getEnv("CAPTURE_FILE", ""),
+		CaptureFilter: getEnv("CAPTURE_FILTER", ""),
+		ExpectedPorts: parsePorts(getEnv("LISTEN_EXPECTED_PORTS", "")),
 	}
 }
 
@@ -52,9 +104,134 @@ func parseList(val string) []string {
 	return result
 }
 
+// parsePorts parses a comma-separated port list, skipping invalid entries.
+func parsePorts(val string) []int {
+	var ports []int
+	for _, p := range parseList(val) {
+		if n, err := strconv.Atoi(p); err == nil && n > 0 && n <= 65535 {
+			ports = append(ports, n)
+		}
+	}
+	return ports
+}
+
 func getEnv(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
 	}
 	return fallback
 }
+
+func getEnvInt64(key string, fallback int64) int64 {
+	if val := os.Getenv(key); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// WithOverrides returns a copy of c with the settings pushed from the API
+// applied. Keys that are absent keep their local value; unknown keys are
+// ignored so that newer servers can push settings older agents lack.
+func (c *Config) WithOverrides(remote map[string]interface{}) (*Config, error) {
+	next := *c
+	next.LogSources = append([]string(nil), c.LogSources...)
+
+	for key, val := range remote {
+		var err error
+		switch key {
+		case "enable_logs":
+			next.EnableLogs, err = asBool(val)
+		case "enable_network":
+			next.EnableNetwork, err = asBool(val)
+		case "enable_cloud":
+			next.EnableCloud, err = asBool(val)
+		case "enable_metrics":
+			next.EnableMetrics, err = asBool(val)
+		case "log_sources":
+			next.LogSources, err = asStrings(val)
+		case "network_interface":
+			next.NetworkInterface, err = asString(val)
+		case "cloud_provider":
+			next.CloudProvider, err = asString(val)
+		case "metrics_interval":
+			next.MetricsInterval, err = asDuration(val)
+		case "heartbeat_interval":
+			var d time.Duration
+			d, err = asDuration(val)
+			next.HeartbeatInterval = int(d / time.Second)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	if next.EnableCloud && next.CloudProvider == "" {
+		return nil, errors.New("cloud_provider is required when enable_cloud is set")
+	}
+	return &next, nil
+}
+
+func asBool(v interface{}) (bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, got %T", v)
+	}
+	return b, nil
+}
+
+func asString(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string, got %T", v)
+	}
+	return s, nil
+}
+
+func asStrings(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return parseList(v), nil
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a list of strings, got %T", item)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("expected a list of strings, got %T", v)
+}
+
+// asDuration accepts Go duration strings ("30s") or a number of seconds.
+func asDuration(v interface{}) (time.Duration, error) {
+	var d time.Duration
+	switch v := v.(type) {
+	case string:
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return 0, err
+		}
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	default:
+		return 0, fmt.Errorf("expected a duration, got %T", v)
+	}
+	if d < time.Second {
+		return 0, errors.New("must be at least 1s")
+	}
+	return d, nil
+}
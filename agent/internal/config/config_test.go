@@ -0,0 +1,53 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/config"
+)
+
+func TestWithOverrides(t *testing.T) {
+	base := &config.Config{
+		EnableLogs:        true,
+		LogSources:        []string{"/var/log/syslog"},
+		NetworkInterface:  "eth0",
+		HeartbeatInterval: 30,
+		MetricsInterval:   30 * time.Second,
+	}
+
+	next, err := base.WithOverrides(map[string]interface{}{
+		"log_sources":        []interface{}{"/var/log/auth.log", "/var/log/nginx/access.log"},
+		"enable_network":     false,
+		"metrics_interval":   "1m",
+		"heartbeat_interval": float64(15),
+		"future_setting":     "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.LogSources) != 2 || next.EnableNetwork || next.MetricsInterval != time.Minute || next.HeartbeatInterval != 15 {
+		t.Errorf("unexpected config %+v", next)
+	}
+	if next.NetworkInterface != "eth0" || !next.EnableLogs {
+		t.Errorf("expected unset keys to keep local values, got %+v", next)
+	}
+	if base.LogSources[0] != "/var/log/syslog" || base.MetricsInterval != 30*time.Second {
+		t.Errorf("expected the base config to be left alone, got %+v", base)
+	}
+}
+
+func TestWithOverridesRejectsBadValues(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"wrong type":     {"enable_logs": "yes"},
+		"bad list":       {"log_sources": []interface{}{1}},
+		"bad duration":   {"metrics_interval": "soon"},
+		"tiny interval":  {"heartbeat_interval": "10ms"},
+		"cloud provider": {"enable_cloud": true},
+	}
+	for name, overrides := range cases {
+		if _, err := (&config.Config{}).WithOverrides(overrides); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -3,57 +3,230 @@ package core
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/spool"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
+// Version is the agent build, set with -ldflags "-X .../core.Version=...".
+var Version = "dev"
+
 type Agent struct {
-	ID         string
-	OrgID      string
-	APIURL     string
-	natsConn   *nats.Conn
-	collectors []Collector
-	eventCh    chan Event
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
-	heartbeat  time.Duration
+	ID        string
+	OrgID     string
+	APIURL    string
+	natsConn  *nats.Conn
+	js        jetstream.JetStream
+	eventCh   chan Event
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	spool     *spool.Spool
+	spill     atomic.Bool
+	apiToken  string
+	onVersion func(int64)
+	started   time.Time
+
+	mu             sync.Mutex
+	ctx            context.Context
+	collectors     []Collector
+	running        map[string]*runningCollector
+	stats          map[string]*collectorStats
+	heartbeat      time.Duration
+	heartbeatReset chan struct{}
+	configVersion  int64
+	configError    string
+}
+
+type runningCollector struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// collectorStats counts what one collector produced. Events are emitted
+// once they reach the agent's queue, and dropped when they could be
+// neither queued, published nor spooled.
+type collectorStats struct {
+	events  atomic.Int64
+	dropped atomic.Int64
+
+	mu        sync.Mutex
+	running   bool
+	startedAt time.Time
+	lastError string
+}
+
+type HeartbeatStatus struct {
+	Version         string            `json:"version"`
+	OS              string            `json:"os"`
+	Arch            string            `json:"arch"`
+	Hostname        string            `json:"hostname"`
+	UptimeSeconds   int64             `json:"uptime_seconds"`
+	Collectors      []CollectorStatus `json:"collectors"`
+	EventQueueDepth int               `json:"event_queue_depth"`
+	EventQueueCap   int               `json:"event_queue_cap"`
+	Resources       ResourceUsage     `json:"resources"`
+	SpoolDepth      int64             `json:"spool_depth"`
+	SpoolBytes      int64             `json:"spool_bytes"`
+	SpoolDropped    int64             `json:"spool_dropped"`
+	ConfigVersion   int64             `json:"config_version"`
+	ConfigError     string            `json:"config_error,omitempty"`
+}
+
+type CollectorStatus struct {
+	Name      string     `json:"name"`
+	Running   bool       `json:"running"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Events    int64      `json:"events"`
+	Dropped   int64      `json:"dropped"`
+}
+
+type ResourceUsage struct {
+	Goroutines int    `json:"goroutines"`
+	HeapBytes  uint64 `json:"heap_bytes"`
+	SysBytes   uint64 `json:"sys_bytes"`
+	// MaxRSSBytes and CPUSeconds are zero where the OS does not report them.
+	MaxRSSBytes int64   `json:"max_rss_bytes"`
+	CPUSeconds  float64 `json:"cpu_seconds"`
 }
 
 func New(id, orgID, apiURL string, nc *nats.Conn, heartbeatSec int) *Agent {
-	return &Agent{
-		ID:        id,
-		OrgID:     orgID,
-		APIURL:    apiURL,
-		natsConn:  nc,
-		eventCh:   make(chan Event, 1000),
-		heartbeat: time.Duration(heartbeatSec) * time.Second,
+	a := &Agent{
+		ID:             id,
+		OrgID:          orgID,
+		APIURL:         apiURL,
+		natsConn:       nc,
+		eventCh:        make(chan Event, 1000),
+		started:        time.Now(),
+		heartbeat:      time.Duration(heartbeatSec) * time.Second,
+		heartbeatReset: make(chan struct{}, 1),
+		running:        make(map[string]*runningCollector),
+		stats:          make(map[string]*collectorStats),
+	}
+	if nc != nil {
+		js, err := jetstream.New(nc)
+		if err != nil {
+			log.Printf("jetstream unavailable: %v", err)
+		}
+		a.js = js
 	}
+	return a
 }
 
+// Register adds a collector. Once the agent has started, the collector is
+// started right away.
 func (a *Agent) Register(c Collector) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.collectors = append(a.collectors, c)
+	a.stats[c.Name()] = &collectorStats{}
+	if a.ctx != nil && a.ctx.Err() == nil {
+		a.startCollector(c)
+	}
+}
+
+// Unregister stops the named collector and waits for it to exit. It
+// reports whether such a collector was registered.
+func (a *Agent) Unregister(name string) bool {
+	a.mu.Lock()
+	var c Collector
+	for i, rc := range a.collectors {
+		if rc.Name() == name {
+			c = rc
+			a.collectors = append(a.collectors[:i], a.collectors[i+1:]...)
+			break
+		}
+	}
+	run := a.running[name]
+	delete(a.running, name)
+	delete(a.stats, name)
+	a.mu.Unlock()
+
+	if c == nil {
+		return false
+	}
+	if run != nil {
+		if err := c.Stop(); err != nil {
+			log.Printf("error stopping collector %s: %v", name, err)
+		}
+		run.cancel()
+		<-run.done
+		log.Printf("stopped collector: %s", name)
+	}
+	return true
+}
+
+func (a *Agent) UseSpool(s *spool.Spool) {
+	a.spool = s
+}
+
+// SetAPIToken sets the agent credential sent with heartbeats. Call before
+// Start.
+func (a *Agent) SetAPIToken(token string) {
+	a.apiToken = token
+}
+
+// OnConfigVersion registers fn to be called with the config version the API
+// expects, as returned by each heartbeat. Call before Start.
+func (a *Agent) OnConfigVersion(fn func(version int64)) {
+	a.onVersion = fn
+}
+
+// SetConfigStatus records the last applied remote config version, and the
+// error if a later version could not be applied, for the next heartbeat.
+func (a *Agent) SetConfigStatus(version int64, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.configVersion = version
+	a.configError = ""
+	if err != nil {
+		a.configError = err.Error()
+	}
+}
+
+func (a *Agent) SetHeartbeatInterval(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	a.mu.Lock()
+	changed := a.heartbeat != d
+	a.heartbeat = d
+	a.mu.Unlock()
+	if changed {
+		select {
+		case a.heartbeatReset <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (a *Agent) heartbeatInterval() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.heartbeat
 }
 
 func (a *Agent) Start(ctx context.Context) error {
 	ctx, a.cancel = context.WithCancel(ctx)
 
+	a.mu.Lock()
+	a.ctx = ctx
 	for _, c := range a.collectors {
-		collector := c
-		a.wg.Add(1)
-		go func() {
-			defer a.wg.Done()
-			log.Printf("starting collector: %s", collector.Name())
-			if err := collector.Start(ctx, a.eventCh); err != nil {
-				log.Printf("collector %s error: %v", collector.Name(), err)
-			}
-		}()
+		a.startCollector(c)
 	}
+	a.mu.Unlock()
 
 	a.wg.Add(1)
 	go func() {
@@ -70,11 +243,106 @@ func (a *Agent) Start(ctx context.Context) error {
 	return nil
 }
 
+// startCollector runs c until its own context is cancelled. Its events
+// pass through a pump that tags and counts them on the way to eventCh.
+// Callers hold a.mu.
+func (a *Agent) startCollector(c Collector) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	run := &runningCollector{cancel: cancel, done: make(chan struct{})}
+	a.running[c.Name()] = run
+	st := a.stats[c.Name()]
+	in := make(chan Event, 64)
+
+	st.mu.Lock()
+	st.running = true
+	st.startedAt = time.Now()
+	st.lastError = ""
+	st.mu.Unlock()
+
+	a.wg.Add(2)
+	go func() {
+		defer a.wg.Done()
+		a.pump(ctx, c.Name(), st, in)
+	}()
+	go func() {
+		defer a.wg.Done()
+		defer close(run.done)
+		log.Printf("starting collector: %s", c.Name())
+		err := c.Start(ctx, in)
+		if err != nil {
+			log.Printf("collector %s error: %v", c.Name(), err)
+		}
+		st.mu.Lock()
+		st.running = false
+		if err != nil {
+			st.lastError = err.Error()
+		}
+		st.mu.Unlock()
+	}()
+}
+
+func (a *Agent) pump(ctx context.Context, name string, st *collectorStats, in <-chan Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-in:
+			event.collector = name
+			select {
+			case a.eventCh <- event:
+				st.events.Add(1)
+				continue
+			default:
+			}
+			if a.spool == nil {
+				st.dropped.Add(1)
+				continue
+			}
+			// The forwarder is falling behind. Have it spool what is queued
+			// rather than publish it, which empties the queue at disk speed,
+			// and wait for room. Only the forwarder writes the spool, so
+			// events are spooled, and replayed, in the order they were
+			// queued.
+			a.spill.Store(true)
+			select {
+			case a.eventCh <- event:
+				st.events.Add(1)
+			case <-ctx.Done():
+				st.dropped.Add(1)
+				return
+			}
+		}
+	}
+}
+
+// encode stamps the agent's identity on event and marshals it.
+func (a *Agent) encode(event Event) ([]byte, error) {
+	event.OrgID = a.OrgID
+	event.AgentID = a.ID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	return json.Marshal(event)
+}
+
+// dropped counts an event lost after it was queued against its collector.
+func (a *Agent) dropped(event Event) {
+	a.mu.Lock()
+	st := a.stats[event.collector]
+	a.mu.Unlock()
+	if st != nil {
+		st.dropped.Add(1)
+	}
+}
+
 func (a *Agent) Stop() error {
 	if a.cancel != nil {
 		a.cancel()
 	}
-	for _, c := range a.collectors {
+	a.mu.Lock()
+	collectors := append([]Collector(nil), a.collectors...)
+	a.mu.Unlock()
+	for _, c := range collectors {
 		if err := c.Stop(); err != nil {
 			log.Printf("error stopping collector %s: %v", c.Name(), err)
 		}
@@ -84,49 +352,202 @@ func (a *Agent) Stop() error {
 }
 
 func (a *Agent) CollectorCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	return len(a.collectors)
 }
 
+// Collector returns the registered collector with the given name, or nil.
+func (a *Agent) Collector(name string) Collector {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range a.collectors {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
 func (a *Agent) EventChannel() chan Event {
 	return a.eventCh
 }
 
 func (a *Agent) eventForwarder(ctx context.Context) {
 	subject := fmt.Sprintf("events.%s.%s", a.OrgID, a.ID)
+
+	replay := time.NewTicker(time.Second)
+	defer replay.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
+			a.spoolPending()
 			return
+		case <-replay.C:
+			a.replaySpool(subject)
 		case event := <-a.eventCh:
-			event.OrgID = a.OrgID
-			event.AgentID = a.ID
-			if event.Time.IsZero() {
-				event.Time = time.Now()
-			}
-
-			data, err := json.Marshal(event)
+			data, err := a.encode(event)
 			if err != nil {
 				log.Printf("failed to marshal event: %v", err)
 				continue
 			}
 
-			if a.natsConn != nil {
-				if err := a.natsConn.Publish(subject, data); err != nil {
-					log.Printf("failed to publish event: %v", err)
-				}
+			if !a.forward(subject, data) {
+				a.dropped(event)
 			}
 		}
 	}
 }
 
+// forward publishes or spools data and reports whether it was kept.
+func (a *Agent) forward(subject string, data []byte) bool {
+	if a.spool == nil {
+		if !a.connected() {
+			return false
+		}
+		if err := a.publish(subject, data); err != nil {
+			log.Printf("failed to publish event: %v", err)
+			return false
+		}
+		return true
+	}
+
+	// Once anything is spooled, new events queue behind it so that
+	// replay preserves the original order.
+	spill := a.spill.Swap(false)
+	if !spill && a.spool.Depth() == 0 && a.connected() {
+		err := a.publish(subject, data)
+		if err == nil {
+			return true
+		}
+		log.Printf("failed to publish event, spooling: %v", err)
+	}
+
+	if err := a.spool.Append(data); err != nil {
+		log.Printf("failed to spool event: %v", err)
+		return false
+	}
+	return true
+}
+
+func (a *Agent) spoolPending() {
+	if a.spool == nil {
+		return
+	}
+	for {
+		select {
+		case event := <-a.eventCh:
+			if data, err := a.encode(event); err == nil {
+				a.spool.Append(data)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (a *Agent) replaySpool(subject string) {
+	if a.spool == nil || a.spool.Depth() == 0 || !a.connected() {
+		return
+	}
+
+	n, err := a.spool.Drain(func(data []byte) error {
+		if !a.connected() {
+			return nats.ErrConnectionClosed
+		}
+		return a.publish(subject, data)
+	})
+	if n > 0 {
+		log.Printf("replayed %d spooled events (%d remaining)", n, a.spool.Depth())
+	}
+	if err != nil {
+		log.Printf("spool replay interrupted: %v", err)
+	}
+}
+
+func (a *Agent) publish(subject string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The stream deduplicates on message ID, so an event that is replayed
+	// from the spool after a lost ack is only stored once.
+	sum := sha256.Sum256(data)
+	_, err := a.js.Publish(ctx, subject, data, jetstream.WithMsgID(hex.EncodeToString(sum[:16])))
+	return err
+}
+
+func (a *Agent) connected() bool {
+	return a.js != nil && a.natsConn.IsConnected()
+}
+
+func (a *Agent) Status() HeartbeatStatus {
+	status := HeartbeatStatus{
+		Version:         Version,
+		OS:              runtime.GOOS,
+		Arch:            runtime.GOARCH,
+		UptimeSeconds:   int64(time.Since(a.started).Seconds()),
+		Collectors:      []CollectorStatus{},
+		EventQueueDepth: len(a.eventCh),
+		EventQueueCap:   cap(a.eventCh),
+		Resources:       resourceUsage(),
+	}
+	status.Hostname, _ = os.Hostname()
+
+	a.mu.Lock()
+	status.ConfigVersion = a.configVersion
+	status.ConfigError = a.configError
+	for _, c := range a.collectors {
+		status.Collectors = append(status.Collectors, a.stats[c.Name()].status(c.Name()))
+	}
+	a.mu.Unlock()
+	if a.spool != nil {
+		status.SpoolDepth = a.spool.Depth()
+		status.SpoolBytes = a.spool.Size()
+		status.SpoolDropped = a.spool.Dropped()
+	}
+	return status
+}
+
+func (st *collectorStats) status(name string) CollectorStatus {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	cs := CollectorStatus{
+		Name:      name,
+		Running:   st.running,
+		LastError: st.lastError,
+		Events:    st.events.Load(),
+		Dropped:   st.dropped.Load(),
+	}
+	if !st.startedAt.IsZero() {
+		started := st.startedAt
+		cs.StartedAt = &started
+	}
+	return cs
+}
+
+func resourceUsage() ResourceUsage {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	usage := ResourceUsage{
+		Goroutines: runtime.NumGoroutine(),
+		HeapBytes:  mem.HeapAlloc,
+		SysBytes:   mem.Sys,
+	}
+	usage.MaxRSSBytes, usage.CPUSeconds = processUsage()
+	return usage
+}
+
 func (a *Agent) heartbeatLoop(ctx context.Context) {
-	ticker := time.NewTicker(a.heartbeat)
+	ticker := time.NewTicker(a.heartbeatInterval())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-a.heartbeatReset:
+			ticker.Reset(a.heartbeatInterval())
 		case <-ticker.C:
 			a.sendHeartbeat()
 		}
@@ -134,13 +555,22 @@ func (a *Agent) heartbeatLoop(ctx context.Context) {
 }
 
 func (a *Agent) sendHeartbeat() {
+	body, err := json.Marshal(a.Status())
+	if err != nil {
+		log.Printf("heartbeat marshal error: %v", err)
+		return
+	}
+
 	url := fmt.Sprintf("%s/api/v1/agents/%s/heartbeat", a.APIURL, a.ID)
-	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewBuffer([]byte("{}")))
+	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewBuffer(body))
 	if err != nil {
 		log.Printf("heartbeat request error: %v", err)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if a.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiToken)
+	}
 
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Do(req)
@@ -148,5 +578,16 @@ func (a *Agent) sendHeartbeat() {
 		log.Printf("heartbeat failed: %v", err)
 		return
 	}
-	resp.Body.Close()
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		log.Printf("heartbeat rejected (%s); is the agent enrolled and not revoked?", resp.Status)
+		return
+	}
+
+	var reply struct {
+		ConfigVersion int64 `json:"config_version"`
+	}
+	if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&reply) == nil && a.onVersion != nil {
+		a.onVersion(reply.ConfigVersion)
+	}
 }
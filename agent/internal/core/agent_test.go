@@ -2,10 +2,17 @@ package core_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/spool"
 )
 
 type mockCollector struct {
@@ -85,3 +92,216 @@ func TestAgentForwardsEvents(t *testing.T) {
 
 	agent.Stop()
 }
+
+func TestAgentSpoolsEventsWhileDisconnected(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer sp.Close()
+
+	agent := core.New("test-agent", "test-org", "http://localhost:8080", nil, 30)
+	agent.UseSpool(sp)
+	agent.Register(&mockCollector{name: "spool-test"})
+
+	agent.Start(context.Background())
+	time.Sleep(200 * time.Millisecond)
+	agent.Stop()
+
+	if got := agent.Status().SpoolDepth; got != 1 {
+		t.Errorf("expected 1 spooled event, got %d", got)
+	}
+
+	var event core.Event
+	sp.Drain(func(data []byte) error {
+		return json.Unmarshal(data, &event)
+	})
+	if event.OrgID != "test-org" || event.AgentID != "test-agent" {
+		t.Errorf("expected spooled event to carry agent identity, got %+v", event)
+	}
+}
+
+type burstCollector struct {
+	n int
+}
+
+func (b *burstCollector) Name() string { return "burst" }
+func (b *burstCollector) Start(ctx context.Context, eventCh chan<- core.Event) error {
+	for i := 0; i < b.n; i++ {
+		eventCh <- core.Event{Source: "burst", Category: "test", Severity: "low", Summary: strconv.Itoa(i)}
+	}
+	<-ctx.Done()
+	return nil
+}
+func (b *burstCollector) Stop() error { return nil }
+
+func TestAgentSpoolsEventsWhenQueueIsFull(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer sp.Close()
+
+	agent := core.New("test-agent", "test-org", "http://localhost:8080", nil, 30)
+	agent.UseSpool(sp)
+	agent.Register(&burstCollector{n: 5000})
+
+	agent.Start(context.Background())
+	deadline := time.Now().Add(5 * time.Second)
+	for sp.Depth() < 5000 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := agent.Status()
+	agent.Stop()
+
+	if got := sp.Depth(); got != 5000 {
+		t.Errorf("expected all 5000 events spooled, got %d", got)
+	}
+	if c := status.Collectors[0]; c.Dropped != 0 || c.Events != 5000 {
+		t.Errorf("expected no drops on a full queue, got %+v", c)
+	}
+
+	next := 0
+	sp.Drain(func(data []byte) error {
+		var event core.Event
+		json.Unmarshal(data, &event)
+		if event.Summary != strconv.Itoa(next) {
+			return fmt.Errorf("expected event %d, replayed %q", next, event.Summary)
+		}
+		next++
+		return nil
+	})
+	if next != 5000 {
+		t.Errorf("expected the spool to replay all 5000 events in order, stopped at %d", next)
+	}
+}
+
+func TestHeartbeatReportsConfigVersion(t *testing.T) {
+	type beat struct {
+		auth string
+		body core.HeartbeatStatus
+	}
+	beats := make(chan beat, 10)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b beat
+		b.auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&b.body)
+		select {
+		case beats <- b:
+		default:
+		}
+		w.Write([]byte(`{"config_version":7}`))
+	}))
+	defer api.Close()
+
+	agent := core.New("test-agent", "test-org", api.URL, nil, 30)
+	agent.SetAPIToken("agt_secret")
+	agent.SetHeartbeatInterval(20 * time.Millisecond)
+	agent.SetConfigStatus(6, errors.New("version 7: bad"))
+	offered := make(chan int64, 10)
+	agent.OnConfigVersion(func(v int64) { offered <- v })
+
+	agent.Start(context.Background())
+	defer agent.Stop()
+
+	select {
+	case b := <-beats:
+		if b.auth != "Bearer agt_secret" || b.body.ConfigVersion != 6 || b.body.ConfigError != "version 7: bad" {
+			t.Errorf("unexpected heartbeat %+v", b)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no heartbeat sent")
+	}
+	select {
+	case v := <-offered:
+		if v != 7 {
+			t.Errorf("expected version 7 from the reply, got %d", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("config version from the reply was not passed on")
+	}
+}
+
+type signalCollector struct {
+	started chan struct{}
+	exited  chan struct{}
+}
+
+func (c *signalCollector) Name() string { return "late" }
+func (c *signalCollector) Start(ctx context.Context, eventCh chan<- core.Event) error {
+	close(c.started)
+	<-ctx.Done()
+	close(c.exited)
+	return nil
+}
+func (c *signalCollector) Stop() error { return nil }
+
+func TestRegisterAndUnregisterWhileRunning(t *testing.T) {
+	agent := core.New("test-agent", "test-org", "http://localhost:8080", nil, 30)
+	agent.Start(context.Background())
+	defer agent.Stop()
+
+	c := &signalCollector{started: make(chan struct{}), exited: make(chan struct{})}
+	agent.Register(c)
+	if agent.CollectorCount() != 1 {
+		t.Fatalf("expected 1 collector, got %d", agent.CollectorCount())
+	}
+	select {
+	case <-c.started:
+	case <-time.After(time.Second):
+		t.Fatal("collector registered after start was not started")
+	}
+
+	if !agent.Unregister("late") || agent.CollectorCount() != 0 {
+		t.Error("expected the collector to be removed")
+	}
+	select {
+	case <-c.exited:
+	default:
+		t.Error("expected Unregister to wait for the collector to exit")
+	}
+	if agent.Unregister("late") {
+		t.Error("expected a second unregister to report false")
+	}
+}
+
+type failingCollector struct{}
+
+func (failingCollector) Name() string { return "broken" }
+func (failingCollector) Start(ctx context.Context, eventCh chan<- core.Event) error {
+	return errors.New("permission denied")
+}
+func (failingCollector) Stop() error { return nil }
+
+func TestStatusReportsCollectorHealth(t *testing.T) {
+	agent := core.New("test-agent", "test-org", "http://localhost:8080", nil, 30)
+	agent.Register(&mockCollector{name: "mock"})
+	agent.Register(failingCollector{})
+	agent.Start(context.Background())
+	defer agent.Stop()
+
+	// Without NATS or a spool the mock's event is emitted, then dropped.
+	deadline := time.Now().Add(2 * time.Second)
+	var status core.HeartbeatStatus
+	for time.Now().Before(deadline) {
+		status = agent.Status()
+		if len(status.Collectors) == 2 && status.Collectors[0].Dropped == 1 && !status.Collectors[1].Running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status.Version == "" || status.OS == "" || status.EventQueueCap != 1000 || status.Resources.Goroutines == 0 {
+		t.Errorf("expected build, host and queue details, got %+v", status)
+	}
+	if len(status.Collectors) != 2 {
+		t.Fatalf("expected 2 collectors, got %+v", status.Collectors)
+	}
+	mock, broken := status.Collectors[0], status.Collectors[1]
+	if mock.Name != "mock" || !mock.Running || mock.StartedAt == nil || mock.Events != 1 || mock.Dropped != 1 {
+		t.Errorf("unexpected mock collector status %+v", mock)
+	}
+	if broken.Running || broken.LastError != "permission denied" {
+		t.Errorf("expected the failed collector to report its error, got %+v", broken)
+	}
+}
@@ -15,6 +15,9 @@ type Event struct {
 	RiskScore float32                `json:"risk_score"`
 	Summary   string                 `json:"summary"`
 	Payload   map[string]interface{} `json:"payload"`
+
+	// collector is the name of the collector that emitted the event.
+	collector string
 }
 
 type Collector interface {
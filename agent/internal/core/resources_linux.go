@@ -0,0 +1,16 @@
+package core
+
+import "syscall"
+
+// processUsage returns the peak resident set size and the CPU time used by
+// the agent so far.
+func processUsage() (maxRSS int64, cpuSeconds float64) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, 0
+	}
+	cpu := ru.Utime.Sec + ru.Stime.Sec
+	micros := ru.Utime.Usec + ru.Stime.Usec
+	// Linux reports ru_maxrss in kilobytes.
+	return ru.Maxrss * 1024, float64(cpu) + float64(micros)/1e6
+}
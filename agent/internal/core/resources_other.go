@@ -0,0 +1,7 @@
+//go:build !linux
+
+package core
+
+func processUsage() (maxRSS int64, cpuSeconds float64) {
+	return 0, 0
+}
@@ -0,0 +1,211 @@
+// Package enroll exchanges a one-time enrollment token for the agent's own
+// credentials and keeps them on disk.
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// Credentials identify an enrolled agent. NKeySeed is generated locally and
+// only its public key is sent to the API.
+type Credentials struct {
+	AgentID          string     `json:"agent_id"`
+	OrgID            string     `json:"org_id"`
+	Token            string     `json:"token"`
+	NKeySeed         string     `json:"nkey_seed"`
+	NATSJWT          string     `json:"nats_jwt,omitempty"`
+	NATSJWTExpiresAt *time.Time `json:"nats_jwt_expires_at,omitempty"`
+
+	mu sync.Mutex
+}
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+// InboxPrefix matches the per-agent inbox the API's NATS JWT allows.
+func InboxPrefix(agentID string) string {
+	return "_INBOX_" + agentID
+}
+
+// Load reads credentials saved by Save. It returns an error wrapping
+// os.ErrNotExist when the agent has not enrolled yet.
+func Load(path string) (*Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Credentials
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if c.AgentID == "" || c.Token == "" {
+		return nil, fmt.Errorf("%s is missing the agent id or token", path)
+	}
+	return &c, nil
+}
+
+// Save writes the credentials readable by the agent's user only.
+func (c *Credentials) Save(path string) error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Enroll generates the agent's NATS user key and exchanges token for an
+// agent id and credential.
+func Enroll(ctx context.Context, apiURL, token, name, hostname string) (*Credentials, error) {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, err
+	}
+	seed, _ := kp.Seed()
+	pub, _ := kp.PublicKey()
+
+	body, _ := json.Marshal(map[string]string{
+		"token":    token,
+		"name":     name,
+		"hostname": hostname,
+		"nkey":     pub,
+	})
+	c := &Credentials{NKeySeed: string(seed)}
+	if err := call(ctx, http.MethodPost, apiURL+"/api/v1/enroll", "", body, http.StatusCreated, c); err != nil {
+		return nil, fmt.Errorf("enroll: %w", err)
+	}
+	if c.AgentID == "" || c.Token == "" {
+		return nil, errors.New("enroll: response is missing the agent id or token")
+	}
+	return c, nil
+}
+
+// NATSOptions authenticates with the agent's NATS JWT when the API issued
+// one, and returns nil otherwise so the caller can fall back to the shared
+// token. The JWT is read on every (re)connect, so refreshes apply without
+// restarting. Replies come back on the agent's own inbox prefix, the only
+// one its JWT may subscribe to.
+func (c *Credentials) NATSOptions() []nats.Option {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.NATSJWT == "" {
+		return nil
+	}
+	return []nats.Option{nats.CustomInboxPrefix(InboxPrefix(c.AgentID)), nats.UserJWT(
+		func() (string, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.NATSJWT, nil
+		},
+		func(nonce []byte) ([]byte, error) {
+			kp, err := nkeys.FromSeed([]byte(c.NKeySeed))
+			if err != nil {
+				return nil, err
+			}
+			defer kp.Wipe()
+			return kp.Sign(nonce)
+		},
+	)}
+}
+
+// KeepFresh renews the NATS JWT when half of its remaining lifetime has
+// passed and saves it to path, until ctx is done. It returns at once when
+// the agent has no NATS JWT.
+func (c *Credentials) KeepFresh(ctx context.Context, apiURL, path string) {
+	for {
+		c.mu.Lock()
+		expires := c.NATSJWTExpiresAt
+		c.mu.Unlock()
+		if expires == nil {
+			return
+		}
+
+		wait := time.Until(*expires) / 2
+		if wait < time.Minute {
+			wait = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if err := c.Refresh(ctx, apiURL); err != nil {
+			log.Printf("failed to refresh NATS credentials: %v", err)
+			continue
+		}
+		if err := c.Save(path); err != nil {
+			log.Printf("failed to save refreshed credentials: %v", err)
+		}
+	}
+}
+
+// Refresh asks the API for a new NATS JWT.
+func (c *Credentials) Refresh(ctx context.Context, apiURL string) error {
+	var resp struct {
+		NATSJWT          string     `json:"nats_jwt"`
+		NATSJWTExpiresAt *time.Time `json:"nats_jwt_expires_at"`
+	}
+	url := fmt.Sprintf("%s/api/v1/agents/%s/nats-credentials", apiURL, c.AgentID)
+	if err := call(ctx, http.MethodPost, url, c.Token, nil, http.StatusOK, &resp); err != nil {
+		return err
+	}
+	if resp.NATSJWT == "" {
+		return errors.New("response is missing the NATS JWT")
+	}
+
+	c.mu.Lock()
+	c.NATSJWT, c.NATSJWTExpiresAt = resp.NATSJWT, resp.NATSJWTExpiresAt
+	c.mu.Unlock()
+	return nil
+}
+
+func call(ctx context.Context, method, url, token string, body []byte, want int, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != want {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,133 @@
+package enroll_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/enroll"
+	"github.com/nats-io/nkeys"
+)
+
+// fakeAPI implements the enrollment endpoints of the API.
+func fakeAPI(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	var nkey string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/enroll", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["token"] != "enr_good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid or expired enrollment token"}`))
+			return
+		}
+		nkey = req["nkey"]
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"agent_id":            "agent-1",
+			"org_id":              "org-1",
+			"token":               "agt_secret",
+			"nats_jwt":            "jwt-1",
+			"nats_jwt_expires_at": time.Now().Add(time.Hour),
+		})
+	})
+	mux.HandleFunc("POST /api/v1/agents/agent-1/nats-credentials", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer agt_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"nats_jwt":            "jwt-2",
+			"nats_jwt_expires_at": time.Now().Add(2 * time.Hour),
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &nkey
+}
+
+func TestEnrollSavesCredentials(t *testing.T) {
+	api, nkey := fakeAPI(t)
+	creds, err := enroll.Enroll(context.Background(), api.URL, "enr_good", "web-01", "web-01.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AgentID != "agent-1" || creds.OrgID != "org-1" || creds.Token != "agt_secret" || creds.NATSJWT != "jwt-1" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+
+	kp, err := nkeys.FromSeed([]byte(creds.NKeySeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, _ := kp.PublicKey(); pub != *nkey {
+		t.Errorf("expected the public key of the local seed to be sent, got %q", *nkey)
+	}
+
+	path := filepath.Join(t.TempDir(), "state", "credentials.json")
+	if err := creds.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected 0600 credentials file, got %v", info.Mode().Perm())
+	}
+	loaded, err := enroll.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.AgentID != creds.AgentID || loaded.NKeySeed != creds.NKeySeed || loaded.NATSJWTExpiresAt == nil {
+		t.Errorf("unexpected loaded credentials %+v", loaded)
+	}
+}
+
+func TestEnrollRejectedToken(t *testing.T) {
+	api, _ := fakeAPI(t)
+	_, err := enroll.Enroll(context.Background(), api.URL, "enr_used", "web-01", "web-01")
+	if err == nil || !strings.Contains(err.Error(), "invalid or expired enrollment token") {
+		t.Errorf("expected the API error to be reported, got %v", err)
+	}
+}
+
+func TestLoadMissingCredentials(t *testing.T) {
+	_, err := enroll.Load(filepath.Join(t.TempDir(), "credentials.json"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestRefreshNATSJWT(t *testing.T) {
+	api, _ := fakeAPI(t)
+	creds, err := enroll.Enroll(context.Background(), api.URL, "enr_good", "web-01", "web-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds.NATSOptions()) != 2 {
+		t.Fatal("expected the NATS JWT and inbox prefix options")
+	}
+	if err := creds.Refresh(context.Background(), api.URL); err != nil {
+		t.Fatal(err)
+	}
+	if creds.NATSJWT != "jwt-2" || time.Until(*creds.NATSJWTExpiresAt) < time.Hour {
+		t.Errorf("expected refreshed JWT, got %q %v", creds.NATSJWT, creds.NATSJWTExpiresAt)
+	}
+
+	creds.Token = "agt_revoked"
+	if err := creds.Refresh(context.Background(), api.URL); err == nil {
+		t.Error("expected refresh with a rejected credential to fail")
+	}
+}
+
+func TestNATSOptionsWithoutJWT(t *testing.T) {
+	if opts := (&enroll.Credentials{AgentID: "a", Token: "t"}).NATSOptions(); opts != nil {
+		t.Errorf("expected no NATS options without a JWT, got %d", len(opts))
+	}
+}
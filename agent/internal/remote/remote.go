@@ -0,0 +1,145 @@
+// Package remote keeps the agent on the config an admin set through the
+// API. Changes arrive on the agent's NATS config subject; the version in
+// each heartbeat reply catches pushes the agent missed.
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Update is a config document and its version, as the API sends it.
+type Update struct {
+	Version int64                  `json:"version"`
+	Config  map[string]interface{} `json:"config"`
+}
+
+func Subject(agentID string) string {
+	return fmt.Sprintf("agents.%s.config", agentID)
+}
+
+// Syncer applies config updates in version order. apply gets the whole
+// remote document each time; report is told the version now running and
+// the error, if any, that kept a newer one from applying.
+type Syncer struct {
+	apiURL  string
+	agentID string
+	token   string
+	apply   func(map[string]interface{}) error
+	report  func(int64, error)
+	client  *http.Client
+
+	mu       sync.Mutex
+	version  int64
+	failed   int64
+	fetching bool
+}
+
+func New(apiURL, agentID, token string, apply func(map[string]interface{}) error, report func(int64, error)) *Syncer {
+	return &Syncer{
+		apiURL:  apiURL,
+		agentID: agentID,
+		token:   token,
+		apply:   apply,
+		report:  report,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *Syncer) Version() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// Handle applies u unless the agent already runs that version or newer.
+// A version that fails to apply is not retried until a newer one arrives.
+func (s *Syncer) Handle(u Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u.Version <= s.version || u.Version == s.failed {
+		return
+	}
+
+	if err := s.apply(u.Config); err != nil {
+		s.failed = u.Version
+		log.Printf("failed to apply config version %d: %v", u.Version, err)
+		s.report(s.version, fmt.Errorf("version %d: %w", u.Version, err))
+		return
+	}
+	s.version = u.Version
+	log.Printf("applied config version %d", u.Version)
+	s.report(s.version, nil)
+}
+
+// Fetch loads the current config from the API and applies it.
+func (s *Syncer) Fetch(ctx context.Context) error {
+	url := fmt.Sprintf("%s/api/v1/agents/%s/config", s.apiURL, s.agentID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch config: unexpected status %s", resp.Status)
+	}
+
+	var u Update
+	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+		return fmt.Errorf("decode config: %w", err)
+	}
+	s.Handle(u)
+	return nil
+}
+
+// Offer is called with the version the API expects. If it is newer than
+// what runs, the config is fetched in the background.
+func (s *Syncer) Offer(version int64) {
+	s.mu.Lock()
+	stale := version > s.version && version != s.failed && !s.fetching
+	if stale {
+		s.fetching = true
+	}
+	s.mu.Unlock()
+	if !stale {
+		return
+	}
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.fetching = false
+			s.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := s.Fetch(ctx); err != nil {
+			log.Printf("config catch-up failed: %v", err)
+		}
+	}()
+}
+
+// Subscribe applies updates pushed on the agent's config subject.
+func (s *Syncer) Subscribe(nc *nats.Conn) (*nats.Subscription, error) {
+	return nc.Subscribe(Subject(s.agentID), func(msg *nats.Msg) {
+		var u Update
+		if err := json.Unmarshal(msg.Data, &u); err != nil {
+			log.Printf("invalid config update: %v", err)
+			return
+		}
+		s.Handle(u)
+	})
+}
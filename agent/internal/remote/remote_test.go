@@ -0,0 +1,92 @@
+package remote_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/remote"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	applied  []map[string]interface{}
+	reported []int64
+	lastErr  error
+}
+
+func (r *recorder) apply(cfg map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cfg["bad"] == true {
+		return errors.New("bad config")
+	}
+	r.applied = append(r.applied, cfg)
+	return nil
+}
+
+func (r *recorder) report(version int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reported = append(r.reported, version)
+	r.lastErr = err
+}
+
+func TestHandleAppliesNewerVersionsOnly(t *testing.T) {
+	rec := &recorder{}
+	s := remote.New("http://unused", "agent-1", "agt_x", rec.apply, rec.report)
+
+	s.Handle(remote.Update{Version: 2, Config: map[string]interface{}{"a": 1}})
+	s.Handle(remote.Update{Version: 1, Config: map[string]interface{}{"a": 0}})
+	s.Handle(remote.Update{Version: 2, Config: map[string]interface{}{"a": 1}})
+	if len(rec.applied) != 1 || s.Version() != 2 {
+		t.Fatalf("expected only version 2 to apply, got %v (version %d)", rec.applied, s.Version())
+	}
+
+	s.Handle(remote.Update{Version: 3, Config: map[string]interface{}{"bad": true}})
+	if s.Version() != 2 || rec.lastErr == nil || rec.reported[len(rec.reported)-1] != 2 {
+		t.Errorf("expected version 3 to fail and 2 to stay reported, got %v %v", rec.reported, rec.lastErr)
+	}
+}
+
+func TestFetchAndOffer(t *testing.T) {
+	var mu sync.Mutex
+	version := int64(1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/agents/agent-1/config" || r.Header.Get("Authorization") != "Bearer agt_x" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode(remote.Update{Version: version, Config: map[string]interface{}{"enable_cloud": false}})
+	}))
+	defer api.Close()
+
+	rec := &recorder{}
+	s := remote.New(api.URL, "agent-1", "agt_x", rec.apply, rec.report)
+	if err := s.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s.Version() != 1 {
+		t.Fatalf("expected version 1, got %d", s.Version())
+	}
+
+	mu.Lock()
+	version = 2
+	mu.Unlock()
+	s.Offer(1)
+	s.Offer(2)
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Version() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s.Version() != 2 {
+		t.Errorf("expected the heartbeat version to trigger a catch-up fetch, got %d", s.Version())
+	}
+}
@@ -0,0 +1,151 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Runner runs an external command, as exec does. Tests substitute a fake.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// Firewall adds and removes drop rules for single source addresses.
+type Firewall interface {
+	Name() string
+	// Setup creates the agent's own table or chain, removing anything a
+	// previous run left in it.
+	Setup(ctx context.Context) error
+	Block(ctx context.Context, ip netip.Addr, ttl time.Duration) error
+	Unblock(ctx context.Context, ip netip.Addr) error
+}
+
+const (
+	nftTable    = "shield"
+	iptChain    = "SHIELD-BLOCK"
+	BackendAuto = "auto"
+)
+
+// Detect returns the named backend, or for "auto" nftables when the nft
+// binary works and iptables otherwise.
+func Detect(ctx context.Context, run Runner, backend string) (Firewall, error) {
+	switch backend {
+	case "nftables":
+		return &NFTables{run: run}, nil
+	case "iptables":
+		return &IPTables{run: run}, nil
+	case "", BackendAuto:
+		if _, err := run.Run(ctx, "nft", "--version"); err == nil {
+			return &NFTables{run: run}, nil
+		}
+		if _, err := run.Run(ctx, "iptables", "--version"); err == nil {
+			return &IPTables{run: run}, nil
+		}
+		return nil, errors.New("neither nft nor iptables is available")
+	default:
+		return nil, fmt.Errorf("unknown firewall backend %q", backend)
+	}
+}
+
+// NFTables keeps blocked addresses in two sets of an inet table. Elements
+// carry their own timeout, so a block still lapses if the agent dies
+// before removing it.
+type NFTables struct {
+	run Runner
+}
+
+func (f *NFTables) Name() string { return "nftables" }
+
+func (f *NFTables) Setup(ctx context.Context) error {
+	steps := [][]string{
+		{"add", "table", "inet", nftTable},
+		{"add", "set", "inet", nftTable, "blocklist4", "{ type ipv4_addr; flags timeout; }"},
+		{"add", "set", "inet", nftTable, "blocklist6", "{ type ipv6_addr; flags timeout; }"},
+		{"flush", "set", "inet", nftTable, "blocklist4"},
+		{"flush", "set", "inet", nftTable, "blocklist6"},
+		{"add", "chain", "inet", nftTable, "input", "{ type filter hook input priority -10; policy accept; }"},
+		{"flush", "chain", "inet", nftTable, "input"},
+		{"add", "rule", "inet", nftTable, "input", "ip", "saddr", "@blocklist4", "drop"},
+		{"add", "rule", "inet", nftTable, "input", "ip6", "saddr", "@blocklist6", "drop"},
+	}
+	for _, args := range steps {
+		if _, err := f.run.Run(ctx, "nft", args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *NFTables) Block(ctx context.Context, ip netip.Addr, ttl time.Duration) error {
+	element := fmt.Sprintf("{ %s timeout %ds }", ip, int64(ttl.Seconds()))
+	_, err := f.run.Run(ctx, "nft", "add", "element", "inet", nftTable, nftSet(ip), element)
+	return err
+}
+
+func (f *NFTables) Unblock(ctx context.Context, ip netip.Addr) error {
+	_, err := f.run.Run(ctx, "nft", "delete", "element", "inet", nftTable, nftSet(ip), fmt.Sprintf("{ %s }", ip))
+	return err
+}
+
+func nftSet(ip netip.Addr) string {
+	if ip.Is4() {
+		return "blocklist4"
+	}
+	return "blocklist6"
+}
+
+// IPTables drops blocked addresses from a chain jumped to from INPUT. Rules
+// have no timeout of their own; Setup clears what a crashed run left.
+type IPTables struct {
+	run Runner
+}
+
+func (f *IPTables) Name() string { return "iptables" }
+
+func (f *IPTables) Setup(ctx context.Context) error {
+	for _, bin := range []string{"iptables", "ip6tables"} {
+		// -N fails when the chain exists, which is fine; -F then empties it.
+		f.run.Run(ctx, bin, "-N", iptChain)
+		if _, err := f.run.Run(ctx, bin, "-F", iptChain); err != nil {
+			return err
+		}
+		if _, err := f.run.Run(ctx, bin, "-C", "INPUT", "-j", iptChain); err != nil {
+			if _, err := f.run.Run(ctx, bin, "-I", "INPUT", "-j", iptChain); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *IPTables) Block(ctx context.Context, ip netip.Addr, _ time.Duration) error {
+	_, err := f.run.Run(ctx, iptBinary(ip), "-A", iptChain, "-s", ip.String(), "-j", "DROP")
+	return err
+}
+
+func (f *IPTables) Unblock(ctx context.Context, ip netip.Addr) error {
+	_, err := f.run.Run(ctx, iptBinary(ip), "-D", iptChain, "-s", ip.String(), "-j", "DROP")
+	return err
+}
+
+func iptBinary(ip netip.Addr) string {
+	if ip.Is4() {
+		return "iptables"
+	}
+	return "ip6tables"
+}
@@ -0,0 +1,303 @@
+// Package response carries out containment actions on the host, currently
+// blocking a source address in the firewall for a limited time. It is
+// opt-in: nothing here runs unless the agent is configured for it.
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+)
+
+const (
+	DefaultTTL = time.Hour
+	MaxTTL     = 24 * time.Hour
+)
+
+var (
+	ErrAllowlisted = errors.New("address is allowlisted")
+	ErrNotBlocked  = errors.New("address is not blocked")
+)
+
+// alwaysAllowed can never be blocked, whatever the configured allowlist.
+var alwaysAllowed = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+type Options struct {
+	Firewall Firewall
+	// Allowlist holds ranges that must never be blocked, such as the
+	// networks the agent is managed from.
+	Allowlist  []netip.Prefix
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+	// DryRun records every action without touching the firewall.
+	DryRun bool
+	// Audit receives one JSON line per action. Emit, when set, also sends
+	// each action into the event stream.
+	Audit io.Writer
+	Emit  func(core.Event)
+	Now   func() time.Time
+}
+
+// Block is an address the responder is dropping traffic from.
+type Block struct {
+	IP          string    `json:"ip"`
+	Reason      string    `json:"reason"`
+	RequestedBy string    `json:"requested_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	DryRun      bool      `json:"dry_run"`
+}
+
+// AuditRecord is one line of the audit trail.
+type AuditRecord struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	IP          string    `json:"ip"`
+	TTLSeconds  int64     `json:"ttl_seconds,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+	Backend     string    `json:"backend"`
+	DryRun      bool      `json:"dry_run"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type Responder struct {
+	opts Options
+
+	mu      sync.Mutex
+	blocks  map[netip.Addr]Block
+	auditMu sync.Mutex
+}
+
+func New(opts Options) (*Responder, error) {
+	if opts.Firewall == nil && !opts.DryRun {
+		return nil, errors.New("a firewall backend is required unless running dry")
+	}
+	if opts.DefaultTTL <= 0 {
+		opts.DefaultTTL = DefaultTTL
+	}
+	if opts.MaxTTL <= 0 {
+		opts.MaxTTL = MaxTTL
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Responder{opts: opts, blocks: make(map[netip.Addr]Block)}, nil
+}
+
+// ParseAllowlist parses CIDRs and bare addresses.
+func ParseAllowlist(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, e := range entries {
+		if p, err := netip.ParsePrefix(e); err == nil {
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist entry %q", e)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func (r *Responder) Setup(ctx context.Context) error {
+	if r.opts.DryRun {
+		return nil
+	}
+	return r.opts.Firewall.Setup(ctx)
+}
+
+// Block drops traffic from ip for ttl, capped at MaxTTL. Blocking an
+// address that is already blocked extends the block.
+func (r *Responder) Block(ctx context.Context, ip string, ttl time.Duration, reason, requestedBy string) (Block, error) {
+	rec := AuditRecord{Action: "block", IP: ip, Reason: reason, RequestedBy: requestedBy}
+	addr, err := r.check(ip)
+	if err != nil {
+		rec.Action = "refused"
+		return Block{}, r.record(rec, err)
+	}
+	if ttl <= 0 {
+		ttl = r.opts.DefaultTTL
+	}
+	if ttl > r.opts.MaxTTL {
+		ttl = r.opts.MaxTTL
+	}
+	rec.IP, rec.TTLSeconds = addr.String(), int64(ttl.Seconds())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.opts.DryRun {
+		if _, ok := r.blocks[addr]; ok {
+			// Re-adding an nftables element does not reset its timeout.
+			r.opts.Firewall.Unblock(ctx, addr)
+		}
+		if err := r.opts.Firewall.Block(ctx, addr, ttl); err != nil {
+			return Block{}, r.record(rec, err)
+		}
+	}
+	now := r.opts.Now()
+	b := Block{
+		IP:          addr.String(),
+		Reason:      reason,
+		RequestedBy: requestedBy,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+		DryRun:      r.opts.DryRun,
+	}
+	r.blocks[addr] = b
+	return b, r.record(rec, nil)
+}
+
+// Unblock lifts a block before it expires.
+func (r *Responder) Unblock(ctx context.Context, ip, reason, requestedBy string) error {
+	rec := AuditRecord{Action: "unblock", IP: ip, Reason: reason, RequestedBy: requestedBy}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return r.record(rec, fmt.Errorf("invalid address %q", ip))
+	}
+	addr = addr.Unmap()
+	rec.IP = addr.String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.blocks[addr]; !ok {
+		return r.record(rec, ErrNotBlocked)
+	}
+	return r.record(rec, r.remove(ctx, addr))
+}
+
+// ExpireDue removes blocks whose TTL has passed and returns how many.
+func (r *Responder) ExpireDue(ctx context.Context) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.opts.Now()
+	n := 0
+	for addr, b := range r.blocks {
+		if now.Before(b.ExpiresAt) {
+			continue
+		}
+		r.record(AuditRecord{Action: "expire", IP: b.IP, Reason: b.Reason}, r.remove(ctx, addr))
+		n++
+	}
+	return n
+}
+
+// Run expires blocks until ctx is done, then lifts the ones left so no
+// rule outlives the agent.
+func (r *Responder) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.mu.Lock()
+			for addr, b := range r.blocks {
+				cleanup, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				r.record(AuditRecord{Action: "unblock", IP: b.IP, Reason: "agent shutdown"}, r.remove(cleanup, addr))
+				cancel()
+			}
+			r.mu.Unlock()
+			return
+		case <-ticker.C:
+			r.ExpireDue(ctx)
+		}
+	}
+}
+
+// Blocks lists the active blocks, soonest to expire first.
+func (r *Responder) Blocks() []Block {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Block, 0, len(r.blocks))
+	for _, b := range r.blocks {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExpiresAt.Before(out[j].ExpiresAt) })
+	return out
+}
+
+// remove lifts a block. The entry is dropped even if the firewall call
+// fails, since an nftables element may already have timed out. Callers
+// hold r.mu.
+func (r *Responder) remove(ctx context.Context, addr netip.Addr) error {
+	delete(r.blocks, addr)
+	if r.opts.DryRun {
+		return nil
+	}
+	return r.opts.Firewall.Unblock(ctx, addr)
+}
+
+func (r *Responder) check(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return addr, fmt.Errorf("invalid address %q", ip)
+	}
+	addr = addr.Unmap()
+	if addr.IsUnspecified() || addr.IsMulticast() || addr.IsLinkLocalUnicast() {
+		return addr, fmt.Errorf("refusing to block %s", addr)
+	}
+	for _, p := range append(alwaysAllowed, r.opts.Allowlist...) {
+		if p.Contains(addr) {
+			return addr, fmt.Errorf("%w: %s is in %s", ErrAllowlisted, addr, p)
+		}
+	}
+	return addr, nil
+}
+
+// record writes rec to the audit trail and returns err.
+func (r *Responder) record(rec AuditRecord, err error) error {
+	rec.Time = r.opts.Now()
+	rec.DryRun = r.opts.DryRun
+	if r.opts.Firewall != nil {
+		rec.Backend = r.opts.Firewall.Name()
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	log.Printf("response: %s %s (dry_run=%t) %s", rec.Action, rec.IP, rec.DryRun, rec.Error)
+
+	if r.opts.Audit != nil {
+		line, _ := json.Marshal(rec)
+		r.auditMu.Lock()
+		r.opts.Audit.Write(append(line, '\n'))
+		r.auditMu.Unlock()
+	}
+	if r.opts.Emit != nil {
+		severity := "medium"
+		if err != nil {
+			severity = "low"
+		}
+		r.opts.Emit(core.Event{
+			Time:     rec.Time,
+			Source:   "response",
+			Category: "response_action",
+			Severity: severity,
+			Summary:  fmt.Sprintf("%s %s", rec.Action, rec.IP),
+			Payload: map[string]interface{}{
+				"action":       rec.Action,
+				"ip":           rec.IP,
+				"ttl_seconds":  rec.TTLSeconds,
+				"reason":       rec.Reason,
+				"requested_by": rec.RequestedBy,
+				"backend":      rec.Backend,
+				"dry_run":      rec.DryRun,
+				"error":        rec.Error,
+			},
+		})
+	}
+	return err
+}
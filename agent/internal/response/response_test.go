@@ -0,0 +1,214 @@
+package response_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/response"
+)
+
+// fakeRunner records commands instead of running them. Commands starting
+// with a prefix in fail return an error.
+type fakeRunner struct {
+	mu   sync.Mutex
+	cmds []string
+	fail []string
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	f.cmds = append(f.cmds, cmd)
+	for _, prefix := range f.fail {
+		if strings.HasPrefix(cmd, prefix) {
+			return nil, errors.New("exit status 1")
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRunner) take() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := f.cmds
+	f.cmds = nil
+	return out
+}
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newResponder(t *testing.T, fw response.Firewall, dryRun bool) (*response.Responder, *clock, *bytes.Buffer, *[]core.Event) {
+	t.Helper()
+	allow, err := response.ParseAllowlist([]string{"10.0.0.0/8", "192.0.2.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := &clock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	audit := &bytes.Buffer{}
+	events := &[]core.Event{}
+	r, err := response.New(response.Options{
+		Firewall:  fw,
+		Allowlist: allow,
+		DryRun:    dryRun,
+		Audit:     audit,
+		Emit:      func(e core.Event) { *events = append(*events, e) },
+		Now:       clk.Now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, clk, audit, events
+}
+
+func TestDetectPrefersNFTables(t *testing.T) {
+	fw, err := response.Detect(context.Background(), &fakeRunner{}, "auto")
+	if err != nil || fw.Name() != "nftables" {
+		t.Errorf("expected nftables, got %v, %v", fw, err)
+	}
+	fw, err = response.Detect(context.Background(), &fakeRunner{fail: []string{"nft"}}, "auto")
+	if err != nil || fw.Name() != "iptables" {
+		t.Errorf("expected the iptables fallback, got %v, %v", fw, err)
+	}
+	if _, err := response.Detect(context.Background(), &fakeRunner{fail: []string{"nft", "iptables"}}, "auto"); err == nil {
+		t.Error("expected an error with no firewall available")
+	}
+}
+
+func TestBlockAndExpireWithNFTables(t *testing.T) {
+	run := &fakeRunner{}
+	fw, _ := response.Detect(context.Background(), run, "nftables")
+	r, clk, audit, events := newResponder(t, fw, false)
+	ctx := context.Background()
+
+	if err := r.Setup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := run.take(); len(cmds) == 0 || cmds[0] != "nft add table inet shield" {
+		t.Errorf("unexpected setup %v", cmds)
+	}
+
+	b, err := r.Block(ctx, "203.0.113.9", 10*time.Minute, "brute_force_attack", "engine")
+	if err != nil {
+		t.Fatalf("block failed: %v", err)
+	}
+	if !b.ExpiresAt.Equal(clk.now.Add(10 * time.Minute)) {
+		t.Errorf("unexpected expiry %v", b.ExpiresAt)
+	}
+	if cmds := run.take(); len(cmds) != 1 || cmds[0] != "nft add element inet shield blocklist4 { 203.0.113.9 timeout 600s }" {
+		t.Errorf("unexpected block commands %v", cmds)
+	}
+
+	r.Block(ctx, "2001:db8::1", 48*time.Hour, "port_scan_with_exploit", "alice@example.com")
+	if cmds := run.take(); len(cmds) != 1 || cmds[0] != "nft add element inet shield blocklist6 { 2001:db8::1 timeout 86400s }" {
+		t.Errorf("expected the TTL capped at 24h in the v6 set, got %v", cmds)
+	}
+	if len(r.Blocks()) != 2 {
+		t.Fatalf("expected 2 blocks, got %v", r.Blocks())
+	}
+
+	clk.now = clk.now.Add(11 * time.Minute)
+	if n := r.ExpireDue(ctx); n != 1 {
+		t.Errorf("expected 1 expired block, got %d", n)
+	}
+	if cmds := run.take(); len(cmds) != 1 || cmds[0] != "nft delete element inet shield blocklist4 { 203.0.113.9 }" {
+		t.Errorf("unexpected expiry commands %v", cmds)
+	}
+
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var rec response.AuditRecord
+		json.Unmarshal([]byte(line), &rec)
+		actions = append(actions, rec.Action+" "+rec.IP)
+	}
+	if strings.Join(actions, ",") != "block 203.0.113.9,block 2001:db8::1,expire 203.0.113.9" {
+		t.Errorf("unexpected audit trail %v", actions)
+	}
+	if len(*events) != 3 || (*events)[0].Category != "response_action" {
+		t.Errorf("expected an event per action, got %+v", *events)
+	}
+}
+
+func TestIPTablesFallback(t *testing.T) {
+	run := &fakeRunner{fail: []string{"iptables -N", "iptables -C"}}
+	fw, _ := response.Detect(context.Background(), run, "iptables")
+	r, _, _, _ := newResponder(t, fw, false)
+	ctx := context.Background()
+
+	if err := r.Setup(ctx); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	setup := strings.Join(run.take(), "\n")
+	if !strings.Contains(setup, "iptables -I INPUT -j SHIELD-BLOCK") || strings.Contains(setup, "ip6tables -I INPUT") {
+		t.Errorf("expected the jump to be added only where missing, got\n%s", setup)
+	}
+
+	r.Block(ctx, "198.51.100.4", 0, "manual", "bob")
+	r.Unblock(ctx, "198.51.100.4", "false positive", "bob")
+	cmds := run.take()
+	if len(cmds) != 2 || cmds[0] != "iptables -A SHIELD-BLOCK -s 198.51.100.4 -j DROP" || cmds[1] != "iptables -D SHIELD-BLOCK -s 198.51.100.4 -j DROP" {
+		t.Errorf("unexpected commands %v", cmds)
+	}
+	if err := r.Unblock(ctx, "198.51.100.4", "", "bob"); !errors.Is(err, response.ErrNotBlocked) {
+		t.Errorf("expected ErrNotBlocked, got %v", err)
+	}
+}
+
+func TestAllowlistAndDryRun(t *testing.T) {
+	run := &fakeRunner{}
+	fw, _ := response.Detect(context.Background(), run, "nftables")
+	r, _, audit, _ := newResponder(t, fw, true)
+	ctx := context.Background()
+
+	for _, ip := range []string{"10.1.2.3", "192.0.2.7", "127.0.0.1", "::ffff:10.0.0.1"} {
+		if _, err := r.Block(ctx, ip, 0, "", "engine"); !errors.Is(err, response.ErrAllowlisted) {
+			t.Errorf("%s: expected ErrAllowlisted, got %v", ip, err)
+		}
+	}
+	for _, ip := range []string{"0.0.0.0", "fe80::1", "not-an-ip"} {
+		if _, err := r.Block(ctx, ip, 0, "", "engine"); err == nil {
+			t.Errorf("%s: expected a refusal", ip)
+		}
+	}
+
+	b, err := r.Block(ctx, "203.0.113.9", 0, "", "engine")
+	if err != nil || !b.DryRun || !b.ExpiresAt.Equal(b.CreatedAt.Add(response.DefaultTTL)) {
+		t.Errorf("expected a dry-run block with the default TTL, got %+v, %v", b, err)
+	}
+	if cmds := run.take(); len(cmds) != 0 {
+		t.Errorf("expected no firewall commands in dry-run mode, got %v", cmds)
+	}
+	if !strings.Contains(audit.String(), `"action":"refused"`) || !strings.Contains(audit.String(), `"dry_run":true`) {
+		t.Errorf("expected refusals and dry-run actions in the audit trail, got\n%s", audit.String())
+	}
+}
+
+func TestParseAllowlist(t *testing.T) {
+	got, err := response.ParseAllowlist([]string{"10.0.0.1/8", "2001:db8::/32", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d: got %s, want %s", i, got[i], want[i])
+		}
+	}
+	if _, err := response.ParseAllowlist([]string{"corp-net"}); err == nil {
+		t.Error("expected an invalid entry to be rejected")
+	}
+}
@@ -0,0 +1,464 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	headerSize   = 16
+	segmentExt   = ".seg"
+	cursorFile   = "cursor"
+	maxRecordLen = 16 << 20
+)
+
+var ErrRecordTooLarge = errors.New("spool: record too large")
+
+type Options struct {
+	MaxBytes     int64
+	MaxAge       time.Duration
+	SegmentBytes int64
+	// SyncInterval bounds how long an appended record may sit in the page
+	// cache before it is synced to disk, and so what a crash or power loss
+	// can take. Segments are also synced when rotated and on Close.
+	SyncInterval time.Duration
+}
+
+type segment struct {
+	seq   uint64
+	path  string
+	size  int64
+	count int64
+}
+
+type Spool struct {
+	mu       sync.Mutex
+	dir      string
+	opts     Options
+	segments []*segment
+	active   *os.File
+	headOff  int64
+	nextSeq  uint64
+	syncer   *time.Timer
+
+	depth   atomic.Int64
+	bytes   atomic.Int64
+	dropped atomic.Int64
+}
+
+func Open(dir string, opts Options) (*Spool, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 256 << 20
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = 8 << 20
+	}
+	if opts.SegmentBytes > opts.MaxBytes {
+		opts.SegmentBytes = opts.MaxBytes
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &Spool{dir: dir, opts: opts}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read spool dir: %w", err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, &segment{seq: seq, path: filepath.Join(s.dir, name)})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	headSeq, headOff := s.readCursor()
+	kept := s.segments[:0]
+	for _, seg := range s.segments {
+		if seg.seq < headSeq {
+			os.Remove(seg.path)
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	s.segments = kept
+
+	for i, seg := range s.segments {
+		start := int64(0)
+		if i == 0 && seg.seq == headSeq {
+			start = headOff
+		}
+		if err := s.scanSegment(seg, start); err != nil {
+			return err
+		}
+	}
+
+	if len(s.segments) > 0 {
+		head := s.segments[0]
+		if head.seq == headSeq {
+			s.headOff = headOff
+		}
+		s.nextSeq = s.segments[len(s.segments)-1].seq + 1
+	} else {
+		s.nextSeq = headSeq + 1
+	}
+	return nil
+}
+
+func (s *Spool) scanSegment(seg *segment, start int64) error {
+	f, err := os.OpenFile(seg.path, os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if start > info.Size() {
+		start = info.Size()
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, 0, info.Size()))
+	valid := int64(0)
+	for {
+		_, n, err := readRecord(r)
+		if err != nil {
+			break
+		}
+		if valid >= start {
+			seg.count++
+		}
+		valid += n
+	}
+
+	if valid < info.Size() {
+		if err := f.Truncate(valid); err != nil {
+			return fmt.Errorf("truncate torn segment: %w", err)
+		}
+	}
+	seg.size = valid
+	if start > valid {
+		start = valid
+	}
+
+	s.depth.Add(seg.count)
+	s.bytes.Add(valid - start)
+	return nil
+}
+
+func (s *Spool) readCursor() (uint64, int64) {
+	data, err := os.ReadFile(filepath.Join(s.dir, cursorFile))
+	if err != nil {
+		return 0, 0
+	}
+	var seq uint64
+	var off int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &off); err != nil {
+		return 0, 0
+	}
+	return seq, off
+}
+
+func (s *Spool) writeCursor() error {
+	seq := s.nextSeq
+	if len(s.segments) > 0 {
+		seq = s.segments[0].seq
+	}
+	tmp := filepath.Join(s.dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", seq, s.headOff)), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, cursorFile))
+}
+
+func (s *Spool) Append(data []byte) error {
+	if len(data) > maxRecordLen {
+		return ErrRecordTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recLen := int64(headerSize + len(data))
+	s.enforceSize(recLen)
+
+	tail := s.tail()
+	if tail == nil || s.active == nil || tail.size+recLen > s.opts.SegmentBytes && tail.size > 0 {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		tail = s.tail()
+	}
+
+	buf := make([]byte, recLen)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(time.Now().UnixNano()))
+	copy(buf[headerSize:], data)
+
+	if _, err := s.active.Write(buf); err != nil {
+		return fmt.Errorf("write spool record: %w", err)
+	}
+
+	tail.size += recLen
+	tail.count++
+	s.depth.Add(1)
+	s.bytes.Add(recLen)
+	if s.syncer == nil {
+		s.syncer = time.AfterFunc(s.opts.SyncInterval, s.syncActive)
+	}
+	return nil
+}
+
+// syncActive syncs the active segment once SyncInterval has passed since
+// the first unsynced append.
+func (s *Spool) syncActive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sync()
+}
+
+// sync flushes the active segment to disk. Callers hold s.mu.
+func (s *Spool) sync() error {
+	if s.syncer != nil {
+		s.syncer.Stop()
+		s.syncer = nil
+	}
+	if s.active == nil {
+		return nil
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("sync spool segment: %w", err)
+	}
+	return nil
+}
+
+func (s *Spool) tail() *segment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+func (s *Spool) rotate() error {
+	s.pruneExpired()
+
+	if s.active != nil {
+		if err := s.sync(); err != nil {
+			return err
+		}
+		s.active.Close()
+		s.active = nil
+	}
+
+	if tail := s.tail(); tail != nil && tail.size == 0 {
+		f, err := os.OpenFile(tail.path, os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("open segment: %w", err)
+		}
+		s.active = f
+		return nil
+	}
+
+	seg := &segment{
+		seq:  s.nextSeq,
+		path: filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextSeq, segmentExt)),
+	}
+	f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+	s.nextSeq++
+	s.segments = append(s.segments, seg)
+	s.active = f
+	return nil
+}
+
+func (s *Spool) enforceSize(incoming int64) {
+	for len(s.segments) > 0 && s.bytes.Load()+incoming > s.opts.MaxBytes {
+		head := s.segments[0]
+		if head == s.tail() && s.active != nil {
+			s.active.Close()
+			s.active = nil
+		}
+		s.dropHead()
+	}
+}
+
+func (s *Spool) dropHead() {
+	head := s.segments[0]
+	os.Remove(head.path)
+	s.depth.Add(-head.count)
+	s.bytes.Add(-(head.size - s.headOff))
+	s.dropped.Add(head.count)
+	s.segments = s.segments[1:]
+	s.headOff = 0
+	s.writeCursor()
+}
+
+func (s *Spool) pruneExpired() {
+	if s.opts.MaxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.opts.MaxAge)
+	for len(s.segments) > 1 {
+		info, err := os.Stat(s.segments[0].path)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return
+		}
+		s.dropHead()
+	}
+}
+
+// Drain replays pending records oldest first, passing each to fn. It stops
+// at the first error from fn, leaving that record at the head of the spool.
+// Records older than MaxAge are discarded without being delivered.
+func (s *Spool) Drain(fn func(data []byte) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivered := 0
+	defer s.writeCursor()
+
+	for len(s.segments) > 0 {
+		head := s.segments[0]
+		done, n, err := s.drainSegment(head, fn)
+		delivered += n
+		if err != nil {
+			return delivered, err
+		}
+		if !done {
+			return delivered, nil
+		}
+
+		if head == s.tail() && s.active != nil {
+			s.active.Close()
+			s.active = nil
+		}
+		os.Remove(head.path)
+		s.segments = s.segments[1:]
+		s.headOff = 0
+	}
+	return delivered, nil
+}
+
+func (s *Spool) drainSegment(seg *segment, fn func([]byte) error) (bool, int, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return false, 0, fmt.Errorf("open segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(f, s.headOff, seg.size-s.headOff))
+	var cutoff time.Time
+	if s.opts.MaxAge > 0 {
+		cutoff = time.Now().Add(-s.opts.MaxAge)
+	}
+
+	delivered := 0
+	for s.headOff < seg.size {
+		rec, n, err := readRecord(r)
+		if err != nil {
+			return false, delivered, fmt.Errorf("read spool record: %w", err)
+		}
+
+		if cutoff.IsZero() || !rec.time.Before(cutoff) {
+			if err := fn(rec.data); err != nil {
+				return false, delivered, err
+			}
+			delivered++
+		} else {
+			s.dropped.Add(1)
+		}
+
+		s.headOff += n
+		seg.count--
+		s.depth.Add(-1)
+		s.bytes.Add(-n)
+	}
+	return true, delivered, nil
+}
+
+type record struct {
+	time time.Time
+	data []byte
+}
+
+func readRecord(r io.Reader) (record, int64, error) {
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return record{}, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(hdr[0:4])
+	if length > maxRecordLen {
+		return record{}, 0, ErrRecordTooLarge
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return record{}, 0, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return record{}, 0, errors.New("spool: checksum mismatch")
+	}
+
+	ts := time.Unix(0, int64(binary.BigEndian.Uint64(hdr[8:16])))
+	return record{time: ts, data: data}, int64(headerSize) + int64(length), nil
+}
+
+func (s *Spool) Depth() int64 {
+	return s.depth.Load()
+}
+
+func (s *Spool) Size() int64 {
+	return s.bytes.Load()
+}
+
+func (s *Spool) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != nil {
+		err := s.sync()
+		if cerr := s.active.Close(); err == nil {
+			err = cerr
+		}
+		s.active = nil
+		return err
+	}
+	return nil
+}
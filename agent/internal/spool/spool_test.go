@@ -0,0 +1,198 @@
+package spool_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/spool"
+)
+
+func drainAll(t *testing.T, s *spool.Spool) []string {
+	t.Helper()
+	var got []string
+	if _, err := s.Drain(func(data []byte) error {
+		got = append(got, string(data))
+		return nil
+	}); err != nil {
+		t.Fatalf("drain failed: %v", err)
+	}
+	return got
+}
+
+func TestSpoolReplaysInOrder(t *testing.T) {
+	s, err := spool.Open(t.TempDir(), spool.Options{SegmentBytes: 64})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := s.Append([]byte(fmt.Sprintf("event-%d", i))); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+
+	if s.Depth() != 10 {
+		t.Errorf("expected depth 10, got %d", s.Depth())
+	}
+
+	got := drainAll(t, s)
+	if len(got) != 10 {
+		t.Fatalf("expected 10 records, got %d", len(got))
+	}
+	for i, v := range got {
+		if v != fmt.Sprintf("event-%d", i) {
+			t.Errorf("record %d out of order: %s", i, v)
+		}
+	}
+
+	if s.Depth() != 0 || s.Size() != 0 {
+		t.Errorf("expected empty spool, got depth=%d size=%d", s.Depth(), s.Size())
+	}
+}
+
+func TestSpoolSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := spool.Open(dir, spool.Options{SegmentBytes: 64})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		s.Append([]byte(fmt.Sprintf("event-%d", i)))
+	}
+
+	delivered := 0
+	s.Drain(func(data []byte) error {
+		if delivered == 2 {
+			return errors.New("link down")
+		}
+		delivered++
+		return nil
+	})
+	s.Close()
+
+	s, err = spool.Open(dir, spool.Options{SegmentBytes: 64})
+	if err != nil {
+		t.Fatalf("failed to reopen spool: %v", err)
+	}
+	defer s.Close()
+
+	if s.Depth() != 3 {
+		t.Fatalf("expected 3 pending after reopen, got %d", s.Depth())
+	}
+	got := drainAll(t, s)
+	if len(got) != 3 || got[0] != "event-2" || got[2] != "event-4" {
+		t.Errorf("unexpected replay after reopen: %v", got)
+	}
+}
+
+func TestSpoolDrainStopsOnError(t *testing.T) {
+	s, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer s.Close()
+
+	s.Append([]byte("a"))
+	s.Append([]byte("b"))
+
+	n, err := s.Drain(func(data []byte) error {
+		return errors.New("publish failed")
+	})
+	if err == nil {
+		t.Fatal("expected drain error")
+	}
+	if n != 0 || s.Depth() != 2 {
+		t.Errorf("expected nothing consumed, got n=%d depth=%d", n, s.Depth())
+	}
+
+	s.Append([]byte("c"))
+	got := drainAll(t, s)
+	if len(got) != 3 || got[0] != "a" || got[2] != "c" {
+		t.Errorf("unexpected replay: %v", got)
+	}
+}
+
+func TestSpoolSizeCapDropsOldest(t *testing.T) {
+	s, err := spool.Open(t.TempDir(), spool.Options{MaxBytes: 200, SegmentBytes: 50})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 20; i++ {
+		s.Append([]byte(fmt.Sprintf("event-%02d", i)))
+	}
+
+	if s.Size() > 200 {
+		t.Errorf("expected size <= 200, got %d", s.Size())
+	}
+	if s.Dropped() == 0 {
+		t.Error("expected dropped records")
+	}
+
+	got := drainAll(t, s)
+	if len(got) == 0 || got[len(got)-1] != "event-19" {
+		t.Errorf("expected newest record to survive, got %v", got)
+	}
+	if int64(len(got))+s.Dropped() != 20 {
+		t.Errorf("expected delivered+dropped=20, got %d+%d", len(got), s.Dropped())
+	}
+}
+
+func TestSpoolAgeCapDiscardsExpired(t *testing.T) {
+	s, err := spool.Open(t.TempDir(), spool.Options{MaxAge: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	defer s.Close()
+
+	s.Append([]byte("stale"))
+	time.Sleep(100 * time.Millisecond)
+	s.Append([]byte("fresh"))
+
+	got := drainAll(t, s)
+	if len(got) != 1 || got[0] != "fresh" {
+		t.Errorf("expected only fresh record, got %v", got)
+	}
+	if s.Dropped() != 1 {
+		t.Errorf("expected 1 dropped, got %d", s.Dropped())
+	}
+}
+
+func TestSpoolTruncatesTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s, err := spool.Open(dir, spool.Options{})
+	if err != nil {
+		t.Fatalf("failed to open spool: %v", err)
+	}
+	s.Append([]byte("complete"))
+	s.Close()
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segs) != 1 {
+		t.Fatalf("expected 1 segment, got %d", len(segs))
+	}
+	f, _ := os.OpenFile(segs[0], os.O_WRONLY|os.O_APPEND, 0o600)
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	s, err = spool.Open(dir, spool.Options{})
+	if err != nil {
+		t.Fatalf("failed to reopen spool: %v", err)
+	}
+	defer s.Close()
+
+	if s.Depth() != 1 {
+		t.Errorf("expected depth 1, got %d", s.Depth())
+	}
+	s.Append([]byte("after"))
+	got := drainAll(t, s)
+	if len(got) != 2 || got[0] != "complete" || got[1] != "after" {
+		t.Errorf("unexpected replay: %v", got)
+	}
+}
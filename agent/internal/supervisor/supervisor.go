@@ -0,0 +1,125 @@
+// Package supervisor keeps the agent's collectors in line with its config,
+// starting, stopping and restarting them as the config changes.
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/cloud"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/host"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/logs"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/config"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/ml"
+)
+
+// Spec is a collector a config asks for. Key covers every setting the
+// collector is built from, so a different Key means a restart.
+type Spec struct {
+	Key string
+	New func() core.Collector
+}
+
+// Builder maps a config to the collectors it enables, keyed by collector
+// name.
+type Builder func(cfg *config.Config) map[string]Spec
+
+type Supervisor struct {
+	agent *core.Agent
+	build Builder
+
+	mu    sync.Mutex
+	specs map[string]Spec
+}
+
+var ErrNotRunning = errors.New("collector is not running")
+
+func New(agent *core.Agent, build Builder) *Supervisor {
+	return &Supervisor{agent: agent, build: build, specs: make(map[string]Spec)}
+}
+
+// Apply makes the agent run the collectors cfg enables. Collectors whose
+// settings are unchanged keep running.
+func (s *Supervisor) Apply(cfg *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := s.build(cfg)
+	for name, running := range s.specs {
+		if spec, ok := want[name]; !ok || spec.Key != running.Key {
+			s.agent.Unregister(name)
+			delete(s.specs, name)
+		}
+	}
+	for name, spec := range want {
+		if _, ok := s.specs[name]; ok {
+			continue
+		}
+		s.agent.Register(spec.New())
+		s.specs[name] = spec
+	}
+	s.agent.SetHeartbeatInterval(time.Duration(cfg.HeartbeatInterval) * time.Second)
+}
+
+// Restart replaces the named collector with a fresh one built from the same
+// settings.
+func (s *Supervisor) Restart(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spec, ok := s.specs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRunning, name)
+	}
+	s.agent.Unregister(name)
+	s.agent.Register(spec.New())
+	return nil
+}
+
+// Collectors is the Builder for the agent's real collectors.
+func Collectors(cfg *config.Config) map[string]Spec {
+	specs := make(map[string]Spec)
+	if cfg.EnableLogs {
+		sources := cfg.LogSources
+		specs["logs"] = Spec{
+			Key: fmt.Sprint(sources),
+			New: func() core.Collector { return logs.NewLogCollector(sources, "") },
+		}
+	}
+	if cfg.EnableNetwork {
+		iface := cfg.NetworkInterface
+		capture := network.CaptureConfig{Mode: cfg.CaptureMode, File: cfg.CaptureFile, Filter: cfg.CaptureFilter}
+		procRoot, expected := cfg.ProcRoot, cfg.ExpectedPorts
+		specs["network"] = Spec{
+			Key: fmt.Sprint(iface, capture, procRoot, expected),
+			New: func() core.Collector {
+				c := network.NewCaptureCollector(iface, capture)
+				c.SetProcRoot(procRoot)
+				c.SetExpectedPorts(expected)
+				return c
+			},
+		}
+	}
+	if cfg.EnableCloud {
+		provider := cfg.CloudProvider
+		specs["cloud"] = Spec{
+			Key: provider,
+			New: func() core.Collector { return cloud.NewCloudCollector(provider, 0) },
+		}
+	}
+	if cfg.EnableMetrics {
+		procRoot, interval := cfg.ProcRoot, cfg.MetricsInterval
+		specs["metrics"] = Spec{
+			Key: fmt.Sprint(procRoot, interval),
+			New: func() core.Collector {
+				detector := ml.NewAnomalyDetector(3.0, 1.5, 30, 100)
+				return host.NewMetricsCollector(procRoot, "/", interval, detector)
+			},
+		}
+	}
+	return specs
+}
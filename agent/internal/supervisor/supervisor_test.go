@@ -0,0 +1,147 @@
+package supervisor_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/config"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/supervisor"
+)
+
+type fakeCollector struct {
+	name string
+	key  string
+	log  *lifecycle
+}
+
+type lifecycle struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *lifecycle) add(e string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *lifecycle) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := l.events
+	l.events = nil
+	return out
+}
+
+func (c *fakeCollector) Name() string { return c.name }
+func (c *fakeCollector) Start(ctx context.Context, ch chan<- core.Event) error {
+	c.log.add("start " + c.name + " " + c.key)
+	<-ctx.Done()
+	return nil
+}
+func (c *fakeCollector) Stop() error {
+	c.log.add("stop " + c.name + " " + c.key)
+	return nil
+}
+
+func builder(log *lifecycle) supervisor.Builder {
+	return func(cfg *config.Config) map[string]supervisor.Spec {
+		specs := map[string]supervisor.Spec{}
+		add := func(name, key string) {
+			specs[name] = supervisor.Spec{Key: key, New: func() core.Collector {
+				return &fakeCollector{name: name, key: key, log: log}
+			}}
+		}
+		if cfg.EnableLogs {
+			add("logs", cfg.LogSources[0])
+		}
+		if cfg.EnableNetwork {
+			add("network", cfg.NetworkInterface)
+		}
+		return specs
+	}
+}
+
+func settle(log *lifecycle) []string {
+	time.Sleep(50 * time.Millisecond)
+	return log.take()
+}
+
+func TestApplyReconcilesCollectors(t *testing.T) {
+	log := &lifecycle{}
+	agent := core.New("agent-1", "org-1", "http://localhost:8080", nil, 30)
+	sup := supervisor.New(agent, builder(log))
+
+	cfg := &config.Config{EnableLogs: true, LogSources: []string{"/var/log/syslog"}, EnableNetwork: true, NetworkInterface: "eth0", HeartbeatInterval: 30}
+	sup.Apply(cfg)
+	agent.Start(context.Background())
+	defer agent.Stop()
+	if got := settle(log); len(got) != 2 {
+		t.Fatalf("expected both collectors to start, got %v", got)
+	}
+
+	// Same settings: nothing restarts.
+	sup.Apply(cfg)
+	if got := settle(log); len(got) != 0 {
+		t.Errorf("expected no changes, got %v", got)
+	}
+
+	next := *cfg
+	next.NetworkInterface = "eth1"
+	sup.Apply(&next)
+	got := settle(log)
+	if len(got) != 2 || got[0] != "stop network eth0" || got[1] != "start network eth1" {
+		t.Errorf("expected only the network collector to restart, got %v", got)
+	}
+
+	next.EnableLogs = false
+	sup.Apply(&next)
+	if got := settle(log); len(got) != 1 || got[0] != "stop logs /var/log/syslog" {
+		t.Errorf("expected the log collector to stop, got %v", got)
+	}
+	if agent.CollectorCount() != 1 {
+		t.Errorf("expected 1 collector, got %d", agent.CollectorCount())
+	}
+}
+
+func TestCollectorsFollowsConfig(t *testing.T) {
+	specs := supervisor.Collectors(&config.Config{EnableLogs: true, EnableMetrics: true, MetricsInterval: time.Minute, ProcRoot: "/proc"})
+	if len(specs) != 2 {
+		t.Fatalf("expected logs and metrics, got %d specs", len(specs))
+	}
+	for name, spec := range specs {
+		if c := spec.New(); c.Name() != name {
+			t.Errorf("spec %q builds collector named %q", name, c.Name())
+		}
+	}
+
+	a := supervisor.Collectors(&config.Config{EnableMetrics: true, MetricsInterval: time.Minute})
+	b := supervisor.Collectors(&config.Config{EnableMetrics: true, MetricsInterval: 2 * time.Minute})
+	if a["metrics"].Key == b["metrics"].Key {
+		t.Error("expected a new metrics interval to change the key")
+	}
+}
+
+func TestRestartRebuildsTheCollector(t *testing.T) {
+	log := &lifecycle{}
+	agent := core.New("agent-1", "org-1", "http://localhost:8080", nil, 30)
+	sup := supervisor.New(agent, builder(log))
+	sup.Apply(&config.Config{EnableNetwork: true, NetworkInterface: "eth0", HeartbeatInterval: 30})
+	agent.Start(context.Background())
+	defer agent.Stop()
+	settle(log)
+
+	if err := sup.Restart("network"); err != nil {
+		t.Fatalf("restart failed: %v", err)
+	}
+	if got := settle(log); len(got) != 2 || got[0] != "stop network eth0" || got[1] != "start network eth0" {
+		t.Errorf("expected the network collector to stop and start again, got %v", got)
+	}
+	if err := sup.Restart("logs"); !errors.Is(err, supervisor.ErrNotRunning) {
+		t.Errorf("expected ErrNotRunning for a disabled collector, got %v", err)
+	}
+}
@@ -2,27 +2,51 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
-	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/cloud"
-	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/logs"
-	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/collectors/network"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/command"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/config"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/enroll"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/remote"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/response"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/spool"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/agent/internal/supervisor"
 	"github.com/nats-io/nats.go"
 )
 
 func main() {
 	cfg := config.Load()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	creds, err := loadCredentials(ctx, cfg)
+	switch {
+	case err == nil:
+		cfg.AgentID, cfg.OrgID = creds.AgentID, creds.OrgID
+	case errors.Is(err, os.ErrNotExist):
+		log.Printf("warning: agent is not enrolled (no %s and no ENROLLMENT_TOKEN); heartbeats will be rejected", cfg.CredentialsFile)
+	default:
+		log.Fatalf("failed to load agent credentials: %v", err)
+	}
+
 	var nc *nats.Conn
-	var err error
 
-	opts := []nats.Option{}
-	if cfg.NATSToken != "" {
+	opts := []nats.Option{
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true),
+		nats.ReconnectBufSize(-1),
+	}
+	if creds != nil && creds.NATSOptions() != nil {
+		opts = append(opts, creds.NATSOptions()...)
+		go creds.KeepFresh(ctx, cfg.APIURL, cfg.CredentialsFile)
+	} else if cfg.NATSToken != "" {
 		opts = append(opts, nats.Token(cfg.NATSToken))
 	}
 
@@ -33,32 +57,72 @@ func main() {
 	defer nc.Close()
 
 	agent := core.New(cfg.AgentID, cfg.OrgID, cfg.APIURL, nc, cfg.HeartbeatInterval)
-
-	if cfg.EnableLogs {
-		logCollector := logs.NewLogCollector(cfg.LogSources, "")
-		agent.Register(logCollector)
-		log.Println("registered log collector")
+	if creds != nil {
+		agent.SetAPIToken(creds.Token)
 	}
 
-	if cfg.EnableNetwork {
-		netCollector := network.NewNetworkCollector(cfg.NetworkInterface)
-		agent.Register(netCollector)
-		log.Println("registered network collector")
+	if cfg.SpoolDir != "" {
+		sp, err := spool.Open(cfg.SpoolDir, spool.Options{
+			MaxBytes: cfg.SpoolMaxBytes,
+			MaxAge:   cfg.SpoolMaxAge,
+		})
+		if err != nil {
+			log.Fatalf("failed to open event spool: %v", err)
+		}
+		defer sp.Close()
+		agent.UseSpool(sp)
+		log.Printf("event spool at %s (%d events pending)", cfg.SpoolDir, sp.Depth())
 	}
 
-	if cfg.EnableCloud {
-		cloudCollector := cloud.NewCloudCollector(cfg.CloudProvider, 0)
-		agent.Register(cloudCollector)
-		log.Println("registered cloud collector for " + cfg.CloudProvider)
-	}
+	sup := supervisor.New(agent, supervisor.Collectors)
+	sup.Apply(cfg)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Remote config needs the agent's own credential to fetch it.
+	if creds != nil {
+		syncer := remote.New(cfg.APIURL, creds.AgentID, creds.Token,
+			func(overrides map[string]interface{}) error {
+				next, err := cfg.WithOverrides(overrides)
+				if err != nil {
+					return err
+				}
+				sup.Apply(next)
+				return nil
+			},
+			agent.SetConfigStatus,
+		)
+		if err := syncer.Fetch(ctx); err != nil {
+			log.Printf("warning: running on local config: %v", err)
+		}
+		if _, err := syncer.Subscribe(nc); err != nil {
+			log.Printf("warning: config pushes disabled: %v", err)
+		}
+		agent.OnConfigVersion(syncer.Offer)
+	}
 
 	if err := agent.Start(ctx); err != nil {
 		log.Fatalf("failed to start agent: %v", err)
 	}
 
+	responder, err := startResponse(ctx, cfg, agent)
+	if err != nil {
+		log.Fatalf("failed to set up response actions: %v", err)
+	}
+
+	responseDone := make(chan struct{})
+	go func() {
+		defer close(responseDone)
+		if responder != nil {
+			responder.Run(ctx)
+		}
+	}()
+
+	commands := command.NewServer()
+	command.RegisterBuiltins(commands, agent, sup)
+	command.RegisterResponse(commands, responder)
+	if _, err := commands.Subscribe(ctx, nc, command.Subject(cfg.OrgID, cfg.AgentID)); err != nil {
+		log.Printf("warning: remote commands disabled: %v", err)
+	}
+
 	log.Printf("Shield Agent started (id=%s, org=%s)", cfg.AgentID, cfg.OrgID)
 
 	sigCh := make(chan os.Signal, 1)
@@ -67,4 +131,77 @@ func main() {
 
 	log.Println("shutting down agent...")
 	agent.Stop()
+	// Lift active blocks before exiting.
+	cancel()
+	<-responseDone
+}
+
+// loadCredentials reads the saved agent credentials, enrolling first when
+// there are none and an enrollment token is configured.
+func loadCredentials(ctx context.Context, cfg *config.Config) (*enroll.Credentials, error) {
+	creds, err := enroll.Load(cfg.CredentialsFile)
+	if !errors.Is(err, os.ErrNotExist) || cfg.EnrollmentToken == "" {
+		return creds, err
+	}
+
+	hostname, _ := os.Hostname()
+	name := cfg.AgentName
+	if name == "" {
+		name = hostname
+	}
+	creds, err = enroll.Enroll(ctx, cfg.APIURL, cfg.EnrollmentToken, name, hostname)
+	if err != nil {
+		return nil, err
+	}
+	if err := creds.Save(cfg.CredentialsFile); err != nil {
+		return nil, fmt.Errorf("save credentials: %w", err)
+	}
+	log.Printf("enrolled as agent %s", creds.AgentID)
+	return creds, nil
+}
+
+// startResponse sets up firewall response actions when they are enabled,
+// and returns nil when they are not. The caller runs the responder.
+func startResponse(ctx context.Context, cfg *config.Config, agent *core.Agent) (*response.Responder, error) {
+	if !cfg.ResponseEnabled {
+		return nil, nil
+	}
+	allow, err := response.ParseAllowlist(cfg.ResponseAllowlist)
+	if err != nil {
+		return nil, err
+	}
+	audit, err := os.OpenFile(cfg.ResponseAuditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	var fw response.Firewall
+	if !cfg.ResponseDryRun {
+		if fw, err = response.Detect(ctx, response.ExecRunner{}, cfg.ResponseBackend); err != nil {
+			return nil, err
+		}
+	}
+	events := agent.EventChannel()
+	responder, err := response.New(response.Options{
+		Firewall:   fw,
+		Allowlist:  allow,
+		DefaultTTL: cfg.ResponseDefaultTTL,
+		MaxTTL:     cfg.ResponseMaxTTL,
+		DryRun:     cfg.ResponseDryRun,
+		Audit:      audit,
+		Emit: func(e core.Event) {
+			select {
+			case events <- e:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := responder.Setup(ctx); err != nil {
+		return nil, err
+	}
+	log.Printf("response actions enabled (dry_run=%t, %d allowlisted ranges)", cfg.ResponseDryRun, len(allow))
+	return responder, nil
 }
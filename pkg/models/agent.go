@@ -3,12 +3,20 @@ package models
 import "time"
 
 type Agent struct {
-	ID            string                 `json:"id" db:"id"`
-	OrgID         string                 `json:"org_id" db:"org_id"`
-	Name          string                 `json:"name" db:"name"`
-	Status        string                 `json:"status" db:"status"`
-	LastHeartbeat *time.Time             `json:"last_heartbeat" db:"last_heartbeat"`
-	Config        map[string]interface{} `json:"config" db:"config"`
-	CreatedAt     time.Time              `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time              `json:"updated_at" db:"updated_at"`
+	ID                   string                 `json:"id" db:"id"`
+	OrgID                string                 `json:"org_id" db:"org_id"`
+	Name                 string                 `json:"name" db:"name"`
+	Status               string                 `json:"status" db:"status"`
+	LastHeartbeat        *time.Time             `json:"last_heartbeat" db:"last_heartbeat"`
+	Config               map[string]interface{} `json:"config" db:"config"`
+	Hostname             string                 `json:"hostname" db:"hostname"`
+	EnrolledAt           *time.Time             `json:"enrolled_at" db:"enrolled_at"`
+	RevokedAt            *time.Time             `json:"revoked_at" db:"revoked_at"`
+	ConfigVersion        int64                  `json:"config_version" db:"config_version"`
+	AppliedConfigVersion int64                  `json:"applied_config_version" db:"applied_config_version"`
+	ConfigError          *string                `json:"config_error" db:"config_error"`
+	Version              string                 `json:"version" db:"agent_version"`
+	Health               map[string]interface{} `json:"health" db:"health"`
+	CreatedAt            time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt            time.Time              `json:"updated_at" db:"updated_at"`
 }
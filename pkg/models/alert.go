@@ -16,14 +16,23 @@ type Alert struct {
 	SourceEvents   []string  `json:"source_events" db:"source_events"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+
+	Category        string                 `json:"category" db:"category"`
+	Source          string                 `json:"source" db:"source"`
+	RiskScore       float32                `json:"risk_score" db:"risk_score"`
+	EventCount      int                    `json:"event_count" db:"event_count"`
+	Payload         map[string]interface{} `json:"payload" db:"payload"`
+	Fingerprint     *string                `json:"fingerprint" db:"fingerprint"`
+	OccurrenceCount int                    `json:"occurrence_count" db:"occurrence_count"`
+	LastSeenAt      time.Time              `json:"last_seen_at" db:"last_seen_at"`
 }
 
 type AlertRule struct {
-	ID                string    `json:"id" db:"id"`
-	OrgID             string    `json:"org_id" db:"org_id"`
-	Name              string    `json:"name" db:"name"`
-	SeverityThreshold string    `json:"severity_threshold" db:"severity_threshold"`
-	Channels          []string  `json:"channels" db:"channels"`
-	Enabled           bool      `json:"enabled" db:"enabled"`
-	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	ID                string                   `json:"id" db:"id"`
+	OrgID             string                   `json:"org_id" db:"org_id"`
+	Name              string                   `json:"name" db:"name"`
+	SeverityThreshold string                   `json:"severity_threshold" db:"severity_threshold"`
+	Channels          []map[string]interface{} `json:"channels" db:"channels"`
+	Enabled           bool                     `json:"enabled" db:"enabled"`
+	CreatedAt         time.Time                `json:"created_at" db:"created_at"`
 }
@@ -0,0 +1,3 @@
+module github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets
+
+go 1.22
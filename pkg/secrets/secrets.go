@@ -0,0 +1,99 @@
+// Package secrets encrypts small values such as webhook URLs and API keys
+// for storage. Sealed values are "enc:v1:" followed by the base64 of the
+// AES-256-GCM nonce and ciphertext. The API seals and the engine opens, so
+// both import this package rather than keeping their own copy.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const prefix = "enc:v1:"
+
+var ErrNoKey = errors.New("secrets key is not configured")
+
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox takes a 32-byte key. An empty key yields a Box that cannot seal or
+// open anything, so callers can fail closed instead of storing plaintext.
+func NewBox(key []byte) (*Box, error) {
+	if len(key) == 0 {
+		return &Box{}, nil
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secrets key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// ParseKey decodes a base64 key as found in SECRETS_KEY.
+func ParseKey(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode secrets key: %w", err)
+	}
+	return key, nil
+}
+
+func (b *Box) Enabled() bool {
+	return b != nil && b.aead != nil
+}
+
+func (b *Box) Seal(plaintext string) (string, error) {
+	if !b.Enabled() {
+		return "", ErrNoKey
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a sealed value. Values without the prefix are returned
+// unchanged so rows written before encryption keep working.
+func (b *Box) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	if !b.Enabled() {
+		return "", ErrNoKey
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", fmt.Errorf("decode sealed value: %w", err)
+	}
+	n := b.aead.NonceSize()
+	if len(data) < n {
+		return "", errors.New("sealed value too short")
+	}
+	plaintext, err := b.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("open sealed value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
@@ -0,0 +1,84 @@
+package secrets_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+)
+
+func testBox(t *testing.T, fill byte) *secrets.Box {
+	t.Helper()
+	b, err := secrets.NewBox(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	b := testBox(t, 1)
+	sealed, err := b.Seal("https://hooks.slack.com/services/T000/B000/XXXX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secrets.IsSealed(sealed) || strings.Contains(sealed, "hooks.slack.com") {
+		t.Errorf("expected opaque sealed value, got %q", sealed)
+	}
+
+	again, _ := b.Seal("https://hooks.slack.com/services/T000/B000/XXXX")
+	if again == sealed {
+		t.Error("expected a fresh nonce per seal")
+	}
+
+	opened, err := b.Open(sealed)
+	if err != nil || opened != "https://hooks.slack.com/services/T000/B000/XXXX" {
+		t.Errorf("got %q, %v", opened, err)
+	}
+}
+
+func TestOpenPassesThroughPlaintext(t *testing.T) {
+	var b *secrets.Box
+	if got, err := b.Open("plain"); err != nil || got != "plain" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestOpenWithWrongKeyFails(t *testing.T) {
+	sealed, _ := testBox(t, 1).Seal("secret")
+	if _, err := testBox(t, 2).Open(sealed); err == nil {
+		t.Error("expected error opening with a different key")
+	}
+}
+
+func TestDisabledBoxFailsClosed(t *testing.T) {
+	b, err := secrets.NewBox(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Enabled() {
+		t.Error("expected box without key to be disabled")
+	}
+	if _, err := b.Seal("secret"); !errors.Is(err, secrets.ErrNoKey) {
+		t.Errorf("expected ErrNoKey, got %v", err)
+	}
+	if _, err := b.Open("enc:v1:AAAA"); !errors.Is(err, secrets.ErrNoKey) {
+		t.Errorf("expected ErrNoKey, got %v", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key, err := secrets.ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil || len(key) != 32 {
+		t.Fatalf("got %d bytes, %v", len(key), err)
+	}
+	if _, err := secrets.NewBox(key[:16]); err == nil {
+		t.Error("expected error for short key")
+	}
+	if _, err := secrets.ParseKey("not base64!"); err == nil {
+		t.Error("expected decode error")
+	}
+}
@@ -0,0 +1,174 @@
+package agentcreds_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agentcreds"
+	natsjwt "github.com/nats-io/jwt/v2"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := agentcreds.NewToken(agentcreds.AgentTokenPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !agentcreds.IsAgentToken(token) || agentcreds.HashToken(token) != hash || strings.Contains(hash, token) {
+		t.Errorf("unexpected token %q / hash %q", token, hash)
+	}
+	other, _, _ := agentcreds.NewToken(agentcreds.AgentTokenPrefix)
+	if other == token {
+		t.Error("expected distinct tokens")
+	}
+}
+
+func TestIssuerScopesAgentSubjects(t *testing.T) {
+	account, _ := nkeys.CreateAccount()
+	seed, _ := account.Seed()
+	accountPub, _ := account.PublicKey()
+
+	issuer, err := agentcreds.NewIssuer(string(seed), "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := nkeys.CreateUser()
+	userPub, _ := user.PublicKey()
+	token, expires, err := issuer.Issue("org-1", "agent-1", userPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := natsjwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != userPub || claims.Issuer != accountPub {
+		t.Errorf("unexpected subject/issuer %s/%s", claims.Subject, claims.Issuer)
+	}
+	if claims.Expires != expires.Unix() || time.Until(expires) > time.Hour {
+		t.Errorf("unexpected expiry %v", expires)
+	}
+	if !claims.Pub.Allow.Contains("events.org-1.agent-1") || len(claims.Pub.Allow) != 1 {
+		t.Errorf("unexpected publish permissions %v", claims.Pub.Allow)
+	}
+	if claims.Sub.Allow.Contains("_INBOX.>") || !claims.Sub.Allow.Contains("_INBOX_agent-1.>") {
+		t.Errorf("expected only the agent's own inbox, got %v", claims.Sub.Allow)
+	}
+	if !claims.Sub.Allow.Contains("agents.org-1.agent-1.cmd") || claims.Resp == nil || claims.Resp.MaxMsgs != 1 {
+		t.Errorf("expected the agent to receive and answer its commands, got sub %v resp %+v", claims.Sub.Allow, claims.Resp)
+	}
+
+	if _, _, err := issuer.Issue("org-1", "agent-1", accountPub); err == nil {
+		t.Error("expected a non-user key to be rejected")
+	}
+}
+
+func TestNewIssuerRequiresAccountSeed(t *testing.T) {
+	if issuer, err := agentcreds.NewIssuer("", "", 0); issuer != nil || err != nil {
+		t.Errorf("expected no issuer without a seed, got %v %v", issuer, err)
+	}
+	user, _ := nkeys.CreateUser()
+	seed, _ := user.Seed()
+	if _, err := agentcreds.NewIssuer(string(seed), "", 0); err == nil {
+		t.Error("expected a user seed to be rejected")
+	}
+}
+
+func TestAgentCannotReadOtherInboxes(t *testing.T) {
+	operator, _ := nkeys.CreateOperator()
+	operatorPub, _ := operator.PublicKey()
+	operatorJWT, err := natsjwt.NewOperatorClaims(operatorPub).Encode(operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operatorClaims, _ := natsjwt.DecodeOperatorClaims(operatorJWT)
+
+	account, _ := nkeys.CreateAccount()
+	accountPub, _ := account.PublicKey()
+	accountSeed, _ := account.Seed()
+	accountJWT, err := natsjwt.NewAccountClaims(accountPub).Encode(operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := &natsserver.MemAccResolver{}
+	resolver.Store(accountPub, accountJWT)
+
+	ns, err := natsserver.NewServer(&natsserver.Options{
+		Port:             -1,
+		TrustedOperators: []*natsjwt.OperatorClaims{operatorClaims},
+		AccountResolver:  resolver,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	// The API side runs as an unrestricted user of the same account.
+	apiUser, _ := nkeys.CreateUser()
+	apiPub, _ := apiUser.PublicKey()
+	apiJWT, _ := natsjwt.NewUserClaims(apiPub).Encode(account)
+	apiConn, err := nats.Connect(ns.ClientURL(), nats.UserJWT(
+		func() (string, error) { return apiJWT, nil },
+		func(nonce []byte) ([]byte, error) { return apiUser.Sign(nonce) },
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(apiConn.Close)
+
+	issuer, err := agentcreds.NewIssuer(string(accountSeed), "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _ := nkeys.CreateUser()
+	userPub, _ := user.PublicKey()
+	token, _, err := issuer.Issue("org-1", "agent-1", userPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied := make(chan string, 4)
+	agentConn, err := nats.Connect(ns.ClientURL(),
+		nats.CustomInboxPrefix(agentcreds.InboxPrefix("agent-1")),
+		nats.UserJWT(
+			func() (string, error) { return token, nil },
+			func(nonce []byte) ([]byte, error) { return user.Sign(nonce) },
+		),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			denied <- err.Error()
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(agentConn.Close)
+
+	// Replies to the agent's own requests still reach it.
+	apiConn.Subscribe("events.org-1.agent-1", func(m *nats.Msg) { m.Respond([]byte("ack")) })
+	apiConn.Flush()
+	if msg, err := agentConn.Request("events.org-1.agent-1", []byte("{}"), 2*time.Second); err != nil || string(msg.Data) != "ack" {
+		t.Fatalf("expected a reply on the agent's inbox, got %v", err)
+	}
+
+	for _, subject := range []string{"_INBOX.>", agentcreds.InboxPrefix("agent-2") + ".>"} {
+		if _, err := agentConn.SubscribeSync(subject); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-denied:
+			if !strings.Contains(msg, "Permissions Violation") || !strings.Contains(msg, subject) {
+				t.Errorf("unexpected error subscribing to %s: %s", subject, msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("expected the subscription to %s to be denied", subject)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package agentcreds
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// Issuer signs NATS user JWTs for enrolled agents with an account signing
+// key. It is only used when NATS runs in operator (JWT) mode; with token
+// auth agents keep using the shared NATS_TOKEN.
+type Issuer struct {
+	signer  nkeys.KeyPair
+	account string
+	ttl     time.Duration
+}
+
+// NewIssuer returns nil when seed is empty. account is the public key of
+// the account the signing key belongs to; leave it empty when seed is the
+// account's own key.
+func NewIssuer(seed, account string, ttl time.Duration) (*Issuer, error) {
+	if seed == "" {
+		return nil, nil
+	}
+	kp, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return nil, fmt.Errorf("parse account seed: %w", err)
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !nkeys.IsValidPublicAccountKey(pub) {
+		return nil, errors.New("seed is not an account key")
+	}
+	if account != "" && !nkeys.IsValidPublicAccountKey(account) {
+		return nil, errors.New("invalid account public key")
+	}
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Issuer{signer: kp, account: account, ttl: ttl}, nil
+}
+
+// replyWindow is how long an agent may take to answer a command; it
+// covers the longest command timeout the API allows.
+const replyWindow = 3 * time.Minute
+
+// InboxPrefix is the reply inbox prefix an agent connects with
+// (nats.CustomInboxPrefix). Each agent gets its own so it cannot read
+// replies meant for the API or for other agents.
+func InboxPrefix(agentID string) string {
+	return "_INBOX_" + agentID
+}
+
+// Subjects returns what an agent may publish to and subscribe on. Replies to
+// commands are allowed separately through the JWT's response permission.
+func Subjects(orgID, agentID string) (pub, sub []string) {
+	return []string{fmt.Sprintf("events.%s.%s", orgID, agentID)},
+		[]string{InboxPrefix(agentID) + ".>", fmt.Sprintf("agents.%s.config", agentID), fmt.Sprintf("agents.%s.%s.cmd", orgID, agentID)}
+}
+
+// Issue signs a user JWT for the agent's public user nkey. JWTs expire
+// after the issuer's TTL, so a revoked agent loses NATS access once its
+// last JWT runs out.
+func (i *Issuer) Issue(orgID, agentID, userKey string) (string, time.Time, error) {
+	if !ValidUserKey(userKey) {
+		return "", time.Time{}, errors.New("invalid user nkey")
+	}
+	expires := time.Now().Add(i.ttl).Truncate(time.Second)
+
+	claims := natsjwt.NewUserClaims(userKey)
+	claims.Name = agentID
+	claims.Expires = expires.Unix()
+	if i.account != "" {
+		claims.IssuerAccount = i.account
+	}
+	pub, sub := Subjects(orgID, agentID)
+	claims.Pub.Allow.Add(pub...)
+	claims.Sub.Allow.Add(sub...)
+	claims.Resp = &natsjwt.ResponsePermission{MaxMsgs: 1, Expires: replyWindow}
+	claims.Tags.Add("org:"+orgID, "agent:"+agentID)
+
+	token, err := claims.Encode(i.signer)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("sign user jwt: %w", err)
+	}
+	return token, expires, nil
+}
+
+func ValidUserKey(key string) bool {
+	return nkeys.IsValidPublicUserKey(key)
+}
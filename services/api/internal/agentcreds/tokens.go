@@ -0,0 +1,37 @@
+// Package agentcreds issues the credentials agents enroll with and
+// authenticate by: one-time enrollment tokens, per-agent API tokens and
+// NATS user JWTs scoped to the agent's own subjects.
+package agentcreds
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	EnrollmentPrefix = "enr_"
+	AgentTokenPrefix = "agt_"
+)
+
+// NewToken returns a random token with prefix and the hash to store for it.
+// Tokens are only ever shown once; the database keeps the hash.
+func NewToken(prefix string) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAgentToken(token string) bool {
+	return strings.HasPrefix(token, AgentTokenPrefix)
+}
@@ -0,0 +1,265 @@
+package agenthealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	DefaultStaleAfter   = 90 * time.Second
+	DefaultOfflineAfter = 5 * time.Minute
+	DefaultInterval     = 30 * time.Second
+)
+
+// AlertSubject is the NATS subject the engine ingests alerts on; it must
+// match alerts.IngestSubject in the engine.
+const AlertSubject = "alerts.ingest"
+
+// alertWait bounds how long a sweep waits for the engine to take an alert.
+const alertWait = 5 * time.Second
+
+// Querier is the subset of *pgxpool.Pool the sweeper needs.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Requester sends a request and waits for its reply, as messaging.Bus does.
+type Requester interface {
+	Request(subject string, data []byte, timeout time.Duration) ([]byte, error)
+}
+
+// Transition is an agent the sweeper moved to a worse status.
+type Transition struct {
+	AgentID       string
+	OrgID         string
+	Name          string
+	From          string
+	To            string
+	LastHeartbeat time.Time
+}
+
+// Fingerprint identifies the open alert for an agent being in status, so a
+// repeat transition folds into it and a heartbeat can resolve it.
+func Fingerprint(agentID, status string) string {
+	return "agent-" + status + ":" + agentID
+}
+
+// Alert is the alert raised for a transition.
+type Alert struct {
+	Severity    string
+	Title       string
+	Description string
+	Fingerprint string
+	Payload     map[string]interface{}
+}
+
+func (t Transition) Alert() Alert {
+	severity := "medium"
+	if t.To == "offline" {
+		severity = "high"
+	}
+	silent := "never sent a heartbeat"
+	if !t.LastHeartbeat.IsZero() {
+		silent = "last heartbeat " + t.LastHeartbeat.UTC().Format(time.RFC3339)
+	}
+	return Alert{
+		Severity:    severity,
+		Title:       fmt.Sprintf("Agent %s is %s", t.Name, t.To),
+		Description: fmt.Sprintf("Agent %s (%s) went from %s to %s; %s.", t.Name, t.AgentID, t.From, t.To, silent),
+		Fingerprint: Fingerprint(t.AgentID, t.To),
+		Payload: map[string]interface{}{
+			"agent_id":       t.AgentID,
+			"from":           t.From,
+			"to":             t.To,
+			"last_heartbeat": t.LastHeartbeat,
+		},
+	}
+}
+
+// Sweeper marks agents stale once no heartbeat arrived for StaleAfter and
+// offline after OfflineAfter, raising an alert for each transition.
+type Sweeper struct {
+	db           Querier
+	alerts       Requester
+	staleAfter   time.Duration
+	offlineAfter time.Duration
+}
+
+func New(db Querier, staleAfter, offlineAfter time.Duration) (*Sweeper, error) {
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	if offlineAfter <= 0 {
+		offlineAfter = DefaultOfflineAfter
+	}
+	if offlineAfter <= staleAfter {
+		return nil, fmt.Errorf("offline threshold %s must exceed stale threshold %s", offlineAfter, staleAfter)
+	}
+	return &Sweeper{db: db, staleAfter: staleAfter, offlineAfter: offlineAfter}, nil
+}
+
+// SendAlertsTo raises transition alerts through the engine, which stores
+// them and hands them to notifications and playbooks like any other alert.
+// Alerts the engine does not take are written to the alerts table directly.
+// Call before Run.
+func (s *Sweeper) SendAlertsTo(r Requester) {
+	s.alerts = r
+}
+
+// Run sweeps every interval until ctx is done.
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				log.Printf("agent sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+// Offline goes first so an agent silent past both thresholds (say, after
+// the API was down) moves straight to offline instead of stopping at stale.
+const markSQL = `
+UPDATE agents a SET status = $1, updated_at = NOW()
+FROM (SELECT id, status FROM agents
+      WHERE revoked_at IS NULL AND status = ANY($2) AND last_heartbeat < $3
+      FOR UPDATE) prev
+WHERE a.id = prev.id
+RETURNING a.id, a.org_id, a.name, prev.status, a.last_heartbeat`
+
+const raiseSQL = `
+INSERT INTO alerts (id, org_id, agent_id, severity, title, description, status,
+	category, source, payload, fingerprint, created_at, last_seen_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, 'open', 'agent_health', 'api', $7, $8, NOW(), NOW(), NOW())
+ON CONFLICT (org_id, fingerprint) WHERE status <> 'resolved' DO UPDATE SET
+	occurrence_count = alerts.occurrence_count + 1,
+	last_seen_at = NOW(),
+	description = EXCLUDED.description,
+	updated_at = NOW()`
+
+// Sweep applies both thresholds once and returns the transitions it made.
+func (s *Sweeper) Sweep(ctx context.Context) ([]Transition, error) {
+	now := time.Now()
+	offline, err := s.mark(ctx, "offline", []string{"online", "stale"}, now.Add(-s.offlineAfter))
+	if err != nil {
+		return nil, err
+	}
+	stale, err := s.mark(ctx, "stale", []string{"online"}, now.Add(-s.staleAfter))
+	if err != nil {
+		return offline, err
+	}
+
+	transitions := append(offline, stale...)
+	for _, t := range transitions {
+		log.Printf("agent %s (%s) is %s", t.Name, t.AgentID, t.To)
+		if err := s.raise(ctx, t); err != nil {
+			log.Printf("failed to raise alert for agent %s: %v", t.AgentID, err)
+		}
+	}
+	return transitions, nil
+}
+
+func (s *Sweeper) mark(ctx context.Context, to string, from []string, cutoff time.Time) ([]Transition, error) {
+	rows, err := s.db.Query(ctx, markSQL, to, from, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("mark agents %s: %w", to, err)
+	}
+	defer rows.Close()
+
+	var transitions []Transition
+	for rows.Next() {
+		t := Transition{To: to}
+		var last *time.Time
+		if err := rows.Scan(&t.AgentID, &t.OrgID, &t.Name, &t.From, &last); err != nil {
+			return nil, fmt.Errorf("scan agent: %w", err)
+		}
+		if last != nil {
+			t.LastHeartbeat = *last
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
+
+func (s *Sweeper) raise(ctx context.Context, t Transition) error {
+	a := t.Alert()
+	if s.alerts != nil {
+		err := s.send(t, a)
+		if err == nil {
+			return nil
+		}
+		log.Printf("engine did not take alert for agent %s, writing it directly: %v", t.AgentID, err)
+	}
+	payload, _ := json.Marshal(a.Payload)
+	_, err := s.db.Exec(ctx, raiseSQL,
+		uuid.NewString(), t.OrgID, t.AgentID, a.Severity, a.Title, a.Description, payload, a.Fingerprint)
+	return err
+}
+
+// ingestAlert is the subset of the engine's alert the sweeper fills in.
+type ingestAlert struct {
+	ID          string                 `json:"id"`
+	OrgID       string                 `json:"org_id"`
+	AgentID     string                 `json:"agent_id"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	Severity    string                 `json:"severity"`
+	Category    string                 `json:"category"`
+	Status      string                 `json:"status"`
+	Source      string                 `json:"source"`
+	EventCount  int                    `json:"event_count"`
+	Payload     map[string]interface{} `json:"payload"`
+	Fingerprint string                 `json:"fingerprint"`
+}
+
+func (s *Sweeper) send(t Transition, a Alert) error {
+	data, err := json.Marshal(ingestAlert{
+		ID:          uuid.NewString(),
+		OrgID:       t.OrgID,
+		AgentID:     t.AgentID,
+		Title:       a.Title,
+		Description: a.Description,
+		Severity:    a.Severity,
+		Category:    "agent_health",
+		Status:      "open",
+		Source:      "api",
+		EventCount:  1,
+		Payload:     a.Payload,
+		Fingerprint: a.Fingerprint,
+	})
+	if err != nil {
+		return err
+	}
+	replyData, err := s.alerts.Request(AlertSubject, data, alertWait)
+	if err != nil {
+		return err
+	}
+	var reply struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(replyData, &reply); err != nil {
+		return fmt.Errorf("invalid reply: %w", err)
+	}
+	if reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+	return nil
+}
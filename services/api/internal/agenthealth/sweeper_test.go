@@ -0,0 +1,235 @@
+package agenthealth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agenthealth"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type fakeAgent struct {
+	id, orgID, name, status string
+	lastHeartbeat           time.Time
+}
+
+// fakeDB plays the agents table for the sweeper's mark query and records
+// the fingerprints of alerts written directly.
+type fakeDB struct {
+	agents []*fakeAgent
+	raised []string
+}
+
+func (db *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	to, from, cutoff := args[0].(string), args[1].([]string), args[2].(time.Time)
+	rows := &fakeRows{}
+	for _, a := range db.agents {
+		if slices.Contains(from, a.status) && a.lastHeartbeat.Before(cutoff) {
+			last := a.lastHeartbeat
+			rows.values = append(rows.values, []any{a.id, a.orgID, a.name, a.status, &last})
+			a.status = to
+		}
+	}
+	return rows, nil
+}
+
+func (db *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	db.raised = append(db.raised, args[7].(string))
+	return pgconn.CommandTag{}, nil
+}
+
+type fakeRows struct {
+	values [][]any
+	i      int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) Next() bool                                   { r.i++; return r.i <= len(r.values) }
+func (r *fakeRows) Values() ([]any, error)                       { return r.values[r.i-1], nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[r.i-1][i]))
+	}
+	return nil
+}
+
+// fakeEngine answers alert ingest requests the way the engine does.
+type fakeEngine struct {
+	alerts []map[string]interface{}
+	err    error
+}
+
+func (e *fakeEngine) Request(subject string, data []byte, timeout time.Duration) ([]byte, error) {
+	if subject != agenthealth.AlertSubject {
+		return nil, errors.New("unexpected subject " + subject)
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	var a map[string]interface{}
+	json.Unmarshal(data, &a)
+	e.alerts = append(e.alerts, a)
+	return []byte(`{}`), nil
+}
+
+func newSweeper(t *testing.T, db *fakeDB) *agenthealth.Sweeper {
+	t.Helper()
+	s, err := agenthealth.New(db, time.Minute, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func statuses(ts []agenthealth.Transition) map[string]string {
+	out := make(map[string]string, len(ts))
+	for _, t := range ts {
+		out[t.AgentID] = t.From + "->" + t.To
+	}
+	return out
+}
+
+func TestNewRejectsOfflineBeforeStale(t *testing.T) {
+	if _, err := agenthealth.New(nil, time.Minute, 30*time.Second); err == nil {
+		t.Error("expected an error when offline comes before stale")
+	}
+	if _, err := agenthealth.New(nil, 0, 0); err != nil {
+		t.Errorf("expected defaults to be valid, got %v", err)
+	}
+}
+
+func TestTransitionAlert(t *testing.T) {
+	last := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	stale := agenthealth.Transition{AgentID: "a1", OrgID: "o1", Name: "web-1", From: "online", To: "stale", LastHeartbeat: last}
+	offline := stale
+	offline.From, offline.To = "stale", "offline"
+
+	s, o := stale.Alert(), offline.Alert()
+	if s.Severity != "medium" || o.Severity != "high" {
+		t.Errorf("expected medium for stale and high for offline, got %s and %s", s.Severity, o.Severity)
+	}
+	if s.Title != "Agent web-1 is stale" {
+		t.Errorf("unexpected title %q", s.Title)
+	}
+	if s.Fingerprint == o.Fingerprint || o.Fingerprint != agenthealth.Fingerprint("a1", "offline") {
+		t.Errorf("expected one fingerprint per status, got %q and %q", s.Fingerprint, o.Fingerprint)
+	}
+	if want := "Agent web-1 (a1) went from online to stale; last heartbeat 2026-03-01T12:00:00Z."; s.Description != want {
+		t.Errorf("got description %q, want %q", s.Description, want)
+	}
+
+	never := agenthealth.Transition{AgentID: "a2", Name: "db-1", From: "online", To: "offline"}
+	if want := "Agent db-1 (a2) went from online to offline; never sent a heartbeat."; never.Alert().Description != want {
+		t.Errorf("got description %q, want %q", never.Alert().Description, want)
+	}
+}
+
+func TestSweepMarksStaleThenOffline(t *testing.T) {
+	now := time.Now()
+	quiet := &fakeAgent{id: "a1", orgID: "o1", name: "web-1", status: "online", lastHeartbeat: now.Add(-2 * time.Minute)}
+	gone := &fakeAgent{id: "a2", orgID: "o1", name: "db-1", status: "online", lastHeartbeat: now.Add(-time.Hour)}
+	healthy := &fakeAgent{id: "a3", orgID: "o1", name: "app-1", status: "online", lastHeartbeat: now}
+	db := &fakeDB{agents: []*fakeAgent{quiet, gone, healthy}}
+	s := newSweeper(t, db)
+
+	ts, err := s.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a1": "online->stale", "a2": "online->offline"}
+	if got := statuses(ts); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	quiet.lastHeartbeat = now.Add(-10 * time.Minute)
+	ts, err = s.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(ts); !reflect.DeepEqual(got, map[string]string{"a1": "stale->offline"}) {
+		t.Errorf("expected only a1 to go offline, got %v", got)
+	}
+	if healthy.status != "online" {
+		t.Errorf("expected the healthy agent to stay online, got %s", healthy.status)
+	}
+
+	wantRaised := []string{
+		agenthealth.Fingerprint("a2", "offline"),
+		agenthealth.Fingerprint("a1", "stale"),
+		agenthealth.Fingerprint("a1", "offline"),
+	}
+	if !reflect.DeepEqual(db.raised, wantRaised) {
+		t.Errorf("expected alerts %v, got %v", wantRaised, db.raised)
+	}
+}
+
+func TestSweepLeavesRecoveredAgentsAlone(t *testing.T) {
+	now := time.Now()
+	agent := &fakeAgent{id: "a1", orgID: "o1", name: "web-1", status: "online", lastHeartbeat: now.Add(-2 * time.Minute)}
+	db := &fakeDB{agents: []*fakeAgent{agent}}
+	s := newSweeper(t, db)
+
+	if ts, _ := s.Sweep(context.Background()); len(ts) != 1 {
+		t.Fatalf("expected the agent to go stale, got %v", statuses(ts))
+	}
+
+	// A heartbeat marks the agent online again.
+	agent.status, agent.lastHeartbeat = "online", now
+	ts, err := s.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 0 || len(db.raised) != 1 {
+		t.Errorf("expected no transitions or alerts after recovery, got %v and %v", statuses(ts), db.raised)
+	}
+}
+
+func TestSweepRaisesAlertsThroughEngine(t *testing.T) {
+	db := &fakeDB{agents: []*fakeAgent{
+		{id: "a1", orgID: "o1", name: "web-1", status: "online", lastHeartbeat: time.Now().Add(-time.Hour)},
+	}}
+	engine := &fakeEngine{}
+	s := newSweeper(t, db)
+	s.SendAlertsTo(engine)
+
+	if _, err := s.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.raised) != 0 {
+		t.Errorf("expected no direct alert writes, got %v", db.raised)
+	}
+	if len(engine.alerts) != 1 {
+		t.Fatalf("expected one alert sent to the engine, got %d", len(engine.alerts))
+	}
+	a := engine.alerts[0]
+	if a["fingerprint"] != agenthealth.Fingerprint("a1", "offline") || a["org_id"] != "o1" || a["agent_id"] != "a1" ||
+		a["category"] != "agent_health" || a["severity"] != "high" || a["title"] != "Agent web-1 is offline" {
+		t.Errorf("unexpected alert %v", a)
+	}
+}
+
+func TestSweepWritesAlertsWhenEngineIsUnavailable(t *testing.T) {
+	db := &fakeDB{agents: []*fakeAgent{
+		{id: "a1", orgID: "o1", name: "web-1", status: "online", lastHeartbeat: time.Now().Add(-time.Hour)},
+	}}
+	s := newSweeper(t, db)
+	s.SendAlertsTo(&fakeEngine{err: errors.New("no responders")})
+
+	if _, err := s.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(db.raised, []string{agenthealth.Fingerprint("a1", "offline")}) {
+		t.Errorf("expected the alert to be written directly, got %v", db.raised)
+	}
+}
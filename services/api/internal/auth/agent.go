@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agentcreds"
+)
+
+var (
+	ErrUnknownAgent = errors.New("unknown agent credential")
+	ErrAgentRevoked = errors.New("agent credential revoked")
+)
+
+// AgentResolver maps an agent's API token to the agent it was issued to.
+type AgentResolver interface {
+	ResolveAgent(ctx context.Context, token string) (*Identity, error)
+}
+
+// PGAgentResolver looks agents up by credential hash. Lookups are not
+// cached so that revocation takes effect on the next request.
+type PGAgentResolver struct {
+	db Querier
+}
+
+func NewPGAgentResolver(db Querier) *PGAgentResolver {
+	return &PGAgentResolver{db: db}
+}
+
+func (p *PGAgentResolver) ResolveAgent(ctx context.Context, token string) (*Identity, error) {
+	id := Identity{Role: "agent"}
+	var revoked bool
+	err := p.db.QueryRow(ctx,
+		`SELECT id, org_id, revoked_at IS NOT NULL FROM agents WHERE credential_hash = $1`,
+		agentcreds.HashToken(token),
+	).Scan(&id.AgentID, &id.OrgID, &revoked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUnknownAgent
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve agent: %w", err)
+	}
+	if revoked {
+		return nil, ErrAgentRevoked
+	}
+	return &id, nil
+}
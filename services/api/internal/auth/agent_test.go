@@ -0,0 +1,54 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+)
+
+type staticAgents map[string]error
+
+func (s staticAgents) ResolveAgent(ctx context.Context, token string) (*auth.Identity, error) {
+	err, ok := s[token]
+	if !ok {
+		return nil, auth.ErrUnknownAgent
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Identity{AgentID: "agent-1", OrgID: "org-a", Role: "agent"}, nil
+}
+
+func TestAuthenticateAgentCredential(t *testing.T) {
+	kc := newKeycloakStub(t)
+	var got *auth.Identity
+	h := auth.Authenticate(auth.Options{
+		KeycloakURL: kc.server.URL,
+		Realm:       "cybershield",
+		Agents:      staticAgents{"agt_good": nil, "agt_revoked": auth.ErrAgentRevoked},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = auth.GetIdentity(r)
+	}))
+
+	cases := map[string]int{
+		"agt_good":    http.StatusOK,
+		"agt_revoked": http.StatusUnauthorized,
+		"agt_unknown": http.StatusUnauthorized,
+	}
+	for token, code := range cases {
+		got = nil
+		req := httptest.NewRequest(http.MethodPatch, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Errorf("%s: expected %d, got %d", token, code, w.Code)
+		}
+		if code == http.StatusOK && (got == nil || got.AgentID != "agent-1" || !got.Can(auth.ReportAgent) || got.Can(auth.ReadAgents)) {
+			t.Errorf("%s: unexpected identity %+v", token, got)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keycloakStub serves a JWKS at the path Keycloak uses for realm
+// "cybershield" and signs tokens with its current key.
+type keycloakStub struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	kid     string
+	fetches atomic.Int32
+	// down makes the JWKS endpoint fail; delay slows every fetch.
+	down  atomic.Bool
+	delay atomic.Int64
+
+	mu   sync.Mutex
+	keys map[string]crypto.Signer
+}
+
+func newKeycloakStub(t *testing.T) *keycloakStub {
+	t.Helper()
+	k := &keycloakStub{keys: make(map[string]crypto.Signer)}
+	k.rotate(t, "test-key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/cybershield/protocol/openid-connect/certs", func(w http.ResponseWriter, r *http.Request) {
+		k.fetches.Add(1)
+		time.Sleep(time.Duration(k.delay.Load()))
+		if k.down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		var keys []map[string]string
+		for kid, key := range k.keys {
+			keys = append(keys, jwkOf(kid, key.Public()))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	k.server = httptest.NewServer(mux)
+	t.Cleanup(k.server.Close)
+	return k
+}
+
+func (k *keycloakStub) issuer() string {
+	return k.server.URL + "/realms/cybershield"
+}
+
+// rotate publishes a new RSA signing key under kid and signs with it from
+// now on. Older keys stay published unless retired.
+func (k *keycloakStub) rotate(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.publish(kid, key)
+	k.key, k.kid = key, kid
+}
+
+func (k *keycloakStub) publish(kid string, key crypto.Signer) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[kid] = key
+}
+
+func (k *keycloakStub) retire(kid string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, kid)
+}
+
+func (k *keycloakStub) token(t *testing.T, sub string) string {
+	t.Helper()
+	return signToken(t, k.key, k.kid, k.claims(sub))
+}
+
+func (k *keycloakStub) claims(sub string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                k.issuer(),
+		"aud":                []string{"shield-api", "account"},
+		"sub":                sub,
+		"email":              "analyst@example.com",
+		"preferred_username": "analyst",
+		"realm_access":       map[string]interface{}{"roles": []string{"admin"}},
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func signToken(t *testing.T, key crypto.Signer, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	var method jwt.SigningMethod = jwt.SigningMethodRS256
+	if ec, ok := key.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+		if ec.Curve == elliptic.P384() {
+			method = jwt.SigningMethodES384
+		}
+	}
+	tok := jwt.NewWithClaims(method, claims)
+	tok.Header["kid"] = kid
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func jwkOf(kid string, pub crypto.PublicKey) map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kid": kid, "kty": "RSA", "alg": "RS256", "use": "sig",
+			"n": b64(pub.N.Bytes()),
+			"e": b64(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kid": kid, "kty": "EC", "use": "sig",
+			"crv": pub.Curve.Params().Name,
+			"x":   b64(pub.X.FillBytes(make([]byte, size))),
+			"y":   b64(pub.Y.FillBytes(make([]byte, size))),
+		}
+	}
+	panic("unsupported key type")
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agentcreds"
+)
+
+const IdentityKey contextKey = "identity"
+
+// Identity is the resolved caller of an API request. Users act for the org
+// of their users row and agents for the org they enrolled into; the service
+// identity (the engine) is not bound to an org and says which org it acts
+// for in the request itself.
+type Identity struct {
+	UserID     string
+	KeycloakID string
+	OrgID      string
+	Email      string
+	Role       string
+	RealmRoles []string
+	Service    bool
+	// AgentID is set when the caller is an enrolled agent using its own
+	// credential.
+	AgentID string
+}
+
+var ErrUnknownUser = errors.New("user is not provisioned")
+
+type Resolver interface {
+	Resolve(ctx context.Context, keycloakID string) (*Identity, error)
+}
+
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// PGResolver maps a Keycloak subject to its users row, caching each lookup
+// for ttl so a page load does not query users once per request.
+type PGResolver struct {
+	db  Querier
+	ttl time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedIdentity
+}
+
+type cachedIdentity struct {
+	identity Identity
+	fetched  time.Time
+}
+
+func NewPGResolver(db Querier, ttl time.Duration) *PGResolver {
+	return &PGResolver{db: db, ttl: ttl, cache: make(map[string]cachedIdentity)}
+}
+
+func (p *PGResolver) Resolve(ctx context.Context, keycloakID string) (*Identity, error) {
+	p.mu.Lock()
+	c, ok := p.cache[keycloakID]
+	p.mu.Unlock()
+	if ok && time.Since(c.fetched) < p.ttl {
+		id := c.identity
+		return &id, nil
+	}
+
+	id := Identity{KeycloakID: keycloakID}
+	err := p.db.QueryRow(ctx,
+		`SELECT id, org_id, email, role FROM users WHERE keycloak_id = $1`, keycloakID,
+	).Scan(&id.UserID, &id.OrgID, &id.Email, &id.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve user: %w", err)
+	}
+
+	p.mu.Lock()
+	p.cache[keycloakID] = cachedIdentity{identity: id, fetched: time.Now()}
+	p.mu.Unlock()
+	return &id, nil
+}
+
+type Options struct {
+	KeycloakURL string
+	Realm       string
+	// Issuer and Audience are checked against iss and aud; see JWTConfig.
+	Issuer   string
+	Audience string
+	// ServiceToken, when set, authenticates the engine as the service
+	// identity instead of a Keycloak user.
+	ServiceToken string
+	Resolver     Resolver
+	// Agents resolves agent credentials; without it agent tokens are
+	// rejected like any other malformed JWT.
+	Agents AgentResolver
+}
+
+// Authenticate accepts the service token, an enrolled agent's credential or
+// a Keycloak JWT whose subject resolves to a provisioned user, and stores
+// the caller's Identity in the request context.
+func Authenticate(opts Options) func(http.Handler) http.Handler {
+	verify := JWTMiddleware(JWTConfig{
+		KeycloakURL: opts.KeycloakURL,
+		Realm:       opts.Realm,
+		Issuer:      opts.Issuer,
+		Audience:    opts.Audience,
+		Leeway:      30 * time.Second,
+	})
+
+	return func(next http.Handler) http.Handler {
+		resolve := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetClaims(r)
+			if claims == nil || claims.Sub == "" {
+				http.Error(w, `{"error":"invalid token"}`, http.StatusUnauthorized)
+				return
+			}
+			if opts.Resolver == nil {
+				http.Error(w, `{"error":"user is not provisioned"}`, http.StatusForbidden)
+				return
+			}
+			id, err := opts.Resolver.Resolve(r.Context(), claims.Sub)
+			if errors.Is(err, ErrUnknownUser) {
+				http.Error(w, `{"error":"user is not provisioned"}`, http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, `{"error":"failed to resolve user"}`, http.StatusInternalServerError)
+				return
+			}
+			if id.Email == "" {
+				id.Email = claims.Email
+			}
+			id.RealmRoles = claims.RealmRoles
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+		})
+		withJWT := verify(resolve)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if opts.ServiceToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(opts.ServiceToken)) == 1 {
+				id := &Identity{Service: true, Role: "service"}
+				next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+				return
+			}
+			if opts.Agents != nil && agentcreds.IsAgentToken(token) {
+				id, err := opts.Agents.ResolveAgent(r.Context(), token)
+				switch {
+				case errors.Is(err, ErrAgentRevoked):
+					http.Error(w, `{"error":"agent credential revoked"}`, http.StatusUnauthorized)
+				case errors.Is(err, ErrUnknownAgent):
+					http.Error(w, `{"error":"invalid agent credential"}`, http.StatusUnauthorized)
+				case err != nil:
+					http.Error(w, `{"error":"failed to resolve agent"}`, http.StatusInternalServerError)
+				default:
+					next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+				}
+				return
+			}
+			withJWT.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return ""
+	}
+	return parts[1]
+}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, IdentityKey, id)
+}
+
+func GetIdentity(r *http.Request) *Identity {
+	id, _ := r.Context().Value(IdentityKey).(*Identity)
+	return id
+}
@@ -0,0 +1,160 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+	"github.com/jackc/pgx/v5"
+)
+
+type staticResolver map[string]auth.Identity
+
+func (s staticResolver) Resolve(ctx context.Context, keycloakID string) (*auth.Identity, error) {
+	id, ok := s[keycloakID]
+	if !ok {
+		return nil, auth.ErrUnknownUser
+	}
+	return &id, nil
+}
+
+func authenticated(t *testing.T, kc *keycloakStub, serviceToken string) (http.Handler, **auth.Identity) {
+	t.Helper()
+	var got *auth.Identity
+	h := auth.Authenticate(auth.Options{
+		KeycloakURL:  kc.server.URL,
+		Realm:        "cybershield",
+		ServiceToken: serviceToken,
+		Resolver: staticResolver{
+			"kc-user-1": {UserID: "u1", KeycloakID: "kc-user-1", OrgID: "org-a", Role: "analyst"},
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = auth.GetIdentity(r)
+	}))
+	return h, &got
+}
+
+func TestAuthenticateResolvesUser(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h, got := authenticated(t, kc, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+kc.token(t, "kc-user-1"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	id := *got
+	if id == nil || id.OrgID != "org-a" || id.Role != "analyst" || id.Email != "analyst@example.com" || id.Service {
+		t.Errorf("unexpected identity %+v", id)
+	}
+}
+
+func TestAuthenticateRejectsUnprovisionedUser(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h, got := authenticated(t, kc, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+kc.token(t, "kc-stranger"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden || *got != nil {
+		t.Errorf("expected 403 without reaching the handler, got %d", w.Code)
+	}
+}
+
+func TestAuthenticateServiceToken(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h, got := authenticated(t, kc, "engine-secret")
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer engine-secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || *got == nil || !(*got).Service || (*got).OrgID != "" {
+		t.Errorf("expected service identity, got %d %+v", w.Code, *got)
+	}
+
+	*got = nil
+	req.Header.Set("Authorization", "Bearer engine-secreT")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || *got != nil {
+		t.Errorf("expected 401 for a wrong token, got %d", w.Code)
+	}
+}
+
+func TestAuthenticateWithoutServiceTokenConfigured(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h, _ := authenticated(t, kc, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+type fakeRow struct {
+	values []string
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, d := range dest {
+		*d.(*string) = r.values[i]
+	}
+	return nil
+}
+
+type fakeQuerier struct {
+	calls int
+	row   fakeRow
+}
+
+func (q *fakeQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q.calls++
+	return q.row
+}
+
+func TestPGResolverCachesLookups(t *testing.T) {
+	q := &fakeQuerier{row: fakeRow{values: []string{"u1", "org-a", "a@example.com", "admin"}}}
+	r := auth.NewPGResolver(q, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		id, err := r.Resolve(context.Background(), "kc-user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.UserID != "u1" || id.OrgID != "org-a" || id.Role != "admin" || id.KeycloakID != "kc-user-1" {
+			t.Errorf("unexpected identity %+v", id)
+		}
+	}
+	if q.calls != 1 {
+		t.Errorf("expected one query, got %d", q.calls)
+	}
+}
+
+func TestPGResolverUnknownUser(t *testing.T) {
+	r := auth.NewPGResolver(&fakeQuerier{row: fakeRow{err: pgx.ErrNoRows}}, time.Minute)
+	if _, err := r.Resolve(context.Background(), "kc-stranger"); !errors.Is(err, auth.ErrUnknownUser) {
+		t.Errorf("expected ErrUnknownUser, got %v", err)
+	}
+
+	r = auth.NewPGResolver(&fakeQuerier{row: fakeRow{err: errors.New("connection refused")}}, time.Minute)
+	if _, err := r.Resolve(context.Background(), "kc-user-1"); err == nil || errors.Is(err, auth.ErrUnknownUser) {
+		t.Errorf("expected a lookup error, got %v", err)
+	}
+}
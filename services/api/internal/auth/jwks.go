@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultJWKSTTL        = 10 * time.Minute
+	DefaultJWKSMinRefresh = 30 * time.Second
+)
+
+var ErrUnknownKey = errors.New("signing key not found")
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// KeySet caches a realm's JWKS. Keys are refetched after ttl, and on a kid
+// the cache does not know, at most once per minRefresh so tokens with bogus
+// kids cannot make us hammer Keycloak. Expiry retries are spaced the same
+// way, so while Keycloak is down the cached keys are served between
+// attempts rather than every request trying again.
+type KeySet struct {
+	url        string
+	ttl        time.Duration
+	minRefresh time.Duration
+	client     *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetched     time.Time
+	lastAttempt time.Time
+	inflight    chan struct{}
+}
+
+func NewKeySet(url string, ttl, minRefresh time.Duration) *KeySet {
+	if ttl <= 0 {
+		ttl = DefaultJWKSTTL
+	}
+	return &KeySet{
+		url:        url,
+		ttl:        ttl,
+		minRefresh: minRefresh,
+		client:     httpClient,
+	}
+}
+
+// Key returns the verification key for kid.
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	keys := s.keys
+	expired := keys == nil || time.Since(s.fetched) >= s.ttl
+	s.mu.Unlock()
+
+	if expired && s.due(min(s.ttl, s.minRefresh)) {
+		keys = s.refresh(ctx)
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if s.due(s.minRefresh) {
+		keys = s.refresh(ctx)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("jwks unavailable from %s", s.url)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+}
+
+// due reports whether a refresh may start, or is already running and can be
+// joined.
+func (s *KeySet) due(interval time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inflight != nil || time.Since(s.lastAttempt) >= interval
+}
+
+// refresh fetches the JWKS, or waits for a fetch already in progress, and
+// returns the keys in use afterwards. The fetch runs without s.mu held. On
+// failure the previous keys stay in use so a Keycloak restart does not log
+// everyone out.
+func (s *KeySet) refresh(ctx context.Context) map[string]crypto.PublicKey {
+	s.mu.Lock()
+	if done := s.inflight; done != nil {
+		s.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.keys
+	}
+	done := make(chan struct{})
+	s.inflight = done
+	s.lastAttempt = time.Now()
+	s.mu.Unlock()
+
+	keys, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		log.Printf("auth: refresh jwks: %v", err)
+	} else {
+		s.keys = keys
+		s.fetched = time.Now()
+	}
+	s.inflight = nil
+	close(done)
+	return s.keys
+}
+
+func (s *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// Keycloak publishes encryption and HMAC keys alongside the
+			// signing keys; one bad entry must not hide the others.
+			log.Printf("auth: skip jwk %s: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		return rsaPublicKey(k.N, k.E)
+	case "EC":
+		return ecPublicKey(k.Crv, k.X, k.Y)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func ecPublicKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(xb) != size {
+		return nil, fmt.Errorf("invalid x coordinate")
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil || len(yb) != size {
+		return nil, fmt.Errorf("invalid y coordinate")
+	}
+
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+	if _, err := key.ECDH(); err != nil {
+		return nil, fmt.Errorf("point is not on %s", crv)
+	}
+	return key, nil
+}
@@ -0,0 +1,249 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func jwtHandler(kc *keycloakStub, cfg auth.JWTConfig) http.Handler {
+	cfg.KeycloakURL = kc.server.URL
+	cfg.Realm = "cybershield"
+	return auth.JWTMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+func status(h http.Handler, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func certsURL(kc *keycloakStub) string {
+	return kc.issuer() + "/protocol/openid-connect/certs"
+}
+
+func TestJWKSAcceptsECKeys(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{})
+
+	keys := map[string]*ecdsa.PrivateKey{}
+	for kid, curve := range map[string]elliptic.Curve{"ec-256": elliptic.P256(), "ec-384": elliptic.P384()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kc.publish(kid, key)
+		keys[kid] = key
+	}
+	for kid, key := range keys {
+		if code := status(h, signToken(t, key, kid, kc.claims("kc-user-1"))); code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", kid, code)
+		}
+	}
+}
+
+func TestJWKSIsCached(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{})
+
+	for i := 0; i < 5; i++ {
+		if code := status(h, kc.token(t, "kc-user-1")); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+	}
+	if n := kc.fetches.Load(); n != 1 {
+		t.Errorf("expected one JWKS fetch, got %d", n)
+	}
+}
+
+func TestJWKSRefreshesOnRotatedKey(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{Keys: auth.NewKeySet(certsURL(kc), time.Hour, 0)})
+
+	old := kc.token(t, "kc-user-1")
+	if code := status(h, old); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	kc.rotate(t, "test-key-2")
+	if code := status(h, kc.token(t, "kc-user-1")); code != http.StatusOK {
+		t.Errorf("expected the rotated key to be fetched, got %d", code)
+	}
+	if code := status(h, old); code != http.StatusOK {
+		t.Errorf("expected tokens from the previous key to stay valid, got %d", code)
+	}
+	if n := kc.fetches.Load(); n != 2 {
+		t.Errorf("expected 2 JWKS fetches, got %d", n)
+	}
+}
+
+func TestJWKSUnknownKidRefreshIsRateLimited(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{Keys: auth.NewKeySet(certsURL(kc), time.Hour, time.Hour)})
+
+	if code := status(h, kc.token(t, "kc-user-1")); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	for i := 0; i < 5; i++ {
+		token := signToken(t, kc.key, "bogus", kc.claims("kc-user-1"))
+		if code := status(h, token); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 for an unknown kid, got %d", code)
+		}
+	}
+	if n := kc.fetches.Load(); n != 1 {
+		t.Errorf("expected unknown kids not to refetch within the interval, got %d fetches", n)
+	}
+}
+
+func TestJWKSExpiresRetiredKeys(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{Keys: auth.NewKeySet(certsURL(kc), 10*time.Millisecond, time.Hour)})
+
+	old := kc.token(t, "kc-user-1")
+	if code := status(h, old); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	kc.rotate(t, "test-key-2")
+	kc.retire("test-key-1")
+	time.Sleep(20 * time.Millisecond)
+	if code := status(h, old); code != http.StatusUnauthorized {
+		t.Errorf("expected the retired key to be dropped after the TTL, got %d", code)
+	}
+}
+
+func TestJWKSKeepsKeysWhenKeycloakIsDown(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{Keys: auth.NewKeySet(certsURL(kc), 10*time.Millisecond, 0)})
+
+	token := kc.token(t, "kc-user-1")
+	if code := status(h, token); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	kc.server.Close()
+	time.Sleep(20 * time.Millisecond)
+	if code := status(h, token); code != http.StatusOK {
+		t.Errorf("expected cached keys to be used while the JWKS is unreachable, got %d", code)
+	}
+}
+
+func TestJWKSOutageRetriesAreRateLimited(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{Keys: auth.NewKeySet(certsURL(kc), 10*time.Millisecond, time.Hour)})
+
+	token := kc.token(t, "kc-user-1")
+	if code := status(h, token); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	kc.down.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if code := status(h, token); code != http.StatusOK {
+			t.Errorf("expected cached keys during the outage, got %d", code)
+		}
+	}
+	if n := kc.fetches.Load(); n != 2 {
+		t.Errorf("expected one retry after the TTL, got %d fetches", n)
+	}
+}
+
+func TestJWKSConcurrentRequestsShareOneFetch(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{Keys: auth.NewKeySet(certsURL(kc), 10*time.Millisecond, time.Hour)})
+
+	token := kc.token(t, "kc-user-1")
+	if code := status(h, token); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	kc.down.Store(true)
+	kc.delay.Store(int64(200 * time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- status(h, token)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expected cached keys during the outage, got %d", code)
+		}
+	}
+	if n := kc.fetches.Load(); n != 2 {
+		t.Errorf("expected concurrent requests to share one JWKS retry, got %d fetches", n)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected requests not to queue behind each other's fetches, took %v", elapsed)
+	}
+}
+
+func TestJWTValidatesClaims(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{Audience: "shield-api"})
+
+	if code := status(h, kc.token(t, "kc-user-1")); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	cases := map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "http://evil.example.com/realms/cybershield" },
+		"missing issuer": func(c jwt.MapClaims) { delete(c, "iss") },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "account" },
+		"not yet valid":  func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"missing exp":    func(c jwt.MapClaims) { delete(c, "exp") },
+	}
+	for name, mutate := range cases {
+		claims := kc.claims("kc-user-1")
+		mutate(claims)
+		if code := status(h, signToken(t, kc.key, kc.kid, claims)); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, code)
+		}
+	}
+}
+
+func TestJWTConfiguredIssuer(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{Issuer: "http://localhost:8180/realms/cybershield"})
+
+	claims := kc.claims("kc-user-1")
+	if code := status(h, signToken(t, kc.key, kc.kid, claims)); code != http.StatusUnauthorized {
+		t.Errorf("expected the internal issuer to be rejected, got %d", code)
+	}
+	claims["iss"] = "http://localhost:8180/realms/cybershield"
+	if code := status(h, signToken(t, kc.key, kc.kid, claims)); code != http.StatusOK {
+		t.Errorf("expected the configured issuer to be accepted, got %d", code)
+	}
+}
+
+func TestJWTRejectsAlgorithmMismatch(t *testing.T) {
+	kc := newKeycloakStub(t)
+	h := jwtHandler(kc, auth.JWTConfig{})
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, kc.claims("kc-user-1"))
+	tok.Header["kid"] = kc.kid
+	s, _ := tok.SignedString([]byte("secret"))
+	if code := status(h, s); code != http.StatusUnauthorized {
+		t.Errorf("expected HS256 to be rejected, got %d", code)
+	}
+}
@@ -2,8 +2,10 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rsa"
+	"encoding/base64"
 	"fmt"
+	"math/big"
 	"net/http"
 	"strings"
 	"time"
@@ -24,8 +26,51 @@ type Claims struct {
 	PreferredUser string   `json:"preferred_username"`
 }
 
+// JWTConfig says which tokens the JWT middleware accepts.
+type JWTConfig struct {
+	KeycloakURL string
+	Realm       string
+	// Issuer is the expected iss claim. It defaults to the realm URL under
+	// KeycloakURL, which only matches when browsers reach Keycloak at the
+	// same address as the API does.
+	Issuer string
+	// Audience, when set, must be one of the token's aud values.
+	Audience string
+	// Leeway tolerates clock skew on exp, nbf and iat.
+	Leeway time.Duration
+	// Keys defaults to a KeySet for the realm's JWKS endpoint.
+	Keys *KeySet
+}
+
+func (c JWTConfig) realmURL() string {
+	return fmt.Sprintf("%s/realms/%s", strings.TrimRight(c.KeycloakURL, "/"), c.Realm)
+}
+
 func Middleware(keycloakURL, realm string) func(http.Handler) http.Handler {
-	jwksURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/certs", keycloakURL, realm)
+	return JWTMiddleware(JWTConfig{KeycloakURL: keycloakURL, Realm: realm})
+}
+
+// JWTMiddleware verifies the bearer token's signature against the realm's
+// JWKS and its iss, aud, exp and nbf claims against cfg.
+func JWTMiddleware(cfg JWTConfig) func(http.Handler) http.Handler {
+	keys := cfg.Keys
+	if keys == nil {
+		keys = NewKeySet(cfg.realmURL()+"/protocol/openid-connect/certs", DefaultJWKSTTL, DefaultJWKSMinRefresh)
+	}
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = cfg.realmURL()
+	}
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384"}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(cfg.Audience))
+	}
+	parser := jwt.NewParser(parserOpts...)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -43,15 +88,12 @@ func Middleware(keycloakURL, realm string) func(http.Handler) http.Handler {
 
 			tokenStr := parts[1]
 
-			token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
+			token, err := parser.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 				kid, ok := token.Header["kid"].(string)
 				if !ok {
 					return nil, fmt.Errorf("missing kid in token header")
 				}
-				return fetchPublicKey(jwksURL, kid)
+				return keys.Key(r.Context(), kid)
 			})
 
 			if err != nil || !token.Valid {
@@ -102,34 +144,20 @@ func GetClaims(r *http.Request) *Claims {
 
 var httpClient = &http.Client{Timeout: 10 * time.Second}
 
-func fetchPublicKey(jwksURL, kid string) (interface{}, error) {
-	resp, err := httpClient.Get(jwksURL)
+// rsaPublicKey builds a key from the base64url modulus and exponent of an
+// RSA JWK.
+func rsaPublicKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
 	if err != nil {
-		return nil, fmt.Errorf("fetch jwks: %w", err)
+		return nil, fmt.Errorf("decode modulus: %w", err)
 	}
-	defer resp.Body.Close()
-
-	var jwks struct {
-		Keys []struct {
-			Kid string `json:"kid"`
-			N   string `json:"n"`
-			E   string `json:"e"`
-			Kty string `json:"kty"`
-		} `json:"keys"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
-		return nil, fmt.Errorf("decode jwks: %w", err)
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("decode exponent: %w", err)
 	}
-
-	for _, key := range jwks.Keys {
-		if key.Kid == kid {
-			return jwt.ParseRSAPublicKeyFromPEM([]byte(fmt.Sprintf(
-				"-----BEGIN PUBLIC KEY-----\n%s\n-----END PUBLIC KEY-----",
-				key.N,
-			)))
-		}
+	exp := new(big.Int).SetBytes(eb)
+	if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid exponent")
 	}
-
-	return nil, fmt.Errorf("key %s not found", kid)
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}, nil
 }
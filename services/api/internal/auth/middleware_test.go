@@ -1,11 +1,15 @@
 package auth_test
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestRejectsMissingToken(t *testing.T) {
@@ -40,3 +44,52 @@ func TestRejectsMalformedToken(t *testing.T) {
 		t.Errorf("expected 401, got %d", w.Code)
 	}
 }
+
+func TestAcceptsTokenSignedByRealmKey(t *testing.T) {
+	kc := newKeycloakStub(t)
+	var claims *auth.Claims
+	handler := auth.Middleware(kc.server.URL, "cybershield")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims = auth.GetClaims(r)
+		}),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+kc.token(t, "kc-user-1"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if claims == nil || claims.Sub != "kc-user-1" || len(claims.RealmRoles) != 1 || claims.RealmRoles[0] != "admin" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestRejectsTokenSignedByOtherKey(t *testing.T) {
+	kc := newKeycloakStub(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := auth.Middleware(kc.server.URL, "cybershield")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	for name, token := range map[string]string{
+		"forged":      signToken(t, other, kc.kid, jwt.MapClaims{"sub": "kc-user-1", "exp": time.Now().Add(time.Hour).Unix()}),
+		"unknown kid": signToken(t, kc.key, "rotated-away", jwt.MapClaims{"sub": "kc-user-1", "exp": time.Now().Add(time.Hour).Unix()}),
+		"expired":     signToken(t, kc.key, kc.kid, jwt.MapClaims{"sub": "kc-user-1", "exp": time.Now().Add(-time.Hour).Unix()}),
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+type Permission string
+
+const (
+	ReadAlerts     Permission = "alerts:read"
+	CreateAlerts   Permission = "alerts:create"
+	UpdateAlerts   Permission = "alerts:update"
+	EscalateAlerts Permission = "alerts:escalate"
+	ReadAgents     Permission = "agents:read"
+	ManageAgents   Permission = "agents:manage"
+	ReportAgent    Permission = "agents:report"
+	CommandAgents  Permission = "agents:command"
+	RespondAgents  Permission = "agents:respond"
+	ReadEvents     Permission = "events:read"
+	IngestEvents   Permission = "events:ingest"
+	ReadRules      Permission = "rules:read"
+	ManageRules    Permission = "rules:manage"
+	ReadOrg        Permission = "org:read"
+	ManageOrg      Permission = "org:manage"
+)
+
+var viewerPermissions = []Permission{ReadAlerts, ReadAgents, ReadEvents, ReadRules, ReadOrg}
+
+var analystPermissions = append(append([]Permission{}, viewerPermissions...),
+	CreateAlerts, UpdateAlerts, EscalateAlerts, IngestEvents, CommandAgents, RespondAgents)
+
+var adminPermissions = append(append([]Permission{}, analystPermissions...),
+	ManageAgents, ManageRules, ManageOrg)
+
+// rolePermissions maps users.role values and Keycloak realm roles to what
+// they allow. "owner" is the realm's business owner role.
+var rolePermissions = map[string][]Permission{
+	"viewer":  viewerPermissions,
+	"analyst": analystPermissions,
+	"admin":   adminPermissions,
+	"owner":   adminPermissions,
+	// The engine posts alerts and provisions orgs; it reads nothing.
+	"service": {CreateAlerts, ManageOrg},
+	// Enrolled agents only report on themselves.
+	"agent": {ReportAgent},
+}
+
+// Permissions returns the union of what the caller's users.role and realm
+// roles allow, sorted.
+func (id *Identity) Permissions() []Permission {
+	if id == nil {
+		return nil
+	}
+	set := make(map[Permission]bool)
+	for _, role := range append([]string{id.Role}, id.RealmRoles...) {
+		for _, p := range rolePermissions[role] {
+			set[p] = true
+		}
+	}
+	perms := make([]Permission, 0, len(set))
+	for p := range set {
+		perms = append(perms, p)
+	}
+	sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+	return perms
+}
+
+func (id *Identity) Can(perm Permission) bool {
+	if id == nil {
+		return false
+	}
+	for _, role := range append([]string{id.Role}, id.RealmRoles...) {
+		for _, p := range rolePermissions[role] {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Can reports whether the caller of r has perm.
+func Can(r *http.Request, perm Permission) bool {
+	return GetIdentity(r).Can(perm)
+}
+
+// Forbid writes the 403 for a missing permission.
+func Forbid(w http.ResponseWriter, perm Permission) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":      "forbidden: your role does not allow " + string(perm),
+		"permission": string(perm),
+	})
+}
+
+// Require rejects callers without perm. Mount it after Authenticate.
+func Require(perm Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := GetIdentity(r)
+			if id == nil {
+				http.Error(w, `{"error":"unauthenticated"}`, http.StatusUnauthorized)
+				return
+			}
+			if !id.Can(perm) {
+				Forbid(w, perm)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
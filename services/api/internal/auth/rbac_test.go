@@ -0,0 +1,87 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+)
+
+func TestRolePermissions(t *testing.T) {
+	cases := []struct {
+		role    string
+		allowed []auth.Permission
+		denied  []auth.Permission
+	}{
+		{"viewer", []auth.Permission{auth.ReadAlerts, auth.ReadRules, auth.ReadOrg}, []auth.Permission{auth.UpdateAlerts, auth.ManageRules, auth.IngestEvents}},
+		{"analyst", []auth.Permission{auth.UpdateAlerts, auth.EscalateAlerts, auth.IngestEvents, auth.CommandAgents, auth.RespondAgents}, []auth.Permission{auth.ManageAgents, auth.ManageRules, auth.ManageOrg}},
+		{"admin", []auth.Permission{auth.ManageAgents, auth.ManageRules, auth.ManageOrg}, nil},
+		{"service", []auth.Permission{auth.CreateAlerts}, []auth.Permission{auth.ReadAlerts, auth.ManageRules}},
+		{"", nil, []auth.Permission{auth.ReadAlerts}},
+		{"superuser", nil, []auth.Permission{auth.ReadAlerts}},
+	}
+	for _, tc := range cases {
+		id := &auth.Identity{Role: tc.role}
+		for _, p := range tc.allowed {
+			if !id.Can(p) {
+				t.Errorf("%q: expected %s to be allowed", tc.role, p)
+			}
+		}
+		for _, p := range tc.denied {
+			if id.Can(p) {
+				t.Errorf("%q: expected %s to be denied", tc.role, p)
+			}
+		}
+	}
+}
+
+func TestPermissionsUnionRealmRoles(t *testing.T) {
+	id := &auth.Identity{Role: "viewer", RealmRoles: []string{"offline_access", "analyst"}}
+	if !id.Can(auth.EscalateAlerts) || id.Can(auth.ManageRules) {
+		t.Errorf("expected analyst permissions from the realm role, got %v", id.Permissions())
+	}
+
+	perms := id.Permissions()
+	if len(perms) != 11 {
+		t.Errorf("expected 11 permissions, got %v", perms)
+	}
+	for i := 1; i < len(perms); i++ {
+		if perms[i-1] >= perms[i] {
+			t.Errorf("expected sorted unique permissions, got %v", perms)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	h := auth.Require(auth.ManageRules)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(id *auth.Identity) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if id != nil {
+			req = req.WithContext(auth.WithIdentity(req.Context(), id))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without identity, got %d", w.Code)
+	}
+
+	w := serve(&auth.Identity{Role: "viewer"})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a viewer, got %d", w.Code)
+	}
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["permission"] != "rules:manage" || resp["error"] == "" {
+		t.Errorf("expected the missing permission in the error, got %s", w.Body.String())
+	}
+
+	if w := serve(&auth.Identity{Role: "admin"}); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for an admin, got %d", w.Code)
+	}
+}
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_alerts_last_seen;
+DROP INDEX IF EXISTS idx_alerts_open_fingerprint;
+
+ALTER TABLE alerts
+    DROP COLUMN IF EXISTS last_seen_at,
+    DROP COLUMN IF EXISTS occurrence_count,
+    DROP COLUMN IF EXISTS fingerprint,
+    DROP COLUMN IF EXISTS payload,
+    DROP COLUMN IF EXISTS event_count,
+    DROP COLUMN IF EXISTS risk_score,
+    DROP COLUMN IF EXISTS source,
+    DROP COLUMN IF EXISTS category;
@@ -0,0 +1,18 @@
+-- Alert lifecycle: repeat occurrences update the open alert instead of
+-- inserting a new row.
+ALTER TABLE alerts
+    ADD COLUMN category VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN source VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN risk_score REAL NOT NULL DEFAULT 0,
+    ADD COLUMN event_count INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN payload JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN fingerprint VARCHAR(64),
+    ADD COLUMN occurrence_count INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE alerts SET last_seen_at = created_at;
+
+-- At most one unresolved alert per org and fingerprint.
+CREATE UNIQUE INDEX idx_alerts_open_fingerprint ON alerts(org_id, fingerprint)
+    WHERE status <> 'resolved';
+CREATE INDEX idx_alerts_last_seen ON alerts(org_id, last_seen_at DESC);
@@ -0,0 +1,16 @@
+-- Delivery log for alert notifications, one row per alert, rule and channel.
+CREATE TABLE notification_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id),
+    alert_id UUID NOT NULL,
+    rule_id UUID REFERENCES alert_rules(id) ON DELETE SET NULL,
+    channel VARCHAR(50) NOT NULL,
+    target VARCHAR(500) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_notification_deliveries_org ON notification_deliveries(org_id, created_at DESC);
+CREATE INDEX idx_notification_deliveries_alert ON notification_deliveries(alert_id);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_agents_credential;
+
+ALTER TABLE agents
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS enrolled_at,
+    DROP COLUMN IF EXISTS hostname,
+    DROP COLUMN IF EXISTS nkey_public,
+    DROP COLUMN IF EXISTS credential_hash;
+
+DROP TABLE IF EXISTS enrollment_tokens;
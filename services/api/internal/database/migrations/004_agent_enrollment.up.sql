@@ -0,0 +1,25 @@
+-- One-time tokens an admin hands to a new agent; the agent exchanges one for
+-- its own credential. Only hashes are stored.
+CREATE TABLE enrollment_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations(id),
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    agent_id UUID REFERENCES agents(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_enrollment_tokens_org ON enrollment_tokens(org_id, created_at DESC);
+
+-- Per-agent credentials issued at enrollment.
+ALTER TABLE agents
+    ADD COLUMN credential_hash VARCHAR(64),
+    ADD COLUMN nkey_public VARCHAR(56),
+    ADD COLUMN hostname VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN enrolled_at TIMESTAMPTZ,
+    ADD COLUMN revoked_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX idx_agents_credential ON agents(credential_hash);
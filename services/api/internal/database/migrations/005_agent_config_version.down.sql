@@ -0,0 +1,4 @@
+ALTER TABLE agents
+    DROP COLUMN IF EXISTS config_error,
+    DROP COLUMN IF EXISTS applied_config_version,
+    DROP COLUMN IF EXISTS config_version;
@@ -0,0 +1,6 @@
+-- Each config change bumps config_version; agents report the version they
+-- applied, and why a newer one failed, with their heartbeat.
+ALTER TABLE agents
+    ADD COLUMN config_version BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN applied_config_version BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN config_error TEXT;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_agents_heartbeat;
+
+ALTER TABLE agents
+    DROP COLUMN IF EXISTS agent_version,
+    DROP COLUMN IF EXISTS health;
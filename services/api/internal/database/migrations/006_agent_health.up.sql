@@ -0,0 +1,9 @@
+-- The last heartbeat body (collectors, queue depth, resource usage) and the
+-- agent build that sent it. The sweeper moves silent agents from online to
+-- stale to offline.
+ALTER TABLE agents
+    ADD COLUMN health JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN agent_version VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_agents_heartbeat ON agents(status, last_heartbeat)
+    WHERE revoked_at IS NULL;
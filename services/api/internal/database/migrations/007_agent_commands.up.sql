@@ -0,0 +1,18 @@
+-- Commands sent to agents and their results. Rows are never deleted, so the
+-- table doubles as the audit trail of who asked which agent to do what.
+CREATE TABLE agent_commands (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations(id),
+    agent_id UUID NOT NULL REFERENCES agents(id),
+    command VARCHAR(50) NOT NULL,
+    args JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    output JSONB,
+    error TEXT,
+    timeout_ms INTEGER NOT NULL,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_agent_commands_agent ON agent_commands(org_id, agent_id, created_at DESC);
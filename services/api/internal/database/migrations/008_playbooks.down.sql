@@ -0,0 +1,4 @@
+ALTER TABLE agent_commands DROP COLUMN IF EXISTS playbook_execution_id;
+DROP TABLE IF EXISTS playbook_step_runs;
+DROP TABLE IF EXISTS playbook_executions;
+DROP TABLE IF EXISTS playbooks;
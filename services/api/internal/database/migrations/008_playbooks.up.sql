@@ -0,0 +1,62 @@
+-- Response playbooks: conditions an alert must meet and the steps to run
+-- for it. Webhook URLs and header values in steps are stored sealed.
+CREATE TABLE playbooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations(id),
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    conditions JSONB NOT NULL DEFAULT '{}',
+    steps JSONB NOT NULL DEFAULT '[]',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_playbooks_org ON playbooks(org_id);
+
+-- One run of a playbook against an alert. steps and alert are copies taken
+-- when the run started, so the log shows what actually ran even after the
+-- playbook is edited or deleted.
+CREATE TABLE playbook_executions (
+    id UUID PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id),
+    playbook_id UUID REFERENCES playbooks(id) ON DELETE SET NULL,
+    playbook_name VARCHAR(255) NOT NULL,
+    alert_id UUID NOT NULL,
+    status VARCHAR(30) NOT NULL,
+    current_step INTEGER NOT NULL DEFAULT 0,
+    steps JSONB NOT NULL,
+    alert JSONB NOT NULL,
+    outputs JSONB NOT NULL DEFAULT '{}',
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_playbook_executions_org ON playbook_executions(org_id, created_at DESC);
+CREATE INDEX idx_playbook_executions_alert ON playbook_executions(alert_id);
+CREATE INDEX idx_playbook_executions_waiting ON playbook_executions(org_id)
+    WHERE status = 'awaiting_approval';
+
+-- The execution log: each step's outcome, and each wait for, grant or
+-- refusal of approval with who gave it.
+CREATE TABLE playbook_step_runs (
+    id BIGSERIAL PRIMARY KEY,
+    execution_id UUID NOT NULL REFERENCES playbook_executions(id),
+    step_index INTEGER NOT NULL,
+    step_name VARCHAR(255) NOT NULL,
+    step_type VARCHAR(50) NOT NULL,
+    status VARCHAR(30) NOT NULL,
+    output JSONB,
+    error TEXT,
+    actor VARCHAR(255),
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_playbook_step_runs_execution ON playbook_step_runs(execution_id, id);
+
+-- Commands a playbook sent are recorded with the execution that sent them.
+ALTER TABLE agent_commands
+    ADD COLUMN playbook_execution_id UUID REFERENCES playbook_executions(id);
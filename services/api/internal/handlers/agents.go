@@ -1,26 +1,62 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agenthealth"
 )
 
+// Publisher publishes a message, as messaging.Bus does.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// AgentHandler serves agents and their config. Bus, when set, pushes config
+// changes to the agent; agents that miss a push catch up on their next
+// heartbeat.
 type AgentHandler struct {
-	DB *pgxpool.Pool
+	DB  *pgxpool.Pool
+	Bus Publisher
+}
+
+func NewAgentHandler(db *pgxpool.Pool, bus Publisher) *AgentHandler {
+	return &AgentHandler{DB: db, Bus: bus}
+}
+
+// AgentConfigSubject is where an agent receives its config.
+func AgentConfigSubject(agentID string) string {
+	return fmt.Sprintf("agents.%s.config", agentID)
 }
 
-func NewAgentHandler(db *pgxpool.Pool) *AgentHandler {
-	return &AgentHandler{DB: db}
+type AgentConfig struct {
+	Version int64                  `json:"version"`
+	Config  map[string]interface{} `json:"config"`
 }
 
+// HeartbeatRequest holds the fields of the agent's health report the API
+// acts on; the whole report is stored as the agent's health.
+type HeartbeatRequest struct {
+	Version       string `json:"version"`
+	ConfigVersion int64  `json:"config_version"`
+	ConfigError   string `json:"config_error"`
+}
+
+const maxHeartbeatBytes = 64 << 10
+
 type CreateAgentRequest struct {
-	Name  string                 `json:"name"`
-	OrgID string                 `json:"org_id"`
+	Name   string                 `json:"name"`
 	Config map[string]interface{} `json:"config"`
 }
 
@@ -31,10 +67,25 @@ type AgentResponse struct {
 	Status        string                 `json:"status"`
 	LastHeartbeat *time.Time             `json:"last_heartbeat"`
 	Config        map[string]interface{} `json:"config"`
-	CreatedAt     time.Time              `json:"created_at"`
+	Hostname      string                 `json:"hostname"`
+	EnrolledAt    *time.Time             `json:"enrolled_at"`
+	RevokedAt     *time.Time             `json:"revoked_at"`
+	// ConfigVersion is the latest config; AppliedConfigVersion is what the
+	// agent last reported running.
+	ConfigVersion        int64                  `json:"config_version"`
+	AppliedConfigVersion int64                  `json:"applied_config_version"`
+	ConfigError          *string                `json:"config_error"`
+	Version              string                 `json:"version"`
+	Health               map[string]interface{} `json:"health"`
+	CreatedAt            time.Time              `json:"created_at"`
 }
 
 func (h *AgentHandler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
 	var req CreateAgentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
@@ -52,7 +103,7 @@ func (h *AgentHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	agent := AgentResponse{
 		ID:        uuid.New().String(),
-		OrgID:     req.OrgID,
+		OrgID:     orgID,
 		Name:      req.Name,
 		Status:    "pending",
 		Config:    req.Config,
@@ -77,6 +128,11 @@ func (h *AgentHandler) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgentHandler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
 	if h.DB == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode([]AgentResponse{})
@@ -84,8 +140,9 @@ func (h *AgentHandler) List(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := h.DB.Query(r.Context(),
-		`SELECT id, org_id, name, status, last_heartbeat, config, created_at
-		 FROM agents ORDER BY created_at DESC`)
+		`SELECT id, org_id, name, status, last_heartbeat, config, hostname, enrolled_at, revoked_at,
+		        config_version, applied_config_version, config_error, agent_version, health, created_at
+		 FROM agents WHERE org_id = $1 ORDER BY created_at DESC`, orgID)
 	if err != nil {
 		http.Error(w, `{"error":"failed to list agents"}`, http.StatusInternalServerError)
 		return
@@ -95,11 +152,13 @@ func (h *AgentHandler) List(w http.ResponseWriter, r *http.Request) {
 	agents := []AgentResponse{}
 	for rows.Next() {
 		var a AgentResponse
-		var configJSON []byte
-		if err := rows.Scan(&a.ID, &a.OrgID, &a.Name, &a.Status, &a.LastHeartbeat, &configJSON, &a.CreatedAt); err != nil {
+		var configJSON, healthJSON []byte
+		if err := rows.Scan(&a.ID, &a.OrgID, &a.Name, &a.Status, &a.LastHeartbeat, &configJSON, &a.Hostname, &a.EnrolledAt, &a.RevokedAt,
+			&a.ConfigVersion, &a.AppliedConfigVersion, &a.ConfigError, &a.Version, &healthJSON, &a.CreatedAt); err != nil {
 			continue
 		}
 		json.Unmarshal(configJSON, &a.Config)
+		json.Unmarshal(healthJSON, &a.Health)
 		agents = append(agents, a)
 	}
 
@@ -108,6 +167,10 @@ func (h *AgentHandler) List(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgentHandler) Get(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
 	id := chi.URLParam(r, "id")
 
 	if h.DB == nil {
@@ -116,34 +179,86 @@ func (h *AgentHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var a AgentResponse
-	var configJSON []byte
+	var configJSON, healthJSON []byte
 	err := h.DB.QueryRow(r.Context(),
-		`SELECT id, org_id, name, status, last_heartbeat, config, created_at
-		 FROM agents WHERE id = $1`, id,
-	).Scan(&a.ID, &a.OrgID, &a.Name, &a.Status, &a.LastHeartbeat, &configJSON, &a.CreatedAt)
+		`SELECT id, org_id, name, status, last_heartbeat, config, hostname, enrolled_at, revoked_at,
+		        config_version, applied_config_version, config_error, agent_version, health, created_at
+		 FROM agents WHERE id = $1 AND org_id = $2`, id, orgID,
+	).Scan(&a.ID, &a.OrgID, &a.Name, &a.Status, &a.LastHeartbeat, &configJSON, &a.Hostname, &a.EnrolledAt, &a.RevokedAt,
+		&a.ConfigVersion, &a.AppliedConfigVersion, &a.ConfigError, &a.Version, &healthJSON, &a.CreatedAt)
 	if err != nil {
 		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
 		return
 	}
 	json.Unmarshal(configJSON, &a.Config)
+	json.Unmarshal(healthJSON, &a.Health)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(a)
 }
 
+// Heartbeat records the calling agent's health report and marks it online.
+// An agent coming back from stale or offline resolves the alerts the
+// sweeper raised for it.
 func (h *AgentHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	caller, ok := callerAgent(w, r)
+	if !ok {
+		return
+	}
+	id := caller.AgentID
 	now := time.Now()
 
+	// Older agents send no body.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHeartbeatBytes))
+	if err != nil {
+		http.Error(w, `{"error":"heartbeat too large"}`, http.StatusRequestEntityTooLarge)
+		return
+	}
+	var req HeartbeatRequest
+	health := []byte(`{}`)
+	if len(bytes.TrimSpace(body)) > 0 {
+		var report map[string]interface{}
+		if err := json.Unmarshal(body, &report); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+		json.Unmarshal(body, &req)
+		health = body
+	}
+	var configError *string
+	if req.ConfigError != "" {
+		configError = &req.ConfigError
+	}
+
+	var configVersion int64
 	if h.DB != nil {
-		_, err := h.DB.Exec(r.Context(),
-			`UPDATE agents SET last_heartbeat = $1, status = 'online', updated_at = $1 WHERE id = $2`,
-			now, id,
-		)
+		var previous string
+		err := h.DB.QueryRow(r.Context(),
+			`UPDATE agents a SET last_heartbeat = $1, status = 'online', updated_at = $1,
+			        applied_config_version = $4, config_error = $5, health = $6, agent_version = $7
+			 FROM (SELECT id, status FROM agents WHERE id = $2 FOR UPDATE) prev
+			 WHERE a.id = prev.id AND a.org_id = $3 AND a.revoked_at IS NULL
+			 RETURNING a.config_version, prev.status`,
+			now, id, caller.OrgID, req.ConfigVersion, configError, health, req.Version,
+		).Scan(&configVersion, &previous)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, `{"error":"failed to update heartbeat"}`, http.StatusInternalServerError)
 			return
 		}
+		if previous == "stale" || previous == "offline" {
+			_, err := h.DB.Exec(r.Context(),
+				`UPDATE alerts SET status = 'resolved', updated_at = NOW()
+				 WHERE org_id = $1 AND agent_id = $2 AND fingerprint = ANY($3) AND status <> 'resolved'`,
+				caller.OrgID, id, []string{agenthealth.Fingerprint(id, "stale"), agenthealth.Fingerprint(id, "offline")},
+			)
+			if err != nil {
+				log.Printf("failed to resolve health alerts for agent %s: %v", id, err)
+			}
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -151,10 +266,40 @@ func (h *AgentHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
 		"id":             id,
 		"last_heartbeat": now,
 		"status":         "online",
+		"config_version": configVersion,
 	})
 }
 
+// GetConfig returns the calling agent's config and its version.
+func (h *AgentHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	caller, ok := callerAgent(w, r)
+	if !ok {
+		return
+	}
+
+	cfg := AgentConfig{Config: map[string]interface{}{}}
+	if h.DB != nil {
+		var configJSON []byte
+		err := h.DB.QueryRow(r.Context(),
+			`SELECT config, config_version FROM agents WHERE id = $1 AND org_id = $2`,
+			caller.AgentID, caller.OrgID,
+		).Scan(&configJSON, &cfg.Version)
+		if err != nil {
+			http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+			return
+		}
+		json.Unmarshal(configJSON, &cfg.Config)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
+
 func (h *AgentHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
 	id := chi.URLParam(r, "id")
 
 	var config map[string]interface{}
@@ -162,22 +307,39 @@ func (h *AgentHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
 		return
 	}
+	if config == nil {
+		config = map[string]interface{}{}
+	}
 
+	cfg := AgentConfig{Config: config}
 	if h.DB != nil {
 		configJSON, _ := json.Marshal(config)
-		_, err := h.DB.Exec(r.Context(),
-			`UPDATE agents SET config = $1, updated_at = NOW() WHERE id = $2`,
-			configJSON, id,
-		)
+		err := h.DB.QueryRow(r.Context(),
+			`UPDATE agents SET config = $1, config_version = config_version + 1, updated_at = NOW()
+			 WHERE id = $2 AND org_id = $3 RETURNING config_version`,
+			configJSON, id, orgID,
+		).Scan(&cfg.Version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, `{"error":"failed to update config"}`, http.StatusInternalServerError)
 			return
 		}
 	}
 
+	if h.Bus != nil {
+		data, _ := json.Marshal(cfg)
+		if err := h.Bus.Publish(AgentConfigSubject(id), data); err != nil {
+			log.Printf("failed to push config to agent %s: %v", id, err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":     id,
-		"config": config,
+		"id":      id,
+		"config":  config,
+		"version": cfg.Version,
 	})
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/handlers"
@@ -12,9 +13,9 @@ import (
 )
 
 func TestCreateAgentReturns201(t *testing.T) {
-	h := handlers.NewAgentHandler(nil)
+	h := handlers.NewAgentHandler(nil, nil)
 	body := `{"name":"Office Network Agent","org_id":"test-org-123"}`
-	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req := userRequest(http.MethodPost, "/", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -35,9 +36,9 @@ func TestCreateAgentReturns201(t *testing.T) {
 }
 
 func TestCreateAgentRejectsMissingName(t *testing.T) {
-	h := handlers.NewAgentHandler(nil)
+	h := handlers.NewAgentHandler(nil, nil)
 	body := `{"org_id":"test-org-123"}`
-	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req := userRequest(http.MethodPost, "/", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -49,8 +50,8 @@ func TestCreateAgentRejectsMissingName(t *testing.T) {
 }
 
 func TestListAgentsReturnsEmptyArray(t *testing.T) {
-	h := handlers.NewAgentHandler(nil)
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	h := handlers.NewAgentHandler(nil, nil)
+	req := userRequest(http.MethodGet, "/", nil)
 	w := httptest.NewRecorder()
 
 	h.List(w, req)
@@ -67,12 +68,12 @@ func TestListAgentsReturnsEmptyArray(t *testing.T) {
 }
 
 func TestHeartbeatReturns200(t *testing.T) {
-	h := handlers.NewAgentHandler(nil)
+	h := handlers.NewAgentHandler(nil, nil)
 
 	r := chi.NewRouter()
 	r.Patch("/{id}/heartbeat", h.Heartbeat)
 
-	req := httptest.NewRequest(http.MethodPatch, "/test-agent-id/heartbeat", nil)
+	req := agentRequest("test-agent-id", http.MethodPatch, "/test-agent-id/heartbeat", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -80,3 +81,143 @@ func TestHeartbeatReturns200(t *testing.T) {
 		t.Errorf("expected 200, got %d", w.Code)
 	}
 }
+
+func TestHeartbeatRequiresTheAgentItself(t *testing.T) {
+	h := handlers.NewAgentHandler(nil, nil)
+
+	r := chi.NewRouter()
+	r.Patch("/{id}/heartbeat", h.Heartbeat)
+
+	for name, req := range map[string]*http.Request{
+		"user":        userRequest(http.MethodPatch, "/test-agent-id/heartbeat", nil),
+		"other agent": agentRequest("other-agent-id", http.MethodPatch, "/test-agent-id/heartbeat", nil),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestCreateAgentUsesCallerOrg(t *testing.T) {
+	h := handlers.NewAgentHandler(nil, nil)
+	body := `{"name":"Branch Agent","org_id":"11111111-1111-1111-1111-111111111111"}`
+	req := userRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	h.Create(w, req)
+
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["org_id"] != testOrgID {
+		t.Errorf("expected agent in caller org %s, got %v", testOrgID, resp["org_id"])
+	}
+}
+
+func TestListAgentsRequiresIdentity(t *testing.T) {
+	h := handlers.NewAgentHandler(nil, nil)
+	w := httptest.NewRecorder()
+
+	h.List(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+type published struct {
+	subject string
+	data    []byte
+}
+
+type fakePublisher struct{ msgs []published }
+
+func (p *fakePublisher) Publish(subject string, data []byte) error {
+	p.msgs = append(p.msgs, published{subject, data})
+	return nil
+}
+
+func TestUpdateConfigPushesToAgent(t *testing.T) {
+	bus := &fakePublisher{}
+	r := chi.NewRouter()
+	r.Put("/{id}/config", handlers.NewAgentHandler(nil, bus).UpdateConfig)
+
+	body := `{"log_sources":["/var/log/auth.log"],"enable_network":false}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, userRequest(http.MethodPut, "/agent-1/config", bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	if len(bus.msgs) != 1 || bus.msgs[0].subject != "agents.agent-1.config" {
+		t.Fatalf("expected a push on agents.agent-1.config, got %+v", bus.msgs)
+	}
+	var cfg handlers.AgentConfig
+	json.Unmarshal(bus.msgs[0].data, &cfg)
+	if cfg.Config["enable_network"] != false {
+		t.Errorf("unexpected pushed config %+v", cfg)
+	}
+}
+
+func TestGetConfigIsForTheAgent(t *testing.T) {
+	r := chi.NewRouter()
+	r.Get("/{id}/config", handlers.NewAgentHandler(nil, nil).GetConfig)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, agentRequest("agent-1", http.MethodGet, "/agent-1/config", nil))
+	var cfg handlers.AgentConfig
+	json.Unmarshal(w.Body.Bytes(), &cfg)
+	if w.Code != http.StatusOK || cfg.Config == nil {
+		t.Errorf("expected the agent's config, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, agentRequest("agent-2", http.MethodGet, "/agent-1/config", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another agent, got %d", w.Code)
+	}
+}
+
+func TestHeartbeatReportsConfigVersion(t *testing.T) {
+	r := chi.NewRouter()
+	r.Patch("/{id}/heartbeat", handlers.NewAgentHandler(nil, nil).Heartbeat)
+
+	body := `{"spool_depth":0,"config_version":3,"config_error":"version 4: cloud_provider is required"}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, agentRequest("agent-1", http.MethodPatch, "/agent-1/heartbeat", bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if _, ok := resp["config_version"]; !ok {
+		t.Errorf("expected the desired config version in the response, got %v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, agentRequest("agent-1", http.MethodPatch, "/agent-1/heartbeat", bytes.NewBufferString(`{`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for malformed body, got %d", w.Code)
+	}
+}
+
+func TestHeartbeatRejectsBadHealthReports(t *testing.T) {
+	r := chi.NewRouter()
+	r.Patch("/{id}/heartbeat", handlers.NewAgentHandler(nil, nil).Heartbeat)
+
+	for name, tc := range map[string]struct {
+		body string
+		code int
+	}{
+		"not an object": {`[1,2]`, http.StatusBadRequest},
+		"too large":     {`{"pad":"` + strings.Repeat("x", 70<<10) + `"}`, http.StatusRequestEntityTooLarge},
+		"full report":   {`{"version":"1.2.0","os":"linux","collectors":[{"name":"logs","running":true,"events":4}]}`, http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, agentRequest("agent-1", http.MethodPatch, "/agent-1/heartbeat", bytes.NewBufferString(tc.body)))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", name, tc.code, w.Code)
+		}
+	}
+}
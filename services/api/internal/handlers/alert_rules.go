@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+)
+
+// TestNotificationSubject is the NATS subject the engine answers test
+// notification requests on.
+const TestNotificationSubject = "notify.test"
+
+const testNotificationTimeout = 30 * time.Second
+
+// Requester sends a request and waits for the reply, as messaging.Bus does.
+type Requester interface {
+	Request(subject string, data []byte, timeout time.Duration) ([]byte, error)
+}
+
+type AlertRuleHandler struct {
+	DB      *pgxpool.Pool
+	Secrets *secrets.Box
+	Bus     Requester
+}
+
+func NewAlertRuleHandler(db *pgxpool.Pool, box *secrets.Box, bus Requester) *AlertRuleHandler {
+	return &AlertRuleHandler{DB: db, Secrets: box, Bus: bus}
+}
+
+type AlertRuleRequest struct {
+	Name              string                `json:"name"`
+	SeverityThreshold string                `json:"severity_threshold"`
+	Channels          []NotificationChannel `json:"channels"`
+	Enabled           *bool                 `json:"enabled"`
+}
+
+type AlertRuleResponse struct {
+	ID                string                `json:"id"`
+	OrgID             string                `json:"org_id"`
+	Name              string                `json:"name"`
+	SeverityThreshold string                `json:"severity_threshold"`
+	Channels          []NotificationChannel `json:"channels"`
+	Enabled           bool                  `json:"enabled"`
+	CreatedAt         time.Time             `json:"created_at"`
+}
+
+type TestDelivery struct {
+	Channel  string `json:"channel"`
+	Target   string `json:"target"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+type testNotificationRequest struct {
+	Rule AlertRuleResponse `json:"rule"`
+}
+
+type testNotificationReply struct {
+	Deliveries []TestDelivery `json:"deliveries"`
+	Error      string         `json:"error,omitempty"`
+}
+
+const alertRuleColumns = `id, org_id, name, severity_threshold, channels, enabled, created_at`
+
+func (h *AlertRuleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var req AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+
+	rule := AlertRuleResponse{
+		ID:        uuid.NewString(),
+		OrgID:     orgID,
+		Enabled:   true,
+		CreatedAt: time.Now(),
+	}
+	if !h.applyRequest(w, &rule, req, nil) {
+		return
+	}
+
+	if h.DB != nil {
+		channelsJSON, _ := json.Marshal(rule.Channels)
+		err := h.DB.QueryRow(r.Context(),
+			`INSERT INTO alert_rules (id, org_id, name, severity_threshold, channels, enabled)
+			 VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`,
+			rule.ID, rule.OrgID, rule.Name, rule.SeverityThreshold, channelsJSON, rule.Enabled,
+		).Scan(&rule.CreatedAt)
+		if err != nil {
+			http.Error(w, `{"error":"failed to create alert rule"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.writeRule(w, http.StatusCreated, rule)
+}
+
+func (h *AlertRuleHandler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
+	if h.DB == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]AlertRuleResponse{})
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT `+alertRuleColumns+` FROM alert_rules WHERE org_id = $1 ORDER BY created_at DESC`, orgID)
+	if err != nil {
+		http.Error(w, `{"error":"failed to list alert rules"}`, http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	rules := []AlertRuleResponse{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, h.redact(rule))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func (h *AlertRuleHandler) Get(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	h.writeRule(w, http.StatusOK, rule)
+}
+
+// Update replaces the rule. Secret values sent back redacted keep the
+// stored value of the channel at the same position.
+func (h *AlertRuleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+
+	rule, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if !h.applyRequest(w, &rule, req, rule.Channels) {
+		return
+	}
+
+	channelsJSON, _ := json.Marshal(rule.Channels)
+	tag, err := h.DB.Exec(r.Context(),
+		`UPDATE alert_rules SET name = $1, severity_threshold = $2, channels = $3, enabled = $4
+		 WHERE id = $5 AND org_id = $6`,
+		rule.Name, rule.SeverityThreshold, channelsJSON, rule.Enabled, rule.ID, rule.OrgID,
+	)
+	if err != nil {
+		http.Error(w, `{"error":"failed to update alert rule"}`, http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, `{"error":"alert rule not found"}`, http.StatusNotFound)
+		return
+	}
+
+	h.writeRule(w, http.StatusOK, rule)
+}
+
+func (h *AlertRuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil || h.DB == nil {
+		http.Error(w, `{"error":"alert rule not found"}`, http.StatusNotFound)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `DELETE FROM alert_rules WHERE id = $1 AND org_id = $2`, id, orgID)
+	if err != nil {
+		http.Error(w, `{"error":"failed to delete alert rule"}`, http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, `{"error":"alert rule not found"}`, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AlertRuleHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r, true)
+}
+
+func (h *AlertRuleHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r, false)
+}
+
+func (h *AlertRuleHandler) setEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil || h.DB == nil {
+		http.Error(w, `{"error":"alert rule not found"}`, http.StatusNotFound)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(),
+		`UPDATE alert_rules SET enabled = $1 WHERE id = $2 AND org_id = $3`, enabled, id, orgID)
+	if err != nil {
+		http.Error(w, `{"error":"failed to update alert rule"}`, http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, `{"error":"alert rule not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      id,
+		"enabled": enabled,
+	})
+}
+
+// Test asks the engine to send a sample alert through every channel of the
+// rule, regardless of its threshold or enabled state, and reports each
+// channel's outcome.
+func (h *AlertRuleHandler) Test(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if h.Bus == nil {
+		http.Error(w, `{"error":"notification service unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	data, _ := json.Marshal(testNotificationRequest{Rule: rule})
+	replyData, err := h.Bus.Request(TestNotificationSubject, data, testNotificationTimeout)
+	if err != nil {
+		http.Error(w, `{"error":"notification service unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+	var reply testNotificationReply
+	if err := json.Unmarshal(replyData, &reply); err != nil {
+		http.Error(w, `{"error":"invalid reply from notification service"}`, http.StatusBadGateway)
+		return
+	}
+	if reply.Error != "" {
+		jsonError(w, http.StatusBadGateway, reply.Error)
+		return
+	}
+	if reply.Deliveries == nil {
+		reply.Deliveries = []TestDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rule_id":    rule.ID,
+		"deliveries": reply.Deliveries,
+	})
+}
+
+// load fetches the caller's rule named in the URL, with channels as stored.
+func (h *AlertRuleHandler) load(w http.ResponseWriter, r *http.Request) (AlertRuleResponse, bool) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return AlertRuleResponse{}, false
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil || h.DB == nil {
+		http.Error(w, `{"error":"alert rule not found"}`, http.StatusNotFound)
+		return AlertRuleResponse{}, false
+	}
+
+	rule, err := scanAlertRule(h.DB.QueryRow(r.Context(),
+		`SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = $1 AND org_id = $2`, id, orgID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, `{"error":"alert rule not found"}`, http.StatusNotFound)
+		return AlertRuleResponse{}, false
+	}
+	if err != nil {
+		http.Error(w, `{"error":"failed to load alert rule"}`, http.StatusInternalServerError)
+		return AlertRuleResponse{}, false
+	}
+	return rule, true
+}
+
+// applyRequest validates req and copies it onto rule with secrets sealed.
+// stored holds the rule's current channels when updating.
+func (h *AlertRuleHandler) applyRequest(w http.ResponseWriter, rule *AlertRuleResponse, req AlertRuleRequest, stored []NotificationChannel) bool {
+	if req.Name == "" {
+		http.Error(w, `{"error":"name is required"}`, http.StatusBadRequest)
+		return false
+	}
+	if len(req.Name) > 255 {
+		http.Error(w, `{"error":"name must be at most 255 characters"}`, http.StatusBadRequest)
+		return false
+	}
+	if req.SeverityThreshold == "" {
+		req.SeverityThreshold = "medium"
+	}
+	if !validSeverities[req.SeverityThreshold] {
+		http.Error(w, `{"error":"invalid severity_threshold, must be one of: info, low, medium, high, critical"}`, http.StatusBadRequest)
+		return false
+	}
+	if len(req.Channels) == 0 {
+		http.Error(w, `{"error":"at least one channel is required"}`, http.StatusBadRequest)
+		return false
+	}
+
+	if err := mergeSecrets(req.Channels, stored); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	channels := make([]NotificationChannel, 0, len(req.Channels))
+	for i, ch := range req.Channels {
+		if err := validateChannel(i, ch); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+		sealed, err := sealChannel(h.Secrets, ch)
+		if errors.Is(err, secrets.ErrNoKey) {
+			http.Error(w, `{"error":"channel secrets cannot be stored: SECRETS_KEY is not configured"}`, http.StatusServiceUnavailable)
+			return false
+		}
+		if err != nil {
+			http.Error(w, `{"error":"failed to encrypt channel secrets"}`, http.StatusInternalServerError)
+			return false
+		}
+		channels = append(channels, sealed)
+	}
+
+	rule.Name = req.Name
+	rule.SeverityThreshold = req.SeverityThreshold
+	rule.Channels = channels
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	return true
+}
+
+func (h *AlertRuleHandler) redact(rule AlertRuleResponse) AlertRuleResponse {
+	channels := make([]NotificationChannel, len(rule.Channels))
+	for i, ch := range rule.Channels {
+		channels[i] = redactChannel(h.Secrets, ch)
+	}
+	rule.Channels = channels
+	return rule
+}
+
+func (h *AlertRuleHandler) writeRule(w http.ResponseWriter, status int, rule AlertRuleResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(h.redact(rule))
+}
+
+func scanAlertRule(row pgx.Row) (AlertRuleResponse, error) {
+	var (
+		rule         AlertRuleResponse
+		channelsJSON []byte
+	)
+	err := row.Scan(&rule.ID, &rule.OrgID, &rule.Name, &rule.SeverityThreshold, &channelsJSON, &rule.Enabled, &rule.CreatedAt)
+	if err != nil {
+		return rule, err
+	}
+	if err := json.Unmarshal(channelsJSON, &rule.Channels); err != nil {
+		return rule, err
+	}
+	if rule.Channels == nil {
+		rule.Channels = []NotificationChannel{}
+	}
+	return rule, nil
+}
+
+func jsonError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,182 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func newRuleHandler(t *testing.T) *handlers.AlertRuleHandler {
+	t.Helper()
+	box, err := secrets.NewBox(bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handlers.NewAlertRuleHandler(nil, box, nil)
+}
+
+func createRule(h *handlers.AlertRuleHandler, body string) *httptest.ResponseRecorder {
+	req := userRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.Create(w, req)
+	return w
+}
+
+func TestCreateAlertRuleRedactsSecrets(t *testing.T) {
+	h := newRuleHandler(t)
+	w := createRule(h, `{
+		"name": "SOC on-call",
+		"severity_threshold": "high",
+		"channels": [
+			{"type": "slack", "url": "https://hooks.slack.com/services/T000/B000/XXXX"},
+			{"type": "pagerduty", "routing_key": "R0UT1NGKEY"},
+			{"type": "webhook", "url": "https://siem.example.com/ingest", "headers": {"Authorization": "Bearer abc"}},
+			{"type": "email", "to": ["soc@example.com"], "subject": "{{upper .Alert.Severity}}: {{.Alert.Title}}"}
+		]
+	}`)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, secret := range []string{"T000/B000", "R0UT1NGKEY", "Bearer abc", "enc:v1:"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("response leaks %q: %s", secret, body)
+		}
+	}
+
+	var resp handlers.AlertRuleResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.OrgID != testOrgID || resp.SeverityThreshold != "high" || !resp.Enabled {
+		t.Errorf("unexpected rule %+v", resp)
+	}
+	if resp.Channels[0].URL != "https://hooks.slack.com/********" {
+		t.Errorf("expected host-preserving redaction, got %q", resp.Channels[0].URL)
+	}
+	if resp.Channels[1].RoutingKey != "********" || resp.Channels[2].Headers["Authorization"] != "********" {
+		t.Errorf("expected redacted secrets, got %+v", resp.Channels)
+	}
+	if resp.Channels[3].To[0] != "soc@example.com" {
+		t.Errorf("expected email recipients to be returned, got %+v", resp.Channels[3])
+	}
+}
+
+func TestCreateAlertRuleDefaults(t *testing.T) {
+	w := createRule(newRuleHandler(t), `{"name":"r","enabled":false,"channels":[{"type":"syslog","address":"udp://10.0.0.5:514"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp handlers.AlertRuleResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.SeverityThreshold != "medium" || resp.Enabled {
+		t.Errorf("expected medium threshold and disabled rule, got %+v", resp)
+	}
+}
+
+func TestCreateAlertRuleValidation(t *testing.T) {
+	cases := map[string]string{
+		"missing name":       `{"channels":[{"type":"slack","url":"https://hooks.slack.com/x"}]}`,
+		"bad threshold":      `{"name":"r","severity_threshold":"urgent","channels":[{"type":"slack","url":"https://hooks.slack.com/x"}]}`,
+		"no channels":        `{"name":"r","channels":[]}`,
+		"unknown type":       `{"name":"r","channels":[{"type":"sms"}]}`,
+		"missing url":        `{"name":"r","channels":[{"type":"teams"}]}`,
+		"relative url":       `{"name":"r","channels":[{"type":"webhook","url":"/hook"}]}`,
+		"missing routing":    `{"name":"r","channels":[{"type":"pagerduty"}]}`,
+		"bad email":          `{"name":"r","channels":[{"type":"email","to":["not-an-address"]}]}`,
+		"bad syslog":         `{"name":"r","channels":[{"type":"syslog","address":"10.0.0.5:514"}]}`,
+		"bad template":       `{"name":"r","channels":[{"type":"slack","url":"https://hooks.slack.com/x","template":"{{.Alert.Title"}]}`,
+		"headers on slack":   `{"name":"r","channels":[{"type":"slack","url":"https://hooks.slack.com/x","headers":{"X":"y"}}]}`,
+		"redacted on create": `{"name":"r","channels":[{"type":"slack","url":"https://hooks.slack.com/********"}]}`,
+		"sealed on create":   `{"name":"r","channels":[{"type":"slack","url":"enc:v1:bm90IGEgc2VjcmV0"}]}`,
+		"sealed routing key": `{"name":"r","channels":[{"type":"pagerduty","routing_key":"enc:v1:bm90IGEgc2VjcmV0"}]}`,
+	}
+	h := newRuleHandler(t)
+	for name, body := range cases {
+		w := createRule(h, body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+			continue
+		}
+		var resp map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp["error"] == "" {
+			t.Errorf("%s: expected json error, got %q", name, w.Body.String())
+		}
+	}
+}
+
+func TestAlertRulesRequireUser(t *testing.T) {
+	h := newRuleHandler(t)
+	body := `{"name":"r","channels":[{"type":"email","to":["soc@example.com"]}]}`
+
+	w := httptest.NewRecorder()
+	h.Create(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without identity, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.Create(w, serviceRequest(http.MethodPost, "/", bytes.NewBufferString(body)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for the service identity, got %d", w.Code)
+	}
+}
+
+func TestCreateAlertRuleWithoutSecretsKey(t *testing.T) {
+	box, _ := secrets.NewBox(nil)
+	h := handlers.NewAlertRuleHandler(nil, box, nil)
+
+	w := createRule(h, `{"name":"r","channels":[{"type":"slack","url":"https://hooks.slack.com/x"}]}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a secrets key, got %d", w.Code)
+	}
+
+	w = createRule(h, `{"name":"r","channels":[{"type":"email","to":["soc@example.com"]}]}`)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected channels without secrets to be accepted, got %d", w.Code)
+	}
+}
+
+func TestListAlertRulesReturnsEmptyArray(t *testing.T) {
+	req := userRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	newRuleHandler(t).List(w, req)
+
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("expected empty array, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestAlertRuleNotFoundWithoutDB(t *testing.T) {
+	h := newRuleHandler(t)
+	r := chi.NewRouter()
+	r.Get("/{id}", h.Get)
+	r.Put("/{id}", h.Update)
+	r.Delete("/{id}", h.Delete)
+	r.Post("/{id}/enable", h.Enable)
+	r.Post("/{id}/test", h.Test)
+
+	id := "4b8e3c1d-2f6a-4a7b-9c0d-1e2f3a4b5c6d"
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/" + id},
+		{http.MethodGet, "/not-a-uuid"},
+		{http.MethodPut, "/" + id},
+		{http.MethodDelete, "/" + id},
+		{http.MethodPost, "/" + id + "/enable"},
+		{http.MethodPost, "/" + id + "/test"},
+	} {
+		req := userRequest(tc.method, tc.path, bytes.NewBufferString(`{}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", tc.method, tc.path, w.Code)
+		}
+	}
+}
@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
 )
 
 var validStatuses = map[string]bool{
@@ -17,6 +22,14 @@ var validStatuses = map[string]bool{
 	"escalated":    true,
 }
 
+var validSeverities = map[string]bool{
+	"info":     true,
+	"low":      true,
+	"medium":   true,
+	"high":     true,
+	"critical": true,
+}
+
 type AlertHandler struct {
 	DB *pgxpool.Pool
 }
@@ -26,18 +39,45 @@ func NewAlertHandler(db *pgxpool.Pool) *AlertHandler {
 }
 
 type AlertResponse struct {
-	ID             string    `json:"id"`
-	OrgID          string    `json:"org_id"`
-	AgentID        *string   `json:"agent_id"`
-	Severity       string    `json:"severity"`
-	Title          string    `json:"title"`
-	Description    *string   `json:"description"`
-	LLMExplanation *string   `json:"llm_explanation"`
-	LLMRemediation *string   `json:"llm_remediation"`
-	Status         string    `json:"status"`
-	AssigneeID     *string   `json:"assignee_id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID              string    `json:"id"`
+	OrgID           string    `json:"org_id"`
+	AgentID         *string   `json:"agent_id"`
+	Severity        string    `json:"severity"`
+	Title           string    `json:"title"`
+	Description     *string   `json:"description"`
+	LLMExplanation  *string   `json:"llm_explanation"`
+	LLMRemediation  *string   `json:"llm_remediation"`
+	Status          string    `json:"status"`
+	AssigneeID      *string   `json:"assignee_id"`
+	Category        string    `json:"category"`
+	Source          string    `json:"source"`
+	RiskScore       float32   `json:"risk_score"`
+	OccurrenceCount int       `json:"occurrence_count"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// CreateAlertRequest is the alert as sent by the engine. Fingerprint and
+// OccurrenceCount let repeated deliveries fold into the open alert.
+type CreateAlertRequest struct {
+	ID              string                   `json:"id"`
+	OrgID           string                   `json:"org_id"`
+	AgentID         string                   `json:"agent_id"`
+	Title           string                   `json:"title"`
+	Description     string                   `json:"description"`
+	Severity        string                   `json:"severity"`
+	Category        string                   `json:"category"`
+	Status          string                   `json:"status"`
+	Source          string                   `json:"source"`
+	RiskScore       float32                  `json:"risk_score"`
+	EventCount      int                      `json:"event_count"`
+	Payload         map[string]interface{}   `json:"payload"`
+	SourceEvents    []map[string]interface{} `json:"source_events"`
+	Fingerprint     string                   `json:"fingerprint"`
+	OccurrenceCount int                      `json:"occurrence_count"`
+	CreatedAt       time.Time                `json:"created_at"`
+	LastSeenAt      time.Time                `json:"last_seen_at"`
 }
 
 type UpdateAlertRequest struct {
@@ -45,7 +85,147 @@ type UpdateAlertRequest struct {
 	AssigneeID *string `json:"assignee_id"`
 }
 
+const alertColumns = `id, org_id, agent_id, severity, title, description,
+	llm_explanation, llm_remediation, status, assignee_id, category, source,
+	risk_score, occurrence_count, last_seen_at, created_at, updated_at`
+
+func (a *AlertResponse) scanTargets() []interface{} {
+	return []interface{}{&a.ID, &a.OrgID, &a.AgentID, &a.Severity, &a.Title,
+		&a.Description, &a.LLMExplanation, &a.LLMRemediation, &a.Status,
+		&a.AssigneeID, &a.Category, &a.Source, &a.RiskScore, &a.OccurrenceCount,
+		&a.LastSeenAt, &a.CreatedAt, &a.UpdatedAt}
+}
+
+// Create ingests an alert from the engine. A repeat of an unresolved alert
+// (same org and fingerprint) updates that alert's occurrence count and
+// last-seen time instead of adding a row. Only the service identity may
+// name the org; alerts from users always land in the user's own org.
+func (h *AlertHandler) Create(w http.ResponseWriter, r *http.Request) {
+	caller := auth.GetIdentity(r)
+	if caller == nil {
+		http.Error(w, `{"error":"unauthenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+	if !caller.Service {
+		req.OrgID = caller.OrgID
+	}
+
+	if _, err := uuid.Parse(req.OrgID); err != nil {
+		http.Error(w, `{"error":"org_id must be a uuid"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Title == "" {
+		http.Error(w, `{"error":"title is required"}`, http.StatusBadRequest)
+		return
+	}
+	if !validSeverities[req.Severity] {
+		http.Error(w, `{"error":"invalid severity, must be one of: info, low, medium, high, critical"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Status == "" {
+		req.Status = "open"
+	}
+	if !validStatuses[req.Status] {
+		http.Error(w, `{"error":"invalid status, must be one of: open, acknowledged, resolved, escalated"}`, http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" {
+		req.ID = uuid.NewString()
+	} else if _, err := uuid.Parse(req.ID); err != nil {
+		http.Error(w, `{"error":"id must be a uuid"}`, http.StatusBadRequest)
+		return
+	}
+	if req.OccurrenceCount < 1 {
+		req.OccurrenceCount = 1
+	}
+	if req.EventCount < 1 {
+		req.EventCount = 1
+	}
+	if req.CreatedAt.IsZero() {
+		req.CreatedAt = time.Now()
+	}
+	if req.LastSeenAt.IsZero() {
+		req.LastSeenAt = req.CreatedAt
+	}
+
+	id := req.ID
+	occurrences := req.OccurrenceCount
+	created := true
+
+	if h.DB != nil {
+		var agentID *string
+		if _, err := uuid.Parse(req.AgentID); err == nil {
+			agentID = &req.AgentID
+		}
+		var fingerprint *string
+		if req.Fingerprint != "" {
+			fingerprint = &req.Fingerprint
+		}
+		if req.Payload == nil {
+			req.Payload = map[string]interface{}{}
+		}
+		if req.SourceEvents == nil {
+			req.SourceEvents = []map[string]interface{}{}
+		}
+		payloadJSON, _ := json.Marshal(req.Payload)
+		sourceJSON, _ := json.Marshal(req.SourceEvents)
+
+		// The engine sends absolute counts, so a redelivered or replayed
+		// alert never moves the counters backwards.
+		err := h.DB.QueryRow(r.Context(),
+			`INSERT INTO alerts (id, org_id, agent_id, severity, title, description, status,
+				category, source, risk_score, event_count, payload, source_events, fingerprint,
+				occurrence_count, created_at, last_seen_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, NOW())
+			 ON CONFLICT (org_id, fingerprint) WHERE status <> 'resolved' DO UPDATE SET
+				occurrence_count = GREATEST(alerts.occurrence_count, EXCLUDED.occurrence_count),
+				event_count = GREATEST(alerts.event_count, EXCLUDED.event_count),
+				last_seen_at = GREATEST(alerts.last_seen_at, EXCLUDED.last_seen_at),
+				risk_score = GREATEST(alerts.risk_score, EXCLUDED.risk_score),
+				description = EXCLUDED.description,
+				source_events = EXCLUDED.source_events,
+				updated_at = NOW()
+			 RETURNING id, occurrence_count, (xmax = 0)`,
+			req.ID, req.OrgID, agentID, req.Severity, req.Title, req.Description, req.Status,
+			req.Category, req.Source, req.RiskScore, req.EventCount, payloadJSON, sourceJSON,
+			fingerprint, req.OccurrenceCount, req.CreatedAt, req.LastSeenAt,
+		).Scan(&id, &occurrences, &created)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				http.Error(w, `{"error":"alert already exists"}`, http.StatusConflict)
+				return
+			}
+			http.Error(w, `{"error":"failed to create alert"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":               id,
+		"occurrence_count": occurrences,
+		"created":          created,
+	})
+}
+
 func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
 	if h.DB == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode([]AlertResponse{})
@@ -55,11 +235,9 @@ func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
 	severity := r.URL.Query().Get("severity")
 	status := r.URL.Query().Get("status")
 
-	query := `SELECT id, org_id, agent_id, severity, title, description,
-		llm_explanation, llm_remediation, status, assignee_id, created_at, updated_at
-		FROM alerts WHERE 1=1`
-	args := []interface{}{}
-	argIdx := 1
+	query := `SELECT ` + alertColumns + ` FROM alerts WHERE org_id = $1`
+	args := []interface{}{orgID}
+	argIdx := 2
 
 	if severity != "" {
 		query += ` AND severity = $` + itoa(argIdx)
@@ -72,7 +250,7 @@ func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
 		argIdx++
 	}
 
-	query += ` ORDER BY created_at DESC LIMIT 100`
+	query += ` ORDER BY last_seen_at DESC LIMIT 100`
 
 	rows, err := h.DB.Query(r.Context(), query, args...)
 	if err != nil {
@@ -84,9 +262,7 @@ func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
 	alerts := []AlertResponse{}
 	for rows.Next() {
 		var a AlertResponse
-		if err := rows.Scan(&a.ID, &a.OrgID, &a.AgentID, &a.Severity, &a.Title,
-			&a.Description, &a.LLMExplanation, &a.LLMRemediation, &a.Status,
-			&a.AssigneeID, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		if err := rows.Scan(a.scanTargets()...); err != nil {
 			continue
 		}
 		alerts = append(alerts, a)
@@ -97,6 +273,10 @@ func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AlertHandler) Get(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
 	id := chi.URLParam(r, "id")
 
 	if h.DB == nil {
@@ -106,12 +286,8 @@ func (h *AlertHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	var a AlertResponse
 	err := h.DB.QueryRow(r.Context(),
-		`SELECT id, org_id, agent_id, severity, title, description,
-			llm_explanation, llm_remediation, status, assignee_id, created_at, updated_at
-		 FROM alerts WHERE id = $1`, id,
-	).Scan(&a.ID, &a.OrgID, &a.AgentID, &a.Severity, &a.Title,
-		&a.Description, &a.LLMExplanation, &a.LLMRemediation, &a.Status,
-		&a.AssigneeID, &a.CreatedAt, &a.UpdatedAt)
+		`SELECT `+alertColumns+` FROM alerts WHERE id = $1 AND org_id = $2`, id, orgID,
+	).Scan(a.scanTargets()...)
 	if err != nil {
 		http.Error(w, `{"error":"alert not found"}`, http.StatusNotFound)
 		return
@@ -122,6 +298,10 @@ func (h *AlertHandler) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AlertHandler) Update(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
 	id := chi.URLParam(r, "id")
 
 	var req UpdateAlertRequest
@@ -134,16 +314,25 @@ func (h *AlertHandler) Update(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"invalid status, must be one of: open, acknowledged, resolved, escalated"}`, http.StatusBadRequest)
 		return
 	}
+	if req.Status == "escalated" && !auth.Can(r, auth.EscalateAlerts) {
+		auth.Forbid(w, auth.EscalateAlerts)
+		return
+	}
 
 	if h.DB != nil {
-		_, err := h.DB.Exec(r.Context(),
-			`UPDATE alerts SET status = $1, assignee_id = COALESCE($2, assignee_id), updated_at = NOW() WHERE id = $3`,
-			req.Status, req.AssigneeID, id,
+		tag, err := h.DB.Exec(r.Context(),
+			`UPDATE alerts SET status = $1, assignee_id = COALESCE($2, assignee_id), updated_at = NOW()
+			 WHERE id = $3 AND org_id = $4`,
+			req.Status, req.AssigneeID, id, orgID,
 		)
 		if err != nil {
 			http.Error(w, `{"error":"failed to update alert"}`, http.StatusInternalServerError)
 			return
 		}
+		if tag.RowsAffected() == 0 {
+			http.Error(w, `{"error":"alert not found"}`, http.StatusNotFound)
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -154,17 +343,26 @@ func (h *AlertHandler) Update(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AlertHandler) Escalate(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
 	id := chi.URLParam(r, "id")
 
 	if h.DB != nil {
-		_, err := h.DB.Exec(r.Context(),
-			`UPDATE alerts SET severity = 'critical', status = 'escalated', updated_at = NOW() WHERE id = $1`,
-			id,
+		tag, err := h.DB.Exec(r.Context(),
+			`UPDATE alerts SET severity = 'critical', status = 'escalated', updated_at = NOW()
+			 WHERE id = $1 AND org_id = $2`,
+			id, orgID,
 		)
 		if err != nil {
 			http.Error(w, `{"error":"failed to escalate alert"}`, http.StatusInternalServerError)
 			return
 		}
+		if tag.RowsAffected() == 0 {
+			http.Error(w, `{"error":"alert not found"}`, http.StatusNotFound)
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
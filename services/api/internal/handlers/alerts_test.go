@@ -13,7 +13,7 @@ import (
 
 func TestListAlertsReturnsEmptyArray(t *testing.T) {
 	h := handlers.NewAlertHandler(nil)
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req := userRequest(http.MethodGet, "/", nil)
 	w := httptest.NewRecorder()
 
 	h.List(w, req)
@@ -36,7 +36,7 @@ func TestUpdateAlertStatusReturns200(t *testing.T) {
 	r.Patch("/{id}", h.Update)
 
 	body := `{"status":"acknowledged"}`
-	req := httptest.NewRequest(http.MethodPatch, "/test-alert-id", bytes.NewBufferString(body))
+	req := userRequest(http.MethodPatch, "/test-alert-id", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
@@ -59,7 +59,7 @@ func TestUpdateAlertRejectsInvalidStatus(t *testing.T) {
 	r.Patch("/{id}", h.Update)
 
 	body := `{"status":"invalid_status"}`
-	req := httptest.NewRequest(http.MethodPatch, "/test-alert-id", bytes.NewBufferString(body))
+	req := userRequest(http.MethodPatch, "/test-alert-id", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
@@ -69,13 +69,35 @@ func TestUpdateAlertRejectsInvalidStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateAlertToEscalatedRequiresPermission(t *testing.T) {
+	h := handlers.NewAlertHandler(nil)
+
+	r := chi.NewRouter()
+	r.Patch("/{id}", h.Update)
+
+	body := `{"status":"escalated"}`
+	req := roleRequest("viewer", http.MethodPatch, "/test-alert-id", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a viewer, got %d", w.Code)
+	}
+
+	req = roleRequest("analyst", http.MethodPatch, "/test-alert-id", bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 for an analyst, got %d", w.Code)
+	}
+}
+
 func TestEscalateAlertReturns200(t *testing.T) {
 	h := handlers.NewAlertHandler(nil)
 
 	r := chi.NewRouter()
 	r.Post("/{id}/escalate", h.Escalate)
 
-	req := httptest.NewRequest(http.MethodPost, "/test-alert-id/escalate", nil)
+	req := userRequest(http.MethodPost, "/test-alert-id/escalate", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -89,3 +111,59 @@ func TestEscalateAlertReturns200(t *testing.T) {
 		t.Errorf("expected severity 'critical', got %v", resp["severity"])
 	}
 }
+
+func TestCreateAlertReturns201(t *testing.T) {
+	h := handlers.NewAlertHandler(nil)
+
+	body := `{"org_id":"7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10","title":"Port Scan Detected","severity":"high","fingerprint":"abc","occurrence_count":2}`
+	req := serviceRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	h.Create(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["id"] == "" || resp["id"] == nil {
+		t.Error("expected generated id")
+	}
+	if resp["occurrence_count"] != float64(2) {
+		t.Errorf("expected occurrence count 2, got %v", resp["occurrence_count"])
+	}
+}
+
+func TestCreateAlertValidates(t *testing.T) {
+	h := handlers.NewAlertHandler(nil)
+
+	cases := map[string]string{
+		"bad json":     `{`,
+		"non-uuid org": `{"org_id":"org-1","title":"t","severity":"high"}`,
+		"no title":     `{"org_id":"7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10","severity":"high"}`,
+		"bad severity": `{"org_id":"7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10","title":"t","severity":"urgent"}`,
+		"bad status":   `{"org_id":"7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10","title":"t","severity":"high","status":"new"}`,
+		"non-uuid id":  `{"id":"evt-1","org_id":"7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10","title":"t","severity":"high"}`,
+	}
+	for name, body := range cases {
+		req := serviceRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		h.Create(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestCreateAlertAsUserUsesCallerOrg(t *testing.T) {
+	h := handlers.NewAlertHandler(nil)
+
+	// The body names an org the user does not belong to; it is ignored.
+	body := `{"org_id":"org-1","title":"Manual finding","severity":"low"}`
+	req := userRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	h.Create(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+}
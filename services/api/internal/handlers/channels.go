@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+)
+
+// NotificationChannel is one entry of alert_rules.channels, in the shape the
+// engine's dispatcher reads. URL, RoutingKey and header values are secrets:
+// they are stored sealed and redacted in responses.
+type NotificationChannel struct {
+	Type       string            `json:"type"`
+	URL        string            `json:"url,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	RoutingKey string            `json:"routing_key,omitempty"`
+	To         []string          `json:"to,omitempty"`
+	Address    string            `json:"address,omitempty"`
+	Template   string            `json:"template,omitempty"`
+	Subject    string            `json:"subject,omitempty"`
+}
+
+const redacted = "********"
+
+var validChannelTypes = map[string]bool{
+	"webhook":   true,
+	"slack":     true,
+	"teams":     true,
+	"pagerduty": true,
+	"email":     true,
+	"syslog":    true,
+}
+
+// The engine renders templates with these functions; only their names
+// matter for validation.
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func isRedacted(v string) bool {
+	return strings.HasSuffix(v, redacted)
+}
+
+// mergeSecrets replaces redacted values in updated with the stored sealed
+// value of the channel at the same position, so clients can send back what
+// they read without re-entering every secret. A sealed value is only
+// accepted if it is the one stored there; anything else sealed did not come
+// from this rule and could not be validated.
+func mergeSecrets(updated, stored []NotificationChannel) error {
+	for i := range updated {
+		ch := &updated[i]
+		var old *NotificationChannel
+		if i < len(stored) && stored[i].Type == ch.Type {
+			old = &stored[i]
+		}
+		keep := func(field, value, previous string) (string, error) {
+			if secrets.IsSealed(value) && value != previous {
+				return "", fmt.Errorf("channel %d: %s must be given in plain text", i, field)
+			}
+			if !isRedacted(value) {
+				return value, nil
+			}
+			if old == nil || previous == "" {
+				return "", fmt.Errorf("channel %d: %s is redacted; provide the full value", i, field)
+			}
+			return previous, nil
+		}
+
+		var err error
+		var prevURL, prevKey string
+		if old != nil {
+			prevURL, prevKey = old.URL, old.RoutingKey
+		}
+		if ch.URL, err = keep("url", ch.URL, prevURL); err != nil {
+			return err
+		}
+		if ch.RoutingKey, err = keep("routing_key", ch.RoutingKey, prevKey); err != nil {
+			return err
+		}
+		for k, v := range ch.Headers {
+			var prev string
+			if old != nil {
+				prev = old.Headers[k]
+			}
+			if ch.Headers[k], err = keep("header "+k, v, prev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateChannel checks a channel before it is stored. Sealed values are
+// the rule's stored ones, as mergeSecrets ensures; they were validated when
+// first saved and are skipped.
+func validateChannel(i int, ch NotificationChannel) error {
+	if !validChannelTypes[ch.Type] {
+		return fmt.Errorf("channel %d: invalid type %q, must be one of: webhook, slack, teams, pagerduty, email, syslog", i, ch.Type)
+	}
+
+	checkURL := func(raw string, required bool) error {
+		if raw == "" {
+			if required {
+				return fmt.Errorf("channel %d: url is required", i)
+			}
+			return nil
+		}
+		if secrets.IsSealed(raw) {
+			return nil
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("channel %d: url must be an absolute http(s) url", i)
+		}
+		return nil
+	}
+
+	switch ch.Type {
+	case "webhook", "slack", "teams":
+		if err := checkURL(ch.URL, true); err != nil {
+			return err
+		}
+	case "pagerduty":
+		if ch.RoutingKey == "" {
+			return fmt.Errorf("channel %d: routing_key is required", i)
+		}
+		if err := checkURL(ch.URL, false); err != nil {
+			return err
+		}
+	case "email":
+		if len(ch.To) == 0 {
+			return fmt.Errorf("channel %d: to is required", i)
+		}
+		for _, addr := range ch.To {
+			if _, err := mail.ParseAddress(addr); err != nil || strings.ContainsAny(addr, "\r\n") {
+				return fmt.Errorf("channel %d: invalid email address %q", i, addr)
+			}
+		}
+	case "syslog":
+		u, err := url.Parse(ch.Address)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" {
+			return fmt.Errorf("channel %d: address must look like udp://host:port or tcp://host:port", i)
+		}
+	}
+
+	if ch.Type != "webhook" && len(ch.Headers) > 0 {
+		return fmt.Errorf("channel %d: headers are only supported for webhook channels", i)
+	}
+	if ch.Subject != "" && ch.Type != "email" {
+		return fmt.Errorf("channel %d: subject is only supported for email channels", i)
+	}
+	for name, text := range map[string]string{"template": ch.Template, "subject": ch.Subject} {
+		if text == "" {
+			continue
+		}
+		if _, err := template.New(name).Funcs(templateFuncs).Parse(text); err != nil {
+			return fmt.Errorf("channel %d: invalid %s: %v", i, name, err)
+		}
+	}
+	return nil
+}
+
+// sealChannel encrypts any secret value that is not sealed yet.
+func sealChannel(box *secrets.Box, ch NotificationChannel) (NotificationChannel, error) {
+	seal := func(v string) (string, error) {
+		if v == "" || secrets.IsSealed(v) {
+			return v, nil
+		}
+		return box.Seal(v)
+	}
+
+	var err error
+	if ch.URL, err = seal(ch.URL); err != nil {
+		return ch, err
+	}
+	if ch.RoutingKey, err = seal(ch.RoutingKey); err != nil {
+		return ch, err
+	}
+	if len(ch.Headers) > 0 {
+		headers := make(map[string]string, len(ch.Headers))
+		for k, v := range ch.Headers {
+			if headers[k], err = seal(v); err != nil {
+				return ch, err
+			}
+		}
+		ch.Headers = headers
+	}
+	return ch, nil
+}
+
+// redactChannel hides secret values. URLs keep their scheme and host so the
+// destination is still recognisable.
+func redactChannel(box *secrets.Box, ch NotificationChannel) NotificationChannel {
+	if ch.URL != "" {
+		display := redacted
+		if plain, err := box.Open(ch.URL); err == nil {
+			if u, err := url.Parse(plain); err == nil && u.Host != "" {
+				display = u.Scheme + "://" + u.Host + "/" + redacted
+			}
+		}
+		ch.URL = display
+	}
+	if ch.RoutingKey != "" {
+		ch.RoutingKey = redacted
+	}
+	if len(ch.Headers) > 0 {
+		headers := make(map[string]string, len(ch.Headers))
+		for k := range ch.Headers {
+			headers[k] = redacted
+		}
+		ch.Headers = headers
+	}
+	return ch
+}
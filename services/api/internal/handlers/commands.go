@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+)
+
+const (
+	defaultCommandTimeout = 30 * time.Second
+	maxCommandTimeout     = 2 * time.Minute
+	// commandReplyGrace lets the agent's own timeout fire, and its
+	// timed_out result arrive, before the request gives up.
+	commandReplyGrace = 5 * time.Second
+)
+
+// commandPermissions lists the commands an agent understands and what the
+// caller needs to send each. Reading state is an investigation step;
+// restarting a collector changes the agent, and blocking an address
+// changes the host it runs on.
+var commandPermissions = map[string]auth.Permission{
+	"status":            auth.CommandAgents,
+	"rescan":            auth.CommandAgents,
+	"flows":             auth.CommandAgents,
+	"tail_log":          auth.CommandAgents,
+	"list_blocks":       auth.CommandAgents,
+	"restart_collector": auth.ManageAgents,
+	"block_ip":          auth.RespondAgents,
+	"unblock_ip":        auth.RespondAgents,
+}
+
+func commandNames() string {
+	names := make([]string, 0, len(commandPermissions))
+	for name := range commandPermissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// CommandHandler sends commands to agents over NATS request/reply and keeps
+// each command and its result in agent_commands.
+type CommandHandler struct {
+	DB  *pgxpool.Pool
+	Bus Requester
+}
+
+func NewCommandHandler(db *pgxpool.Pool, bus Requester) *CommandHandler {
+	return &CommandHandler{DB: db, Bus: bus}
+}
+
+// AgentCommandSubject is where an agent receives commands.
+func AgentCommandSubject(orgID, agentID string) string {
+	return fmt.Sprintf("agents.%s.%s.cmd", orgID, agentID)
+}
+
+type CommandRequest struct {
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args"`
+	// TimeoutSeconds defaults to 30 and is capped at 120.
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// AgentCommand is the message the agent receives.
+type AgentCommand struct {
+	ID        string          `json:"id"`
+	Command   string          `json:"command"`
+	Args      json.RawMessage `json:"args,omitempty"`
+	TimeoutMS int64           `json:"timeout_ms"`
+	// RequestedBy goes into the agent's own audit trail.
+	RequestedBy string `json:"requested_by,omitempty"`
+}
+
+// AgentCommandResult is the agent's reply.
+type AgentCommandResult struct {
+	Status string          `json:"status"`
+	Output json.RawMessage `json:"output"`
+	Error  string          `json:"error"`
+}
+
+type CommandResponse struct {
+	ID          string          `json:"id"`
+	AgentID     string          `json:"agent_id"`
+	Command     string          `json:"command"`
+	Args        json.RawMessage `json:"args"`
+	Status      string          `json:"status"`
+	Output      json.RawMessage `json:"output"`
+	Error       *string         `json:"error"`
+	TimeoutMS   int64           `json:"timeout_ms"`
+	RequestedBy *string         `json:"requested_by"`
+	CreatedAt   time.Time       `json:"created_at"`
+	CompletedAt *time.Time      `json:"completed_at"`
+}
+
+// Create sends a command to the agent and waits for its result, which is
+// stored whether the command succeeded, failed or timed out.
+func (h *CommandHandler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+	agentID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(agentID); err != nil {
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var req CommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+	perm, known := commandPermissions[req.Command]
+	if !known {
+		jsonError(w, http.StatusBadRequest, "unknown command, must be one of: "+commandNames())
+		return
+	}
+	if !auth.Can(r, perm) {
+		auth.Forbid(w, perm)
+		return
+	}
+	if len(req.Args) == 0 || string(req.Args) == "null" {
+		req.Args = json.RawMessage(`{}`)
+	}
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	if timeout > maxCommandTimeout {
+		timeout = maxCommandTimeout
+	}
+	if h.Bus == nil {
+		http.Error(w, `{"error":"agent commands are unavailable without NATS"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	caller := auth.GetIdentity(r)
+	cmd := CommandResponse{
+		ID:        uuid.NewString(),
+		AgentID:   agentID,
+		Command:   req.Command,
+		Args:      req.Args,
+		Status:    "running",
+		TimeoutMS: timeout.Milliseconds(),
+		CreatedAt: time.Now(),
+	}
+	if caller.UserID != "" {
+		cmd.RequestedBy = &caller.UserID
+	}
+
+	if h.DB != nil {
+		var revokedAt *time.Time
+		err := h.DB.QueryRow(r.Context(),
+			`SELECT revoked_at FROM agents WHERE id = $1 AND org_id = $2`, agentID, orgID,
+		).Scan(&revokedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error":"failed to load agent"}`, http.StatusInternalServerError)
+			return
+		}
+		if revokedAt != nil {
+			http.Error(w, `{"error":"agent is revoked"}`, http.StatusConflict)
+			return
+		}
+
+		_, err = h.DB.Exec(r.Context(),
+			`INSERT INTO agent_commands (id, org_id, agent_id, command, args, status, timeout_ms, requested_by, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			cmd.ID, orgID, agentID, cmd.Command, []byte(cmd.Args), cmd.Status, cmd.TimeoutMS, cmd.RequestedBy, cmd.CreatedAt,
+		)
+		if err != nil {
+			http.Error(w, `{"error":"failed to record command"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+	log.Printf("agent command %s: %s on agent %s by %s", cmd.ID, cmd.Command, agentID, caller.Email)
+
+	msg, _ := json.Marshal(AgentCommand{ID: cmd.ID, Command: cmd.Command, Args: cmd.Args, TimeoutMS: cmd.TimeoutMS, RequestedBy: caller.Email})
+	reply, err := h.Bus.Request(AgentCommandSubject(orgID, agentID), msg, timeout+commandReplyGrace)
+	var result AgentCommandResult
+	switch {
+	case errors.Is(err, nats.ErrNoResponders):
+		result = AgentCommandResult{Status: "failed", Error: "agent is not connected"}
+	case errors.Is(err, nats.ErrTimeout):
+		result = AgentCommandResult{Status: "timed_out", Error: "agent did not reply in time"}
+	case err != nil:
+		result = AgentCommandResult{Status: "failed", Error: err.Error()}
+	default:
+		if err := json.Unmarshal(reply, &result); err != nil || result.Status == "" {
+			result = AgentCommandResult{Status: "failed", Error: "invalid reply from agent"}
+		}
+	}
+
+	completed := time.Now()
+	cmd.Status = result.Status
+	cmd.Output = result.Output
+	cmd.CompletedAt = &completed
+	if result.Error != "" {
+		cmd.Error = &result.Error
+	}
+
+	if h.DB != nil {
+		var output []byte
+		if len(cmd.Output) > 0 {
+			output = cmd.Output
+		}
+		// The outcome is recorded even if the caller hung up meanwhile.
+		_, err := h.DB.Exec(context.WithoutCancel(r.Context()),
+			`UPDATE agent_commands SET status = $1, output = $2, error = $3, completed_at = $4 WHERE id = $5`,
+			cmd.Status, output, cmd.Error, completed, cmd.ID,
+		)
+		if err != nil {
+			log.Printf("failed to record result of agent command %s: %v", cmd.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cmd)
+}
+
+func (h *CommandHandler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+	agentID := chi.URLParam(r, "id")
+
+	commands := []CommandResponse{}
+	if h.DB != nil {
+		rows, err := h.DB.Query(r.Context(),
+			`SELECT id, agent_id, command, args, status, output, error, timeout_ms, requested_by, created_at, completed_at
+			 FROM agent_commands WHERE org_id = $1 AND agent_id = $2
+			 ORDER BY created_at DESC LIMIT 100`, orgID, agentID)
+		if err != nil {
+			http.Error(w, `{"error":"failed to list commands"}`, http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var c CommandResponse
+			if err := rows.Scan(c.scanTargets()...); err != nil {
+				continue
+			}
+			commands = append(commands, c)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+}
+
+func (h *CommandHandler) Get(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
+	if h.DB == nil {
+		http.Error(w, `{"error":"command not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var c CommandResponse
+	err := h.DB.QueryRow(r.Context(),
+		`SELECT id, agent_id, command, args, status, output, error, timeout_ms, requested_by, created_at, completed_at
+		 FROM agent_commands WHERE id = $1 AND agent_id = $2 AND org_id = $3`,
+		chi.URLParam(r, "commandID"), chi.URLParam(r, "id"), orgID,
+	).Scan(c.scanTargets()...)
+	if err != nil {
+		http.Error(w, `{"error":"command not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+func (c *CommandResponse) scanTargets() []any {
+	return []any{&c.ID, &c.AgentID, &c.Command, &c.Args, &c.Status, &c.Output, &c.Error,
+		&c.TimeoutMS, &c.RequestedBy, &c.CreatedAt, &c.CompletedAt}
+}
@@ -0,0 +1,116 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nats-io/nats.go"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/handlers"
+)
+
+const testAgentID = "3b0e5c1a-8f2d-4e6b-9a7c-1d2e3f4a5b6c"
+
+type fakeRequester struct {
+	subject string
+	sent    handlers.AgentCommand
+	timeout time.Duration
+	reply   string
+	err     error
+}
+
+func (f *fakeRequester) Request(subject string, data []byte, timeout time.Duration) ([]byte, error) {
+	f.subject, f.timeout = subject, timeout
+	json.Unmarshal(data, &f.sent)
+	return []byte(f.reply), f.err
+}
+
+func commandRouter(bus handlers.Requester) chi.Router {
+	h := handlers.NewCommandHandler(nil, bus)
+	r := chi.NewRouter()
+	r.Post("/{id}/commands", h.Create)
+	return r
+}
+
+func sendCommand(r chi.Router, role, body string) (*httptest.ResponseRecorder, handlers.CommandResponse) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, roleRequest(role, http.MethodPost, "/"+testAgentID+"/commands", bytes.NewBufferString(body)))
+	var resp handlers.CommandResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestCreateCommandSendsToTheAgent(t *testing.T) {
+	bus := &fakeRequester{reply: `{"status":"succeeded","output":{"lines":["a","b"]}}`}
+	w, resp := sendCommand(commandRouter(bus), "analyst", `{"command":"tail_log","args":{"source":"/var/log/auth.log","lines":2},"timeout_seconds":10}`)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if bus.subject != "agents."+testOrgID+"."+testAgentID+".cmd" {
+		t.Errorf("unexpected subject %q", bus.subject)
+	}
+	if bus.sent.ID != resp.ID || bus.sent.Command != "tail_log" || bus.sent.TimeoutMS != 10000 || bus.timeout <= 10*time.Second {
+		t.Errorf("unexpected command %+v sent with timeout %s", bus.sent, bus.timeout)
+	}
+	if resp.Status != "succeeded" || string(resp.Output) != `{"lines":["a","b"]}` || resp.CompletedAt == nil || resp.RequestedBy == nil {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestCreateCommandRecordsFailures(t *testing.T) {
+	cases := map[string]struct {
+		bus    *fakeRequester
+		status string
+	}{
+		"offline":   {&fakeRequester{err: nats.ErrNoResponders}, "failed"},
+		"no reply":  {&fakeRequester{err: nats.ErrTimeout}, "timed_out"},
+		"garbage":   {&fakeRequester{reply: `nope`}, "failed"},
+		"agent err": {&fakeRequester{reply: `{"status":"failed","error":"cloud collector is not enabled"}`}, "failed"},
+	}
+	for name, tc := range cases {
+		w, resp := sendCommand(commandRouter(tc.bus), "admin", `{"command":"rescan"}`)
+		if w.Code != http.StatusCreated || resp.Status != tc.status || resp.Error == nil {
+			t.Errorf("%s: expected a stored %s result, got %d %+v", name, tc.status, w.Code, resp)
+		}
+		if tc.bus.sent.TimeoutMS != 30000 {
+			t.Errorf("%s: expected the default timeout, got %d", name, tc.bus.sent.TimeoutMS)
+		}
+	}
+}
+
+func TestCreateCommandChecksCommandAndPermission(t *testing.T) {
+	bus := &fakeRequester{reply: `{"status":"succeeded"}`}
+	r := commandRouter(bus)
+
+	if w, _ := sendCommand(r, "admin", `{"command":"shell","args":{"cmd":"id"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown command, got %d", w.Code)
+	}
+	if w, _ := sendCommand(r, "analyst", `{"command":"restart_collector","args":{"name":"logs"}}`); w.Code != http.StatusForbidden {
+		t.Errorf("expected analysts to be refused a restart, got %d", w.Code)
+	}
+	if w, _ := sendCommand(r, "admin", `{"command":"restart_collector","args":{"name":"logs"}}`); w.Code != http.StatusCreated {
+		t.Errorf("expected admins to restart collectors, got %d", w.Code)
+	}
+	if bus.subject == "" || bus.sent.Command != "restart_collector" {
+		t.Errorf("expected only the permitted command to be sent, got %+v", bus.sent)
+	}
+	if w, _ := sendCommand(r, "viewer", `{"command":"block_ip","args":{"ip":"203.0.113.9"}}`); w.Code != http.StatusForbidden {
+		t.Errorf("expected viewers to be refused a block, got %d", w.Code)
+	}
+	if w, _ := sendCommand(r, "analyst", `{"command":"block_ip","args":{"ip":"203.0.113.9","ttl_seconds":600}}`); w.Code != http.StatusCreated {
+		t.Errorf("expected analysts to block addresses, got %d", w.Code)
+	}
+	if bus.sent.Command != "block_ip" || bus.sent.RequestedBy != "analyst@example.com" {
+		t.Errorf("expected the block to name its requester, got %+v", bus.sent)
+	}
+
+	if w, _ := sendCommand(commandRouter(nil), "admin", `{"command":"status"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without NATS, got %d", w.Code)
+	}
+}
@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agentcreds"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+)
+
+const (
+	defaultEnrollmentTTL = 24 * time.Hour
+	maxEnrollmentTTL     = 7 * 24 * time.Hour
+)
+
+// EnrollmentHandler issues one-time enrollment tokens and exchanges them
+// for per-agent credentials. NATS is nil unless NATS runs in JWT mode.
+type EnrollmentHandler struct {
+	DB   *pgxpool.Pool
+	NATS *agentcreds.Issuer
+}
+
+func NewEnrollmentHandler(db *pgxpool.Pool, issuer *agentcreds.Issuer) *EnrollmentHandler {
+	return &EnrollmentHandler{DB: db, NATS: issuer}
+}
+
+type CreateEnrollmentTokenRequest struct {
+	Description string `json:"description"`
+	// ExpiresIn is in seconds.
+	ExpiresIn int `json:"expires_in"`
+}
+
+type EnrollmentTokenResponse struct {
+	ID          string     `json:"id"`
+	OrgID       string     `json:"org_id"`
+	Token       string     `json:"token,omitempty"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at"`
+	AgentID     *string    `json:"agent_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type EnrollRequest struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	// NKey is the agent's public NATS user key. The seed never leaves the
+	// agent.
+	NKey string `json:"nkey"`
+}
+
+type EnrollResponse struct {
+	AgentID string `json:"agent_id"`
+	OrgID   string `json:"org_id"`
+	// Token authenticates the agent to the API. It is only returned here.
+	Token string `json:"token"`
+	NATSCredentials
+}
+
+type NATSCredentials struct {
+	NATSJWT          string     `json:"nats_jwt,omitempty"`
+	NATSJWTExpiresAt *time.Time `json:"nats_jwt_expires_at,omitempty"`
+}
+
+func tokenStatus(t EnrollmentTokenResponse) string {
+	switch {
+	case t.UsedAt != nil:
+		return "used"
+	case time.Now().After(t.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+func (h *EnrollmentHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateEnrollmentTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+	ttl := defaultEnrollmentTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > maxEnrollmentTTL {
+		http.Error(w, `{"error":"expires_in must be between 1 second and 7 days"}`, http.StatusBadRequest)
+		return
+	}
+
+	token, hash, err := agentcreds.NewToken(agentcreds.EnrollmentPrefix)
+	if err != nil {
+		http.Error(w, `{"error":"failed to create enrollment token"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := EnrollmentTokenResponse{
+		ID:          uuid.NewString(),
+		OrgID:       orgID,
+		Token:       token,
+		Description: req.Description,
+		ExpiresAt:   time.Now().Add(ttl).UTC(),
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if h.DB != nil {
+		var createdBy *string
+		if id := auth.GetIdentity(r); id.UserID != "" {
+			createdBy = &id.UserID
+		}
+		err := h.DB.QueryRow(r.Context(),
+			`INSERT INTO enrollment_tokens (id, org_id, token_hash, description, created_by, expires_at)
+			 VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`,
+			resp.ID, orgID, hash, resp.Description, createdBy, resp.ExpiresAt,
+		).Scan(&resp.CreatedAt)
+		if err != nil {
+			http.Error(w, `{"error":"failed to create enrollment token"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+	resp.Status = tokenStatus(resp)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *EnrollmentHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
+	tokens := []EnrollmentTokenResponse{}
+	if h.DB != nil {
+		rows, err := h.DB.Query(r.Context(),
+			`SELECT id, org_id, description, expires_at, used_at, agent_id, created_at
+			 FROM enrollment_tokens WHERE org_id = $1 ORDER BY created_at DESC`, orgID)
+		if err != nil {
+			http.Error(w, `{"error":"failed to list enrollment tokens"}`, http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var t EnrollmentTokenResponse
+			if err := rows.Scan(&t.ID, &t.OrgID, &t.Description, &t.ExpiresAt, &t.UsedAt, &t.AgentID, &t.CreatedAt); err != nil {
+				continue
+			}
+			t.Status = tokenStatus(t)
+			tokens = append(tokens, t)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// DeleteToken withdraws an unused token. Used tokens stay as the record of
+// which token enrolled which agent.
+func (h *EnrollmentHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil || h.DB == nil {
+		http.Error(w, `{"error":"enrollment token not found"}`, http.StatusNotFound)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(),
+		`DELETE FROM enrollment_tokens WHERE id = $1 AND org_id = $2 AND used_at IS NULL`, id, orgID)
+	if err != nil {
+		http.Error(w, `{"error":"failed to delete enrollment token"}`, http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, `{"error":"enrollment token not found"}`, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Enroll exchanges an enrollment token for an agent and its credentials.
+// It is the one agent endpoint that is not authenticated; the token is.
+func (h *EnrollmentHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	var req EnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, `{"error":"token is required"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		req.Name = req.Hostname
+	}
+	if req.Name == "" {
+		http.Error(w, `{"error":"name or hostname is required"}`, http.StatusBadRequest)
+		return
+	}
+	if req.NKey != "" && !agentcreds.ValidUserKey(req.NKey) {
+		http.Error(w, `{"error":"nkey must be a public NATS user key"}`, http.StatusBadRequest)
+		return
+	}
+	if h.DB == nil {
+		http.Error(w, `{"error":"invalid or expired enrollment token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	credential, credentialHash, err := agentcreds.NewToken(agentcreds.AgentTokenPrefix)
+	if err != nil {
+		http.Error(w, `{"error":"failed to enroll agent"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := EnrollResponse{AgentID: uuid.NewString(), Token: credential}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, `{"error":"failed to enroll agent"}`, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var tokenID string
+	err = tx.QueryRow(r.Context(),
+		`SELECT id, org_id FROM enrollment_tokens
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 FOR UPDATE`, agentcreds.HashToken(req.Token),
+	).Scan(&tokenID, &resp.OrgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, `{"error":"invalid or expired enrollment token"}`, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"failed to enroll agent"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var nkey *string
+	if req.NKey != "" {
+		nkey = &req.NKey
+	}
+	_, err = tx.Exec(r.Context(),
+		`INSERT INTO agents (id, org_id, name, hostname, credential_hash, nkey_public, enrolled_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+		resp.AgentID, resp.OrgID, req.Name, req.Hostname, credentialHash, nkey,
+	)
+	if err == nil {
+		_, err = tx.Exec(r.Context(),
+			`UPDATE enrollment_tokens SET used_at = NOW(), agent_id = $1 WHERE id = $2`, resp.AgentID, tokenID)
+	}
+	if err != nil {
+		http.Error(w, `{"error":"failed to enroll agent"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Issue the NATS JWT before committing: if it fails the token stays
+	// unused, so the agent can simply enroll again.
+	if h.NATS != nil && req.NKey != "" {
+		creds, err := h.issueNATS(resp.OrgID, resp.AgentID, req.NKey)
+		if err != nil {
+			http.Error(w, `{"error":"failed to issue nats credentials"}`, http.StatusInternalServerError)
+			return
+		}
+		resp.NATSCredentials = creds
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, `{"error":"failed to enroll agent"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RefreshNATS issues the calling agent a fresh NATS JWT. Agents call it
+// before their current JWT expires; revoked agents are refused by
+// Authenticate and so lose NATS access when their last JWT runs out.
+func (h *EnrollmentHandler) RefreshNATS(w http.ResponseWriter, r *http.Request) {
+	id, ok := callerAgent(w, r)
+	if !ok {
+		return
+	}
+	if h.NATS == nil {
+		http.Error(w, `{"error":"nats credentials are not issued by this deployment"}`, http.StatusNotImplemented)
+		return
+	}
+	if h.DB == nil {
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var nkey *string
+	err := h.DB.QueryRow(r.Context(),
+		`SELECT nkey_public FROM agents WHERE id = $1 AND org_id = $2`, id.AgentID, id.OrgID,
+	).Scan(&nkey)
+	if err != nil {
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+	if nkey == nil {
+		http.Error(w, `{"error":"agent enrolled without an nkey"}`, http.StatusConflict)
+		return
+	}
+
+	creds, err := h.issueNATS(id.OrgID, id.AgentID, *nkey)
+	if err != nil {
+		http.Error(w, `{"error":"failed to issue nats credentials"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(creds)
+}
+
+func (h *EnrollmentHandler) issueNATS(orgID, agentID, nkey string) (NATSCredentials, error) {
+	token, expires, err := h.NATS.Issue(orgID, agentID, nkey)
+	if err != nil {
+		return NATSCredentials{}, err
+	}
+	return NATSCredentials{NATSJWT: token, NATSJWTExpiresAt: &expires}, nil
+}
+
+// Revoke disables an agent's credential. API calls with it fail at once;
+// NATS access ends when the agent's current JWT expires.
+func (h *EnrollmentHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil || h.DB == nil {
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+
+	var revokedAt time.Time
+	err := h.DB.QueryRow(r.Context(),
+		`UPDATE agents SET revoked_at = COALESCE(revoked_at, NOW()), status = 'revoked', updated_at = NOW()
+		 WHERE id = $1 AND org_id = $2 RETURNING revoked_at`, id, orgID,
+	).Scan(&revokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"failed to revoke agent"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":         id,
+		"status":     "revoked",
+		"revoked_at": revokedAt,
+	})
+}
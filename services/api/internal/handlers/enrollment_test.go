@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agentcreds"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/handlers"
+	"github.com/go-chi/chi/v5"
+	"github.com/nats-io/nkeys"
+)
+
+func TestCreateEnrollmentToken(t *testing.T) {
+	h := handlers.NewEnrollmentHandler(nil, nil)
+	req := userRequest(http.MethodPost, "/", bytes.NewBufferString(`{"description":"web-01","expires_in":3600}`))
+	w := httptest.NewRecorder()
+	h.CreateToken(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp handlers.EnrollmentTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !strings.HasPrefix(resp.Token, agentcreds.EnrollmentPrefix) || resp.OrgID != testOrgID || resp.Status != "active" {
+		t.Errorf("unexpected token %+v", resp)
+	}
+}
+
+func TestCreateEnrollmentTokenRejectsLongExpiry(t *testing.T) {
+	h := handlers.NewEnrollmentHandler(nil, nil)
+	for _, body := range []string{`{"expires_in":-1}`, `{"expires_in":2592000}`} {
+		w := httptest.NewRecorder()
+		h.CreateToken(w, userRequest(http.MethodPost, "/", bytes.NewBufferString(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestEnrollValidatesRequest(t *testing.T) {
+	h := handlers.NewEnrollmentHandler(nil, nil)
+	account, _ := nkeys.CreateAccount()
+	accountPub, _ := account.PublicKey()
+
+	cases := map[string]struct {
+		body string
+		code int
+	}{
+		"missing token":  {`{"hostname":"web-01"}`, http.StatusBadRequest},
+		"missing name":   {`{"token":"enr_x"}`, http.StatusBadRequest},
+		"account nkey":   {`{"token":"enr_x","hostname":"web-01","nkey":"` + accountPub + `"}`, http.StatusBadRequest},
+		"unknown token":  {`{"token":"enr_x","hostname":"web-01"}`, http.StatusUnauthorized},
+		"malformed json": {`{`, http.StatusBadRequest},
+	}
+	for name, tc := range cases {
+		w := httptest.NewRecorder()
+		h.Enroll(w, httptest.NewRequest(http.MethodPost, "/enroll", bytes.NewBufferString(tc.body)))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", name, tc.code, w.Code)
+		}
+	}
+}
+
+func TestRefreshNATSCredentials(t *testing.T) {
+	r := chi.NewRouter()
+	r.Post("/{id}/nats-credentials", handlers.NewEnrollmentHandler(nil, nil).RefreshNATS)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, agentRequest("agent-1", http.MethodPost, "/agent-1/nats-credentials", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without a NATS issuer, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, userRequest(http.MethodPost, "/agent-1/nats-credentials", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a user, got %d", w.Code)
+	}
+}
+
+func TestRevokeAgentNotFoundWithoutDB(t *testing.T) {
+	r := chi.NewRouter()
+	r.Post("/{id}/revoke", handlers.NewEnrollmentHandler(nil, nil).Revoke)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, userRequest(http.MethodPost, "/4b8e3c1d-2f6a-4a7b-9c0d-1e2f3a4b5c6d/revoke", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
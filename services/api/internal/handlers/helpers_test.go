@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+)
+
+const testOrgID = "7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10"
+
+// userRequest builds a request as an authenticated admin of testOrgID.
+func userRequest(method, target string, body io.Reader) *http.Request {
+	return roleRequest("admin", method, target, body)
+}
+
+func roleRequest(role, method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	return req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{
+		UserID:     "0d9c7b3e-5a41-4f2e-8c6d-2b1a0f9e8d7c",
+		KeycloakID: "kc-user-1",
+		OrgID:      testOrgID,
+		Email:      "analyst@example.com",
+		Role:       role,
+	}))
+}
+
+// serviceRequest builds a request as the engine's service identity.
+func serviceRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	return req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Service: true, Role: "service"}))
+}
+
+// agentRequest builds a request as an enrolled agent of testOrgID.
+func agentRequest(agentID, method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	return req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{
+		AgentID: agentID,
+		OrgID:   testOrgID,
+		Role:    "agent",
+	}))
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+)
+
+// callerOrg returns the org the authenticated user acts for. The service
+// identity has no org of its own and is refused.
+func callerOrg(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := auth.GetIdentity(r)
+	if id == nil {
+		http.Error(w, `{"error":"unauthenticated"}`, http.StatusUnauthorized)
+		return "", false
+	}
+	if id.Service || id.OrgID == "" {
+		http.Error(w, `{"error":"this endpoint requires a user token"}`, http.StatusForbidden)
+		return "", false
+	}
+	return id.OrgID, true
+}
+
+// callerAgent returns the enrolled agent making the request. If the route
+// names an agent, it must be the caller.
+func callerAgent(w http.ResponseWriter, r *http.Request) (*auth.Identity, bool) {
+	id := auth.GetIdentity(r)
+	if id == nil {
+		http.Error(w, `{"error":"unauthenticated"}`, http.StatusUnauthorized)
+		return nil, false
+	}
+	if id.AgentID == "" {
+		http.Error(w, `{"error":"this endpoint requires an agent credential"}`, http.StatusForbidden)
+		return nil, false
+	}
+	if param := chi.URLParam(r, "id"); param != "" && param != id.AgentID {
+		http.Error(w, `{"error":"agents may only report on themselves"}`, http.StatusForbidden)
+		return nil, false
+	}
+	return id, true
+}
+
+type MeResponse struct {
+	UserID      string            `json:"user_id,omitempty"`
+	AgentID     string            `json:"agent_id,omitempty"`
+	OrgID       string            `json:"org_id,omitempty"`
+	Email       string            `json:"email,omitempty"`
+	Role        string            `json:"role"`
+	RealmRoles  []string          `json:"realm_roles"`
+	Permissions []auth.Permission `json:"permissions"`
+}
+
+// Me describes the caller and their effective permissions so clients can
+// hide controls the caller cannot use.
+func Me(w http.ResponseWriter, r *http.Request) {
+	id := auth.GetIdentity(r)
+	if id == nil {
+		http.Error(w, `{"error":"unauthenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	resp := MeResponse{
+		UserID:      id.UserID,
+		AgentID:     id.AgentID,
+		OrgID:       id.OrgID,
+		Email:       id.Email,
+		Role:        id.Role,
+		RealmRoles:  id.RealmRoles,
+		Permissions: id.Permissions(),
+	}
+	if resp.RealmRoles == nil {
+		resp.RealmRoles = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,35 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/handlers"
+)
+
+func TestMeReturnsPermissions(t *testing.T) {
+	w := httptest.NewRecorder()
+	handlers.Me(w, roleRequest("viewer", http.MethodGet, "/me", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp handlers.MeResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.OrgID != testOrgID || resp.Role != "viewer" || resp.RealmRoles == nil {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if len(resp.Permissions) != 5 {
+		t.Errorf("expected the 5 viewer permissions, got %v", resp.Permissions)
+	}
+}
+
+func TestMeRequiresIdentity(t *testing.T) {
+	w := httptest.NewRecorder()
+	handlers.Me(w, httptest.NewRequest(http.MethodGet, "/me", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
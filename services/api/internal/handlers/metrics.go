@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -44,6 +45,11 @@ type EventResponse struct {
 }
 
 func (h *MetricsHandler) GetThreatScore(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
 	if h.DB == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -59,7 +65,7 @@ func (h *MetricsHandler) GetThreatScore(w http.ResponseWriter, r *http.Request)
 	err := h.DB.QueryRow(r.Context(),
 		`SELECT score, factors FROM threat_scores
 		 WHERE org_id = $1 ORDER BY time DESC LIMIT 1`,
-		r.URL.Query().Get("org_id"),
+		orgID,
 	).Scan(&score, &factors)
 
 	if err != nil {
@@ -83,7 +89,19 @@ func (h *MetricsHandler) GetThreatScore(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// IngestEvents stores events for the caller's org. The agent_id query
+// parameter must name one of the org's agents.
 func (h *MetricsHandler) IngestEvents(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+	agentID := r.URL.Query().Get("agent_id")
+	if _, err := uuid.Parse(agentID); err != nil {
+		http.Error(w, `{"error":"agent_id must be a uuid"}`, http.StatusBadRequest)
+		return
+	}
+
 	var events []EventIngest
 	if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
 		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
@@ -96,13 +114,25 @@ func (h *MetricsHandler) IngestEvents(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if h.DB != nil {
+		var owned bool
+		err := h.DB.QueryRow(r.Context(),
+			`SELECT EXISTS (SELECT 1 FROM agents WHERE id = $1 AND org_id = $2)`, agentID, orgID,
+		).Scan(&owned)
+		if err != nil {
+			http.Error(w, `{"error":"failed to ingest events"}`, http.StatusInternalServerError)
+			return
+		}
+		if !owned {
+			http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+			return
+		}
+
 		for _, e := range events {
 			payloadJSON, _ := json.Marshal(e.Payload)
 			_, err := h.DB.Exec(r.Context(),
 				`INSERT INTO events (time, org_id, agent_id, source, category, severity, summary, payload)
 				 VALUES (NOW(), $1, $2, $3, $4, $5, $6, $7)`,
-				r.URL.Query().Get("org_id"),
-				r.URL.Query().Get("agent_id"),
+				orgID, agentID,
 				e.Source, e.Category, e.Severity, e.Summary, payloadJSON,
 			)
 			if err != nil {
@@ -120,6 +150,11 @@ func (h *MetricsHandler) IngestEvents(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MetricsHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
 	if h.DB == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode([]EventResponse{})
@@ -131,9 +166,9 @@ func (h *MetricsHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
 	severity := r.URL.Query().Get("severity")
 
 	query := `SELECT time, org_id, agent_id, source, category, severity, risk_score, summary, payload
-		FROM events WHERE 1=1`
-	args := []interface{}{}
-	argIdx := 1
+		FROM events WHERE org_id = $1`
+	args := []interface{}{orgID}
+	argIdx := 2
 
 	if source != "" {
 		query += ` AND source = $` + fmt.Sprintf("%d", argIdx)
@@ -177,6 +212,11 @@ func (h *MetricsHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MetricsHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
 	if h.DB == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode([]MetricPoint{})
@@ -209,9 +249,9 @@ func (h *MetricsHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := h.DB.Query(r.Context(),
 		`SELECT time, metric_name, metric_value FROM metrics
-		 WHERE metric_name = $1 AND time > NOW() - $2::interval
+		 WHERE org_id = $1 AND metric_name = $2 AND time > NOW() - $3::interval
 		 ORDER BY time ASC`,
-		name, duration,
+		orgID, name, duration,
 	)
 	if err != nil {
 		http.Error(w, `{"error":"failed to query metrics"}`, http.StatusInternalServerError)
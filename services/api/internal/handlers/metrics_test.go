@@ -12,7 +12,7 @@ import (
 
 func TestGetThreatScoreReturns200(t *testing.T) {
 	h := handlers.NewMetricsHandler(nil)
-	req := httptest.NewRequest(http.MethodGet, "/threat-score", nil)
+	req := userRequest(http.MethodGet, "/threat-score", nil)
 	w := httptest.NewRecorder()
 
 	h.GetThreatScore(w, req)
@@ -31,7 +31,7 @@ func TestGetThreatScoreReturns200(t *testing.T) {
 func TestIngestEventsReturns201(t *testing.T) {
 	h := handlers.NewMetricsHandler(nil)
 	body := `[{"source":"syslog","category":"auth","severity":"medium","summary":"Failed SSH login","payload":{}}]`
-	req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(body))
+	req := userRequest(http.MethodPost, "/events?agent_id=4b8e3c1d-2f6a-4a7b-9c0d-1e2f3a4b5c6d", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -51,7 +51,7 @@ func TestIngestEventsReturns201(t *testing.T) {
 func TestIngestEventsRejectsEmptyBatch(t *testing.T) {
 	h := handlers.NewMetricsHandler(nil)
 	body := `[]`
-	req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(body))
+	req := userRequest(http.MethodPost, "/events?agent_id=4b8e3c1d-2f6a-4a7b-9c0d-1e2f3a4b5c6d", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -64,7 +64,7 @@ func TestIngestEventsRejectsEmptyBatch(t *testing.T) {
 
 func TestListEventsReturnsEmptyArray(t *testing.T) {
 	h := handlers.NewMetricsHandler(nil)
-	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req := userRequest(http.MethodGet, "/events", nil)
 	w := httptest.NewRecorder()
 
 	h.ListEvents(w, req)
@@ -82,7 +82,7 @@ func TestListEventsReturnsEmptyArray(t *testing.T) {
 
 func TestQueryMetricsReturnsEmptyArray(t *testing.T) {
 	h := handlers.NewMetricsHandler(nil)
-	req := httptest.NewRequest(http.MethodGet, "/?name=cpu&range=24h", nil)
+	req := userRequest(http.MethodGet, "/?name=cpu&range=24h", nil)
 	w := httptest.NewRecorder()
 
 	h.QueryMetrics(w, req)
@@ -97,3 +97,16 @@ func TestQueryMetricsReturnsEmptyArray(t *testing.T) {
 		t.Errorf("expected empty array, got %d items", len(resp))
 	}
 }
+
+func TestIngestEventsRequiresAgentID(t *testing.T) {
+	h := handlers.NewMetricsHandler(nil)
+	body := `[{"source":"network","category":"port_scan","severity":"high","summary":"scan"}]`
+	req := userRequest(http.MethodPost, "/events?org_id="+testOrgID, bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	h.IngestEvents(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
 )
 
 type OrgHandler struct {
@@ -28,7 +30,19 @@ type OrgResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Create provisions a new tenant. Users belong to exactly one org, so only
+// the service identity may create orgs.
 func (h *OrgHandler) Create(w http.ResponseWriter, r *http.Request) {
+	caller := auth.GetIdentity(r)
+	if caller == nil {
+		http.Error(w, `{"error":"unauthenticated"}`, http.StatusUnauthorized)
+		return
+	}
+	if !caller.Service {
+		http.Error(w, `{"error":"organizations can only be created by the platform"}`, http.StatusForbidden)
+		return
+	}
+
 	var req CreateOrgRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
@@ -63,7 +77,13 @@ func (h *OrgHandler) Create(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(org)
 }
 
+// List returns the caller's own org.
 func (h *OrgHandler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
 	if h.DB == nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode([]OrgResponse{})
@@ -71,7 +91,7 @@ func (h *OrgHandler) List(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := h.DB.Query(r.Context(),
-		`SELECT id, name, plan, created_at FROM organizations ORDER BY created_at DESC`)
+		`SELECT id, name, plan, created_at FROM organizations WHERE id = $1`, orgID)
 	if err != nil {
 		http.Error(w, `{"error":"failed to list organizations"}`, http.StatusInternalServerError)
 		return
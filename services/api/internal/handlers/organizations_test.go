@@ -13,7 +13,7 @@ import (
 func TestCreateOrgReturns201(t *testing.T) {
 	h := handlers.NewOrgHandler(nil)
 	body := `{"name":"Test Corp"}`
-	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req := serviceRequest(http.MethodPost, "/", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -33,7 +33,7 @@ func TestCreateOrgReturns201(t *testing.T) {
 func TestCreateOrgRejectsMissingName(t *testing.T) {
 	h := handlers.NewOrgHandler(nil)
 	body := `{}`
-	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req := serviceRequest(http.MethodPost, "/", bytes.NewBufferString(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -43,3 +43,15 @@ func TestCreateOrgRejectsMissingName(t *testing.T) {
 		t.Errorf("expected 400, got %d", w.Code)
 	}
 }
+
+func TestCreateOrgRejectsUsers(t *testing.T) {
+	h := handlers.NewOrgHandler(nil)
+	req := userRequest(http.MethodPost, "/", bytes.NewBufferString(`{"name":"Other Corp"}`))
+	w := httptest.NewRecorder()
+
+	h.Create(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+}
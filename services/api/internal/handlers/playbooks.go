@@ -0,0 +1,814 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
+)
+
+// PlaybookApprovalSubject is the NATS subject the engine takes approvals
+// of waiting playbook steps on.
+const PlaybookApprovalSubject = "playbooks.approve"
+
+const (
+	maxPlaybookSteps       = 20
+	maxPlaybookStepTimeout = 300
+	playbookApprovalWait   = 10 * time.Second
+)
+
+var validStepTypes = map[string]bool{
+	"enrich":        true,
+	"notify":        true,
+	"webhook":       true,
+	"agent_command": true,
+	"set_status":    true,
+	"assign":        true,
+}
+
+var validLookups = map[string]bool{
+	"agent":          true,
+	"related_alerts": true,
+}
+
+// Step names key the outputs later steps can template against.
+var stepNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// The engine renders step parameters with these functions.
+var playbookTemplateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"field": func(string) interface{} { return nil },
+}
+
+// PlaybookHandler manages playbooks and exposes their execution log. The
+// engine runs the playbooks; approvals are relayed to it over NATS.
+type PlaybookHandler struct {
+	DB      *pgxpool.Pool
+	Secrets *secrets.Box
+	Bus     Requester
+}
+
+func NewPlaybookHandler(db *pgxpool.Pool, box *secrets.Box, bus Requester) *PlaybookHandler {
+	return &PlaybookHandler{DB: db, Secrets: box, Bus: bus}
+}
+
+type PlaybookConditions struct {
+	Categories  []string          `json:"categories,omitempty"`
+	MinSeverity string            `json:"min_severity,omitempty"`
+	Rules       []string          `json:"rules,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+}
+
+type PlaybookStep struct {
+	Name            string          `json:"name"`
+	Type            string          `json:"type"`
+	Params          json.RawMessage `json:"params,omitempty"`
+	TimeoutSeconds  int             `json:"timeout_seconds,omitempty"`
+	RequireApproval bool            `json:"require_approval,omitempty"`
+	ContinueOnError bool            `json:"continue_on_error,omitempty"`
+}
+
+type PlaybookRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Conditions  PlaybookConditions `json:"conditions"`
+	Steps       []PlaybookStep     `json:"steps"`
+	Enabled     *bool              `json:"enabled"`
+}
+
+type PlaybookResponse struct {
+	ID          string             `json:"id"`
+	OrgID       string             `json:"org_id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Conditions  PlaybookConditions `json:"conditions"`
+	Steps       []PlaybookStep     `json:"steps"`
+	Enabled     bool               `json:"enabled"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+type PlaybookExecutionResponse struct {
+	ID           string            `json:"id"`
+	PlaybookID   *string           `json:"playbook_id"`
+	PlaybookName string            `json:"playbook_name"`
+	AlertID      string            `json:"alert_id"`
+	Status       string            `json:"status"`
+	CurrentStep  int               `json:"current_step"`
+	Steps        []PlaybookStep    `json:"steps"`
+	Outputs      json.RawMessage   `json:"outputs"`
+	Error        *string           `json:"error"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	CompletedAt  *time.Time        `json:"completed_at"`
+	StepRuns     []PlaybookStepRun `json:"step_runs,omitempty"`
+}
+
+type PlaybookStepRun struct {
+	StepIndex  int             `json:"step_index"`
+	StepName   string          `json:"step_name"`
+	StepType   string          `json:"step_type"`
+	Status     string          `json:"status"`
+	Output     json.RawMessage `json:"output"`
+	Error      *string         `json:"error"`
+	Actor      *string         `json:"actor"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+}
+
+type playbookApprovalRequest struct {
+	OrgID       string `json:"org_id"`
+	ExecutionID string `json:"execution_id"`
+	Step        int    `json:"step"`
+	Approved    bool   `json:"approved"`
+	Actor       string `json:"actor"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type playbookApprovalReply struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+type webhookParams struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+const playbookColumns = `id, org_id, name, description, conditions, steps, enabled, created_at, updated_at`
+
+func (h *PlaybookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var req PlaybookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	p := PlaybookResponse{ID: uuid.NewString(), OrgID: orgID, Enabled: true, CreatedAt: now, UpdatedAt: now}
+	if !h.applyRequest(w, r, &p, req, nil) {
+		return
+	}
+
+	if h.DB != nil {
+		conditions, _ := json.Marshal(p.Conditions)
+		steps, _ := json.Marshal(p.Steps)
+		err := h.DB.QueryRow(r.Context(),
+			`INSERT INTO playbooks (id, org_id, name, description, conditions, steps, enabled)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at, updated_at`,
+			p.ID, p.OrgID, p.Name, p.Description, conditions, steps, p.Enabled,
+		).Scan(&p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			http.Error(w, `{"error":"failed to create playbook"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.writePlaybook(w, http.StatusCreated, p)
+}
+
+func (h *PlaybookHandler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
+	playbooks := []PlaybookResponse{}
+	if h.DB != nil {
+		rows, err := h.DB.Query(r.Context(),
+			`SELECT `+playbookColumns+` FROM playbooks WHERE org_id = $1 ORDER BY created_at DESC`, orgID)
+		if err != nil {
+			http.Error(w, `{"error":"failed to list playbooks"}`, http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			p, err := scanPlaybook(rows)
+			if err != nil {
+				continue
+			}
+			p.Steps = h.redactSteps(p.Steps)
+			playbooks = append(playbooks, p)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(playbooks)
+}
+
+func (h *PlaybookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	h.writePlaybook(w, http.StatusOK, p)
+}
+
+// Update replaces the playbook. Redacted webhook secrets keep the stored
+// value of the webhook step at the same position. Runs already started
+// keep the steps they started with.
+func (h *PlaybookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req PlaybookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+
+	p, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if !h.applyRequest(w, r, &p, req, p.Steps) {
+		return
+	}
+
+	conditions, _ := json.Marshal(p.Conditions)
+	steps, _ := json.Marshal(p.Steps)
+	err := h.DB.QueryRow(r.Context(),
+		`UPDATE playbooks SET name = $1, description = $2, conditions = $3, steps = $4, enabled = $5, updated_at = NOW()
+		 WHERE id = $6 AND org_id = $7 RETURNING updated_at`,
+		p.Name, p.Description, conditions, steps, p.Enabled, p.ID, p.OrgID,
+	).Scan(&p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, `{"error":"playbook not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"failed to update playbook"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.writePlaybook(w, http.StatusOK, p)
+}
+
+// Delete removes the playbook; its executions stay in the log.
+func (h *PlaybookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil || h.DB == nil {
+		http.Error(w, `{"error":"playbook not found"}`, http.StatusNotFound)
+		return
+	}
+
+	tag, err := h.DB.Exec(r.Context(), `DELETE FROM playbooks WHERE id = $1 AND org_id = $2`, id, orgID)
+	if err != nil {
+		http.Error(w, `{"error":"failed to delete playbook"}`, http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, `{"error":"playbook not found"}`, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListExecutions returns the org's most recent executions, optionally
+// filtered by playbook_id, alert_id or status.
+func (h *PlaybookHandler) ListExecutions(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return
+	}
+
+	executions := []PlaybookExecutionResponse{}
+	if h.DB != nil {
+		query := `SELECT ` + executionColumns + ` FROM playbook_executions WHERE org_id = $1`
+		args := []interface{}{orgID}
+		for _, filter := range []string{"playbook_id", "alert_id", "status"} {
+			v := r.URL.Query().Get(filter)
+			if v == "" {
+				continue
+			}
+			if filter != "status" {
+				if _, err := uuid.Parse(v); err != nil {
+					jsonError(w, http.StatusBadRequest, filter+" must be a uuid")
+					return
+				}
+			}
+			args = append(args, v)
+			query += fmt.Sprintf(" AND %s = $%d", filter, len(args))
+		}
+		query += ` ORDER BY created_at DESC LIMIT 100`
+
+		rows, err := h.DB.Query(r.Context(), query, args...)
+		if err != nil {
+			http.Error(w, `{"error":"failed to list playbook executions"}`, http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e, err := scanExecution(rows)
+			if err != nil {
+				continue
+			}
+			e.Steps = h.redactSteps(e.Steps)
+			executions = append(executions, e)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(executions)
+}
+
+// GetExecution returns an execution with its step log.
+func (h *PlaybookHandler) GetExecution(w http.ResponseWriter, r *http.Request) {
+	e, ok := h.loadExecution(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *PlaybookHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, true)
+}
+
+func (h *PlaybookHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, false)
+}
+
+// decide relays an approval or rejection of the step the execution is
+// waiting at. Approving an agent command also needs the permission to send
+// that command directly.
+func (h *PlaybookHandler) decide(w http.ResponseWriter, r *http.Request, approved bool) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	e, ok := h.loadExecution(w, r)
+	if !ok {
+		return
+	}
+	if e.Status != "awaiting_approval" || e.CurrentStep >= len(e.Steps) {
+		jsonError(w, http.StatusConflict, "execution is "+e.Status+", not awaiting approval")
+		return
+	}
+	if step := e.Steps[e.CurrentStep]; step.Type == "agent_command" {
+		var p struct {
+			Command string `json:"command"`
+		}
+		json.Unmarshal(step.Params, &p)
+		if perm, known := commandPermissions[p.Command]; known && !auth.Can(r, perm) {
+			auth.Forbid(w, perm)
+			return
+		}
+	}
+	if h.Bus == nil {
+		http.Error(w, `{"error":"playbook service unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	caller := auth.GetIdentity(r)
+	data, _ := json.Marshal(playbookApprovalRequest{
+		OrgID:       caller.OrgID,
+		ExecutionID: e.ID,
+		Step:        e.CurrentStep,
+		Approved:    approved,
+		Actor:       caller.Email,
+		Reason:      body.Reason,
+	})
+	replyData, err := h.Bus.Request(PlaybookApprovalSubject, data, playbookApprovalWait)
+	if err != nil {
+		http.Error(w, `{"error":"playbook service unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+	var reply playbookApprovalReply
+	if err := json.Unmarshal(replyData, &reply); err != nil {
+		http.Error(w, `{"error":"invalid reply from playbook service"}`, http.StatusBadGateway)
+		return
+	}
+	if reply.Error != "" {
+		jsonError(w, http.StatusConflict, reply.Error)
+		return
+	}
+
+	if e, ok = h.loadExecution(w, r); !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *PlaybookHandler) load(w http.ResponseWriter, r *http.Request) (PlaybookResponse, bool) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return PlaybookResponse{}, false
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil || h.DB == nil {
+		http.Error(w, `{"error":"playbook not found"}`, http.StatusNotFound)
+		return PlaybookResponse{}, false
+	}
+
+	p, err := scanPlaybook(h.DB.QueryRow(r.Context(),
+		`SELECT `+playbookColumns+` FROM playbooks WHERE id = $1 AND org_id = $2`, id, orgID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, `{"error":"playbook not found"}`, http.StatusNotFound)
+		return PlaybookResponse{}, false
+	}
+	if err != nil {
+		http.Error(w, `{"error":"failed to load playbook"}`, http.StatusInternalServerError)
+		return PlaybookResponse{}, false
+	}
+	return p, true
+}
+
+const executionColumns = `id, playbook_id, playbook_name, alert_id, status, current_step,
+	steps, outputs, error, created_at, updated_at, completed_at`
+
+// loadExecution fetches the caller's execution named in the URL, with its
+// step log and webhook secrets redacted.
+func (h *PlaybookHandler) loadExecution(w http.ResponseWriter, r *http.Request) (PlaybookExecutionResponse, bool) {
+	orgID, ok := callerOrg(w, r)
+	if !ok {
+		return PlaybookExecutionResponse{}, false
+	}
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil || h.DB == nil {
+		http.Error(w, `{"error":"playbook execution not found"}`, http.StatusNotFound)
+		return PlaybookExecutionResponse{}, false
+	}
+
+	e, err := scanExecution(h.DB.QueryRow(r.Context(),
+		`SELECT `+executionColumns+` FROM playbook_executions WHERE id = $1 AND org_id = $2`, id, orgID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, `{"error":"playbook execution not found"}`, http.StatusNotFound)
+		return PlaybookExecutionResponse{}, false
+	}
+	if err != nil {
+		http.Error(w, `{"error":"failed to load playbook execution"}`, http.StatusInternalServerError)
+		return PlaybookExecutionResponse{}, false
+	}
+	e.Steps = h.redactSteps(e.Steps)
+
+	rows, err := h.DB.Query(r.Context(),
+		`SELECT step_index, step_name, step_type, status, output, error, actor, started_at, finished_at
+		 FROM playbook_step_runs WHERE execution_id = $1 ORDER BY id`, id)
+	if err != nil {
+		http.Error(w, `{"error":"failed to load playbook execution"}`, http.StatusInternalServerError)
+		return PlaybookExecutionResponse{}, false
+	}
+	defer rows.Close()
+	e.StepRuns = []PlaybookStepRun{}
+	for rows.Next() {
+		var s PlaybookStepRun
+		if err := rows.Scan(&s.StepIndex, &s.StepName, &s.StepType, &s.Status, &s.Output,
+			&s.Error, &s.Actor, &s.StartedAt, &s.FinishedAt); err != nil {
+			continue
+		}
+		e.StepRuns = append(e.StepRuns, s)
+	}
+	return e, true
+}
+
+// applyRequest validates req and copies it onto p with webhook secrets
+// sealed. stored holds the playbook's current steps when updating.
+func (h *PlaybookHandler) applyRequest(w http.ResponseWriter, r *http.Request, p *PlaybookResponse, req PlaybookRequest, stored []PlaybookStep) bool {
+	if req.Name == "" {
+		http.Error(w, `{"error":"name is required"}`, http.StatusBadRequest)
+		return false
+	}
+	if len(req.Name) > 255 {
+		http.Error(w, `{"error":"name must be at most 255 characters"}`, http.StatusBadRequest)
+		return false
+	}
+	if err := validateConditions(req.Conditions); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if len(req.Steps) == 0 {
+		http.Error(w, `{"error":"at least one step is required"}`, http.StatusBadRequest)
+		return false
+	}
+	if len(req.Steps) > maxPlaybookSteps {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("a playbook has at most %d steps", maxPlaybookSteps))
+		return false
+	}
+
+	names := make(map[string]bool, len(req.Steps))
+	steps := make([]PlaybookStep, 0, len(req.Steps))
+	for i, step := range req.Steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("%s_%d", step.Type, i+1)
+		}
+		if err := validateStep(i, step); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+		if names[step.Name] {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("step %d: duplicate name %q", i+1, step.Name))
+			return false
+		}
+		names[step.Name] = true
+
+		switch step.Type {
+		case "agent_command":
+			// Only someone who could send the command may automate it.
+			var params struct {
+				Command string `json:"command"`
+			}
+			json.Unmarshal(step.Params, &params)
+			if perm := commandPermissions[params.Command]; !auth.Can(r, perm) {
+				auth.Forbid(w, perm)
+				return false
+			}
+		case "webhook":
+			var previous *PlaybookStep
+			if i < len(stored) && stored[i].Type == "webhook" {
+				previous = &stored[i]
+			}
+			sealed, err := h.sealWebhook(i, step, previous)
+			if errors.Is(err, secrets.ErrNoKey) {
+				http.Error(w, `{"error":"webhook secrets cannot be stored: SECRETS_KEY is not configured"}`, http.StatusServiceUnavailable)
+				return false
+			}
+			if err != nil {
+				jsonError(w, http.StatusBadRequest, err.Error())
+				return false
+			}
+			step = sealed
+		}
+		steps = append(steps, step)
+	}
+
+	p.Name = req.Name
+	p.Description = req.Description
+	p.Conditions = req.Conditions
+	p.Steps = steps
+	if req.Enabled != nil {
+		p.Enabled = *req.Enabled
+	}
+	return true
+}
+
+func validateConditions(c PlaybookConditions) error {
+	if c.MinSeverity != "" && !validSeverities[c.MinSeverity] {
+		return errors.New("invalid conditions.min_severity, must be one of: info, low, medium, high, critical")
+	}
+	for field, pattern := range c.Fields {
+		if field == "" {
+			return errors.New("conditions.fields: field path must not be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("conditions.fields.%s: invalid pattern %q", field, pattern)
+		}
+	}
+	return nil
+}
+
+func validateStep(i int, step PlaybookStep) error {
+	n := i + 1
+	if !validStepTypes[step.Type] {
+		return fmt.Errorf("step %d: invalid type %q, must be one of: enrich, notify, webhook, agent_command, set_status, assign", n, step.Type)
+	}
+	if !stepNamePattern.MatchString(step.Name) || len(step.Name) > 100 {
+		return fmt.Errorf("step %d: name must start with a letter and contain only letters, digits and underscores", n)
+	}
+	if step.TimeoutSeconds < 0 || step.TimeoutSeconds > maxPlaybookStepTimeout {
+		return fmt.Errorf("step %d: timeout_seconds must be between 0 and %d", n, maxPlaybookStepTimeout)
+	}
+	decode := func(v interface{}) error {
+		if len(step.Params) == 0 || string(step.Params) == "null" {
+			return nil
+		}
+		if err := json.Unmarshal(step.Params, v); err != nil {
+			return fmt.Errorf("step %d: invalid params: %v", n, err)
+		}
+		return nil
+	}
+
+	switch step.Type {
+	case "enrich":
+		var p struct {
+			Lookups []string `json:"lookups"`
+		}
+		if err := decode(&p); err != nil {
+			return err
+		}
+		for _, l := range p.Lookups {
+			if !validLookups[l] {
+				return fmt.Errorf("step %d: unknown lookup %q, must be one of: agent, related_alerts", n, l)
+			}
+		}
+	case "notify":
+		var p struct {
+			RuleID string `json:"rule_id"`
+		}
+		if err := decode(&p); err != nil {
+			return err
+		}
+		if _, err := uuid.Parse(p.RuleID); err != nil {
+			return fmt.Errorf("step %d: rule_id must be the id of an alert rule", n)
+		}
+	case "webhook":
+		var p webhookParams
+		if err := decode(&p); err != nil {
+			return err
+		}
+		if p.URL == "" {
+			return fmt.Errorf("step %d: url is required", n)
+		}
+		if !secrets.IsSealed(p.URL) && !isRedacted(p.URL) {
+			u, err := url.Parse(p.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("step %d: url must be an absolute http(s) url", n)
+			}
+		}
+	case "agent_command":
+		var p struct {
+			Command string          `json:"command"`
+			Args    json.RawMessage `json:"args"`
+			AgentID string          `json:"agent_id"`
+		}
+		if err := decode(&p); err != nil {
+			return err
+		}
+		if _, known := commandPermissions[p.Command]; !known {
+			return fmt.Errorf("step %d: unknown command, must be one of: %s", n, commandNames())
+		}
+		if err := checkTemplates(p.AgentID); err != nil {
+			return fmt.Errorf("step %d: agent_id: %v", n, err)
+		}
+		if len(p.Args) > 0 {
+			var args interface{}
+			if err := json.Unmarshal(p.Args, &args); err != nil {
+				return fmt.Errorf("step %d: invalid args: %v", n, err)
+			}
+			if err := checkTemplates(args); err != nil {
+				return fmt.Errorf("step %d: args: %v", n, err)
+			}
+		}
+	case "set_status":
+		var p struct {
+			Status string `json:"status"`
+		}
+		if err := decode(&p); err != nil {
+			return err
+		}
+		if !validStatuses[p.Status] {
+			return fmt.Errorf("step %d: invalid status, must be one of: open, acknowledged, resolved, escalated", n)
+		}
+	case "assign":
+		var p struct {
+			AssigneeID string `json:"assignee_id"`
+		}
+		if err := decode(&p); err != nil {
+			return err
+		}
+		if _, err := uuid.Parse(p.AssigneeID); err != nil {
+			return fmt.Errorf("step %d: assignee_id must be a user id", n)
+		}
+	}
+	return nil
+}
+
+// checkTemplates parses every string in v as the engine will.
+func checkTemplates(v interface{}) error {
+	switch x := v.(type) {
+	case string:
+		if !strings.Contains(x, "{{") {
+			return nil
+		}
+		if _, err := template.New("param").Funcs(playbookTemplateFuncs).Parse(x); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	case map[string]interface{}:
+		for _, item := range x {
+			if err := checkTemplates(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range x {
+			if err := checkTemplates(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sealWebhook seals the step's URL and header values. Redacted values are
+// replaced by those of previous, the stored step at the same position.
+func (h *PlaybookHandler) sealWebhook(i int, step PlaybookStep, previous *PlaybookStep) (PlaybookStep, error) {
+	var p, old webhookParams
+	json.Unmarshal(step.Params, &p)
+	if previous != nil {
+		json.Unmarshal(previous.Params, &old)
+	}
+	seal := func(field, value, stored string) (string, error) {
+		if isRedacted(value) {
+			if stored == "" {
+				return "", fmt.Errorf("step %d: %s is redacted; provide the full value", i+1, field)
+			}
+			return stored, nil
+		}
+		if value == "" || secrets.IsSealed(value) {
+			return value, nil
+		}
+		return h.Secrets.Seal(value)
+	}
+
+	var err error
+	if p.URL, err = seal("url", p.URL, old.URL); err != nil {
+		return step, err
+	}
+	if len(p.Headers) > 0 {
+		headers := make(map[string]string, len(p.Headers))
+		for k, v := range p.Headers {
+			if headers[k], err = seal("header "+k, v, old.Headers[k]); err != nil {
+				return step, err
+			}
+		}
+		p.Headers = headers
+	}
+	step.Params, _ = json.Marshal(p)
+	return step, nil
+}
+
+// redactSteps hides webhook secrets the way alert rule channels are.
+func (h *PlaybookHandler) redactSteps(steps []PlaybookStep) []PlaybookStep {
+	out := make([]PlaybookStep, len(steps))
+	for i, step := range steps {
+		if step.Type == "webhook" {
+			var p webhookParams
+			json.Unmarshal(step.Params, &p)
+			ch := redactChannel(h.Secrets, NotificationChannel{Type: "webhook", URL: p.URL, Headers: p.Headers})
+			p.URL, p.Headers = ch.URL, ch.Headers
+			step.Params, _ = json.Marshal(p)
+		}
+		out[i] = step
+	}
+	return out
+}
+
+func (h *PlaybookHandler) writePlaybook(w http.ResponseWriter, status int, p PlaybookResponse) {
+	p.Steps = h.redactSteps(p.Steps)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func scanPlaybook(row pgx.Row) (PlaybookResponse, error) {
+	var (
+		p                 PlaybookResponse
+		conditions, steps []byte
+	)
+	err := row.Scan(&p.ID, &p.OrgID, &p.Name, &p.Description, &conditions, &steps, &p.Enabled, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(conditions, &p.Conditions); err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(steps, &p.Steps); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+func scanExecution(row pgx.Row) (PlaybookExecutionResponse, error) {
+	var (
+		e     PlaybookExecutionResponse
+		steps []byte
+	)
+	err := row.Scan(&e.ID, &e.PlaybookID, &e.PlaybookName, &e.AlertID, &e.Status, &e.CurrentStep,
+		&steps, &e.Outputs, &e.Error, &e.CreatedAt, &e.UpdatedAt, &e.CompletedAt)
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(steps, &e.Steps); err != nil {
+		return e, err
+	}
+	return e, nil
+}
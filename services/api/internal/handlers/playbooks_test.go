@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/handlers"
+)
+
+func newPlaybookHandler(t *testing.T, bus handlers.Requester) *handlers.PlaybookHandler {
+	t.Helper()
+	box, err := secrets.NewBox(bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handlers.NewPlaybookHandler(nil, box, bus)
+}
+
+func createPlaybook(h *handlers.PlaybookHandler, role, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.Create(w, roleRequest(role, http.MethodPost, "/", bytes.NewBufferString(body)))
+	return w
+}
+
+func TestCreatePlaybook(t *testing.T) {
+	w := createPlaybook(newPlaybookHandler(t, nil), "admin", `{
+		"name": "contain brute force",
+		"conditions": {"rules": ["brute_force_attack"], "min_severity": "high", "fields": {"group_key.payload.src_ip": "203.0.113.*"}},
+		"steps": [
+			{"type": "enrich", "params": {"lookups": ["agent", "related_alerts"]}},
+			{"name": "ticket", "type": "webhook", "params": {"url": "https://tickets.example.com/hook", "headers": {"Authorization": "Bearer abc"}}, "continue_on_error": true},
+			{"name": "block", "type": "agent_command", "params": {"command": "block_ip", "args": {"ip": "{{field \"group_key.payload.src_ip\"}}"}}, "timeout_seconds": 60}
+		]
+	}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, secret := range []string{"tickets.example.com/hook", "Bearer abc", "enc:v1:"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("response leaks %q: %s", secret, body)
+		}
+	}
+
+	var resp handlers.PlaybookResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.OrgID != testOrgID || !resp.Enabled || len(resp.Steps) != 3 {
+		t.Fatalf("unexpected playbook %+v", resp)
+	}
+	if resp.Steps[0].Name != "enrich_1" {
+		t.Errorf("expected a default step name, got %q", resp.Steps[0].Name)
+	}
+}
+
+func TestCreatePlaybookValidation(t *testing.T) {
+	h := newPlaybookHandler(t, nil)
+	cases := map[string]string{
+		"no name":          `{"steps":[{"type":"enrich"}]}`,
+		"no steps":         `{"name":"p","steps":[]}`,
+		"bad severity":     `{"name":"p","conditions":{"min_severity":"urgent"},"steps":[{"type":"enrich"}]}`,
+		"bad pattern":      `{"name":"p","conditions":{"fields":{"user":"["}},"steps":[{"type":"enrich"}]}`,
+		"unknown type":     `{"name":"p","steps":[{"type":"shell"}]}`,
+		"bad step name":    `{"name":"p","steps":[{"name":"1st","type":"enrich"}]}`,
+		"duplicate names":  `{"name":"p","steps":[{"name":"a","type":"enrich"},{"name":"a","type":"enrich"}]}`,
+		"long timeout":     `{"name":"p","steps":[{"type":"enrich","timeout_seconds":301}]}`,
+		"unknown lookup":   `{"name":"p","steps":[{"type":"enrich","params":{"lookups":["whois"]}}]}`,
+		"notify no rule":   `{"name":"p","steps":[{"type":"notify","params":{}}]}`,
+		"webhook no url":   `{"name":"p","steps":[{"type":"webhook","params":{}}]}`,
+		"webhook scheme":   `{"name":"p","steps":[{"type":"webhook","params":{"url":"ftp://example.com"}}]}`,
+		"unknown command":  `{"name":"p","steps":[{"type":"agent_command","params":{"command":"rm"}}]}`,
+		"bad template":     `{"name":"p","steps":[{"type":"agent_command","params":{"command":"block_ip","args":{"ip":"{{field"}}}]}`,
+		"bad status":       `{"name":"p","steps":[{"type":"set_status","params":{"status":"closed"}}]}`,
+		"bad assignee":     `{"name":"p","steps":[{"type":"assign","params":{"assignee_id":"bob"}}]}`,
+		"redacted new url": `{"name":"p","steps":[{"type":"webhook","params":{"url":"https://example.com/********"}}]}`,
+	}
+	for name, body := range cases {
+		if w := createPlaybook(h, "admin", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCreatePlaybookNeedsCommandPermission(t *testing.T) {
+	w := createPlaybook(newPlaybookHandler(t, nil), "analyst",
+		`{"name":"p","steps":[{"type":"agent_command","params":{"command":"restart_collector","args":{"collector":"logs"}}}]}`)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a command the caller cannot send, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPlaybookExecutionsWithoutDB(t *testing.T) {
+	bus := &fakeRequester{reply: `{"status":"approved"}`}
+	h := newPlaybookHandler(t, bus)
+	r := chi.NewRouter()
+	r.Get("/", h.ListExecutions)
+	r.Post("/{id}/approve", h.Approve)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, userRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("expected an empty list, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, roleRequest("analyst", http.MethodPost, "/3f0d3c4a-1b2c-4d5e-8f90-a1b2c3d4e5f6/approve", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown execution, got %d: %s", w.Code, w.Body.String())
+	}
+	if bus.subject != "" {
+		t.Errorf("approval of an unknown execution was sent on %q", bus.subject)
+	}
+}
@@ -1,6 +1,10 @@
 package messaging
 
-import "github.com/nats-io/nats.go"
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
 
 type Bus struct {
 	conn *nats.Conn
@@ -40,3 +44,11 @@ func (b *Bus) Conn() *nats.Conn {
 func (b *Bus) Close() {
 	b.conn.Close()
 }
+
+func (b *Bus) Request(subject string, data []byte, timeout time.Duration) ([]byte, error) {
+	msg, err := b.conn.Request(subject, data, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Data, nil
+}
@@ -83,3 +83,26 @@ func TestMultipleSubscribers(t *testing.T) {
 		}
 	}
 }
+
+func TestRequestReply(t *testing.T) {
+	nc := setupTestNATS(t)
+	bus := messaging.New(nc)
+
+	if _, err := nc.Subscribe("test.request", func(msg *nats.Msg) {
+		msg.Respond(append([]byte("re: "), msg.Data...))
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	reply, err := bus.Request("test.request", []byte("ping"), 2*time.Second)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if string(reply) != "re: ping" {
+		t.Errorf("unexpected reply: %s", reply)
+	}
+
+	if _, err := bus.Request("test.nobody", []byte("ping"), 200*time.Millisecond); err == nil {
+		t.Error("expected error when nobody answers")
+	}
+}
@@ -3,25 +3,56 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agentcreds"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/handlers"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/messaging"
 )
 
+// Options carries the optional dependencies of the server. A nil Bus
+// disables features that need the engine, such as test notifications.
+// Without an Auth.Resolver or Auth.Agents, users and agents are resolved
+// from the database. A nil AgentNATS leaves agents on the shared NATS token.
+type Options struct {
+	Auth      auth.Options
+	Secrets   *secrets.Box
+	Bus       *messaging.Bus
+	AgentNATS *agentcreds.Issuer
+}
+
 type Server struct {
-	Router *chi.Mux
-	DB     *pgxpool.Pool
-	WSHub  *handlers.WSHub
+	Router    *chi.Mux
+	DB        *pgxpool.Pool
+	WSHub     *handlers.WSHub
+	Auth      auth.Options
+	Secrets   *secrets.Box
+	Bus       *messaging.Bus
+	AgentNATS *agentcreds.Issuer
 }
 
-func New(db *pgxpool.Pool) *Server {
+func New(db *pgxpool.Pool, opts Options) *Server {
 	s := &Server{
-		Router: chi.NewRouter(),
-		DB:     db,
-		WSHub:  handlers.NewWSHub(),
+		Router:    chi.NewRouter(),
+		DB:        db,
+		WSHub:     handlers.NewWSHub(),
+		Auth:      opts.Auth,
+		Secrets:   opts.Secrets,
+		Bus:       opts.Bus,
+		AgentNATS: opts.AgentNATS,
+	}
+
+	if s.Auth.Resolver == nil && db != nil {
+		s.Auth.Resolver = auth.NewPGResolver(db, time.Minute)
+	}
+	if s.Auth.Agents == nil && db != nil {
+		s.Auth.Agents = auth.NewPGAgentResolver(db)
 	}
 
 	s.Router.Use(middleware.Logger)
@@ -37,38 +68,94 @@ func New(db *pgxpool.Pool) *Server {
 
 func (s *Server) mountRoutes() {
 	orgHandler := handlers.NewOrgHandler(s.DB)
-	agentHandler := handlers.NewAgentHandler(s.DB)
 	alertHandler := handlers.NewAlertHandler(s.DB)
 	metricsHandler := handlers.NewMetricsHandler(s.DB)
 
+	var requester handlers.Requester
+	var publisher handlers.Publisher
+	if s.Bus != nil {
+		requester = s.Bus
+		publisher = s.Bus
+	}
+	agentHandler := handlers.NewAgentHandler(s.DB, publisher)
+	alertRuleHandler := handlers.NewAlertRuleHandler(s.DB, s.Secrets, requester)
+	enrollmentHandler := handlers.NewEnrollmentHandler(s.DB, s.AgentNATS)
+	commandHandler := handlers.NewCommandHandler(s.DB, requester)
+	playbookHandler := handlers.NewPlaybookHandler(s.DB, s.Secrets, requester)
+
 	s.Router.Route("/api/v1", func(r chi.Router) {
-		r.Route("/organizations", func(r chi.Router) {
-			r.Post("/", orgHandler.Create)
-			r.Get("/", orgHandler.List)
-		})
-		r.Route("/agents", func(r chi.Router) {
-			r.Post("/", agentHandler.Create)
-			r.Get("/", agentHandler.List)
-			r.Get("/{id}", agentHandler.Get)
-			r.Patch("/{id}/heartbeat", agentHandler.Heartbeat)
-			r.Put("/{id}/config", agentHandler.UpdateConfig)
-		})
-		r.Route("/alerts", func(r chi.Router) {
-			r.Get("/", alertHandler.List)
-			r.Get("/{id}", alertHandler.Get)
-			r.Patch("/{id}", alertHandler.Update)
-			r.Post("/{id}/escalate", alertHandler.Escalate)
-		})
-		r.Route("/metrics", func(r chi.Router) {
-			r.Get("/", metricsHandler.QueryMetrics)
-			r.Get("/threat-score", metricsHandler.GetThreatScore)
-		})
-		r.Route("/events", func(r chi.Router) {
-			r.Post("/", metricsHandler.IngestEvents)
-			r.Get("/", metricsHandler.ListEvents)
+		r.Post("/enroll", enrollmentHandler.Enroll)
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.Authenticate(s.Auth))
+
+			r.Get("/me", handlers.Me)
+
+			r.Route("/organizations", func(r chi.Router) {
+				r.With(auth.Require(auth.ManageOrg)).Post("/", orgHandler.Create)
+				r.With(auth.Require(auth.ReadOrg)).Get("/", orgHandler.List)
+			})
+			r.Route("/agents", func(r chi.Router) {
+				r.With(auth.Require(auth.ManageAgents)).Post("/", agentHandler.Create)
+				r.With(auth.Require(auth.ReadAgents)).Get("/", agentHandler.List)
+				r.With(auth.Require(auth.ReadAgents)).Get("/{id}", agentHandler.Get)
+				r.With(auth.Require(auth.ReportAgent)).Patch("/{id}/heartbeat", agentHandler.Heartbeat)
+				r.With(auth.Require(auth.ReportAgent)).Post("/{id}/nats-credentials", enrollmentHandler.RefreshNATS)
+				r.With(auth.Require(auth.ReportAgent)).Get("/{id}/config", agentHandler.GetConfig)
+				r.With(auth.Require(auth.ManageAgents)).Put("/{id}/config", agentHandler.UpdateConfig)
+				r.With(auth.Require(auth.ManageAgents)).Post("/{id}/revoke", enrollmentHandler.Revoke)
+				r.With(auth.Require(auth.CommandAgents)).Post("/{id}/commands", commandHandler.Create)
+				r.With(auth.Require(auth.CommandAgents)).Get("/{id}/commands", commandHandler.List)
+				r.With(auth.Require(auth.CommandAgents)).Get("/{id}/commands/{commandID}", commandHandler.Get)
+			})
+			r.Route("/enrollment-tokens", func(r chi.Router) {
+				r.Use(auth.Require(auth.ManageAgents))
+				r.Post("/", enrollmentHandler.CreateToken)
+				r.Get("/", enrollmentHandler.ListTokens)
+				r.Delete("/{id}", enrollmentHandler.DeleteToken)
+			})
+			r.Route("/alerts", func(r chi.Router) {
+				r.With(auth.Require(auth.CreateAlerts)).Post("/", alertHandler.Create)
+				r.With(auth.Require(auth.ReadAlerts)).Get("/", alertHandler.List)
+				r.With(auth.Require(auth.ReadAlerts)).Get("/{id}", alertHandler.Get)
+				r.With(auth.Require(auth.UpdateAlerts)).Patch("/{id}", alertHandler.Update)
+				r.With(auth.Require(auth.EscalateAlerts)).Post("/{id}/escalate", alertHandler.Escalate)
+			})
+			r.Route("/alert-rules", func(r chi.Router) {
+				r.With(auth.Require(auth.ManageRules)).Post("/", alertRuleHandler.Create)
+				r.With(auth.Require(auth.ReadRules)).Get("/", alertRuleHandler.List)
+				r.With(auth.Require(auth.ReadRules)).Get("/{id}", alertRuleHandler.Get)
+				r.With(auth.Require(auth.ManageRules)).Put("/{id}", alertRuleHandler.Update)
+				r.With(auth.Require(auth.ManageRules)).Delete("/{id}", alertRuleHandler.Delete)
+				r.With(auth.Require(auth.ManageRules)).Post("/{id}/enable", alertRuleHandler.Enable)
+				r.With(auth.Require(auth.ManageRules)).Post("/{id}/disable", alertRuleHandler.Disable)
+				r.With(auth.Require(auth.ManageRules)).Post("/{id}/test", alertRuleHandler.Test)
+			})
+			r.Route("/playbooks", func(r chi.Router) {
+				r.With(auth.Require(auth.ManageRules)).Post("/", playbookHandler.Create)
+				r.With(auth.Require(auth.ReadRules)).Get("/", playbookHandler.List)
+				r.With(auth.Require(auth.ReadRules)).Get("/{id}", playbookHandler.Get)
+				r.With(auth.Require(auth.ManageRules)).Put("/{id}", playbookHandler.Update)
+				r.With(auth.Require(auth.ManageRules)).Delete("/{id}", playbookHandler.Delete)
+			})
+			r.Route("/playbook-executions", func(r chi.Router) {
+				r.With(auth.Require(auth.ReadAlerts)).Get("/", playbookHandler.ListExecutions)
+				r.With(auth.Require(auth.ReadAlerts)).Get("/{id}", playbookHandler.GetExecution)
+				r.With(auth.Require(auth.RespondAgents)).Post("/{id}/approve", playbookHandler.Approve)
+				r.With(auth.Require(auth.RespondAgents)).Post("/{id}/reject", playbookHandler.Reject)
+			})
+			r.Route("/metrics", func(r chi.Router) {
+				r.Use(auth.Require(auth.ReadEvents))
+				r.Get("/", metricsHandler.QueryMetrics)
+				r.Get("/threat-score", metricsHandler.GetThreatScore)
+			})
+			r.Route("/events", func(r chi.Router) {
+				r.With(auth.Require(auth.IngestEvents)).Post("/", metricsHandler.IngestEvents)
+				r.With(auth.Require(auth.ReadEvents)).Get("/", metricsHandler.ListEvents)
+			})
+			r.Route("/threats", func(r chi.Router) {})
+			r.Route("/settings", func(r chi.Router) {})
 		})
-		r.Route("/threats", func(r chi.Router) {})
-		r.Route("/settings", func(r chi.Router) {})
 	})
 
 	s.Router.Get("/ws", s.WSHub.HandleWS)
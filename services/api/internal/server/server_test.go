@@ -3,13 +3,15 @@ package server_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/server"
 )
 
 func TestHealthEndpoint(t *testing.T) {
-	srv := server.New(nil)
+	srv := server.New(nil, server.Options{})
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	w := httptest.NewRecorder()
 	srv.Router.ServeHTTP(w, req)
@@ -18,3 +20,63 @@ func TestHealthEndpoint(t *testing.T) {
 		t.Errorf("expected 200, got %d", w.Code)
 	}
 }
+
+func TestAPIRequiresAuthentication(t *testing.T) {
+	srv := server.New(nil, server.Options{Auth: auth.Options{ServiceToken: "engine-secret"}})
+
+	for _, path := range []string{"/api/v1/alerts", "/api/v1/agents", "/api/v1/events", "/api/v1/alert-rules"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", path, w.Code)
+		}
+	}
+
+	body := `{"org_id":"7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10","title":"Port Scan Detected","severity":"high"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/alerts", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer engine-secret")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected the engine to ingest alerts, got %d", w.Code)
+	}
+}
+
+func TestServiceIdentityCannotReadOrManageRules(t *testing.T) {
+	srv := server.New(nil, server.Options{Auth: auth.Options{ServiceToken: "engine-secret"}})
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/alerts"},
+		{http.MethodPost, "/api/v1/alert-rules"},
+		{http.MethodPost, "/api/v1/agents"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer engine-secret")
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403, got %d", tc.method, tc.path, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.Header.Set("Authorization", "Bearer engine-secret")
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"alerts:create"`) {
+		t.Errorf("expected /me to list the service permissions, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEnrollDoesNotRequireAuthentication(t *testing.T) {
+	srv := server.New(nil, server.Options{})
+
+	body := `{"token":"enr_unknown","hostname":"web-01"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/enroll", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "enrollment token") {
+		t.Errorf("expected the enrollment token to be checked, got %d %s", w.Code, w.Body.String())
+	}
+}
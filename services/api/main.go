@@ -5,8 +5,13 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agentcreds"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/agenthealth"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/auth"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/config"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/database"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/messaging"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/api/internal/server"
 )
 
@@ -20,7 +25,52 @@ func main() {
 	}
 	defer db.Close()
 
-	srv := server.New(db)
+	key, err := secrets.ParseKey(cfg.SecretsKey)
+	if err != nil {
+		log.Fatalf("invalid SECRETS_KEY: %v", err)
+	}
+	box, err := secrets.NewBox(key)
+	if err != nil {
+		log.Fatalf("invalid SECRETS_KEY: %v", err)
+	}
+	if !box.Enabled() {
+		log.Printf("warning: SECRETS_KEY is not set; alert rules with channel secrets cannot be saved")
+	}
+
+	bus, err := messaging.Connect(cfg.NATSUrl, cfg.NATSToken)
+	if err != nil {
+		log.Printf("warning: failed to connect to NATS, test notifications are disabled: %v", err)
+		bus = nil
+	} else {
+		defer bus.Close()
+	}
+
+	agentNATS, err := agentcreds.NewIssuer(cfg.AgentNATSSigningSeed, cfg.AgentNATSAccount, cfg.AgentNATSJWTTTL)
+	if err != nil {
+		log.Fatalf("invalid AGENT_NATS_SIGNING_SEED: %v", err)
+	}
+
+	sweeper, err := agenthealth.New(db, cfg.AgentStaleAfter, cfg.AgentOfflineAfter)
+	if err != nil {
+		log.Fatalf("invalid agent heartbeat thresholds: %v", err)
+	}
+	if bus != nil {
+		sweeper.SendAlertsTo(bus)
+	}
+	go sweeper.Run(ctx, cfg.AgentSweepEvery)
+
+	srv := server.New(db, server.Options{
+		Auth: auth.Options{
+			KeycloakURL:  cfg.KeycloakURL,
+			Realm:        cfg.KeycloakRealm,
+			Issuer:       cfg.KeycloakIssuer,
+			Audience:     cfg.KeycloakAudience,
+			ServiceToken: cfg.ServiceToken,
+		},
+		Secrets:   box,
+		Bus:       bus,
+		AgentNATS: agentNATS,
+	})
 
 	log.Printf("API server starting on :%s", cfg.Port)
 	if err := http.ListenAndServe(":"+cfg.Port, srv.Router); err != nil {
@@ -2,58 +2,103 @@ package alerts
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/sigma"
 )
 
 type Alert struct {
-	ID          string                 `json:"id"`
-	OrgID       string                 `json:"org_id"`
-	AgentID     string                 `json:"agent_id"`
-	Title       string                 `json:"title"`
-	Description string                 `json:"description"`
-	Severity    string                 `json:"severity"`
-	Category    string                 `json:"category"`
-	Status      string                 `json:"status"`
-	Source      string                 `json:"source"`
-	RiskScore   float64                `json:"risk_score"`
-	EventCount  int                    `json:"event_count"`
-	Payload     map[string]interface{} `json:"payload"`
-	CreatedAt   time.Time              `json:"created_at"`
+	ID           string                 `json:"id"`
+	OrgID        string                 `json:"org_id"`
+	AgentID      string                 `json:"agent_id"`
+	Title        string                 `json:"title"`
+	Description  string                 `json:"description"`
+	Severity     string                 `json:"severity"`
+	Category     string                 `json:"category"`
+	Status       string                 `json:"status"`
+	Source       string                 `json:"source"`
+	RiskScore    float64                `json:"risk_score"`
+	EventCount   int                    `json:"event_count"`
+	Payload      map[string]interface{} `json:"payload"`
+	SourceEvents []core.Event           `json:"source_events,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+
+	Fingerprint     string    `json:"fingerprint"`
+	OccurrenceCount int       `json:"occurrence_count"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
+const (
+	maxSourceEvents = 50
+	maxListedAlerts = 100
+)
+
 type AlertGenerator struct {
-	mu          sync.RWMutex
-	alerts      []Alert
-	apiURL      string
-	webhookURL  string
-	threshold   float64
-	alertCh     chan Alert
-	dedup       map[string]time.Time
-	dedupWindow time.Duration
+	mu        sync.RWMutex
+	store     Store
+	apiURL    string
+	apiToken  string
+	threshold float64
+	alertCh   chan Alert
+	playbooks Playbooks
+}
+
+// Playbooks is handed each newly created alert, as playbooks.Runner is.
+// Trigger must not block.
+type Playbooks interface {
+	Trigger(alert Alert)
 }
 
-func NewAlertGenerator(apiURL, webhookURL string, threshold float64) *AlertGenerator {
+func NewAlertGenerator(apiURL string, threshold float64) *AlertGenerator {
 	if threshold <= 0 {
 		threshold = 5.0
 	}
 	return &AlertGenerator{
-		apiURL:      apiURL,
-		webhookURL:  webhookURL,
-		threshold:   threshold,
-		alertCh:     make(chan Alert, 100),
-		dedup:       make(map[string]time.Time),
-		dedupWindow: 5 * time.Minute,
+		apiURL:    apiURL,
+		threshold: threshold,
+		alertCh:   make(chan Alert, 100),
+		store:     NewMemoryStore(0, 0),
 	}
 }
 
+// SetStore replaces the default in-memory store. Call before processing.
+func (g *AlertGenerator) SetStore(store Store) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.store = store
+}
+
+// SetAPIToken sets the service token sent with alerts posted to the API.
+// Call before processing.
+func (g *AlertGenerator) SetAPIToken(token string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.apiToken = token
+}
+
+// SetPlaybooks hands new alerts to p, after they are stored. Repeat
+// occurrences of an open alert do not trigger playbooks again. Call before
+// processing.
+func (g *AlertGenerator) SetPlaybooks(p Playbooks) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.playbooks = p
+}
+
 func (g *AlertGenerator) ProcessEvent(event core.Event) error {
 	riskScore := calculateEventRisk(event)
 
@@ -62,19 +107,20 @@ func (g *AlertGenerator) ProcessEvent(event core.Event) error {
 	}
 
 	alert := Alert{
-		ID:          fmt.Sprintf("evt-%d", time.Now().UnixNano()),
-		OrgID:       event.OrgID,
-		AgentID:     event.AgentID,
-		Title:       generateTitle(event),
-		Description: event.Summary,
-		Severity:    event.Severity,
-		Category:    event.Category,
-		Status:      "open",
-		Source:      event.Source,
-		RiskScore:   riskScore,
-		EventCount:  1,
-		Payload:     event.Payload,
-		CreatedAt:   time.Now(),
+		ID:           uuid.NewString(),
+		OrgID:        event.OrgID,
+		AgentID:      event.AgentID,
+		Title:        generateTitle(event),
+		Description:  event.Summary,
+		Severity:     event.Severity,
+		Category:     event.Category,
+		Status:       "open",
+		Source:       event.Source,
+		RiskScore:    riskScore,
+		EventCount:   1,
+		Payload:      event.Payload,
+		SourceEvents: []core.Event{event},
+		CreatedAt:    time.Now(),
 	}
 
 	return g.emitAlert(alert)
@@ -88,45 +134,146 @@ func (g *AlertGenerator) ProcessCorrelation(result correlation.CorrelationResult
 		agentID = result.Events[0].AgentID
 	}
 
+	title := "Correlated: " + result.Rule
+	description := result.Summary
+	payload := map[string]interface{}{"rule": result.Rule}
+	if key := formatGroupKey(result.GroupKey); key != "" {
+		title += " (" + key + ")"
+		description += " [" + key + "]"
+		group := make(map[string]interface{}, len(result.GroupKey))
+		for k, v := range result.GroupKey {
+			group[k] = v
+		}
+		payload["group_key"] = group
+	}
+
 	alert := Alert{
-		ID:          fmt.Sprintf("cor-%d", time.Now().UnixNano()),
-		OrgID:       orgID,
-		AgentID:     agentID,
-		Title:       "Correlated: " + result.Rule,
-		Description: result.Summary,
-		Severity:    result.Severity,
-		Category:    result.Category,
-		Status:      "open",
-		Source:      "correlation",
-		RiskScore:   correlationRisk(result),
-		EventCount:  len(result.Events),
-		CreatedAt:   time.Now(),
+		ID:           uuid.NewString(),
+		OrgID:        orgID,
+		AgentID:      agentID,
+		Title:        title,
+		Description:  description,
+		Severity:     result.Severity,
+		Category:     result.Category,
+		Status:       "open",
+		Source:       "correlation",
+		RiskScore:    correlationRisk(result),
+		EventCount:   len(result.Events),
+		Payload:      payload,
+		SourceEvents: lastEvents(result.Events, maxSourceEvents),
+		CreatedAt:    time.Now(),
 	}
 
 	return g.emitAlert(alert)
 }
 
-func (g *AlertGenerator) emitAlert(alert Alert) error {
-	dedupKey := fmt.Sprintf("%s-%s-%s", alert.OrgID, alert.Category, alert.Severity)
+func (g *AlertGenerator) ProcessSigma(m sigma.Match) error {
+	orgID := ""
+	agentID := ""
+	if len(m.Events) > 0 {
+		last := m.Events[len(m.Events)-1]
+		orgID = last.OrgID
+		agentID = last.AgentID
+	}
 
-	g.mu.Lock()
-	if lastTime, exists := g.dedup[dedupKey]; exists {
-		if time.Since(lastTime) < g.dedupWindow {
-			g.mu.Unlock()
-			return nil
+	title := m.Rule.Title
+	description := m.Rule.Description
+	if description == "" {
+		description = "Sigma rule matched: " + m.Rule.Title
+	}
+	payload := map[string]interface{}{
+		"rule":      m.Rule.Title,
+		"sigma_id":  m.Rule.ID,
+		"tags":      m.Rule.Tags,
+		"level":     m.Rule.Level,
+		"logsource": m.Rule.Logsource,
+	}
+	if key := formatGroupKey(m.GroupKey); key != "" {
+		title += " (" + key + ")"
+		description += " [" + key + "]"
+		group := make(map[string]interface{}, len(m.GroupKey))
+		for k, v := range m.GroupKey {
+			group[k] = v
 		}
+		payload["group_key"] = group
 	}
-	g.dedup[dedupKey] = time.Now()
-	g.alerts = append(g.alerts, alert)
-	g.mu.Unlock()
 
-	select {
-	case g.alertCh <- alert:
+	severity := sigmaSeverity(m.Rule.Level)
+	alert := Alert{
+		ID:           uuid.NewString(),
+		OrgID:        orgID,
+		AgentID:      agentID,
+		Title:        title,
+		Description:  description,
+		Severity:     severity,
+		Category:     "sigma",
+		Status:       "open",
+		Source:       "sigma",
+		RiskScore:    correlationRisk(correlation.CorrelationResult{Severity: severity, Events: m.Events}),
+		EventCount:   len(m.Events),
+		Payload:      payload,
+		SourceEvents: lastEvents(m.Events, maxSourceEvents),
+		CreatedAt:    time.Now(),
+	}
+
+	return g.emitAlert(alert)
+}
+
+func sigmaSeverity(level string) string {
+	switch level {
+	case "informational":
+		return "info"
+	case "low", "medium", "high", "critical":
+		return level
 	default:
+		return "medium"
 	}
+}
 
-	go g.sendToAPI(alert)
-	go g.sendWebhook(alert)
+// emitAlert records the alert in the store. A repeat of an alert that is
+// still unresolved (same fingerprint, computed unless the alert brings its
+// own) updates it rather than creating a new one; only new
+// alerts go to the channel for notification and to the playbooks. Without a
+// database the API has no copy of the alert, so every change is posted to it;
+// with one, the store has already written the row the API reads.
+func (g *AlertGenerator) emitAlert(alert Alert) error {
+	now := time.Now()
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = now
+	}
+	alert.LastSeenAt = alert.CreatedAt
+	alert.UpdatedAt = now
+	alert.OccurrenceCount = 1
+	if alert.Fingerprint == "" {
+		alert.Fingerprint = Fingerprint(alert)
+	}
+
+	g.mu.RLock()
+	store, playbooks := g.store, g.playbooks
+	g.mu.RUnlock()
+
+	stored, created, err := store.Upsert(context.Background(), alert)
+	if errors.Is(err, ErrInvalidOrg) {
+		log.Printf("alert generator: dropping alert %q for unknown org %q", alert.Title, alert.OrgID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("store alert: %w", err)
+	}
+
+	if created {
+		select {
+		case g.alertCh <- stored:
+		default:
+			log.Printf("alert generator: alert channel full, alert %s not dispatched", stored.ID)
+		}
+		if playbooks != nil {
+			playbooks.Trigger(stored)
+		}
+	}
+	if _, inMemory := store.(*MemoryStore); inMemory {
+		go g.sendToAPI(stored)
+	}
 
 	return nil
 }
@@ -143,53 +290,78 @@ func (g *AlertGenerator) sendToAPI(alert Alert) {
 	}
 
 	url := fmt.Sprintf("%s/api/v1/alerts", g.apiURL)
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
-		log.Printf("alert generator: failed to send to API: %v", err)
+		log.Printf("alert generator: failed to build API request: %v", err)
 		return
 	}
-	resp.Body.Close()
-}
-
-func (g *AlertGenerator) sendWebhook(alert Alert) {
-	if g.webhookURL == "" {
-		return
-	}
-
-	payload := map[string]interface{}{
-		"text": fmt.Sprintf("[%s] %s: %s", alert.Severity, alert.Title, alert.Description),
-		"alert": alert,
-	}
-
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return
+	req.Header.Set("Content-Type", "application/json")
+	g.mu.RLock()
+	token := g.apiToken
+	g.mu.RUnlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
-
-	resp, err := http.Post(g.webhookURL, "application/json", bytes.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Printf("alert generator: webhook failed: %v", err)
+		log.Printf("alert generator: failed to send to API: %v", err)
 		return
 	}
 	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("alert generator: API rejected alert %s: %s", alert.ID, resp.Status)
+	}
 }
 
 func (g *AlertGenerator) Alerts() <-chan Alert {
 	return g.alertCh
 }
 
+// GetAlerts returns the most recently created alerts from the store,
+// oldest first.
 func (g *AlertGenerator) GetAlerts() []Alert {
 	g.mu.RLock()
-	defer g.mu.RUnlock()
-	result := make([]Alert, len(g.alerts))
-	copy(result, g.alerts)
+	store := g.store
+	g.mu.RUnlock()
+
+	result, err := store.List(context.Background(), maxListedAlerts)
+	if err != nil {
+		log.Printf("alert generator: list alerts: %v", err)
+		return nil
+	}
 	return result
 }
 
 func (g *AlertGenerator) AlertCount() int {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	return len(g.alerts)
+	return len(g.GetAlerts())
+}
+
+// formatGroupKey renders a correlation group key as "src_ip=1.2.3.4",
+// dropping the payload prefix and empty values.
+func formatGroupKey(key map[string]string) string {
+	fields := make([]string, 0, len(key))
+	for f := range key {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if key[f] == "" {
+			continue
+		}
+		parts = append(parts, strings.TrimPrefix(f, "payload.")+"="+key[f])
+	}
+	return strings.Join(parts, ", ")
+}
+
+func lastEvents(events []core.Event, n int) []core.Event {
+	if len(events) > n {
+		events = events[len(events)-n:]
+	}
+	out := make([]core.Event, len(events))
+	copy(out, events)
+	return out
 }
 
 func calculateEventRisk(event core.Event) float64 {
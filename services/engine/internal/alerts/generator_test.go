@@ -1,16 +1,22 @@
 package alerts_test
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/sigma"
 )
 
 func TestAlertGeneratorCreation(t *testing.T) {
-	g := alerts.NewAlertGenerator("", "", 5.0)
+	g := alerts.NewAlertGenerator("", 5.0)
 	if g == nil {
 		t.Fatal("expected non-nil generator")
 	}
@@ -20,7 +26,7 @@ func TestAlertGeneratorCreation(t *testing.T) {
 }
 
 func TestAlertGeneratorHighSeverity(t *testing.T) {
-	g := alerts.NewAlertGenerator("", "", 5.0)
+	g := alerts.NewAlertGenerator("", 5.0)
 
 	err := g.ProcessEvent(core.Event{
 		Time:     time.Now(),
@@ -54,7 +60,7 @@ func TestAlertGeneratorHighSeverity(t *testing.T) {
 }
 
 func TestAlertGeneratorLowSeverityFiltered(t *testing.T) {
-	g := alerts.NewAlertGenerator("", "", 5.0)
+	g := alerts.NewAlertGenerator("", 5.0)
 
 	g.ProcessEvent(core.Event{
 		Time:     time.Now(),
@@ -71,7 +77,7 @@ func TestAlertGeneratorLowSeverityFiltered(t *testing.T) {
 }
 
 func TestAlertGeneratorDeduplication(t *testing.T) {
-	g := alerts.NewAlertGenerator("", "", 5.0)
+	g := alerts.NewAlertGenerator("", 5.0)
 
 	for i := 0; i < 5; i++ {
 		g.ProcessEvent(core.Event{
@@ -87,10 +93,103 @@ func TestAlertGeneratorDeduplication(t *testing.T) {
 	if g.AlertCount() != 1 {
 		t.Errorf("expected 1 alert (deduped), got %d", g.AlertCount())
 	}
+	alert := g.GetAlerts()[0]
+	if alert.OccurrenceCount != 5 {
+		t.Errorf("expected repeats folded into occurrence count 5, got %d", alert.OccurrenceCount)
+	}
+	if alert.LastSeenAt.Before(alert.CreatedAt) {
+		t.Errorf("expected last seen %v after created %v", alert.LastSeenAt, alert.CreatedAt)
+	}
+}
+
+func TestAlertGeneratorUsesUUIDs(t *testing.T) {
+	g := alerts.NewAlertGenerator("", 5.0)
+	g.ProcessEvent(core.Event{OrgID: "org-1", Category: "port_scan", Severity: "high"})
+
+	alert := g.GetAlerts()[0]
+	if _, err := uuid.Parse(alert.ID); err != nil {
+		t.Errorf("expected uuid alert id, got %q", alert.ID)
+	}
+	if alert.Fingerprint == "" {
+		t.Error("expected fingerprint to be set")
+	}
+}
+
+func TestAlertGeneratorOnlyNotifiesNewAlerts(t *testing.T) {
+	g := alerts.NewAlertGenerator("", 5.0)
+	for i := 0; i < 3; i++ {
+		g.ProcessEvent(core.Event{OrgID: "org-1", Category: "port_scan", Severity: "high"})
+	}
+
+	<-g.Alerts()
+	select {
+	case a := <-g.Alerts():
+		t.Errorf("expected repeats not to be re-sent, got %+v", a)
+	default:
+	}
+}
+
+func TestAlertGeneratorPostsToAPI(t *testing.T) {
+	received := make(chan alerts.Alert, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/alerts" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer engine-secret" {
+			t.Errorf("expected service token, got %q", got)
+		}
+		var a alerts.Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		received <- a
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	g := alerts.NewAlertGenerator(srv.URL, 5.0)
+	g.SetAPIToken("engine-secret")
+	g.ProcessEvent(core.Event{OrgID: "org-1", Category: "port_scan", Severity: "high"})
+	g.ProcessEvent(core.Event{OrgID: "org-1", Category: "port_scan", Severity: "high"})
+
+	counts := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case a := <-received:
+			counts[a.OccurrenceCount] = true
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for API post")
+		}
+	}
+	if !counts[1] || !counts[2] {
+		t.Errorf("expected posts for the new alert and its update, got %v", counts)
+	}
+}
+
+func TestAlertGeneratorSkipsAPIWithDatabaseStore(t *testing.T) {
+	posted := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted <- struct{}{}
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	q := &fakeQuerier{row: fakeRow{values: []interface{}{
+		uuid.New(), "open", float32(8), 1, 1, now, now, now, true,
+	}}}
+	g := alerts.NewAlertGenerator(srv.URL, 5.0)
+	g.SetStore(alerts.NewPGStore(q))
+	if err := g.ProcessEvent(core.Event{OrgID: testOrg, Category: "port_scan", Severity: "high"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-posted:
+		t.Error("expected no API post when alerts are stored in the database")
+	case <-time.After(200 * time.Millisecond):
+	}
 }
 
 func TestAlertGeneratorCorrelation(t *testing.T) {
-	g := alerts.NewAlertGenerator("", "", 5.0)
+	g := alerts.NewAlertGenerator("", 5.0)
 
 	result := correlation.CorrelationResult{
 		Rule:     "brute_force_attack",
@@ -122,8 +221,82 @@ func TestAlertGeneratorCorrelation(t *testing.T) {
 	}
 }
 
+func TestAlertGeneratorCorrelationNamesGroupKey(t *testing.T) {
+	g := alerts.NewAlertGenerator("", 5.0)
+
+	for _, ip := range []string{"203.0.113.7", "198.51.100.4"} {
+		g.ProcessCorrelation(correlation.CorrelationResult{
+			Rule:     "brute_force_attack",
+			Severity: "high",
+			Category: "attack",
+			Summary:  "Multiple authentication failures",
+			GroupKey: map[string]string{"payload.src_ip": ip},
+			Events:   []core.Event{{OrgID: "org-1", Category: "auth_failure"}},
+		})
+	}
+
+	alertList := g.GetAlerts()
+	if len(alertList) != 2 {
+		t.Fatalf("expected one alert per attacker, got %d", len(alertList))
+	}
+	alert := alertList[0]
+	if alert.Title != "Correlated: brute_force_attack (src_ip=203.0.113.7)" {
+		t.Errorf("unexpected title %q", alert.Title)
+	}
+	group, ok := alert.Payload["group_key"].(map[string]interface{})
+	if !ok || group["payload.src_ip"] != "203.0.113.7" {
+		t.Errorf("expected group key in payload, got %v", alert.Payload)
+	}
+}
+
+func TestAlertGeneratorSigma(t *testing.T) {
+	g := alerts.NewAlertGenerator("", 5.0)
+
+	rules, err := sigma.Parse([]byte(`
+title: SSH Brute Force
+id: 6b1f0c2e
+level: informational
+tags: [attack.t1110]
+logsource: {product: linux, service: sshd}
+detection:
+  sel: {category: auth_failure}
+  condition: sel | count() by SourceIp >= 2
+`), nil)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	err = g.ProcessSigma(sigma.Match{
+		Rule:     rules[0],
+		GroupKey: map[string]string{"payload.src_ip": "203.0.113.7"},
+		Events:   []core.Event{{OrgID: "org-1", AgentID: "agent-1"}, {OrgID: "org-1", AgentID: "agent-1"}},
+		Count:    2,
+	})
+	if err != nil {
+		t.Fatalf("ProcessSigma: %v", err)
+	}
+
+	alertList := g.GetAlerts()
+	if len(alertList) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alertList))
+	}
+	alert := alertList[0]
+	if alert.Title != "SSH Brute Force (src_ip=203.0.113.7)" {
+		t.Errorf("unexpected title %q", alert.Title)
+	}
+	if alert.Severity != "info" || alert.Category != "sigma" || alert.OrgID != "org-1" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	if alert.Payload["sigma_id"] != "6b1f0c2e" {
+		t.Errorf("expected sigma id in payload, got %v", alert.Payload)
+	}
+	if tags, ok := alert.Payload["tags"].([]string); !ok || len(tags) != 1 || tags[0] != "attack.t1110" {
+		t.Errorf("expected tags in payload, got %v", alert.Payload["tags"])
+	}
+}
+
 func TestAlertChannel(t *testing.T) {
-	g := alerts.NewAlertGenerator("", "", 5.0)
+	g := alerts.NewAlertGenerator("", 5.0)
 
 	g.ProcessEvent(core.Event{
 		Time:     time.Now(),
@@ -144,7 +317,7 @@ func TestAlertChannel(t *testing.T) {
 }
 
 func TestAlertGeneratorCriticalEvent(t *testing.T) {
-	g := alerts.NewAlertGenerator("", "", 5.0)
+	g := alerts.NewAlertGenerator("", 5.0)
 
 	g.ProcessEvent(core.Event{
 		Time:     time.Now(),
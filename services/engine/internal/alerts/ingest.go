@@ -0,0 +1,50 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// IngestSubject is the NATS subject other services raise alerts on, such as
+// the API's agent health alerts. They go through emitAlert like the
+// engine's own, so they are stored, notified and handed to playbooks. The
+// reply is an IngestReply.
+const IngestSubject = "alerts.ingest"
+
+type IngestReply struct {
+	Error string `json:"error,omitempty"`
+}
+
+// HandleIngest records the alert in data and returns the encoded
+// IngestReply. The sender may set a fingerprint to control which open alert
+// repeats fold into.
+func (g *AlertGenerator) HandleIngest(data []byte) []byte {
+	reply := IngestReply{}
+	if err := g.ingest(data); err != nil {
+		reply.Error = err.Error()
+	}
+	out, _ := json.Marshal(reply)
+	return out
+}
+
+func (g *AlertGenerator) ingest(data []byte) error {
+	var alert Alert
+	if err := json.Unmarshal(data, &alert); err != nil {
+		return fmt.Errorf("invalid alert: %w", err)
+	}
+	if alert.OrgID == "" || alert.Title == "" || alert.Severity == "" {
+		return fmt.Errorf("invalid alert: org_id, title and severity are required")
+	}
+	if alert.ID == "" {
+		alert.ID = uuid.NewString()
+	}
+	if alert.Status == "" {
+		alert.Status = "open"
+	}
+	if alert.EventCount < 1 {
+		alert.EventCount = 1
+	}
+	return g.emitAlert(alert)
+}
@@ -0,0 +1,47 @@
+package alerts_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+)
+
+func TestHandleIngestEmitsAlert(t *testing.T) {
+	g := alerts.NewAlertGenerator("", 5.0)
+	data, _ := json.Marshal(alerts.Alert{
+		OrgID:       "org-1",
+		AgentID:     "agent-1",
+		Title:       "Agent web-1 is offline",
+		Severity:    "high",
+		Category:    "agent_health",
+		Source:      "api",
+		Fingerprint: "agent-offline:agent-1",
+	})
+
+	var reply alerts.IngestReply
+	if err := json.Unmarshal(g.HandleIngest(data), &reply); err != nil || reply.Error != "" {
+		t.Fatalf("expected ingest to succeed, got %+v (%v)", reply, err)
+	}
+	g.HandleIngest(data)
+
+	a := <-g.Alerts()
+	if a.Fingerprint != "agent-offline:agent-1" || a.Status != "open" || a.ID == "" {
+		t.Errorf("expected the sender's fingerprint on a new open alert, got %+v", a)
+	}
+	if list := g.GetAlerts(); len(list) != 1 || list[0].OccurrenceCount != 2 {
+		t.Errorf("expected the repeat to fold into one alert, got %+v", list)
+	}
+}
+
+func TestHandleIngestRejectsIncompleteAlerts(t *testing.T) {
+	g := alerts.NewAlertGenerator("", 5.0)
+	var reply alerts.IngestReply
+	json.Unmarshal(g.HandleIngest([]byte(`{"org_id":"org-1"}`)), &reply)
+	if reply.Error == "" {
+		t.Error("expected an alert without title or severity to be rejected")
+	}
+	if g.AlertCount() != 0 {
+		t.Errorf("expected nothing stored, got %d alerts", g.AlertCount())
+	}
+}
@@ -0,0 +1,158 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+)
+
+var ErrInvalidOrg = errors.New("alerts: org id is not a uuid")
+
+// Querier is the subset of *pgxpool.Pool the store needs.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// PGStore keeps alerts in the alerts table. Repeat occurrences are folded
+// into the unresolved alert with the same (org_id, fingerprint) using the
+// partial unique index from migration 002.
+type PGStore struct {
+	db Querier
+}
+
+func NewPGStore(db Querier) *PGStore {
+	return &PGStore{db: db}
+}
+
+const upsertAlertSQL = `
+INSERT INTO alerts (id, org_id, agent_id, severity, title, description, status,
+	category, source, risk_score, event_count, payload, source_events, fingerprint,
+	occurrence_count, created_at, last_seen_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, 1, $15, $16, NOW())
+ON CONFLICT (org_id, fingerprint) WHERE status <> 'resolved' DO UPDATE SET
+	occurrence_count = alerts.occurrence_count + 1,
+	last_seen_at = GREATEST(alerts.last_seen_at, EXCLUDED.last_seen_at),
+	description = EXCLUDED.description,
+	risk_score = GREATEST(alerts.risk_score, EXCLUDED.risk_score),
+	event_count = alerts.event_count + EXCLUDED.event_count,
+	source_events = EXCLUDED.source_events,
+	updated_at = NOW()
+RETURNING id, status, risk_score, event_count, occurrence_count, created_at, last_seen_at, updated_at, (xmax = 0)`
+
+func (s *PGStore) Upsert(ctx context.Context, alert Alert) (Alert, bool, error) {
+	orgID, err := uuid.Parse(alert.OrgID)
+	if err != nil {
+		return Alert{}, false, ErrInvalidOrg
+	}
+	var agentID *uuid.UUID
+	if a, err := uuid.Parse(alert.AgentID); err == nil {
+		agentID = &a
+	}
+
+	payload, err := json.Marshal(alert.Payload)
+	if err != nil {
+		return Alert{}, false, fmt.Errorf("marshal alert payload: %w", err)
+	}
+	sourceEvents, err := json.Marshal(SourceEventRecords(alert.SourceEvents))
+	if err != nil {
+		return Alert{}, false, fmt.Errorf("marshal source events: %w", err)
+	}
+
+	var (
+		id        uuid.UUID
+		riskScore float32
+		created   bool
+	)
+	stored := alert
+	err = s.db.QueryRow(ctx, upsertAlertSQL,
+		alert.ID, orgID, agentID, alert.Severity, truncate(alert.Title, 500),
+		alert.Description, alert.Status, alert.Category, alert.Source,
+		float32(alert.RiskScore), alert.EventCount, payload, sourceEvents,
+		alert.Fingerprint, alert.CreatedAt, alert.LastSeenAt,
+	).Scan(&id, &stored.Status, &riskScore, &stored.EventCount, &stored.OccurrenceCount,
+		&stored.CreatedAt, &stored.LastSeenAt, &stored.UpdatedAt, &created)
+	if err != nil {
+		return Alert{}, false, fmt.Errorf("upsert alert: %w", err)
+	}
+	stored.ID = id.String()
+	stored.RiskScore = float64(riskScore)
+	return stored, created, nil
+}
+
+const listAlertsSQL = `
+SELECT * FROM (
+	SELECT id, org_id, agent_id, severity, title, COALESCE(description, ''), status,
+		category, source, risk_score, event_count, payload, fingerprint,
+		occurrence_count, created_at, last_seen_at, updated_at
+	FROM alerts ORDER BY created_at DESC LIMIT $1
+) recent ORDER BY created_at`
+
+func (s *PGStore) List(ctx context.Context, limit int) ([]Alert, error) {
+	rows, err := s.db.Query(ctx, listAlertsSQL, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Alert
+	for rows.Next() {
+		var (
+			a           Alert
+			id, orgID   uuid.UUID
+			agentID     *uuid.UUID
+			riskScore   float32
+			fingerprint *string
+		)
+		if err := rows.Scan(&id, &orgID, &agentID, &a.Severity, &a.Title, &a.Description,
+			&a.Status, &a.Category, &a.Source, &riskScore, &a.EventCount, &a.Payload,
+			&fingerprint, &a.OccurrenceCount, &a.CreatedAt, &a.LastSeenAt, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan alert: %w", err)
+		}
+		a.ID = id.String()
+		a.OrgID = orgID.String()
+		if agentID != nil {
+			a.AgentID = agentID.String()
+		}
+		if fingerprint != nil {
+			a.Fingerprint = *fingerprint
+		}
+		a.RiskScore = float64(riskScore)
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// SourceEventRecords trims events down to the fields stored with an alert.
+func SourceEventRecords(events []core.Event) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(events))
+	for _, e := range events {
+		out = append(out, map[string]interface{}{
+			"time":     e.Time,
+			"agent_id": e.AgentID,
+			"source":   e.Source,
+			"category": e.Category,
+			"severity": e.Severity,
+			"summary":  e.Summary,
+		})
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
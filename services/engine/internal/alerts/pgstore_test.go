@@ -0,0 +1,121 @@
+package alerts_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+)
+
+const testOrg = "7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10"
+
+type fakeRow struct {
+	values []interface{}
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, d := range dest {
+		switch p := d.(type) {
+		case *uuid.UUID:
+			*p = r.values[i].(uuid.UUID)
+		case *string:
+			*p = r.values[i].(string)
+		case *float32:
+			*p = r.values[i].(float32)
+		case *int:
+			*p = r.values[i].(int)
+		case *time.Time:
+			*p = r.values[i].(time.Time)
+		case *bool:
+			*p = r.values[i].(bool)
+		}
+	}
+	return nil
+}
+
+type fakeQuerier struct {
+	sql  string
+	args []interface{}
+	row  fakeRow
+}
+
+func (q *fakeQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q.sql, q.args = sql, args
+	return q.row
+}
+
+func (q *fakeQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestPGStoreUpsertReturnsStoredState(t *testing.T) {
+	existing := uuid.New()
+	created := time.Now().Add(-time.Hour)
+	now := time.Now()
+	q := &fakeQuerier{row: fakeRow{values: []interface{}{
+		existing, "acknowledged", float32(8), 7, 3, created, now, now, false,
+	}}}
+	store := alerts.NewPGStore(q)
+
+	a := newAlert(testOrg, "Port Scan", now)
+	a.ID = uuid.NewString()
+	a.AgentID = "not-a-uuid"
+	a.SourceEvents = []core.Event{{Category: "port_scan"}, {Category: "port_scan"}}
+
+	stored, isNew, err := store.Upsert(context.Background(), a)
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if isNew {
+		t.Error("expected update of existing alert")
+	}
+	if stored.ID != existing.String() || stored.OccurrenceCount != 3 || stored.Status != "acknowledged" {
+		t.Errorf("expected stored state from the row, got %+v", stored)
+	}
+	if !stored.CreatedAt.Equal(created) {
+		t.Errorf("expected original created_at, got %v", stored.CreatedAt)
+	}
+
+	if !strings.Contains(q.sql, "ON CONFLICT (org_id, fingerprint) WHERE status <> 'resolved'") {
+		t.Error("expected upsert on the open-fingerprint index")
+	}
+	if q.args[1] != uuid.MustParse(testOrg) {
+		t.Errorf("expected org uuid arg, got %v", q.args[1])
+	}
+	if q.args[2].(*uuid.UUID) != nil {
+		t.Errorf("expected nil agent id for non-uuid agent, got %v", q.args[2])
+	}
+	if q.args[13] != a.Fingerprint {
+		t.Errorf("expected fingerprint arg, got %v", q.args[13])
+	}
+	if !strings.Contains(string(q.args[12].([]byte)), "port_scan") {
+		t.Errorf("expected source events arg, got %s", q.args[12])
+	}
+}
+
+func TestPGStoreRejectsNonUUIDOrg(t *testing.T) {
+	store := alerts.NewPGStore(&fakeQuerier{})
+	_, _, err := store.Upsert(context.Background(), newAlert("org-1", "Port Scan", time.Now()))
+	if !errors.Is(err, alerts.ErrInvalidOrg) {
+		t.Errorf("expected ErrInvalidOrg, got %v", err)
+	}
+}
+
+func TestPGStoreUpsertError(t *testing.T) {
+	store := alerts.NewPGStore(&fakeQuerier{row: fakeRow{err: errors.New("connection reset")}})
+	_, _, err := store.Upsert(context.Background(), newAlert(testOrg, "Port Scan", time.Now()))
+	if err == nil {
+		t.Error("expected database error to be returned")
+	}
+}
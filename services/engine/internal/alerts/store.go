@@ -0,0 +1,159 @@
+package alerts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store is the system of record for alerts. Upsert either creates a new
+// alert or, when an unresolved alert with the same fingerprint exists for the
+// org, bumps its occurrence count and last-seen time. The returned alert is
+// the stored state; created reports which of the two happened.
+type Store interface {
+	Upsert(ctx context.Context, alert Alert) (stored Alert, created bool, err error)
+	List(ctx context.Context, limit int) ([]Alert, error)
+}
+
+// Fingerprint identifies repeat occurrences of the same alert within an org.
+// Alerts raised from a single event also key on the agent, so the same
+// detection on two hosts stays two alerts; correlation and Sigma alerts span
+// agents and name what they group on in the title instead.
+func Fingerprint(alert Alert) string {
+	key := alert.Category + "\x1f" + alert.Severity + "\x1f" + alert.Title
+	if alert.Source != "correlation" && alert.Source != "sigma" {
+		key += "\x1f" + alert.AgentID
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+const (
+	defaultMemoryTTL       = time.Hour
+	defaultMemoryMaxAlerts = 10000
+)
+
+// MemoryStore keeps alerts in process for deployments without a database.
+// Alerts not seen for ttl are pruned, and a later occurrence starts a fresh
+// alert; the oldest alerts are dropped once maxAlerts is reached.
+type MemoryStore struct {
+	mu        sync.Mutex
+	alerts    map[string]*memoryAlert
+	ttl       time.Duration
+	maxAlerts int
+	seq       int64
+	lastPrune time.Time
+}
+
+type memoryAlert struct {
+	alert Alert
+	seq   int64
+}
+
+func NewMemoryStore(ttl time.Duration, maxAlerts int) *MemoryStore {
+	if ttl <= 0 {
+		ttl = defaultMemoryTTL
+	}
+	if maxAlerts <= 0 {
+		maxAlerts = defaultMemoryMaxAlerts
+	}
+	return &MemoryStore{
+		alerts:    make(map[string]*memoryAlert),
+		ttl:       ttl,
+		maxAlerts: maxAlerts,
+		lastPrune: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Upsert(ctx context.Context, alert Alert) (Alert, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPrune) > time.Minute {
+		s.pruneLocked(now)
+	}
+
+	key := alert.OrgID + "\x1e" + alert.Fingerprint
+	if existing, ok := s.alerts[key]; ok && now.Sub(existing.alert.LastSeenAt) <= s.ttl && existing.alert.Status != "resolved" {
+		a := &existing.alert
+		a.OccurrenceCount++
+		a.LastSeenAt = alert.LastSeenAt
+		a.UpdatedAt = now
+		a.Description = alert.Description
+		a.EventCount += alert.EventCount
+		if alert.RiskScore > a.RiskScore {
+			a.RiskScore = alert.RiskScore
+		}
+		if len(alert.SourceEvents) > 0 {
+			a.SourceEvents = alert.SourceEvents
+		}
+		return *a, false, nil
+	}
+
+	if len(s.alerts) >= s.maxAlerts {
+		s.evictOldestLocked()
+	}
+	s.seq++
+	s.alerts[key] = &memoryAlert{alert: alert, seq: s.seq}
+	return alert, true, nil
+}
+
+// List returns up to limit of the most recently created alerts, oldest
+// first.
+func (s *MemoryStore) List(ctx context.Context, limit int) ([]Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]*memoryAlert, 0, len(s.alerts))
+	for _, e := range s.alerts {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	out := make([]Alert, len(entries))
+	for i, e := range entries {
+		out[i] = e.alert
+	}
+	return out, nil
+}
+
+// Prune drops alerts that have not been seen within the store's ttl.
+// Upsert calls it periodically.
+func (s *MemoryStore) Prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(time.Now())
+}
+
+func (s *MemoryStore) pruneLocked(now time.Time) {
+	for k, e := range s.alerts {
+		if now.Sub(e.alert.LastSeenAt) > s.ttl {
+			delete(s.alerts, k)
+		}
+	}
+	s.lastPrune = now
+}
+
+func (s *MemoryStore) evictOldestLocked() {
+	var oldestKey string
+	var oldest time.Time
+	for k, e := range s.alerts {
+		if oldestKey == "" || e.alert.LastSeenAt.Before(oldest) {
+			oldestKey, oldest = k, e.alert.LastSeenAt
+		}
+	}
+	delete(s.alerts, oldestKey)
+}
+
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.alerts)
+}
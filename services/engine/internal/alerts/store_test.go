@@ -0,0 +1,139 @@
+package alerts_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+)
+
+func newAlert(org, title string, at time.Time) alerts.Alert {
+	a := alerts.Alert{
+		ID:              fmt.Sprintf("%s-%d", title, at.UnixNano()),
+		OrgID:           org,
+		Title:           title,
+		Severity:        "high",
+		Category:        "attack",
+		Status:          "open",
+		EventCount:      1,
+		OccurrenceCount: 1,
+		CreatedAt:       at,
+		LastSeenAt:      at,
+	}
+	a.Fingerprint = alerts.Fingerprint(a)
+	return a
+}
+
+func TestMemoryStoreFoldsRepeats(t *testing.T) {
+	s := alerts.NewMemoryStore(time.Hour, 100)
+	ctx := context.Background()
+	first := time.Now()
+
+	stored, created, err := s.Upsert(ctx, newAlert("org-1", "Port Scan", first))
+	if err != nil || !created {
+		t.Fatalf("expected first upsert to create, got created=%v err=%v", created, err)
+	}
+	firstID := stored.ID
+
+	later := first.Add(time.Minute)
+	stored, created, err = s.Upsert(ctx, newAlert("org-1", "Port Scan", later))
+	if err != nil || created {
+		t.Fatalf("expected repeat to update, got created=%v err=%v", created, err)
+	}
+	if stored.ID != firstID {
+		t.Errorf("expected repeat to keep id %s, got %s", firstID, stored.ID)
+	}
+	if stored.OccurrenceCount != 2 || stored.EventCount != 2 {
+		t.Errorf("expected occurrence 2 and event count 2, got %d/%d", stored.OccurrenceCount, stored.EventCount)
+	}
+	if !stored.LastSeenAt.Equal(later) || !stored.CreatedAt.Equal(first) {
+		t.Errorf("expected created %v last seen %v, got %v %v", first, later, stored.CreatedAt, stored.LastSeenAt)
+	}
+
+	if _, created, _ := s.Upsert(ctx, newAlert("org-2", "Port Scan", later)); !created {
+		t.Error("expected same alert in another org to be separate")
+	}
+	if s.Len() != 2 {
+		t.Errorf("expected 2 alerts, got %d", s.Len())
+	}
+}
+
+func TestMemoryStoreExpiresAfterTTL(t *testing.T) {
+	s := alerts.NewMemoryStore(10*time.Millisecond, 100)
+	ctx := context.Background()
+
+	s.Upsert(ctx, newAlert("org-1", "Port Scan", time.Now()))
+	time.Sleep(20 * time.Millisecond)
+
+	s.Prune()
+	if s.Len() != 0 {
+		t.Fatalf("expected stale alert pruned, got %d", s.Len())
+	}
+	if _, created, _ := s.Upsert(ctx, newAlert("org-1", "Port Scan", time.Now())); !created {
+		t.Error("expected a new alert after the previous one expired")
+	}
+}
+
+func TestMemoryStoreBounded(t *testing.T) {
+	s := alerts.NewMemoryStore(time.Hour, 3)
+	ctx := context.Background()
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		s.Upsert(ctx, newAlert("org-1", fmt.Sprintf("alert-%d", i), now.Add(time.Duration(i)*time.Second)))
+	}
+	if s.Len() != 3 {
+		t.Fatalf("expected store capped at 3, got %d", s.Len())
+	}
+	list, _ := s.List(ctx, 0)
+	if list[0].Title != "alert-2" || list[2].Title != "alert-4" {
+		t.Errorf("expected oldest alerts evicted, got %s..%s", list[0].Title, list[2].Title)
+	}
+}
+
+func TestMemoryStoreListLimit(t *testing.T) {
+	s := alerts.NewMemoryStore(time.Hour, 100)
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		s.Upsert(ctx, newAlert("org-1", fmt.Sprintf("alert-%d", i), now))
+	}
+
+	list, err := s.List(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Title != "alert-3" || list[1].Title != "alert-4" {
+		t.Errorf("expected the two newest alerts oldest first, got %v", list)
+	}
+}
+
+func TestFingerprintIgnoresVolatileFields(t *testing.T) {
+	a := newAlert("org-1", "Port Scan", time.Now())
+	b := newAlert("org-1", "Port Scan", time.Now().Add(time.Hour))
+	b.Description = "different"
+	b.RiskScore = 9
+	if alerts.Fingerprint(a) != alerts.Fingerprint(b) {
+		t.Error("expected fingerprint to ignore description, score and time")
+	}
+	b.Severity = "critical"
+	if alerts.Fingerprint(a) == alerts.Fingerprint(b) {
+		t.Error("expected fingerprint to change with severity")
+	}
+}
+
+func TestFingerprintSeparatesAgentsForEventAlerts(t *testing.T) {
+	a := newAlert("org-1", "Port Scan Detected", time.Now())
+	a.Source, a.AgentID = "network", "agent-1"
+	b := a
+	b.AgentID = "agent-2"
+	if alerts.Fingerprint(a) == alerts.Fingerprint(b) {
+		t.Error("expected per-event alerts from different agents to differ")
+	}
+	a.Source, b.Source = "correlation", "correlation"
+	if alerts.Fingerprint(a) != alerts.Fingerprint(b) {
+		t.Error("expected correlation alerts to ignore the agent")
+	}
+}
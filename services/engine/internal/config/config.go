@@ -1,17 +1,60 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 type Config struct {
-	NATSUrl        string
-	NATSToken      string
-	DatabaseURL    string
-	APIURL         string
-	LLMProvider    string
-	LLMAPIKey      string
-	LLMModel       string
-	AlertWebhook   string
-	ScoringWindow  string
+	NATSUrl       string
+	NATSToken     string
+	DatabaseURL   string
+	APIURL        string
+	LLMProvider   string
+	LLMAPIKey     string
+	LLMModel      string
+	AlertWebhook  string
+	ScoringWindow string
+
+	EventsStream          string
+	EventsConsumer        string
+	EventsDeadLetter      string
+	EventsMaxDeliver      int
+	EventsAckWait         time.Duration
+	EventsRedeliveryDelay time.Duration
+
+	PersistBatchSize      int
+	PersistFlushInterval  time.Duration
+	PersistQueueSize      int
+	ScoreSnapshotInterval time.Duration
+
+	RulesDir            string
+	RulesReloadInterval time.Duration
+
+	SigmaDir string
+
+	NotifyMaxAttempts int
+	NotifyBackoff     time.Duration
+	NotifyRulesTTL    time.Duration
+	SMTPAddr          string
+	SMTPFrom          string
+	SMTPUsername      string
+	SMTPPassword      string
+	PagerDutyURL      string
+	SecretsKey        string
+	APIServiceToken   string
+
+	PlaybooksTTL           time.Duration
+	PlaybookWorkers        int
+	PlaybookStepTimeout    time.Duration
+	PlaybookMaxStepTimeout time.Duration
+
+	IntelFeeds string
+
+	GeoIPCityDB         string
+	GeoIPASNDB          string
+	GeoIPReloadInterval time.Duration
 }
 
 func Load() *Config {
@@ -25,6 +68,45 @@ func Load() *Config {
 		LLMModel:      getEnv("LLM_MODEL", "claude-sonnet-4-20250514"),
 		AlertWebhook:  getEnv("ALERT_WEBHOOK", ""),
 		ScoringWindow: getEnv("SCORING_WINDOW", "24h"),
+
+		EventsStream:          getEnv("EVENTS_STREAM", "EVENTS"),
+		EventsConsumer:        getEnv("EVENTS_CONSUMER", "engine"),
+		EventsDeadLetter:      getEnv("EVENTS_DEAD_LETTER_SUBJECT", "deadletter.events"),
+		EventsMaxDeliver:      getEnvInt("EVENTS_MAX_DELIVER", 5),
+		EventsAckWait:         getEnvDuration("EVENTS_ACK_WAIT", 30*time.Second),
+		EventsRedeliveryDelay: getEnvDuration("EVENTS_REDELIVERY_DELAY", time.Second),
+
+		PersistBatchSize:      getEnvInt("PERSIST_BATCH_SIZE", 500),
+		PersistFlushInterval:  getEnvDuration("PERSIST_FLUSH_INTERVAL", 2*time.Second),
+		PersistQueueSize:      getEnvInt("PERSIST_QUEUE_SIZE", 10000),
+		ScoreSnapshotInterval: getEnvDuration("SCORE_SNAPSHOT_INTERVAL", time.Minute),
+
+		RulesDir:            getEnv("RULES_DIR", "/etc/shield/rules"),
+		RulesReloadInterval: getEnvDuration("RULES_RELOAD_INTERVAL", 10*time.Second),
+
+		SigmaDir: getEnv("SIGMA_DIR", "/etc/shield/sigma"),
+
+		NotifyMaxAttempts: getEnvInt("NOTIFY_MAX_ATTEMPTS", 4),
+		NotifyBackoff:     getEnvDuration("NOTIFY_BACKOFF", 2*time.Second),
+		NotifyRulesTTL:    getEnvDuration("NOTIFY_RULES_TTL", 30*time.Second),
+		SMTPAddr:          getEnv("SMTP_ADDR", ""),
+		SMTPFrom:          getEnv("SMTP_FROM", "cybershield@localhost"),
+		SMTPUsername:      getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:      getEnv("SMTP_PASSWORD", ""),
+		PagerDutyURL:      getEnv("PAGERDUTY_EVENTS_URL", "https://events.pagerduty.com/v2/enqueue"),
+		SecretsKey:        getEnv("SECRETS_KEY", ""),
+		APIServiceToken:   getEnv("API_SERVICE_TOKEN", ""),
+
+		PlaybooksTTL:           getEnvDuration("PLAYBOOKS_TTL", 30*time.Second),
+		PlaybookWorkers:        getEnvInt("PLAYBOOK_WORKERS", 2),
+		PlaybookStepTimeout:    getEnvDuration("PLAYBOOK_STEP_TIMEOUT", 30*time.Second),
+		PlaybookMaxStepTimeout: getEnvDuration("PLAYBOOK_MAX_STEP_TIMEOUT", 5*time.Minute),
+
+		IntelFeeds: getEnv("INTEL_FEEDS", "/etc/shield/intel/feeds.yml"),
+
+		GeoIPCityDB:         getEnv("GEOIP_CITY_DB", "/etc/shield/geoip/GeoLite2-City.mmdb"),
+		GeoIPASNDB:          getEnv("GEOIP_ASN_DB", "/etc/shield/geoip/GeoLite2-ASN.mmdb"),
+		GeoIPReloadInterval: getEnvDuration("GEOIP_RELOAD_INTERVAL", time.Minute),
 	}
 }
 
@@ -34,3 +116,21 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	if val := os.Getenv(key); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
@@ -3,12 +3,16 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 type Event struct {
@@ -30,26 +34,76 @@ type Pipeline struct {
 	Handler EventHandler
 }
 
+// EventEnricher annotates an event in place before the pipelines see it.
+type EventEnricher func(event *Event) error
+
+type Enricher struct {
+	Name   string
+	Enrich EventEnricher
+}
+
+type DeliveryConfig struct {
+	Stream            string
+	Consumer          string
+	DeadLetterSubject string
+	MaxDeliver        int
+	AckWait           time.Duration
+	RedeliveryDelay   time.Duration
+	MaxAge            time.Duration
+}
+
+func DefaultDeliveryConfig() DeliveryConfig {
+	return DeliveryConfig{
+		Stream:            "EVENTS",
+		Consumer:          "engine",
+		DeadLetterSubject: "deadletter.events",
+		MaxDeliver:        5,
+		AckWait:           30 * time.Second,
+		RedeliveryDelay:   time.Second,
+		MaxAge:            7 * 24 * time.Hour,
+	}
+}
+
+type delivery struct {
+	event Event
+	msg   jetstream.Msg
+}
+
 type Engine struct {
 	nc        *nats.Conn
+	js        jetstream.JetStream
 	db        *pgxpool.Pool
-	subs      []*nats.Subscription
+	delivery  DeliveryConfig
+	consumer  jetstream.ConsumeContext
+	enrichers []Enricher
 	pipelines []Pipeline
-	eventCh   chan Event
+	eventCh   chan delivery
 	cancel    context.CancelFunc
 	wg        sync.WaitGroup
 	mu        sync.RWMutex
 	processed int64
+
+	// handled records, by stream sequence, the pipelines that already
+	// succeeded for a message awaiting redelivery, so the retry only runs
+	// the ones that failed.
+	handledMu sync.Mutex
+	handled   map[uint64]map[string]bool
 }
 
 func New(nc *nats.Conn, db *pgxpool.Pool) *Engine {
 	return &Engine{
-		nc:      nc,
-		db:      db,
-		eventCh: make(chan Event, 5000),
+		nc:       nc,
+		db:       db,
+		delivery: DefaultDeliveryConfig(),
+		eventCh:  make(chan delivery, 5000),
+		handled:  make(map[uint64]map[string]bool),
 	}
 }
 
+func (e *Engine) SetDelivery(cfg DeliveryConfig) {
+	e.delivery = cfg
+}
+
 func (e *Engine) RegisterPipeline(name string, handler EventHandler) {
 	e.pipelines = append(e.pipelines, Pipeline{
 		Name:    name,
@@ -57,26 +111,48 @@ func (e *Engine) RegisterPipeline(name string, handler EventHandler) {
 	})
 }
 
+// RegisterEnricher adds a stage that runs, in registration order, before
+// every pipeline. A failing enricher is logged and the event goes on
+// without its annotations.
+func (e *Engine) RegisterEnricher(name string, enricher EventEnricher) {
+	e.enrichers = append(e.enrichers, Enricher{
+		Name:   name,
+		Enrich: enricher,
+	})
+}
+
 func (e *Engine) Start(ctx context.Context) error {
 	ctx, e.cancel = context.WithCancel(ctx)
 
-	sub, err := e.nc.Subscribe("events.>", func(msg *nats.Msg) {
+	js, err := jetstream.New(e.nc)
+	if err != nil {
+		return fmt.Errorf("jetstream: %w", err)
+	}
+	e.js = js
+
+	consumer, err := e.setupStreams(ctx)
+	if err != nil {
+		e.cancel()
+		return err
+	}
+
+	e.consumer, err = consumer.Consume(func(msg jetstream.Msg) {
 		var event Event
-		if err := json.Unmarshal(msg.Data, &event); err != nil {
+		if err := json.Unmarshal(msg.Data(), &event); err != nil {
 			log.Printf("engine: failed to unmarshal event: %v", err)
+			e.deadLetter(msg, fmt.Sprintf("unmarshal: %v", err))
 			return
 		}
 
 		select {
-		case e.eventCh <- event:
-		default:
-			log.Println("engine: event channel full, dropping event")
+		case e.eventCh <- delivery{event: event, msg: msg}:
+		case <-ctx.Done():
 		}
 	})
 	if err != nil {
-		return err
+		e.cancel()
+		return fmt.Errorf("consume events: %w", err)
 	}
-	e.subs = append(e.subs, sub)
 
 	for i := 0; i < 4; i++ {
 		e.wg.Add(1)
@@ -90,9 +166,47 @@ func (e *Engine) Start(ctx context.Context) error {
 	return nil
 }
 
+func (e *Engine) setupStreams(ctx context.Context) (jetstream.Consumer, error) {
+	cfg := e.delivery
+
+	_, err := e.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       cfg.Stream,
+		Subjects:   []string{"events.>"},
+		Storage:    jetstream.FileStorage,
+		MaxAge:     cfg.MaxAge,
+		Duplicates: 2 * time.Minute,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create stream %s: %w", cfg.Stream, err)
+	}
+
+	_, err = e.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.Stream + "_DLQ",
+		Subjects: []string{cfg.DeadLetterSubject + ".>"},
+		Storage:  jetstream.FileStorage,
+		MaxAge:   cfg.MaxAge,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create dead-letter stream: %w", err)
+	}
+
+	consumer, err := e.js.CreateOrUpdateConsumer(ctx, cfg.Stream, jetstream.ConsumerConfig{
+		Durable:       cfg.Consumer,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+		MaxDeliver:    cfg.MaxDeliver,
+		FilterSubject: "events.>",
+		MaxAckPending: cap(e.eventCh),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create consumer %s: %w", cfg.Consumer, err)
+	}
+	return consumer, nil
+}
+
 func (e *Engine) Stop() error {
-	for _, sub := range e.subs {
-		sub.Unsubscribe()
+	if e.consumer != nil {
+		e.consumer.Stop()
 	}
 	if e.cancel != nil {
 		e.cancel()
@@ -106,8 +220,12 @@ func (e *Engine) processEvents(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case event := <-e.eventCh:
-			e.runPipelines(event)
+		case d := <-e.eventCh:
+			seq, done := e.handledFor(d.msg)
+			err := e.runPipelines(d.event, done)
+			if d.msg != nil {
+				e.recordHandled(seq, done, e.settle(d.msg, err))
+			}
 			e.mu.Lock()
 			e.processed++
 			e.mu.Unlock()
@@ -115,11 +233,113 @@ func (e *Engine) processEvents(ctx context.Context) {
 	}
 }
 
-func (e *Engine) runPipelines(event Event) {
+// runPipelines runs every pipeline not already in done, adding those that
+// succeed to it.
+func (e *Engine) runPipelines(event Event, done map[string]bool) error {
+	for _, en := range e.enrichers {
+		if err := en.Enrich(&event); err != nil {
+			log.Printf("engine: enricher %s error: %v", en.Name, err)
+		}
+	}
+
+	var errs []error
 	for _, p := range e.pipelines {
+		if done[p.Name] {
+			continue
+		}
 		if err := p.Handler(event); err != nil {
 			log.Printf("engine: pipeline %s error: %v", p.Name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		done[p.Name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// handledFor returns the message's stream sequence and the pipelines that
+// handled it on earlier deliveries. Injected events have no sequence.
+func (e *Engine) handledFor(msg jetstream.Msg) (uint64, map[string]bool) {
+	if msg == nil {
+		return 0, map[string]bool{}
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		return 0, map[string]bool{}
+	}
+	seq := meta.Sequence.Stream
+	e.handledMu.Lock()
+	defer e.handledMu.Unlock()
+	if done, ok := e.handled[seq]; ok {
+		return seq, done
+	}
+	return seq, map[string]bool{}
+}
+
+// recordHandled keeps done for a message that will be redelivered and
+// forgets it once the message is acked or dead-lettered.
+func (e *Engine) recordHandled(seq uint64, done map[string]bool, redeliver bool) {
+	if seq == 0 {
+		return
+	}
+	e.handledMu.Lock()
+	defer e.handledMu.Unlock()
+	if !redeliver {
+		delete(e.handled, seq)
+		return
+	}
+	e.handled[seq] = done
+}
+
+// settle acks, naks or dead-letters msg and reports whether it was nak'd
+// for redelivery.
+func (e *Engine) settle(msg jetstream.Msg, pipelineErr error) bool {
+	if pipelineErr == nil {
+		if err := msg.Ack(); err != nil {
+			log.Printf("engine: ack failed: %v", err)
 		}
+		return false
+	}
+
+	delivered := uint64(1)
+	if meta, err := msg.Metadata(); err == nil {
+		delivered = meta.NumDelivered
+	}
+
+	if e.delivery.MaxDeliver > 0 && delivered >= uint64(e.delivery.MaxDeliver) {
+		e.deadLetter(msg, pipelineErr.Error())
+		return false
+	}
+
+	delay := e.delivery.RedeliveryDelay << min(delivered-1, 16)
+	if delay > e.delivery.AckWait {
+		delay = e.delivery.AckWait
+	}
+	if err := msg.NakWithDelay(delay); err != nil {
+		log.Printf("engine: nak failed: %v", err)
+	}
+	return true
+}
+
+func (e *Engine) deadLetter(msg jetstream.Msg, reason string) {
+	out := nats.NewMsg(e.delivery.DeadLetterSubject + "." + msg.Subject())
+	out.Data = msg.Data()
+	out.Header.Set("Shield-Original-Subject", msg.Subject())
+	out.Header.Set("Shield-Error", reason)
+	if meta, err := msg.Metadata(); err == nil {
+		out.Header.Set("Shield-Deliveries", strconv.FormatUint(meta.NumDelivered, 10))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := e.js.PublishMsg(ctx, out); err != nil {
+		log.Printf("engine: failed to dead-letter event from %s: %v", msg.Subject(), err)
+		msg.Nak()
+		return
+	}
+	if err := msg.TermWithReason(reason); err != nil {
+		log.Printf("engine: term failed: %v", err)
 	}
 }
 
@@ -135,7 +355,7 @@ func (e *Engine) PipelineCount() int {
 
 func (e *Engine) InjectEvent(event Event) {
 	select {
-	case e.eventCh <- event:
+	case e.eventCh <- delivery{event: event}:
 	default:
 	}
 }
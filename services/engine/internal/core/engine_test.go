@@ -3,17 +3,20 @@ package core_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
 	natsserver "github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 func setupTestNATS(t *testing.T) *nats.Conn {
 	t.Helper()
-	opts := &natsserver.Options{Port: -1}
+	opts := &natsserver.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()}
 	ns, err := natsserver.NewServer(opts)
 	if err != nil {
 		t.Fatalf("failed to create nats server: %v", err)
@@ -143,6 +146,44 @@ func TestEngineMultiplePipelines(t *testing.T) {
 	engine.Stop()
 }
 
+func TestEngineEnrichersRunBeforePipelines(t *testing.T) {
+	nc := setupTestNATS(t)
+	engine := core.New(nc, nil)
+
+	engine.RegisterEnricher("tag", func(event *core.Event) error {
+		event.Severity = "high"
+		event.Payload["tagged"] = true
+		return nil
+	})
+	engine.RegisterEnricher("broken", func(event *core.Event) error {
+		return errors.New("lookup failed")
+	})
+	processed := make(chan core.Event, 10)
+	engine.RegisterPipeline("collect", func(event core.Event) error {
+		processed <- event
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer engine.Stop()
+
+	data, _ := json.Marshal(core.Event{Time: time.Now(), OrgID: "org-1", Severity: "low", Payload: map[string]interface{}{}})
+	nc.Publish("events.org-1.agent-1", data)
+
+	select {
+	case got := <-processed:
+		if got.Severity != "high" || got.Payload["tagged"] != true {
+			t.Errorf("expected the enriched event, got %+v", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for event processing")
+	}
+}
+
 func TestEngineProcessedCount(t *testing.T) {
 	nc := setupTestNATS(t)
 	engine := core.New(nc, nil)
@@ -173,3 +214,197 @@ func TestEngineProcessedCount(t *testing.T) {
 
 	engine.Stop()
 }
+
+func testDelivery() core.DeliveryConfig {
+	cfg := core.DefaultDeliveryConfig()
+	cfg.MaxDeliver = 3
+	cfg.AckWait = 2 * time.Second
+	cfg.RedeliveryDelay = 10 * time.Millisecond
+	return cfg
+}
+
+func TestEngineRedeliversFailedEvents(t *testing.T) {
+	nc := setupTestNATS(t)
+	engine := core.New(nc, nil)
+	engine.SetDelivery(testDelivery())
+
+	var attempts atomic.Int32
+	done := make(chan struct{}, 1)
+	engine.RegisterPipeline("flaky", func(event core.Event) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("transient failure")
+		}
+		done <- struct{}{}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer engine.Stop()
+
+	data, _ := json.Marshal(core.Event{Time: time.Now(), OrgID: "org-1", Source: "test"})
+	nc.Publish("events.org-1.agent-1", data)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for redelivery")
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestEngineRedeliveryOnlyRetriesFailedPipelines(t *testing.T) {
+	nc := setupTestNATS(t)
+	engine := core.New(nc, nil)
+	engine.SetDelivery(testDelivery())
+
+	var counted, flaky atomic.Int32
+	done := make(chan struct{}, 1)
+	engine.RegisterPipeline("counter", func(event core.Event) error {
+		counted.Add(1)
+		return nil
+	})
+	engine.RegisterPipeline("flaky", func(event core.Event) error {
+		if flaky.Add(1) == 1 {
+			return errors.New("backpressure")
+		}
+		done <- struct{}{}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer engine.Stop()
+
+	data, _ := json.Marshal(core.Event{Time: time.Now(), OrgID: "org-1", Source: "test"})
+	nc.Publish("events.org-1.agent-1", data)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for redelivery")
+	}
+	if counted.Load() != 1 {
+		t.Errorf("expected the succeeding pipeline to run once, ran %d times", counted.Load())
+	}
+}
+
+func TestEngineDeadLettersAfterMaxDeliver(t *testing.T) {
+	nc := setupTestNATS(t)
+	engine := core.New(nc, nil)
+	engine.SetDelivery(testDelivery())
+
+	var attempts atomic.Int32
+	engine.RegisterPipeline("broken", func(event core.Event) error {
+		attempts.Add(1)
+		return errors.New("permanent failure")
+	})
+
+	dead := make(chan *nats.Msg, 1)
+	nc.Subscribe("deadletter.events.>", func(msg *nats.Msg) {
+		dead <- msg
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer engine.Stop()
+
+	data, _ := json.Marshal(core.Event{Time: time.Now(), OrgID: "org-1", Source: "test"})
+	nc.Publish("events.org-1.agent-1", data)
+
+	select {
+	case msg := <-dead:
+		if msg.Subject != "deadletter.events.events.org-1.agent-1" {
+			t.Errorf("unexpected dead-letter subject %s", msg.Subject)
+		}
+		if msg.Header.Get("Shield-Error") == "" {
+			t.Error("expected error header on dead-lettered message")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for dead-letter")
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestEngineDeadLettersMalformedEvents(t *testing.T) {
+	nc := setupTestNATS(t)
+	engine := core.New(nc, nil)
+	engine.SetDelivery(testDelivery())
+
+	dead := make(chan *nats.Msg, 1)
+	nc.Subscribe("deadletter.events.>", func(msg *nats.Msg) {
+		dead <- msg
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := engine.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer engine.Stop()
+
+	nc.Publish("events.org-1.agent-1", []byte("not json"))
+
+	select {
+	case msg := <-dead:
+		if string(msg.Data) != "not json" {
+			t.Errorf("expected original payload, got %q", msg.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for dead-letter")
+	}
+}
+
+func TestEngineReceivesEventsPublishedWhileStopped(t *testing.T) {
+	nc := setupTestNATS(t)
+
+	first := core.New(nc, nil)
+	first.SetDelivery(testDelivery())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := first.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	first.Stop()
+
+	js, _ := jetstream.New(nc)
+	for i := 0; i < 3; i++ {
+		data, _ := json.Marshal(core.Event{Time: time.Now(), OrgID: "org-1", Source: "test"})
+		if _, err := js.Publish(ctx, "events.org-1.agent-1", data); err != nil {
+			t.Fatalf("publish while engine down failed: %v", err)
+		}
+	}
+
+	processed := make(chan core.Event, 10)
+	second := core.New(nc, nil)
+	second.SetDelivery(testDelivery())
+	second.RegisterPipeline("collect", func(event core.Event) error {
+		processed <- event
+		return nil
+	})
+	if err := second.Start(ctx); err != nil {
+		t.Fatalf("failed to restart: %v", err)
+	}
+	defer second.Stop()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-processed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 3 events after restart, got %d", i)
+		}
+	}
+}
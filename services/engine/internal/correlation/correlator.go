@@ -2,6 +2,8 @@ package correlation
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,6 +18,14 @@ type Rule struct {
 	Match       func(events []core.Event) bool
 	Severity    string
 	Category    string
+	// GroupBy partitions events by the values of these fields (see
+	// FieldValue) so the rule only ever sees events sharing a key, e.g.
+	// the same payload.src_ip. Events missing any of the fields are left
+	// out of the rule.
+	GroupBy []string
+	// Filter, when set, keeps events the rule can never match out of its
+	// group partitions.
+	Filter func(event core.Event) bool
 }
 
 type CorrelationResult struct {
@@ -25,15 +35,25 @@ type CorrelationResult struct {
 	Category  string
 	Summary   string
 	Timestamp time.Time
+	GroupKey  map[string]string
+}
+
+type partition struct {
+	events   []core.Event
+	window   time.Duration
+	lastSeen time.Time
 }
 
 type Correlator struct {
-	mu        sync.RWMutex
-	rules     []Rule
-	buffer    map[string][]core.Event
-	results   []CorrelationResult
-	maxBuffer int
-	resultCh  chan CorrelationResult
+	mu         sync.RWMutex
+	rules      []Rule
+	ruleSets   map[string][]Rule
+	buffer     map[string][]core.Event
+	partitions map[string]*partition
+	lastEvict  time.Time
+	results    []CorrelationResult
+	maxBuffer  int
+	resultCh   chan CorrelationResult
 }
 
 func New(maxBuffer int) *Correlator {
@@ -41,65 +61,177 @@ func New(maxBuffer int) *Correlator {
 		maxBuffer = 10000
 	}
 	c := &Correlator{
-		buffer:    make(map[string][]core.Event),
-		maxBuffer: maxBuffer,
-		resultCh:  make(chan CorrelationResult, 100),
+		buffer:     make(map[string][]core.Event),
+		ruleSets:   make(map[string][]Rule),
+		partitions: make(map[string]*partition),
+		lastEvict:  time.Now(),
+		maxBuffer:  maxBuffer,
+		resultCh:   make(chan CorrelationResult, 100),
 	}
 	c.registerDefaultRules()
 	return c
 }
 
 func (c *Correlator) RegisterRule(rule Rule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.rules = append(c.rules, rule)
 }
 
+// SetRules replaces the named rule set, leaving built-in rules and other
+// sets untouched. Passing no rules removes the set.
+func (c *Correlator) SetRules(set string, rules []Rule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(rules) == 0 {
+		delete(c.ruleSets, set)
+		return
+	}
+	c.ruleSets[set] = append([]Rule(nil), rules...)
+}
+
+func (c *Correlator) activeRules() []Rule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	rules := make([]Rule, 0, len(c.rules))
+	rules = append(rules, c.rules...)
+	for _, set := range c.ruleSets {
+		rules = append(rules, set...)
+	}
+	return rules
+}
+
 func (c *Correlator) Process(event core.Event) error {
+	now := time.Now()
+	rules := c.activeRules()
+
+	type groupEval struct {
+		rule   Rule
+		key    map[string]string
+		events []core.Event
+	}
+	var grouped []groupEval
+
 	c.mu.Lock()
-	key := event.OrgID
-	c.buffer[key] = append(c.buffer[key], event)
+	orgID := event.OrgID
+	c.buffer[orgID] = append(c.buffer[orgID], event)
+	if len(c.buffer[orgID]) > c.maxBuffer {
+		c.buffer[orgID] = c.buffer[orgID][len(c.buffer[orgID])-c.maxBuffer:]
+	}
+	orgEvents := make([]core.Event, len(c.buffer[orgID]))
+	copy(orgEvents, c.buffer[orgID])
 
-	if len(c.buffer[key]) > c.maxBuffer {
-		c.buffer[key] = c.buffer[key][len(c.buffer[key])-c.maxBuffer:]
+	// Grouped rules keep their own per-key buffers. Only the partition the
+	// new event lands in has changed, so only that one is re-evaluated.
+	for _, rule := range rules {
+		if len(rule.GroupBy) == 0 || (rule.Filter != nil && !rule.Filter(event)) {
+			continue
+		}
+		values, id, ok := GroupKey(event, rule.GroupBy)
+		if !ok {
+			continue
+		}
+		pk := orgID + "\x00" + rule.Name + "\x00" + id
+		p, ok := c.partitions[pk]
+		if !ok {
+			p = &partition{}
+			c.partitions[pk] = p
+		}
+		p.events = append(filterByWindow(p.events, now, rule.Window), event)
+		if len(p.events) > c.maxBuffer {
+			p.events = p.events[len(p.events)-c.maxBuffer:]
+		}
+		p.window = rule.Window
+		p.lastSeen = now
+
+		events := make([]core.Event, len(p.events))
+		copy(events, p.events)
+		grouped = append(grouped, groupEval{rule: rule, key: values, events: events})
+	}
+
+	if now.Sub(c.lastEvict) >= time.Minute {
+		c.evictLocked(now)
 	}
 	c.mu.Unlock()
 
-	c.evaluateRules(key)
+	for _, rule := range rules {
+		if len(rule.GroupBy) == 0 {
+			c.evaluate(rule, nil, orgEvents, now)
+		}
+	}
+	for _, g := range grouped {
+		c.evaluate(g.rule, g.key, g.events, now)
+	}
 	return nil
 }
 
-func (c *Correlator) evaluateRules(orgID string) {
-	c.mu.RLock()
-	events := make([]core.Event, len(c.buffer[orgID]))
-	copy(events, c.buffer[orgID])
-	c.mu.RUnlock()
+func (c *Correlator) evaluate(rule Rule, key map[string]string, events []core.Event, now time.Time) {
+	windowEvents := filterByWindow(events, now, rule.Window)
+	if len(windowEvents) < rule.MinEvents {
+		return
+	}
+	if !rule.Match(windowEvents) {
+		return
+	}
 
-	now := time.Now()
-	for _, rule := range c.rules {
-		windowEvents := filterByWindow(events, now, rule.Window)
-		if len(windowEvents) < rule.MinEvents {
-			continue
-		}
+	result := CorrelationResult{
+		Rule:      rule.Name,
+		Events:    windowEvents,
+		Severity:  rule.Severity,
+		Category:  rule.Category,
+		Summary:   rule.Description,
+		Timestamp: now,
+		GroupKey:  key,
+	}
 
-		if rule.Match(windowEvents) {
-			result := CorrelationResult{
-				Rule:      rule.Name,
-				Events:    windowEvents,
-				Severity:  rule.Severity,
-				Category:  rule.Category,
-				Summary:   rule.Description,
-				Timestamp: now,
-			}
+	c.mu.Lock()
+	c.results = append(c.results, result)
+	c.mu.Unlock()
 
-			c.mu.Lock()
-			c.results = append(c.results, result)
-			c.mu.Unlock()
+	select {
+	case c.resultCh <- result:
+	default:
+	}
+}
 
-			select {
-			case c.resultCh <- result:
-			default:
-			}
+// EvictStale drops group partitions that have seen no events for longer
+// than their rule's window. Process calls it about once a minute.
+func (c *Correlator) EvictStale() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked(time.Now())
+}
+
+func (c *Correlator) evictLocked(now time.Time) {
+	for k, p := range c.partitions {
+		if now.Sub(p.lastSeen) > p.window {
+			delete(c.partitions, k)
 		}
 	}
+	c.lastEvict = now
+}
+
+func (c *Correlator) PartitionCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.partitions)
+}
+
+// GroupKey returns the event's values for the given fields, along with a
+// string form suitable for use as a map key. ok is false when the event
+// lacks any of the fields.
+func GroupKey(event core.Event, fields []string) (map[string]string, string, bool) {
+	values := make(map[string]string, len(fields))
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		v, ok := FieldValue(event, f)
+		if !ok {
+			return nil, "", false
+		}
+		parts[i] = fmt.Sprint(v)
+		values[f] = parts[i]
+	}
+	return values, strings.Join(parts, "\x1f"), true
 }
 
 func filterByWindow(events []core.Event, now time.Time, window time.Duration) []core.Event {
@@ -132,7 +264,24 @@ func (c *Correlator) ClearResults() {
 }
 
 func (c *Correlator) RuleCount() int {
-	return len(c.rules)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n := len(c.rules)
+	for _, set := range c.ruleSets {
+		n += len(set)
+	}
+	return n
+}
+
+// BuiltinRuleNames lists the rules every Correlator starts with.
+func BuiltinRuleNames() []string {
+	var c Correlator
+	c.registerDefaultRules()
+	names := make([]string, len(c.rules))
+	for i, r := range c.rules {
+		names[i] = r.Name
+	}
+	return names
 }
 
 func (c *Correlator) registerDefaultRules() {
@@ -143,6 +292,10 @@ func (c *Correlator) registerDefaultRules() {
 		MinEvents:   5,
 		Severity:    "high",
 		Category:    "attack",
+		GroupBy:     []string{"payload.src_ip"},
+		Filter: func(e core.Event) bool {
+			return e.Category == "auth_failure"
+		},
 		Match: func(events []core.Event) bool {
 			failCount := 0
 			for _, e := range events {
@@ -161,6 +314,10 @@ func (c *Correlator) registerDefaultRules() {
 		MinEvents:   2,
 		Severity:    "critical",
 		Category:    "attack",
+		GroupBy:     []string{"agent_id"},
+		Filter: func(e core.Event) bool {
+			return e.Category == "port_scan" || e.Category == "suspicious_port"
+		},
 		Match: func(events []core.Event) bool {
 			hasPortScan := false
 			hasSuspicious := false
@@ -201,18 +358,34 @@ func (c *Correlator) registerDefaultRules() {
 		MinEvents:   2,
 		Severity:    "critical",
 		Category:    "attack",
+		GroupBy:     []string{"payload.user"},
+		Filter: func(e core.Event) bool {
+			return e.Category == "auth_failure" || e.Category == "auth_success"
+		},
 		Match: func(events []core.Event) bool {
-			hasFailure := false
-			hasSuccess := false
-			for _, e := range events {
-				if e.Category == "auth_failure" {
-					hasFailure = true
+			ordered := make([]core.Event, len(events))
+			copy(ordered, events)
+			sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Time.Before(ordered[j].Time) })
+
+			failedFrom := make(map[string]bool)
+			for _, e := range ordered {
+				src, _ := FieldValue(e, "payload.src_ip")
+				srcIP, _ := src.(string)
+				if srcIP == "" {
+					continue
 				}
-				if e.Category == "auth_success" && hasFailure {
-					hasSuccess = true
+				switch e.Category {
+				case "auth_failure":
+					failedFrom[srcIP] = true
+				case "auth_success":
+					for failed := range failedFrom {
+						if failed != srcIP {
+							return true
+						}
+					}
 				}
 			}
-			return hasFailure && hasSuccess
+			return false
 		},
 	})
 
@@ -223,6 +396,10 @@ func (c *Correlator) registerDefaultRules() {
 		MinEvents:   10,
 		Severity:    "medium",
 		Category:    "availability",
+		GroupBy:     []string{"agent_id"},
+		Filter: func(e core.Event) bool {
+			return e.Category == "web_error"
+		},
 		Match: func(events []core.Event) bool {
 			errorCount := 0
 			for _, e := range events {
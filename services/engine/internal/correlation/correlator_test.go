@@ -1,6 +1,7 @@
 package correlation_test
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -27,6 +28,7 @@ func TestCorrelatorBruteForceDetection(t *testing.T) {
 			Category: "auth_failure",
 			Severity: "medium",
 			Summary:  "Failed password",
+			Payload:  map[string]interface{}{"src_ip": "203.0.113.7"},
 		})
 	}
 
@@ -52,6 +54,7 @@ func TestCorrelatorPortScanWithExploit(t *testing.T) {
 	c.Process(core.Event{
 		Time:     now,
 		OrgID:    "org-1",
+		AgentID:  "agent-1",
 		Source:   "network",
 		Category: "port_scan",
 		Severity: "high",
@@ -59,6 +62,7 @@ func TestCorrelatorPortScanWithExploit(t *testing.T) {
 	c.Process(core.Event{
 		Time:     now.Add(time.Second),
 		OrgID:    "org-1",
+		AgentID:  "agent-1",
 		Source:   "network",
 		Category: "suspicious_port",
 		Severity: "high",
@@ -89,6 +93,7 @@ func TestCorrelatorLateralMovement(t *testing.T) {
 		Source:   "auth",
 		Category: "auth_failure",
 		Severity: "medium",
+		Payload:  map[string]interface{}{"user": "deploy", "src_ip": "10.0.0.5"},
 	})
 	c.Process(core.Event{
 		Time:     now.Add(time.Minute),
@@ -96,6 +101,7 @@ func TestCorrelatorLateralMovement(t *testing.T) {
 		Source:   "auth",
 		Category: "auth_success",
 		Severity: "info",
+		Payload:  map[string]interface{}{"user": "deploy", "src_ip": "10.0.0.9"},
 	})
 
 	results := c.GetResults()
@@ -103,6 +109,9 @@ func TestCorrelatorLateralMovement(t *testing.T) {
 	for _, r := range results {
 		if r.Rule == "lateral_movement" {
 			found = true
+			if r.GroupKey["payload.user"] != "deploy" {
+				t.Errorf("expected group key user=deploy, got %v", r.GroupKey)
+			}
 		}
 	}
 	if !found {
@@ -110,6 +119,139 @@ func TestCorrelatorLateralMovement(t *testing.T) {
 	}
 }
 
+func TestCorrelatorLateralMovementRequiresDifferentSource(t *testing.T) {
+	c := correlation.New(1000)
+
+	now := time.Now()
+	events := []core.Event{
+		{Time: now, Category: "auth_failure", Payload: map[string]interface{}{"user": "deploy", "src_ip": "10.0.0.5"}},
+		{Time: now.Add(time.Second), Category: "auth_success", Payload: map[string]interface{}{"user": "deploy", "src_ip": "10.0.0.5"}},
+		{Time: now.Add(2 * time.Second), Category: "auth_failure", Payload: map[string]interface{}{"user": "alice", "src_ip": "10.0.0.7"}},
+		{Time: now.Add(3 * time.Second), Category: "auth_success", Payload: map[string]interface{}{"user": "bob", "src_ip": "10.0.0.8"}},
+	}
+	for _, e := range events {
+		e.OrgID = "org-1"
+		c.Process(e)
+	}
+
+	for _, r := range c.GetResults() {
+		if r.Rule == "lateral_movement" {
+			t.Errorf("unexpected lateral_movement for %v", r.GroupKey)
+		}
+	}
+}
+
+func TestCorrelatorBruteForcePartitionsBySource(t *testing.T) {
+	c := correlation.New(1000)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		c.Process(core.Event{
+			Time:     now,
+			OrgID:    "org-1",
+			Category: "auth_failure",
+			Payload:  map[string]interface{}{"src_ip": fmt.Sprintf("10.0.0.%d", i)},
+		})
+	}
+	for _, r := range c.GetResults() {
+		if r.Rule == "brute_force_attack" {
+			t.Fatal("expected no brute force for failures spread across sources")
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		c.Process(core.Event{
+			Time:     now,
+			OrgID:    "org-1",
+			Category: "auth_failure",
+			Payload:  map[string]interface{}{"src_ip": "203.0.113.7"},
+		})
+	}
+	var fired []correlation.CorrelationResult
+	for _, r := range c.GetResults() {
+		if r.Rule == "brute_force_attack" {
+			fired = append(fired, r)
+		}
+	}
+	if len(fired) != 1 {
+		t.Fatalf("expected one brute force result, got %d", len(fired))
+	}
+	if fired[0].GroupKey["payload.src_ip"] != "203.0.113.7" {
+		t.Errorf("expected attacker in group key, got %v", fired[0].GroupKey)
+	}
+	for _, e := range fired[0].Events {
+		if e.Payload["src_ip"] != "203.0.113.7" {
+			t.Errorf("expected only attacker events in result, got %v", e.Payload["src_ip"])
+		}
+	}
+}
+
+func TestCorrelatorSkipsEventsMissingGroupFields(t *testing.T) {
+	c := correlation.New(1000)
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		c.Process(core.Event{
+			Time:     now,
+			OrgID:    "org-1",
+			Category: "auth_failure",
+			Payload:  map[string]interface{}{"message": "message repeated 3 times"},
+		})
+	}
+	for _, r := range c.GetResults() {
+		if r.Rule == "brute_force_attack" {
+			t.Fatalf("expected no brute force for failures without a source, got %v", r.GroupKey)
+		}
+	}
+	if n := c.PartitionCount(); n != 0 {
+		t.Errorf("expected no partitions for incomplete events, got %d", n)
+	}
+}
+
+func TestCorrelatorOnlyPartitionsEventsRulesCanMatch(t *testing.T) {
+	c := correlation.New(1000)
+
+	c.Process(core.Event{
+		Time:     time.Now(),
+		OrgID:    "org-1",
+		AgentID:  "agent-1",
+		Category: "process_start",
+		Payload:  map[string]interface{}{"src_ip": "10.0.0.5", "user": "deploy"},
+	})
+	if n := c.PartitionCount(); n != 0 {
+		t.Errorf("expected no partitions for an event no rule matches, got %d", n)
+	}
+}
+
+func TestCorrelatorEvictsStalePartitions(t *testing.T) {
+	c := correlation.New(1000)
+	c.RegisterRule(correlation.Rule{
+		Name:      "short",
+		Window:    10 * time.Millisecond,
+		MinEvents: 100,
+		GroupBy:   []string{"payload.host"},
+		Match:     func(events []core.Event) bool { return false },
+	})
+
+	for i := 0; i < 3; i++ {
+		c.Process(core.Event{
+			Time:    time.Now(),
+			OrgID:   "org-1",
+			Payload: map[string]interface{}{"host": fmt.Sprintf("h%d", i)},
+		})
+	}
+	before := c.PartitionCount()
+	if before == 0 {
+		t.Fatal("expected partitions to be created")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	c.EvictStale()
+	if c.PartitionCount() >= before {
+		t.Errorf("expected short-window partitions evicted, had %d now %d", before, c.PartitionCount())
+	}
+}
+
 func TestCorrelatorNoFalsePositives(t *testing.T) {
 	c := correlation.New(1000)
 
@@ -138,6 +280,7 @@ func TestCorrelatorClearResults(t *testing.T) {
 			Time:     now.Add(time.Duration(i) * time.Second),
 			OrgID:    "org-1",
 			Category: "auth_failure",
+			Payload:  map[string]interface{}{"src_ip": "203.0.113.7"},
 		})
 	}
 
@@ -201,3 +344,64 @@ func TestFormatResult(t *testing.T) {
 		t.Error("expected non-empty formatted string")
 	}
 }
+
+func TestCorrelatorSetRulesReplacesSet(t *testing.T) {
+	c := correlation.New(1000)
+	base := c.RuleCount()
+
+	rule := func(name string) correlation.Rule {
+		return correlation.Rule{
+			Name:      name,
+			Window:    time.Minute,
+			MinEvents: 1,
+			Severity:  "low",
+			Match:     func(events []core.Event) bool { return true },
+		}
+	}
+
+	c.SetRules("files", []correlation.Rule{rule("a"), rule("b")})
+	if c.RuleCount() != base+2 {
+		t.Fatalf("expected %d rules, got %d", base+2, c.RuleCount())
+	}
+
+	c.SetRules("files", []correlation.Rule{rule("c")})
+	if c.RuleCount() != base+1 {
+		t.Fatalf("expected set to be replaced, got %d rules", c.RuleCount())
+	}
+
+	c.SetRules("files", nil)
+	if c.RuleCount() != base {
+		t.Errorf("expected set to be removed, got %d rules", c.RuleCount())
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	e := core.Event{
+		AgentID:  "agent-1",
+		Category: "auth_failure",
+		Payload: map[string]interface{}{
+			"src_ip": "10.0.0.5",
+			"user":   map[string]interface{}{"name": "root"},
+		},
+	}
+
+	cases := []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"category", "auth_failure", true},
+		{"agent_id", "agent-1", true},
+		{"source", "", false},
+		{"payload.src_ip", "10.0.0.5", true},
+		{"payload.user.name", "root", true},
+		{"payload.user.uid", nil, false},
+		{"payload.src_ip.x", nil, false},
+	}
+	for _, tc := range cases {
+		got, ok := correlation.FieldValue(e, tc.path)
+		if ok != tc.ok || (ok && got != tc.want) {
+			t.Errorf("FieldValue(%q) = %v, %v; want %v, %v", tc.path, got, ok, tc.want, tc.ok)
+		}
+	}
+}
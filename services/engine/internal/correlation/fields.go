@@ -0,0 +1,55 @@
+package correlation
+
+import (
+	"strings"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+)
+
+// FieldValue resolves a field path such as "category", "agent_id" or
+// "payload.src_ip" against an event. Nested payload objects are walked with
+// further dots ("payload.user.name").
+func FieldValue(event core.Event, path string) (interface{}, bool) {
+	switch path {
+	case "source":
+		return event.Source, event.Source != ""
+	case "category":
+		return event.Category, event.Category != ""
+	case "severity":
+		return event.Severity, event.Severity != ""
+	case "summary":
+		return event.Summary, event.Summary != ""
+	case "agent_id":
+		return event.AgentID, event.AgentID != ""
+	case "org_id":
+		return event.OrgID, event.OrgID != ""
+	}
+
+	rest, ok := strings.CutPrefix(path, "payload.")
+	if !ok || event.Payload == nil {
+		return nil, false
+	}
+
+	var cur interface{} = event.Payload
+	for _, part := range strings.Split(rest, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+// IsField reports whether path names something FieldValue can resolve.
+func IsField(path string) bool {
+	switch path {
+	case "source", "category", "severity", "summary", "agent_id", "org_id":
+		return true
+	}
+	rest, ok := strings.CutPrefix(path, "payload.")
+	return ok && rest != "" && !strings.HasPrefix(rest, ".") && !strings.HasSuffix(rest, ".") && !strings.Contains(rest, "..")
+}
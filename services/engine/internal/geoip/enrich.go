@@ -0,0 +1,83 @@
+package geoip
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+)
+
+// Suffix names the field an address's annotation is stored in, next to
+// the address: payload.src_ip gets payload.src_ip_geo.
+const Suffix = "_geo"
+
+// Enrich annotates every payload field holding an IP address, or a
+// host:port with an IP host, with what db knows about it. A rule can then
+// match on payload.src_ip_geo.country. It has the signature of a
+// core.EventEnricher.
+func (db *DB) Enrich(event *core.Event) error {
+	if event.Payload != nil {
+		db.annotate(event.Payload)
+	}
+	return nil
+}
+
+func (db *DB) annotate(m map[string]interface{}) {
+	geo := make(map[string]interface{})
+	for k, v := range m {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			db.annotate(v)
+		case string:
+			if strings.HasSuffix(k, Suffix) {
+				continue
+			}
+			addr, ok := parseAddr(v)
+			if !ok {
+				continue
+			}
+			if info, ok := db.Lookup(addr); ok {
+				geo[k+Suffix] = info.fields()
+			}
+		}
+	}
+	for k, v := range geo {
+		if _, exists := m[k]; !exists {
+			m[k] = v
+		}
+	}
+}
+
+func parseAddr(s string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr, true
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// fields is the annotation stored on events; unknown values are left out.
+func (info Info) fields() map[string]interface{} {
+	f := make(map[string]interface{})
+	set := func(k string, v interface{}, ok bool) {
+		if ok {
+			f[k] = v
+		}
+	}
+	set("country", info.Country, info.Country != "")
+	set("country_name", info.CountryName, info.CountryName != "")
+	set("city", info.City, info.City != "")
+	set("latitude", info.Latitude, info.Latitude != 0 || info.Longitude != 0)
+	set("longitude", info.Longitude, info.Latitude != 0 || info.Longitude != 0)
+	set("asn", info.ASN, info.ASN != 0)
+	set("org", info.Org, info.Org != "")
+	set("private", true, info.Private)
+	set("reserved", true, info.Reserved)
+	set("cloud", info.Cloud, info.Cloud != "")
+	return f
+}
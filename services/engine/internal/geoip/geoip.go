@@ -0,0 +1,206 @@
+// Package geoip annotates event IPs with location and network owner from
+// MaxMind-format (MMDB) GeoLite2 City and ASN databases on disk.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Info is what is known about an address. Private and reserved addresses
+// are flagged without a database lookup.
+type Info struct {
+	Country     string
+	CountryName string
+	City        string
+	Latitude    float64
+	Longitude   float64
+	ASN         uint
+	Org         string
+	Private     bool
+	Reserved    bool
+	// Cloud names the provider announcing the address, judged by ASN.
+	Cloud string
+}
+
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country           countryRecord `maxminddb:"country"`
+	RegisteredCountry countryRecord `maxminddb:"registered_country"`
+	Location          struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+type countryRecord struct {
+	ISOCode string            `maxminddb:"iso_code"`
+	Names   map[string]string `maxminddb:"names"`
+}
+
+type asnRecord struct {
+	Number uint   `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// DB looks addresses up in a city and an ASN database, either of which may
+// be missing. The databases are swapped whole on reload, so lookups never
+// lock.
+type DB struct {
+	city atomic.Pointer[maxminddb.Reader]
+	asn  atomic.Pointer[maxminddb.Reader]
+}
+
+func NewDB() *DB {
+	return &DB{}
+}
+
+// LoadCity reads a City database (GeoLite2-City, GeoIP2-City) into memory
+// and starts using it. The file is read rather than mapped, so replacing
+// it on disk cannot disturb lookups in flight.
+func (db *DB) LoadCity(path string) error {
+	r, err := openDB(path, "City")
+	if err != nil {
+		return err
+	}
+	db.city.Store(r)
+	return nil
+}
+
+// LoadASN is LoadCity for an ASN database (GeoLite2-ASN).
+func (db *DB) LoadASN(path string) error {
+	r, err := openDB(path, "ASN")
+	if err != nil {
+		return err
+	}
+	db.asn.Store(r)
+	return nil
+}
+
+func openDB(path, kind string) (*maxminddb.Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !strings.Contains(r.Metadata.DatabaseType, kind) {
+		return nil, fmt.Errorf("%s: expected a %s database, got %s", path, kind, r.Metadata.DatabaseType)
+	}
+	// A file caught mid-copy has to fail here rather than on lookups.
+	if err := r.Verify(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Lookup returns what the databases know about addr. ok is false when
+// nothing is known, not even a flag.
+func (db *DB) Lookup(addr netip.Addr) (Info, bool) {
+	addr = addr.Unmap().WithZone("")
+	info := Info{Private: isPrivate(addr), Reserved: isReserved(addr)}
+	if info.Private || info.Reserved {
+		return info, true
+	}
+
+	found := false
+	ip := net.IP(addr.AsSlice())
+	if r := db.city.Load(); r != nil {
+		var rec cityRecord
+		if err := r.Lookup(ip, &rec); err == nil {
+			country := rec.Country
+			if country.ISOCode == "" {
+				country = rec.RegisteredCountry
+			}
+			info.Country = country.ISOCode
+			info.CountryName = country.Names["en"]
+			info.City = rec.City.Names["en"]
+			info.Latitude = rec.Location.Latitude
+			info.Longitude = rec.Location.Longitude
+			found = info.Country != "" || info.City != ""
+		}
+	}
+	if r := db.asn.Load(); r != nil {
+		var rec asnRecord
+		if err := r.Lookup(ip, &rec); err == nil && rec.Number != 0 {
+			info.ASN = rec.Number
+			info.Org = rec.Org
+			info.Cloud = cloudASNs[rec.Number]
+			found = true
+		}
+	}
+	return info, found
+}
+
+var (
+	privatePrefixes = mustPrefixes(
+		"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+		"100.64.0.0/10", // carrier-grade NAT
+		"fc00::/7",
+	)
+	reservedPrefixes = mustPrefixes(
+		"0.0.0.0/8", "127.0.0.0/8", "169.254.0.0/16", "192.0.0.0/24",
+		"192.0.2.0/24", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24",
+		"224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "64:ff9b:1::/48", "100::/64", "2001:db8::/32",
+		"fe80::/10", "ff00::/8",
+	)
+)
+
+func mustPrefixes(ss ...string) []netip.Prefix {
+	out := make([]netip.Prefix, len(ss))
+	for i, s := range ss {
+		out[i] = netip.MustParsePrefix(s)
+	}
+	return out
+}
+
+func isPrivate(addr netip.Addr) bool {
+	return containedIn(privatePrefixes, addr)
+}
+
+// isReserved covers loopback, link-local, multicast, documentation and
+// the other special-purpose ranges that never route on the internet.
+func isReserved(addr netip.Addr) bool {
+	return containedIn(reservedPrefixes, addr)
+}
+
+func containedIn(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// cloudASNs are the autonomous systems of the large hosting providers.
+var cloudASNs = map[uint]string{
+	16509:  "aws",
+	14618:  "aws",
+	8987:   "aws",
+	15169:  "gcp",
+	396982: "gcp",
+	19527:  "gcp",
+	8075:   "azure",
+	8068:   "azure",
+	31898:  "oracle",
+	13335:  "cloudflare",
+	14061:  "digitalocean",
+	63949:  "akamai-linode",
+	20473:  "vultr",
+	16276:  "ovh",
+	24940:  "hetzner",
+	45102:  "alibaba",
+	132203: "tencent",
+}
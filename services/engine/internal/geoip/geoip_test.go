@@ -0,0 +1,214 @@
+package geoip_test
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/geoip"
+)
+
+func cityRecord(iso, country, city string, lat, lon float64) map[string]interface{} {
+	return map[string]interface{}{
+		"country":  map[string]interface{}{"iso_code": iso, "names": map[string]interface{}{"en": country}},
+		"city":     map[string]interface{}{"names": map[string]interface{}{"en": city}},
+		"location": map[string]interface{}{"latitude": lat, "longitude": lon},
+	}
+}
+
+func asnRecord(asn uint32, org string) map[string]interface{} {
+	return map[string]interface{}{
+		"autonomous_system_number":       asn,
+		"autonomous_system_organization": org,
+	}
+}
+
+// fixtures writes small City and ASN databases and returns their paths.
+func fixtures(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	city := filepath.Join(dir, "GeoLite2-City.mmdb")
+	asn := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	writeMMDB(t, city, "GeoLite2-City", map[string]map[string]interface{}{
+		"81.2.69.0/24":    cityRecord("GB", "United Kingdom", "London", 51.5142, -0.0931),
+		"89.160.20.0/24":  cityRecord("SE", "Sweden", "Linköping", 58.4167, 15.6167),
+		"2a02:cf40::/32":  cityRecord("NO", "Norway", "", 59.955, 10.859),
+		"52.94.0.0/16":    {"registered_country": map[string]interface{}{"iso_code": "US", "names": map[string]interface{}{"en": "United States"}}},
+		"216.160.83.0/24": cityRecord("US", "United States", "Milton", 47.2513, -122.3149),
+	})
+	writeMMDB(t, asn, "GeoLite2-ASN", map[string]map[string]interface{}{
+		"81.2.69.0/24":   asnRecord(20712, "Andrews & Arnold Ltd"),
+		"52.94.0.0/16":   asnRecord(16509, "AMAZON-02"),
+		"2a02:cf40::/32": asnRecord(29695, "Altibox AS"),
+	})
+	return city, asn
+}
+
+func TestLookup(t *testing.T) {
+	city, asn := fixtures(t)
+	db := geoip.NewDB()
+	if err := db.LoadCity(city); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LoadASN(asn); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want geoip.Info
+	}{
+		{"81.2.69.160", geoip.Info{Country: "GB", CountryName: "United Kingdom", City: "London", Latitude: 51.5142, Longitude: -0.0931, ASN: 20712, Org: "Andrews & Arnold Ltd"}},
+		{"::ffff:89.160.20.112", geoip.Info{Country: "SE", CountryName: "Sweden", City: "Linköping", Latitude: 58.4167, Longitude: 15.6167}},
+		{"2a02:cf40:add::1", geoip.Info{Country: "NO", CountryName: "Norway", Latitude: 59.955, Longitude: 10.859, ASN: 29695, Org: "Altibox AS"}},
+		{"52.94.236.248", geoip.Info{Country: "US", CountryName: "United States", ASN: 16509, Org: "AMAZON-02", Cloud: "aws"}},
+		{"10.1.2.3", geoip.Info{Private: true}},
+		{"100.64.0.1", geoip.Info{Private: true}},
+		{"fd00::1", geoip.Info{Private: true}},
+		{"127.0.0.1", geoip.Info{Reserved: true}},
+		{"198.51.100.7", geoip.Info{Reserved: true}},
+		{"fe80::1", geoip.Info{Reserved: true}},
+		{"0.0.0.0", geoip.Info{Reserved: true}},
+	}
+	for _, tt := range tests {
+		got, ok := db.Lookup(netip.MustParseAddr(tt.ip))
+		if !ok || got != tt.want {
+			t.Errorf("Lookup(%s) = %+v %v, want %+v", tt.ip, got, ok, tt.want)
+		}
+	}
+	if info, ok := db.Lookup(netip.MustParseAddr("8.8.8.8")); ok {
+		t.Errorf("expected no data for an address outside the fixture, got %+v", info)
+	}
+}
+
+func TestLoadRejectsWrongDatabase(t *testing.T) {
+	city, asn := fixtures(t)
+	db := geoip.NewDB()
+	if err := db.LoadCity(asn); err == nil {
+		t.Error("expected an ASN database to be rejected as a City database")
+	}
+	if err := db.LoadASN(city); err == nil {
+		t.Error("expected a City database to be rejected as an ASN database")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.mmdb")
+	os.WriteFile(bad, []byte("not a database"), 0o644)
+	if err := db.LoadCity(bad); err == nil {
+		t.Error("expected a corrupt file to be rejected")
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	city, asn := fixtures(t)
+	db := geoip.NewDB()
+	db.LoadCity(city)
+	db.LoadASN(asn)
+
+	event := core.Event{Payload: map[string]interface{}{
+		"src_ip":      "81.2.69.160",
+		"remote_addr": "[2a02:cf40::5]:443",
+		"local_addr":  "10.0.0.5:51000",
+		"user":        "alice",
+		"conn":        map[string]interface{}{"dst_ip": "52.94.1.1"},
+		"unknown_ip":  "8.8.8.8",
+	}}
+	if err := db.Enrich(&event); err != nil {
+		t.Fatal(err)
+	}
+	p := event.Payload
+
+	src, _ := p["src_ip_geo"].(map[string]interface{})
+	if src["country"] != "GB" || src["city"] != "London" || src["asn"] != uint(20712) || src["org"] != "Andrews & Arnold Ltd" {
+		t.Errorf("unexpected src_ip_geo %v", src)
+	}
+	if remote, _ := p["remote_addr_geo"].(map[string]interface{}); remote["country"] != "NO" {
+		t.Errorf("unexpected remote_addr_geo %v", remote)
+	}
+	if local, _ := p["local_addr_geo"].(map[string]interface{}); local["private"] != true || local["country"] != nil {
+		t.Errorf("unexpected local_addr_geo %v", local)
+	}
+	conn := p["conn"].(map[string]interface{})
+	if dst, _ := conn["dst_ip_geo"].(map[string]interface{}); dst["cloud"] != "aws" || dst["country"] != "US" {
+		t.Errorf("unexpected conn.dst_ip_geo %v", dst)
+	}
+	for _, k := range []string{"user_geo", "unknown_ip_geo"} {
+		if _, ok := p[k]; ok {
+			t.Errorf("did not expect %s", k)
+		}
+	}
+}
+
+func TestWatcherReloadsReplacedDatabase(t *testing.T) {
+	city, asn := fixtures(t)
+	db := geoip.NewDB()
+	w := geoip.NewWatcher(db, city, asn+".missing", 10*time.Millisecond)
+	if n, err := w.Load(); n != 1 || err != nil {
+		t.Fatalf("expected the city database to load, got %d (%v)", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	// Replace the database the way updaters do: write aside, then rename.
+	next := city + ".tmp"
+	writeMMDB(t, next, "GeoLite2-City", map[string]map[string]interface{}{
+		"81.2.69.0/24": cityRecord("IE", "Ireland", "Dublin", 53.3331, -6.2489),
+	})
+	later := time.Now().Add(time.Second)
+	os.Chtimes(next, later, later)
+	if err := os.Rename(next, city); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, _ := db.Lookup(netip.MustParseAddr("81.2.69.160"))
+		if info.Country == "IE" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the replaced database to load, still got %+v", info)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A broken replacement keeps the current database.
+	os.WriteFile(city, []byte("truncated"), 0o644)
+	time.Sleep(100 * time.Millisecond)
+	if info, _ := db.Lookup(netip.MustParseAddr("81.2.69.160")); info.Country != "IE" {
+		t.Errorf("expected the previous database to stay, got %+v", info)
+	}
+}
+
+func TestWatcherLoadsDatabaseInstalledLater(t *testing.T) {
+	city, _ := fixtures(t)
+	missing := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	db := geoip.NewDB()
+	w := geoip.NewWatcher(db, missing, "", 10*time.Millisecond)
+	if n, err := w.Load(); n != 0 || err != nil {
+		t.Fatalf("expected nothing to load, got %d (%v)", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	if err := os.Rename(city, missing); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, _ := db.Lookup(netip.MustParseAddr("81.2.69.160"))
+		if info.Country == "GB" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the installed database to load, still got %+v", info)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,166 @@
+package geoip_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"testing"
+)
+
+// writeMMDB writes a MaxMind DB with an IPv6 search tree and 24-bit
+// records, mapping each network to its record. IPv4 networks live under
+// ::/96, where readers look for them. Networks must not nest.
+func writeMMDB(t *testing.T, path, dbType string, networks map[string]map[string]interface{}) {
+	t.Helper()
+
+	type node struct {
+		children [2]*node
+		data     int // offset into the data section plus one; 0 is none
+	}
+	root := &node{}
+	var data bytes.Buffer
+	for cidr, record := range networks {
+		p := netip.MustParsePrefix(cidr)
+		addr, bits := p.Addr().As16(), p.Bits()
+		if p.Addr().Is4() {
+			addr = [16]byte{}
+			v4 := p.Addr().As4()
+			copy(addr[12:], v4[:])
+			bits += 96
+		}
+		n := root
+		for i := 0; i < bits; i++ {
+			b := addr[i/8] >> (7 - uint(i%8)) & 1
+			if n.children[b] == nil {
+				n.children[b] = &node{}
+			}
+			n = n.children[b]
+		}
+		n.data = data.Len() + 1
+		encodeMMDB(&data, record)
+	}
+
+	// Number the inner nodes breadth first; leaves become data pointers.
+	var order []*node
+	index := make(map[*node]int)
+	for queue := []*node{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		index[n] = len(order)
+		order = append(order, n)
+		for _, c := range n.children {
+			if c != nil && c.data == 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	nodeCount := len(order)
+	record := func(c *node) int {
+		switch {
+		case c == nil:
+			return nodeCount
+		case c.data != 0:
+			return nodeCount + 16 + c.data - 1
+		}
+		return index[c]
+	}
+
+	var out bytes.Buffer
+	for _, n := range order {
+		for _, c := range n.children {
+			r := record(c)
+			out.Write([]byte{byte(r >> 16), byte(r >> 8), byte(r)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encodeMMDB(&out, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1760000000),
+		"database_type":               dbType,
+		"description":                 map[string]interface{}{"en": "test fixture"},
+		"ip_version":                  uint16(6),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	})
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// encodeMMDB writes v in the MaxMind DB data section format.
+func encodeMMDB(w *bytes.Buffer, v interface{}) {
+	control := func(typ, size int) {
+		first := byte(0)
+		if typ <= 7 {
+			first = byte(typ << 5)
+		}
+		var extra []byte
+		switch {
+		case size < 29:
+			first |= byte(size)
+		case size < 285:
+			first |= 29
+			extra = []byte{byte(size - 29)}
+		default:
+			first |= 30
+			extra = []byte{byte((size - 285) >> 8), byte(size - 285)}
+		}
+		w.WriteByte(first)
+		if typ > 7 {
+			w.WriteByte(byte(typ - 7))
+		}
+		w.Write(extra)
+	}
+	unsigned := func(typ int, n uint64) {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], n)
+		b := bytes.TrimLeft(buf[:], "\x00")
+		control(typ, len(b))
+		w.Write(b)
+	}
+
+	switch v := v.(type) {
+	case string:
+		control(2, len(v))
+		w.WriteString(v)
+	case float64:
+		control(3, 8)
+		binary.Write(w, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		unsigned(5, uint64(v))
+	case uint32:
+		unsigned(6, uint64(v))
+	case uint64:
+		unsigned(9, v)
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		control(14, n)
+	case []interface{}:
+		control(11, len(v))
+		for _, item := range v {
+			encodeMMDB(w, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		control(7, len(keys))
+		for _, k := range keys {
+			encodeMMDB(w, k)
+			encodeMMDB(w, v[k])
+		}
+	default:
+		panic("unsupported mmdb type")
+	}
+}
@@ -0,0 +1,112 @@
+package geoip
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// Watcher reloads a DB's databases when their files are replaced. A
+// reload that fails is logged and the previous database stays in use.
+type Watcher struct {
+	db       *DB
+	files    []*watchedFile
+	interval time.Duration
+}
+
+type watchedFile struct {
+	path    string
+	load    func(string) error
+	stamp   fileStamp
+	pending fileStamp
+}
+
+type fileStamp struct {
+	size    int64
+	modTime int64
+}
+
+// NewWatcher watches the City and ASN database paths; an empty path is
+// not used.
+func NewWatcher(db *DB, cityPath, asnPath string, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	w := &Watcher{db: db, interval: interval}
+	if cityPath != "" {
+		w.files = append(w.files, &watchedFile{path: cityPath, load: db.LoadCity})
+	}
+	if asnPath != "" {
+		w.files = append(w.files, &watchedFile{path: asnPath, load: db.LoadASN})
+	}
+	return w
+}
+
+// Load reads every database that exists, returning how many loaded and
+// the last error.
+func (w *Watcher) Load() (int, error) {
+	n := 0
+	var lastErr error
+	for _, f := range w.files {
+		stamp, err := statFile(f.path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				lastErr = err
+			}
+			continue
+		}
+		if err := f.load(f.path); err != nil {
+			lastErr = err
+			continue
+		}
+		f.stamp = stamp
+		n++
+	}
+	return n, lastErr
+}
+
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, f := range w.files {
+				w.check(f)
+			}
+		}
+	}
+}
+
+func (w *Watcher) check(f *watchedFile) {
+	stamp, err := statFile(f.path)
+	if err != nil || stamp == f.stamp {
+		f.pending = fileStamp{}
+		return
+	}
+	// Wait for the file to look the same on two consecutive polls so one
+	// caught mid-copy isn't loaded.
+	if stamp != f.pending {
+		f.pending = stamp
+		return
+	}
+	f.pending = fileStamp{}
+	f.stamp = stamp
+	if err := f.load(f.path); err != nil {
+		log.Printf("geoip: reload of %s failed, keeping previous database: %v", f.path, err)
+		return
+	}
+	log.Printf("geoip: reloaded %s", f.path)
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime().UnixNano()}, nil
+}
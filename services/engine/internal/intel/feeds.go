@@ -0,0 +1,314 @@
+package intel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultInterval   = time.Hour
+	defaultConfidence = 50
+	maxFeedSize       = 256 << 20
+)
+
+// Feed is one configured intelligence source, read from a local file or
+// fetched over HTTP.
+type Feed struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	Path string `yaml:"path"`
+	// Format is stix, misp, text or csv. It defaults from the extension of
+	// the path or URL: .txt is text, .csv is csv and .json is stix.
+	Format   string        `yaml:"format"`
+	Interval time.Duration `yaml:"interval"`
+	// Confidence is given to indicators whose source states none.
+	Confidence int `yaml:"confidence"`
+	// TTL bounds how long indicators outlive the last successful fetch,
+	// so a feed that stops updating ages out. It defaults to three
+	// intervals.
+	TTL time.Duration `yaml:"ttl"`
+	// Headers are sent with HTTP requests, e.g. a MISP Authorization key.
+	// $VAR references are expanded from the environment.
+	Headers map[string]string `yaml:"headers"`
+	Enabled *bool             `yaml:"enabled"`
+}
+
+func (f Feed) enabled() bool {
+	return f.Enabled == nil || *f.Enabled
+}
+
+// LoadFeeds reads the feed list from a YAML file with a top-level feeds
+// key, applying defaults and dropping disabled feeds.
+func LoadFeeds(path string) ([]Feed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Feeds []Feed `yaml:"feeds"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var feeds []Feed
+	seen := make(map[string]bool)
+	var errs []error
+	for i, f := range doc.Feeds {
+		if err := f.normalize(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: feed %d: %w", path, i+1, err))
+			continue
+		}
+		if seen[f.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate feed name %q", path, f.Name))
+			continue
+		}
+		seen[f.Name] = true
+		if f.enabled() {
+			feeds = append(feeds, f)
+		}
+	}
+	return feeds, errors.Join(errs...)
+}
+
+func (f *Feed) normalize() error {
+	if f.Name == "" {
+		return errors.New("name is required")
+	}
+	if (f.URL == "") == (f.Path == "") {
+		return fmt.Errorf("%s: exactly one of url and path is required", f.Name)
+	}
+	if f.URL != "" && !strings.HasPrefix(f.URL, "http://") && !strings.HasPrefix(f.URL, "https://") {
+		return fmt.Errorf("%s: url must be http or https", f.Name)
+	}
+	if f.Format == "" {
+		switch strings.ToLower(filepath.Ext(f.URL + f.Path)) {
+		case ".txt":
+			f.Format = FormatText
+		case ".csv":
+			f.Format = FormatCSV
+		case ".json":
+			f.Format = FormatSTIX
+		default:
+			return fmt.Errorf("%s: format is required", f.Name)
+		}
+	}
+	switch f.Format {
+	case FormatSTIX, FormatMISP, FormatText, FormatCSV:
+	default:
+		return fmt.Errorf("%s: unknown format %q", f.Name, f.Format)
+	}
+	if f.Confidence < 0 || f.Confidence > 100 {
+		return fmt.Errorf("%s: confidence must be between 0 and 100", f.Name)
+	}
+	if f.Confidence == 0 {
+		f.Confidence = defaultConfidence
+	}
+	if f.Interval <= 0 {
+		f.Interval = defaultInterval
+	}
+	if f.TTL <= 0 {
+		f.TTL = 3 * f.Interval
+	}
+	return nil
+}
+
+// Fetcher keeps a Store filled from feeds, refreshing each on its own
+// interval. A failed refresh keeps the feed's previous indicators until
+// their TTL runs out.
+type Fetcher struct {
+	store  *Store
+	feeds  []Feed
+	client *http.Client
+
+	mu    sync.Mutex
+	state map[string]*feedState
+}
+
+// feedState remembers a feed's last fetch, so unchanged files and HTTP
+// 304 responses only extend the indicators' lifetime.
+type feedState struct {
+	parsed       []Indicator
+	etag         string
+	lastModified string
+	modTime      time.Time
+}
+
+func NewFetcher(store *Store, feeds []Feed) *Fetcher {
+	return &Fetcher{
+		store:  store,
+		feeds:  feeds,
+		client: &http.Client{Timeout: time.Minute},
+		state:  make(map[string]*feedState),
+	}
+}
+
+// Refresh fetches feed once and replaces its indicators, returning how
+// many it has.
+func (f *Fetcher) Refresh(ctx context.Context, feed Feed) (int, error) {
+	f.mu.Lock()
+	st := f.state[feed.Name]
+	if st == nil {
+		st = &feedState{}
+		f.state[feed.Name] = st
+	}
+	f.mu.Unlock()
+
+	var (
+		data    []byte
+		changed bool
+		err     error
+	)
+	if feed.Path != "" {
+		data, changed, err = readFeedFile(feed.Path, st)
+	} else {
+		data, changed, err = f.fetchFeed(ctx, feed, st)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if changed {
+		parsed, err := Parse(feed.Format, bytes.NewReader(data))
+		if err != nil {
+			return 0, err
+		}
+		st.parsed = parsed
+	}
+
+	now := time.Now()
+	inds := make([]Indicator, 0, len(st.parsed))
+	for _, ind := range st.parsed {
+		ind.Feed = feed.Name
+		if ind.Confidence <= 0 {
+			ind.Confidence = feed.Confidence
+		}
+		ind.Confidence = min(ind.Confidence, 100)
+		if stale := now.Add(feed.TTL); ind.Expires.IsZero() || ind.Expires.After(stale) {
+			ind.Expires = stale
+		}
+		if !ind.expired(now) {
+			inds = append(inds, ind)
+		}
+	}
+	f.store.Replace(feed.Name, inds)
+	return len(inds), nil
+}
+
+func readFeedFile(path string, st *feedState) ([]byte, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if st.parsed != nil && info.ModTime().Equal(st.modTime) {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	st.modTime = info.ModTime()
+	return data, true, nil
+}
+
+func (f *Fetcher) fetchFeed(ctx context.Context, feed Feed, st *feedState) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	for k, v := range feed.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	if st.parsed != nil {
+		if st.etag != "" {
+			req.Header.Set("If-None-Match", st.etag)
+		}
+		if st.lastModified != "" {
+			req.Header.Set("If-Modified-Since", st.lastModified)
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && st.parsed != nil:
+		return nil, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("GET %s: %s", feed.URL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > maxFeedSize {
+		return nil, false, fmt.Errorf("GET %s: feed larger than %d bytes", feed.URL, maxFeedSize)
+	}
+	st.etag = resp.Header.Get("ETag")
+	st.lastModified = resp.Header.Get("Last-Modified")
+	return data, true, nil
+}
+
+// Run refreshes every feed now and then on its interval, and prunes
+// expired indicators, until ctx is done.
+func (f *Fetcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, feed := range f.feeds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.runFeed(ctx, feed)
+		}()
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+			if n := f.store.Prune(time.Now()); n > 0 {
+				log.Printf("intel: %d indicators expired", n)
+			}
+		}
+	}
+}
+
+func (f *Fetcher) runFeed(ctx context.Context, feed Feed) {
+	ticker := time.NewTicker(feed.Interval)
+	defer ticker.Stop()
+	for {
+		n, err := f.Refresh(ctx, feed)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("intel: refresh of feed %s failed, keeping previous indicators: %v", feed.Name, err)
+		} else {
+			log.Printf("intel: feed %s has %d indicators", feed.Name, n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package intel_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/intel"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFeeds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feeds.yml")
+	writeFile(t, path, `
+feeds:
+  - name: feodo
+    url: https://feodotracker.example/ipblocklist.txt
+    interval: 30m
+  - name: local
+    path: /etc/shield/intel/local.csv
+    confidence: 90
+  - name: off
+    path: /tmp/x.json
+    enabled: false
+`)
+	feeds, err := intel.LoadFeeds(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 2 {
+		t.Fatalf("expected 2 enabled feeds, got %+v", feeds)
+	}
+	if f := feeds[0]; f.Format != intel.FormatText || f.Interval != 30*time.Minute || f.TTL != 90*time.Minute || f.Confidence != 50 {
+		t.Errorf("unexpected defaults %+v", f)
+	}
+	if f := feeds[1]; f.Format != intel.FormatCSV || f.Interval != time.Hour || f.Confidence != 90 {
+		t.Errorf("unexpected defaults %+v", f)
+	}
+
+	writeFile(t, path, `
+feeds:
+  - name: a
+    url: ftp://example/list.txt
+  - name: b
+    path: /x/list
+  - name: c
+    path: /x/list.txt
+    url: https://example/list.txt
+  - name: d
+    path: /x/list.txt
+    confidence: 101
+`)
+	_, err = intel.LoadFeeds(path)
+	for _, want := range []string{"url must be http", "format is required", "exactly one of url and path", "between 0 and 100"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error mentioning %q, got %v", want, err)
+		}
+	}
+}
+
+func TestFetcherHTTPFeed(t *testing.T) {
+	var requests, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "secret-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(mispExport))
+	}))
+	defer srv.Close()
+
+	t.Setenv("MISP_KEY", "secret-key")
+	feed := intel.Feed{
+		Name:       "misp",
+		URL:        srv.URL + "/events/restSearch",
+		Format:     intel.FormatMISP,
+		Confidence: 70,
+		TTL:        time.Hour,
+		Headers:    map[string]string{"Authorization": "$MISP_KEY"},
+	}
+	store := intel.NewStore()
+	f := intel.NewFetcher(store, []intel.Feed{feed})
+
+	n, err := f.Refresh(context.Background(), feed)
+	if err != nil || n != 6 {
+		t.Fatalf("expected 6 indicators, got %d (%v)", n, err)
+	}
+	ind, ok := store.Match("198.51.100.9", time.Now())
+	if !ok || ind.Feed != "misp" || ind.Confidence != 70 {
+		t.Errorf("unexpected match %+v %v", ind, ok)
+	}
+	if ttl := time.Until(ind.Expires); ttl < 59*time.Minute || ttl > time.Hour {
+		t.Errorf("expected the feed TTL to set expiry, got %v", ttl)
+	}
+
+	// An unchanged feed keeps its indicators.
+	if n, err := f.Refresh(context.Background(), feed); err != nil || n != 6 {
+		t.Fatalf("expected 6 indicators after a 304, got %d (%v)", n, err)
+	}
+	if notModified.Load() != 1 {
+		t.Errorf("expected a conditional request, got %d of %d", notModified.Load(), requests.Load())
+	}
+
+	// A failing refresh leaves them in place too.
+	feed.Headers = nil
+	if _, err := f.Refresh(context.Background(), feed); err == nil {
+		t.Fatal("expected an error from an unauthorized fetch")
+	}
+	if _, ok := store.Match("198.51.100.9", time.Now()); !ok {
+		t.Error("expected previous indicators to survive a failed refresh")
+	}
+}
+
+func TestFetcherFileFeedAndMatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	writeFile(t, path, "198.51.100.0/24\n")
+	feed := intel.Feed{Name: "local", Path: path, Format: intel.FormatText, Confidence: 85, Interval: 10 * time.Millisecond, TTL: time.Hour}
+
+	store := intel.NewStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go intel.NewFetcher(store, []intel.Feed{feed}).Run(ctx)
+
+	waitFor(t, func() bool { return store.Index().Len() == 1 })
+
+	m := intel.NewMatcher(store)
+	event := core.Event{
+		Severity: "low",
+		Payload: map[string]interface{}{
+			"remote_addr": "198.51.100.7:443",
+			"process":     map[string]interface{}{"name": "curl"},
+			"ports":       []interface{}{float64(443)},
+		},
+	}
+	if err := m.Enrich(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Severity != "high" {
+		t.Errorf("expected severity raised to high, got %s", event.Severity)
+	}
+	tags, _ := event.Payload[intel.PayloadKey].([]interface{})
+	if len(tags) != 1 {
+		t.Fatalf("expected one match, got %v", event.Payload[intel.PayloadKey])
+	}
+	tag := tags[0].(map[string]interface{})
+	if tag["field"] != "payload.remote_addr" || tag["indicator"] != "198.51.100.0/24" || tag["feed"] != "local" || tag["confidence"] != 85 {
+		t.Errorf("unexpected tag %v", tag)
+	}
+
+	// Severity is never lowered.
+	event = core.Event{Severity: "critical", Payload: map[string]interface{}{"src_ip": "198.51.100.1"}}
+	m.Enrich(&event)
+	if event.Severity != "critical" {
+		t.Errorf("expected severity to stay critical, got %s", event.Severity)
+	}
+
+	// Replacing the file swaps the indicators on the next refresh.
+	time.Sleep(10 * time.Millisecond)
+	writeFile(t, path, "evil.example\n")
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	waitFor(t, func() bool {
+		_, ok := store.Match("c2.evil.example", time.Now())
+		return ok
+	})
+	event = core.Event{Severity: "info", Payload: map[string]interface{}{"src_ip": "198.51.100.1"}}
+	m.Enrich(&event)
+	if _, tagged := event.Payload[intel.PayloadKey]; tagged || event.Severity != "info" {
+		t.Errorf("expected no match after the feed changed, got %v", event)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the feed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoadFeedsExample(t *testing.T) {
+	if _, err := intel.LoadFeeds("../../intel/feeds.yml"); err != nil {
+		t.Fatalf("example feeds failed validation: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package intel
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Index is an immutable set of indicators. IPs and CIDRs share a radix
+// tree; domains, URLs and hashes are hashed by value.
+type Index struct {
+	prefixes prefixTree
+	domains  map[string][]*Indicator
+	urls     map[string][]*Indicator
+	hashes   map[string][]*Indicator
+	size     int
+}
+
+// NewIndex indexes inds. Values are expected to be normalized, as the
+// parsers and Classify leave them.
+func NewIndex(inds []Indicator) *Index {
+	ix := &Index{
+		domains: make(map[string][]*Indicator),
+		urls:    make(map[string][]*Indicator),
+		hashes:  make(map[string][]*Indicator),
+	}
+	for i := range inds {
+		ind := &inds[i]
+		switch ind.Type {
+		case TypeIP:
+			addr, err := netip.ParseAddr(ind.Value)
+			if err != nil {
+				continue
+			}
+			ix.prefixes.insert(netip.PrefixFrom(addr, addr.BitLen()), ind)
+		case TypeCIDR:
+			p, err := netip.ParsePrefix(ind.Value)
+			if err != nil {
+				continue
+			}
+			ix.prefixes.insert(p, ind)
+		case TypeDomain:
+			ix.domains[ind.Value] = append(ix.domains[ind.Value], ind)
+		case TypeURL:
+			ix.urls[ind.Value] = append(ix.urls[ind.Value], ind)
+		case TypeHash:
+			ix.hashes[ind.Value] = append(ix.hashes[ind.Value], ind)
+		default:
+			continue
+		}
+		ix.size++
+	}
+	return ix
+}
+
+func (ix *Index) Len() int {
+	return ix.size
+}
+
+// Match looks up a value of any kind, or the host of a host:port. IPs
+// match every CIDR containing them, domains match indicators for any
+// parent domain, and URLs match on their host too. Of the unexpired
+// matches the one with the highest confidence wins, the most specific on
+// a tie.
+func (ix *Index) Match(value string, now time.Time) (Indicator, bool) {
+	var best *Indicator
+	consider := func(cands []*Indicator) {
+		for _, c := range cands {
+			if !c.expired(now) && (best == nil || c.Confidence >= best.Confidence) {
+				best = c
+			}
+		}
+	}
+
+	typ, v, ok := Classify(value)
+	if !ok {
+		// host:port, as in a remote address
+		if typ, v, ok = Classify(hostOf(value)); !ok {
+			return Indicator{}, false
+		}
+	}
+	switch typ {
+	case TypeIP:
+		addr, _ := netip.ParseAddr(v)
+		consider(ix.prefixes.lookup(addr))
+	case TypeDomain:
+		ix.matchDomain(v, consider)
+	case TypeURL:
+		host := hostOf(v)
+		if addr, err := netip.ParseAddr(host); err == nil {
+			consider(ix.prefixes.lookup(addr))
+		} else {
+			ix.matchDomain(host, consider)
+		}
+		consider(ix.urls[v])
+	case TypeHash:
+		consider(ix.hashes[v])
+	}
+	if best == nil {
+		return Indicator{}, false
+	}
+	return *best, true
+}
+
+// matchDomain considers the domain's parents before the domain itself,
+// so a tie goes to the most specific.
+func (ix *Index) matchDomain(d string, consider func([]*Indicator)) {
+	var chain []string
+	for {
+		chain = append(chain, d)
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		consider(ix.domains[chain[i]])
+	}
+}
+
+// Store holds the indicators of every feed and the index built from them.
+// Lookups read the current index without locking; replacing a feed's
+// indicators rebuilds it.
+type Store struct {
+	mu    sync.Mutex
+	feeds map[string][]Indicator
+	index atomic.Pointer[Index]
+}
+
+func NewStore() *Store {
+	s := &Store{feeds: make(map[string][]Indicator)}
+	s.index.Store(NewIndex(nil))
+	return s
+}
+
+// Replace sets the indicators of feed, dropping the ones it had before.
+func (s *Store) Replace(feed string, inds []Indicator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(inds) == 0 {
+		delete(s.feeds, feed)
+	} else {
+		s.feeds[feed] = inds
+	}
+	s.rebuild()
+}
+
+// Prune drops expired indicators and reports how many went.
+func (s *Store) Prune(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	for feed, inds := range s.feeds {
+		kept := inds[:0:0]
+		for _, ind := range inds {
+			if !ind.expired(now) {
+				kept = append(kept, ind)
+			}
+		}
+		if len(kept) == len(inds) {
+			continue
+		}
+		dropped += len(inds) - len(kept)
+		if len(kept) == 0 {
+			delete(s.feeds, feed)
+		} else {
+			s.feeds[feed] = kept
+		}
+	}
+	if dropped > 0 {
+		s.rebuild()
+	}
+	return dropped
+}
+
+func (s *Store) rebuild() {
+	var all []Indicator
+	for _, inds := range s.feeds {
+		all = append(all, inds...)
+	}
+	s.index.Store(NewIndex(all))
+}
+
+func (s *Store) Index() *Index {
+	return s.index.Load()
+}
+
+func (s *Store) Match(value string, now time.Time) (Indicator, bool) {
+	return s.Index().Match(value, now)
+}
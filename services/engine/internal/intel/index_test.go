@@ -0,0 +1,144 @@
+package intel_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/intel"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		in   string
+		typ  intel.Type
+		want string
+	}{
+		{"198.51.100.7", intel.TypeIP, "198.51.100.7"},
+		{"::ffff:198.51.100.7", intel.TypeIP, "198.51.100.7"},
+		{"2001:DB8::1", intel.TypeIP, "2001:db8::1"},
+		{"203.0.113.77/24", intel.TypeCIDR, "203.0.113.0/24"},
+		{"Evil.Example.COM.", intel.TypeDomain, "evil.example.com"},
+		{"evil[.]example[.]com", intel.TypeDomain, "evil.example.com"},
+		{"hxxps://Evil.Example.com/payload.exe#frag", intel.TypeURL, "https://evil.example.com/payload.exe"},
+		{"D41D8CD98F00B204E9800998ECF8427E", intel.TypeHash, "d41d8cd98f00b204e9800998ecf8427e"},
+	}
+	for _, tt := range tests {
+		typ, got, ok := intel.Classify(tt.in)
+		if !ok || typ != tt.typ || got != tt.want {
+			t.Errorf("Classify(%q) = %s %q %v, want %s %q", tt.in, typ, got, ok, tt.typ, tt.want)
+		}
+	}
+	for _, in := range []string{"", "curl", "/usr/bin/curl", "tcp", "1.2.3", "report.123"} {
+		if typ, _, ok := intel.Classify(in); ok {
+			t.Errorf("Classify(%q) should not classify, got %s", in, typ)
+		}
+	}
+}
+
+func TestIndexMatchesNestedPrefixes(t *testing.T) {
+	ix := intel.NewIndex([]intel.Indicator{
+		{Type: intel.TypeCIDR, Value: "10.0.0.0/8", Feed: "wide", Confidence: 30},
+		{Type: intel.TypeCIDR, Value: "10.1.0.0/16", Feed: "narrow", Confidence: 60},
+		{Type: intel.TypeIP, Value: "10.1.2.3", Feed: "host", Confidence: 60},
+		{Type: intel.TypeCIDR, Value: "10.128.0.0/9", Feed: "upper", Confidence: 90},
+		{Type: intel.TypeCIDR, Value: "2001:db8:bad::/48", Feed: "v6", Confidence: 70},
+	})
+	now := time.Now()
+
+	tests := []struct {
+		value, feed string
+	}{
+		{"10.1.2.3", "host"}, // ties go to the most specific
+		{"10.1.9.9", "narrow"},
+		{"10.2.0.1", "wide"},
+		{"10.200.0.1", "upper"},     // higher confidence beats the /8
+		{"10.1.2.3:443", "host"},    // host:port
+		{"::ffff:10.2.0.1", "wide"}, // v4-mapped
+		{"2001:db8:bad:1::5", "v6"},
+		{"http://10.1.9.9/x", "narrow"},
+	}
+	for _, tt := range tests {
+		ind, ok := ix.Match(tt.value, now)
+		if !ok || ind.Feed != tt.feed {
+			t.Errorf("Match(%q) = %+v %v, want feed %s", tt.value, ind, ok, tt.feed)
+		}
+	}
+	for _, miss := range []string{"11.0.0.1", "2001:db8:bae::1", "192.168.1.1"} {
+		if ind, ok := ix.Match(miss, now); ok {
+			t.Errorf("Match(%q) should miss, got %+v", miss, ind)
+		}
+	}
+}
+
+func TestIndexManyPrefixes(t *testing.T) {
+	var inds []intel.Indicator
+	for i := 0; i < 256; i++ {
+		inds = append(inds, intel.Indicator{Type: intel.TypeCIDR, Value: fmt.Sprintf("172.16.%d.0/24", i), Feed: fmt.Sprint(i)})
+	}
+	ix := intel.NewIndex(inds)
+	if ix.Len() != 256 {
+		t.Fatalf("expected 256 indicators, got %d", ix.Len())
+	}
+	for i := 0; i < 256; i++ {
+		ind, ok := ix.Match(fmt.Sprintf("172.16.%d.9", i), time.Now())
+		if !ok || ind.Feed != fmt.Sprint(i) {
+			t.Fatalf("172.16.%d.9 matched %+v %v", i, ind, ok)
+		}
+	}
+}
+
+func TestIndexMatchesDomainsURLsAndHashes(t *testing.T) {
+	ix := intel.NewIndex([]intel.Indicator{
+		{Type: intel.TypeDomain, Value: "evil.example", Feed: "domains", Confidence: 50},
+		{Type: intel.TypeURL, Value: "https://cdn.example/drop.exe", Feed: "urls", Confidence: 70},
+		{Type: intel.TypeHash, Value: "d41d8cd98f00b204e9800998ecf8427e", Feed: "hashes", Confidence: 90},
+	})
+	now := time.Now()
+
+	for value, feed := range map[string]string{
+		"evil.example":                     "domains",
+		"c2.eu.evil.example":               "domains",
+		"https://login.evil.example/a":     "domains",
+		"https://CDN.example/drop.exe":     "urls",
+		"D41D8CD98F00B204E9800998ECF8427E": "hashes",
+	} {
+		ind, ok := ix.Match(value, now)
+		if !ok || ind.Feed != feed {
+			t.Errorf("Match(%q) = %+v %v, want feed %s", value, ind, ok, feed)
+		}
+	}
+	for _, miss := range []string{"notevil.example", "example", "https://cdn.example/other.exe"} {
+		if ind, ok := ix.Match(miss, now); ok {
+			t.Errorf("Match(%q) should miss, got %+v", miss, ind)
+		}
+	}
+}
+
+func TestStoreExpiresIndicators(t *testing.T) {
+	now := time.Now()
+	s := intel.NewStore()
+	s.Replace("feed", []intel.Indicator{
+		{Type: intel.TypeIP, Value: "198.51.100.1", Feed: "feed", Expires: now.Add(time.Minute)},
+		{Type: intel.TypeIP, Value: "198.51.100.2", Feed: "feed", Expires: now.Add(time.Hour)},
+	})
+
+	later := now.Add(2 * time.Minute)
+	if _, ok := s.Match("198.51.100.1", later); ok {
+		t.Error("expired indicator should not match")
+	}
+	if _, ok := s.Match("198.51.100.2", later); !ok {
+		t.Error("live indicator should match")
+	}
+	if n := s.Prune(later); n != 1 {
+		t.Errorf("expected 1 pruned, got %d", n)
+	}
+	if s.Index().Len() != 1 {
+		t.Errorf("expected 1 indicator left, got %d", s.Index().Len())
+	}
+
+	s.Replace("feed", nil)
+	if s.Index().Len() != 0 {
+		t.Errorf("expected an empty index, got %d", s.Index().Len())
+	}
+}
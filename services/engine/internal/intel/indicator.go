@@ -0,0 +1,148 @@
+// Package intel ingests threat intelligence feeds and matches events
+// against their indicators.
+package intel
+
+import (
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Type string
+
+const (
+	TypeIP     Type = "ip"
+	TypeCIDR   Type = "cidr"
+	TypeDomain Type = "domain"
+	TypeURL    Type = "url"
+	TypeHash   Type = "hash"
+)
+
+// Indicator is one indicator of compromise. Value is normalized: IPv4
+// addresses are never IPv6-mapped, prefixes are masked, and domains, URL
+// hosts and hashes are lowercase.
+type Indicator struct {
+	Type  Type
+	Value string
+	Feed  string
+	// Confidence runs from 0 to 100. Zero means the source gave none and
+	// the feed's default applies.
+	Confidence  int
+	Description string
+	// Expires is when the indicator stops matching; zero never.
+	Expires time.Time
+}
+
+func (ind *Indicator) expired(now time.Time) bool {
+	return !ind.Expires.IsZero() && !now.Before(ind.Expires)
+}
+
+// Classify works out which kind of indicator s is and normalizes it.
+// Defanged values such as "hxxp://evil[.]com" are accepted.
+func Classify(s string) (Type, string, bool) {
+	s = refang(strings.TrimSpace(s))
+	if s == "" {
+		return "", "", false
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return TypeIP, addr.Unmap().WithZone("").String(), true
+	}
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return TypeCIDR, normalizePrefix(p).String(), true
+	}
+	if strings.Contains(s, "://") {
+		if u, ok := normalizeURL(s); ok {
+			return TypeURL, u, true
+		}
+		return "", "", false
+	}
+	if h, ok := normalizeHash(s); ok {
+		return TypeHash, h, true
+	}
+	if d, ok := normalizeDomain(s); ok {
+		return TypeDomain, d, true
+	}
+	return "", "", false
+}
+
+var refanger = strings.NewReplacer("[.]", ".", "(.)", ".", "[:]", ":", "hxxp", "http", "hXXp", "http")
+
+func refang(s string) string {
+	return refanger.Replace(s)
+}
+
+func normalizePrefix(p netip.Prefix) netip.Prefix {
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked()
+}
+
+func normalizeURL(s string) (string, bool) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), true
+}
+
+func normalizeHash(s string) (string, bool) {
+	switch len(s) {
+	case 32, 40, 64, 128: // MD5, SHA-1, SHA-256, SHA-512
+	default:
+		return "", false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", false
+	}
+	return strings.ToLower(s), true
+}
+
+// normalizeDomain accepts host names with at least two labels and an
+// alphabetic top-level label, so file names like "a.out" mostly don't.
+func normalizeDomain(s string) (string, bool) {
+	d := strings.TrimSuffix(strings.ToLower(strings.TrimPrefix(s, "*.")), ".")
+	if len(d) > 253 || !strings.Contains(d, ".") {
+		return "", false
+	}
+	labels := strings.Split(d, ".")
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return "", false
+		}
+		for _, r := range l {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return "", false
+			}
+		}
+	}
+	tld := labels[len(labels)-1]
+	for _, r := range tld {
+		if r < 'a' || r > 'z' {
+			if !strings.HasPrefix(tld, "xn--") {
+				return "", false
+			}
+		}
+	}
+	return d, true
+}
+
+// hostOf returns the host of a URL or host:port value.
+func hostOf(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return ""
+}
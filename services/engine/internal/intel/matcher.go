@@ -0,0 +1,116 @@
+package intel
+
+import (
+	"sort"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+)
+
+// PayloadKey is the payload field matches are recorded under.
+const PayloadKey = "threat_intel"
+
+var severityRank = map[string]int{
+	"info":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// Matcher checks every string in an event's payload against a Store.
+type Matcher struct {
+	store *Store
+	now   func() time.Time
+}
+
+func NewMatcher(store *Store) *Matcher {
+	return &Matcher{store: store, now: time.Now}
+}
+
+// Enrich records the indicators an event's payload matches under
+// payload.threat_intel, best first, and raises the event's severity to
+// what the most confident match warrants. It has the signature of a
+// core.EventEnricher.
+func (m *Matcher) Enrich(event *core.Event) error {
+	ix := m.store.Index()
+	if ix.Len() == 0 || event.Payload == nil {
+		return nil
+	}
+	now := m.now()
+
+	var matches []map[string]interface{}
+	seen := make(map[string]bool)
+	walkStrings(event.Payload, "payload", func(field, value string) {
+		if seen[value] {
+			return
+		}
+		seen[value] = true
+		ind, ok := ix.Match(value, now)
+		if !ok {
+			return
+		}
+		matches = append(matches, map[string]interface{}{
+			"field":       field,
+			"value":       value,
+			"indicator":   ind.Value,
+			"type":        string(ind.Type),
+			"feed":        ind.Feed,
+			"confidence":  ind.Confidence,
+			"description": ind.Description,
+		})
+	})
+	if len(matches) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i]["confidence"].(int) > matches[j]["confidence"].(int)
+	})
+	tagged := make([]interface{}, len(matches))
+	for i, match := range matches {
+		tagged[i] = match
+	}
+	event.Payload[PayloadKey] = tagged
+
+	if sev := SeverityFor(matches[0]["confidence"].(int)); severityRank[sev] > severityRank[event.Severity] {
+		event.Severity = sev
+	}
+	return nil
+}
+
+// SeverityFor is the least severity an event matching an indicator of the
+// given confidence gets.
+func SeverityFor(confidence int) string {
+	switch {
+	case confidence >= 80:
+		return "high"
+	case confidence >= 50:
+		return "medium"
+	}
+	return "low"
+}
+
+// walkStrings calls fn with every string in v and the dotted path to it,
+// leaving out the payload's own threat_intel field.
+func walkStrings(v interface{}, path string, fn func(field, value string)) {
+	switch v := v.(type) {
+	case string:
+		fn(path, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			if k != PayloadKey || path != "payload" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkStrings(v[k], path+"."+k, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkStrings(item, path, fn)
+		}
+	}
+}
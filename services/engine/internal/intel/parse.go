@@ -0,0 +1,362 @@
+package intel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Feed formats.
+const (
+	FormatSTIX = "stix"
+	FormatMISP = "misp"
+	FormatText = "text"
+	FormatCSV  = "csv"
+)
+
+// Parse reads indicators in the given format. Entries that are not a
+// recognizable indicator are skipped.
+func Parse(format string, r io.Reader) ([]Indicator, error) {
+	switch format {
+	case FormatSTIX:
+		return ParseSTIX(r)
+	case FormatMISP:
+		return ParseMISP(r)
+	case FormatText:
+		return ParseText(r)
+	case FormatCSV:
+		return ParseCSV(r)
+	}
+	return nil, fmt.Errorf("unknown feed format %q", format)
+}
+
+type stixObject struct {
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Pattern     string    `json:"pattern"`
+	PatternType string    `json:"pattern_type"`
+	ValidUntil  time.Time `json:"valid_until"`
+	Confidence  int       `json:"confidence"`
+	Revoked     bool      `json:"revoked"`
+}
+
+// stixComparison matches the equality comparisons of a STIX pattern that
+// carry an indicator, e.g. [ipv4-addr:value = '198.51.100.1'] or
+// [file:hashes.'SHA-256' = '...'].
+var stixComparison = regexp.MustCompile(`(ipv4-addr|ipv6-addr|domain-name|url|file):(value|hashes\.(?:'[^']+'|[A-Za-z0-9-]+))\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// ParseSTIX reads the indicator objects of a STIX 2.1 bundle. A pattern
+// may carry several values joined with OR or AND; each becomes an
+// indicator.
+func ParseSTIX(r io.Reader) ([]Indicator, error) {
+	var bundle struct {
+		Type    string       `json:"type"`
+		Objects []stixObject `json:"objects"`
+	}
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("decode stix bundle: %w", err)
+	}
+
+	var out []Indicator
+	for _, obj := range bundle.Objects {
+		if obj.Type != "indicator" || obj.Revoked || (obj.PatternType != "" && obj.PatternType != "stix") {
+			continue
+		}
+		desc := obj.Name
+		if desc == "" {
+			desc = obj.Description
+		}
+		for _, m := range stixComparison.FindAllStringSubmatch(obj.Pattern, -1) {
+			value := strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(m[3])
+			typ, v, ok := Classify(value)
+			if !ok || !stixTypeMatches(m[1], typ) {
+				continue
+			}
+			out = append(out, Indicator{
+				Type:        typ,
+				Value:       v,
+				Confidence:  obj.Confidence,
+				Description: desc,
+				Expires:     obj.ValidUntil,
+			})
+		}
+	}
+	return out, nil
+}
+
+func stixTypeMatches(object string, typ Type) bool {
+	switch object {
+	case "ipv4-addr", "ipv6-addr":
+		return typ == TypeIP || typ == TypeCIDR
+	case "domain-name":
+		return typ == TypeDomain
+	case "url":
+		return typ == TypeURL
+	case "file":
+		return typ == TypeHash
+	}
+	return false
+}
+
+type mispAttribute struct {
+	Type    string   `json:"type"`
+	Value   string   `json:"value"`
+	ToIDS   mispBool `json:"to_ids"`
+	Comment string   `json:"comment"`
+	Deleted mispBool `json:"deleted"`
+}
+
+// mispBool accepts the booleans MISP writes as true, 1 or "1".
+type mispBool bool
+
+func (b *mispBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true", "1":
+		*b = true
+	case "false", "0", "", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid MISP boolean %s", data)
+	}
+	return nil
+}
+
+// mispTypes maps the parts of MISP attribute types to indicator kinds.
+// Composite types such as "domain|ip" or "filename|sha256" are split on
+// the bar, as are their values.
+var mispTypes = map[string][]Type{
+	"ip-src":   {TypeIP, TypeCIDR},
+	"ip-dst":   {TypeIP, TypeCIDR},
+	"ip":       {TypeIP, TypeCIDR},
+	"domain":   {TypeDomain},
+	"hostname": {TypeDomain},
+	"url":      {TypeURL},
+	"md5":      {TypeHash},
+	"sha1":     {TypeHash},
+	"sha256":   {TypeHash},
+	"sha512":   {TypeHash},
+}
+
+// ParseMISP reads the attributes flagged for detection (to_ids) from a
+// MISP event export, a list of events, or a restSearch response.
+func ParseMISP(r io.Reader) ([]Indicator, error) {
+	var doc json.RawMessage
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode misp export: %w", err)
+	}
+	var out []Indicator
+	if err := walkMISP(doc, "", &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func walkMISP(raw json.RawMessage, info string, out *[]Indicator) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil
+	}
+	if raw[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return fmt.Errorf("decode misp export: %w", err)
+		}
+		for _, item := range items {
+			if err := walkMISP(item, info, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if raw[0] != '{' {
+		return nil
+	}
+
+	var node struct {
+		Info      string            `json:"info"`
+		Event     json.RawMessage   `json:"Event"`
+		Response  json.RawMessage   `json:"response"`
+		Attribute []mispAttribute   `json:"Attribute"`
+		Object    []json.RawMessage `json:"Object"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return fmt.Errorf("decode misp export: %w", err)
+	}
+	if node.Info != "" {
+		info = node.Info
+	}
+	for _, attr := range node.Attribute {
+		*out = append(*out, mispIndicators(attr, info)...)
+	}
+	for _, sub := range []json.RawMessage{node.Event, node.Response} {
+		if err := walkMISP(sub, info, out); err != nil {
+			return err
+		}
+	}
+	for _, obj := range node.Object {
+		if err := walkMISP(obj, info, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mispIndicators(attr mispAttribute, info string) []Indicator {
+	if !attr.ToIDS || attr.Deleted {
+		return nil
+	}
+	desc := info
+	if attr.Comment != "" {
+		desc = strings.TrimSpace(info + ": " + attr.Comment)
+	}
+
+	types := strings.Split(attr.Type, "|")
+	values := strings.Split(attr.Value, "|")
+	if len(types) != len(values) {
+		return nil
+	}
+	var out []Indicator
+	for i, t := range types {
+		want := mispTypes[t]
+		if want == nil {
+			continue
+		}
+		typ, v, ok := Classify(values[i])
+		if !ok || !containsType(want, typ) {
+			continue
+		}
+		out = append(out, Indicator{Type: typ, Value: v, Description: desc})
+	}
+	return out
+}
+
+func containsType(types []Type, t Type) bool {
+	for _, x := range types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseText reads a blocklist with one indicator per line. Comments start
+// with # or ;, and hosts-file lines such as "0.0.0.0 evil.example" yield
+// the host name.
+func ParseText(r io.Reader) ([]Indicator, error) {
+	var out []Indicator
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		value := fields[0]
+		if len(fields) > 1 && (value == "0.0.0.0" || value == "127.0.0.1" || value == "::") {
+			value = fields[1]
+		}
+		if typ, v, ok := Classify(value); ok {
+			out = append(out, Indicator{Type: typ, Value: v})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read blocklist: %w", err)
+	}
+	return out, nil
+}
+
+// csvColumns are the header names ParseCSV recognizes.
+var csvColumns = map[string]string{
+	"indicator":   "value",
+	"ioc":         "value",
+	"value":       "value",
+	"confidence":  "confidence",
+	"description": "description",
+	"comment":     "description",
+	"expires":     "expires",
+	"valid_until": "expires",
+}
+
+// ParseCSV reads indicators from CSV. With a header row naming an
+// indicator (or ioc, or value) column, confidence, description and
+// expires columns are read too; otherwise the first column is the
+// indicator. Lines starting with # are comments.
+func ParseCSV(r io.Reader) ([]Indicator, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	cols := map[string]int{"value": 0}
+	var out []Indicator
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		if first {
+			if header := csvHeader(rec); header != nil {
+				cols = header
+				continue
+			}
+		}
+
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		typ, v, ok := Classify(field("value"))
+		if !ok {
+			continue
+		}
+		ind := Indicator{Type: typ, Value: v, Description: field("description")}
+		if c, err := strconv.Atoi(field("confidence")); err == nil {
+			ind.Confidence = max(0, min(c, 100))
+		}
+		ind.Expires = parseTime(field("expires"))
+		out = append(out, ind)
+	}
+	return out, nil
+}
+
+func csvHeader(rec []string) map[string]int {
+	cols := make(map[string]int)
+	for i, name := range rec {
+		if col, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			if _, dup := cols[col]; !dup {
+				cols[col] = i
+			}
+		}
+	}
+	if _, ok := cols["value"]; !ok {
+		return nil
+	}
+	return cols
+}
+
+func parseTime(s string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,185 @@
+package intel_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/intel"
+)
+
+const stixBundle = `{
+  "type": "bundle",
+  "id": "bundle--5d0092c5-5f74-4287-9642-33f4c354e56d",
+  "objects": [
+    {
+      "type": "indicator",
+      "spec_version": "2.1",
+      "id": "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f",
+      "name": "Emotet C2",
+      "pattern": "[ipv4-addr:value = '198.51.100.1'] OR [ipv4-addr:value = '203.0.113.0/24']",
+      "pattern_type": "stix",
+      "valid_from": "2026-01-01T00:00:00Z",
+      "valid_until": "2027-01-01T00:00:00Z",
+      "confidence": 85
+    },
+    {
+      "type": "indicator",
+      "spec_version": "2.1",
+      "id": "indicator--a932fcc6-e032-476c-826f-cb970a5a1ade",
+      "name": "Dropper",
+      "pattern": "[file:hashes.'SHA-256' = 'AEC070645FE53EE3B3763059376134F058CC337247C978ADD178B6CCDFB0019F'] AND [url:value = 'http://evil.example/it\\'s.exe']",
+      "pattern_type": "stix",
+      "valid_from": "2026-01-01T00:00:00Z"
+    },
+    {
+      "type": "indicator",
+      "id": "indicator--revoked",
+      "pattern": "[domain-name:value = 'old.example']",
+      "pattern_type": "stix",
+      "revoked": true
+    },
+    {
+      "type": "indicator",
+      "id": "indicator--yara",
+      "pattern": "rule x { condition: true }",
+      "pattern_type": "yara"
+    },
+    {
+      "type": "malware",
+      "id": "malware--1",
+      "name": "Emotet"
+    }
+  ]
+}`
+
+func TestParseSTIX(t *testing.T) {
+	inds, err := intel.ParseSTIX(strings.NewReader(stixBundle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []intel.Indicator{
+		{Type: intel.TypeIP, Value: "198.51.100.1", Confidence: 85, Description: "Emotet C2", Expires: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Type: intel.TypeCIDR, Value: "203.0.113.0/24", Confidence: 85, Description: "Emotet C2", Expires: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Type: intel.TypeHash, Value: "aec070645fe53ee3b3763059376134f058cc337247c978add178b6ccdfb0019f", Description: "Dropper"},
+		{Type: intel.TypeURL, Value: "http://evil.example/it's.exe", Description: "Dropper"},
+	}
+	if len(inds) != len(want) {
+		t.Fatalf("expected %d indicators, got %+v", len(want), inds)
+	}
+	for i, w := range want {
+		if g := inds[i]; g.Type != w.Type || g.Value != w.Value || g.Confidence != w.Confidence || g.Description != w.Description || !g.Expires.Equal(w.Expires) {
+			t.Errorf("indicator %d: expected %+v, got %+v", i, w, g)
+		}
+	}
+}
+
+const mispExport = `{
+  "response": [
+    {
+      "Event": {
+        "info": "Phishing campaign",
+        "Attribute": [
+          {"type": "ip-dst", "value": "198.51.100.9", "to_ids": true},
+          {"type": "domain|ip", "value": "phish.example|203.0.113.5", "to_ids": "1", "comment": "landing page"},
+          {"type": "ip-src|port", "value": "192.0.2.10|8443", "to_ids": true},
+          {"type": "filename|md5", "value": "invoice.doc|D41D8CD98F00B204E9800998ECF8427E", "to_ids": 1},
+          {"type": "url", "value": "https://phish.example/login", "to_ids": false},
+          {"type": "email-src", "value": "boss@phish.example", "to_ids": true}
+        ],
+        "Object": [
+          {"name": "file", "Attribute": [{"type": "sha1", "value": "da39a3ee5e6b4b0d3255bfef95601890afd80709", "to_ids": true}]}
+        ]
+      }
+    }
+  ]
+}`
+
+func TestParseMISP(t *testing.T) {
+	inds, err := intel.ParseMISP(strings.NewReader(mispExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		typ   intel.Type
+		value string
+	}{
+		{intel.TypeIP, "198.51.100.9"},
+		{intel.TypeDomain, "phish.example"},
+		{intel.TypeIP, "203.0.113.5"},
+		{intel.TypeIP, "192.0.2.10"},
+		{intel.TypeHash, "d41d8cd98f00b204e9800998ecf8427e"},
+		{intel.TypeHash, "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+	}
+	if len(inds) != len(want) {
+		t.Fatalf("expected %d indicators, got %+v", len(want), inds)
+	}
+	for i, w := range want {
+		if inds[i].Type != w.typ || inds[i].Value != w.value {
+			t.Errorf("indicator %d: expected %s %s, got %+v", i, w.typ, w.value, inds[i])
+		}
+	}
+	if inds[1].Description != "Phishing campaign: landing page" {
+		t.Errorf("unexpected description %q", inds[1].Description)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	const blocklist = `# Feodo Tracker style list
+198.51.100.1
+203.0.113.0/24   # whole range
+; another comment style
+0.0.0.0 ads.example
+evil[.]example
+not an indicator
+`
+	inds, err := intel.ParseText(strings.NewReader(blocklist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ind := range inds {
+		got = append(got, string(ind.Type)+":"+ind.Value)
+	}
+	want := "ip:198.51.100.1 cidr:203.0.113.0/24 domain:ads.example domain:evil.example"
+	if strings.Join(got, " ") != want {
+		t.Errorf("expected %s, got %s", want, strings.Join(got, " "))
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	const withHeader = `# exported 2026-10-01
+type,indicator,confidence,expires,description
+ip,198.51.100.1,90,2027-01-01,"C2, tier 1"
+domain,evil.example,,,
+hash,zz-not-a-hash,10,,
+`
+	inds, err := intel.ParseCSV(strings.NewReader(withHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inds) != 2 {
+		t.Fatalf("expected 2 indicators, got %+v", inds)
+	}
+	first := inds[0]
+	if first.Value != "198.51.100.1" || first.Confidence != 90 || first.Description != "C2, tier 1" || !first.Expires.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected first indicator %+v", first)
+	}
+	if inds[1].Type != intel.TypeDomain || inds[1].Confidence != 0 {
+		t.Errorf("unexpected second indicator %+v", inds[1])
+	}
+
+	inds, err = intel.ParseCSV(strings.NewReader("198.51.100.2,first seen 2026-09-30\nevil.example\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inds) != 2 || inds[0].Value != "198.51.100.2" {
+		t.Errorf("expected the first column to be read without a header, got %+v", inds)
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	if _, err := intel.Parse("xml", strings.NewReader("")); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
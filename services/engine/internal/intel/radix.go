@@ -0,0 +1,96 @@
+package intel
+
+import (
+	"math/bits"
+	"net/netip"
+)
+
+// prefixTree is a path-compressed binary radix tree of CIDR prefixes. A
+// lookup walks at most one node per distinct prefix length on the path,
+// and returns every stored prefix that contains the address.
+type prefixTree struct {
+	v4, v6 *prefixNode
+}
+
+type prefixNode struct {
+	prefix     netip.Prefix
+	indicators []*Indicator // empty on the nodes that only join two branches
+	children   [2]*prefixNode
+}
+
+func (t *prefixTree) insert(p netip.Prefix, ind *Indicator) {
+	root := &t.v6
+	if p.Addr().Is4() {
+		root = &t.v4
+	}
+	insertPrefix(root, p.Masked(), ind)
+}
+
+func insertPrefix(np **prefixNode, p netip.Prefix, ind *Indicator) {
+	for {
+		n := *np
+		if n == nil {
+			*np = &prefixNode{prefix: p, indicators: []*Indicator{ind}}
+			return
+		}
+		common := commonBits(n.prefix, p)
+		switch {
+		case common == n.prefix.Bits() && common == p.Bits():
+			n.indicators = append(n.indicators, ind)
+			return
+		case common == n.prefix.Bits():
+			np = &n.children[bitAt(p.Addr(), common)]
+		case common == p.Bits():
+			parent := &prefixNode{prefix: p, indicators: []*Indicator{ind}}
+			parent.children[bitAt(n.prefix.Addr(), common)] = n
+			*np = parent
+			return
+		default:
+			fork := &prefixNode{prefix: netip.PrefixFrom(p.Addr(), common).Masked()}
+			fork.children[bitAt(n.prefix.Addr(), common)] = n
+			fork.children[bitAt(p.Addr(), common)] = &prefixNode{prefix: p, indicators: []*Indicator{ind}}
+			*np = fork
+			return
+		}
+	}
+}
+
+// lookup returns the indicators of every prefix containing addr, least
+// specific first.
+func (t *prefixTree) lookup(addr netip.Addr) []*Indicator {
+	addr = addr.Unmap()
+	n := t.v6
+	if addr.Is4() {
+		n = t.v4
+	}
+	var out []*Indicator
+	for n != nil && n.prefix.Contains(addr) {
+		out = append(out, n.indicators...)
+		if n.prefix.Bits() == addr.BitLen() {
+			break
+		}
+		n = n.children[bitAt(addr, n.prefix.Bits())]
+	}
+	return out
+}
+
+// commonBits is the length of the prefix a and b share, at most the
+// shorter of the two.
+func commonBits(a, b netip.Prefix) int {
+	limit := min(a.Bits(), b.Bits())
+	x, y := a.Addr().AsSlice(), b.Addr().AsSlice()
+	n := 0
+	for i := range x {
+		if d := x[i] ^ y[i]; d != 0 {
+			n += bits.LeadingZeros8(d)
+			break
+		}
+		n += 8
+	}
+	return min(n, limit)
+}
+
+func bitAt(addr netip.Addr, i int) int {
+	b := addr.AsSlice()
+	return int(b[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,295 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type sender func(ctx context.Context, n Notification, ch ChannelConfig) error
+
+// target describes where a channel delivers without exposing secrets such
+// as webhook tokens or routing keys.
+func (ch ChannelConfig) target() string {
+	switch ch.Type {
+	case "webhook", "slack", "teams":
+		if u, err := url.Parse(ch.URL); err == nil {
+			return u.Host
+		}
+		return ""
+	case "email":
+		return strings.Join(ch.To, ",")
+	case "syslog":
+		return ch.Address
+	case "pagerduty":
+		return "pagerduty"
+	}
+	return ""
+}
+
+func (d *Dispatcher) postJSON(ctx context.Context, target string, body interface{}, headers map[string]string) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return permanent(err)
+	}
+	return d.post(ctx, target, "application/json", data, headers)
+}
+
+// post treats 5xx and 429 as retryable and any other non-2xx as permanent.
+func (d *Dispatcher) post(ctx context.Context, target, contentType string, body []byte, headers map[string]string) error {
+	if target == "" {
+		return permanent(errors.New("missing url"))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return permanent(err)
+}
+
+func (d *Dispatcher) sendWebhook(ctx context.Context, n Notification, ch ChannelConfig) error {
+	if ch.Template == "" {
+		return d.postJSON(ctx, ch.URL, map[string]interface{}{
+			"rule":  n.Rule.Name,
+			"alert": n.Alert,
+		}, ch.Headers)
+	}
+	body, err := render("webhook", ch.Template, n)
+	if err != nil {
+		return err
+	}
+	contentType := "application/json"
+	if ct, ok := ch.Headers["Content-Type"]; ok {
+		contentType = ct
+	}
+	return d.post(ctx, ch.URL, contentType, []byte(body), ch.Headers)
+}
+
+func (d *Dispatcher) sendSlack(ctx context.Context, n Notification, ch ChannelConfig) error {
+	text, err := render("slack", ch.Template, n)
+	if err != nil {
+		return err
+	}
+	return d.postJSON(ctx, ch.URL, map[string]interface{}{"text": text}, nil)
+}
+
+var teamsColors = map[string]string{
+	"critical": "8B0000",
+	"high":     "D9534F",
+	"medium":   "F0AD4E",
+	"low":      "5BC0DE",
+	"info":     "777777",
+}
+
+func (d *Dispatcher) sendTeams(ctx context.Context, n Notification, ch ChannelConfig) error {
+	text, err := render("teams", ch.Template, n)
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("[%s] %s", strings.ToUpper(n.Alert.Severity), n.Alert.Title)
+	return d.postJSON(ctx, ch.URL, map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    title,
+		"themeColor": teamsColors[n.Alert.Severity],
+		"title":      title,
+		"text":       text,
+	}, nil)
+}
+
+var pagerDutySeverity = map[string]string{
+	"critical": "critical",
+	"high":     "error",
+	"medium":   "warning",
+	"low":      "info",
+	"info":     "info",
+}
+
+// sendPagerDuty triggers an Events API v2 incident. The alert fingerprint
+// is the dedup key so repeats of an open alert land on the same incident.
+func (d *Dispatcher) sendPagerDuty(ctx context.Context, n Notification, ch ChannelConfig) error {
+	if ch.RoutingKey == "" {
+		return permanent(errors.New("missing routing_key"))
+	}
+	summary, err := render("pagerduty", ch.Template, n)
+	if err != nil {
+		return err
+	}
+	if len(summary) > 1024 {
+		summary = summary[:1024]
+	}
+
+	dedupKey := n.Alert.Fingerprint
+	if dedupKey == "" {
+		dedupKey = n.Alert.ID
+	}
+	source := n.Alert.AgentID
+	if source == "" {
+		source = "cybershield-engine"
+	}
+	severity, ok := pagerDutySeverity[n.Alert.Severity]
+	if !ok {
+		severity = "warning"
+	}
+
+	endpoint := d.cfg.PagerDutyURL
+	if ch.URL != "" {
+		endpoint = ch.URL
+	}
+	return d.postJSON(ctx, endpoint, map[string]interface{}{
+		"routing_key":  ch.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    n.Alert.OrgID + ":" + dedupKey,
+		"payload": map[string]interface{}{
+			"summary":   summary,
+			"source":    source,
+			"severity":  severity,
+			"component": n.Alert.Category,
+			"class":     n.Alert.Source,
+			"timestamp": n.Alert.CreatedAt.Format(time.RFC3339),
+			"custom_details": map[string]interface{}{
+				"alert_id":    n.Alert.ID,
+				"org_id":      n.Alert.OrgID,
+				"description": n.Alert.Description,
+				"risk_score":  n.Alert.RiskScore,
+				"rule":        n.Rule.Name,
+			},
+		},
+	}, nil)
+}
+
+func (d *Dispatcher) sendEmail(ctx context.Context, n Notification, ch ChannelConfig) error {
+	smtpCfg := d.cfg.SMTP
+	if smtpCfg.Addr == "" {
+		return permanent(errors.New("smtp is not configured"))
+	}
+	if len(ch.To) == 0 {
+		return permanent(errors.New("missing recipients"))
+	}
+	for _, rcpt := range append([]string{smtpCfg.From}, ch.To...) {
+		if strings.ContainsAny(rcpt, "\r\n") {
+			return permanent(fmt.Errorf("invalid address %q", rcpt))
+		}
+	}
+
+	subject, err := render("email_subject", ch.Subject, n)
+	if err != nil {
+		return err
+	}
+	body, err := render("email", ch.Template, n)
+	if err != nil {
+		return err
+	}
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", smtpCfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(ch.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if smtpCfg.Username != "" {
+		host, _, _ := net.SplitHostPort(smtpCfg.Addr)
+		auth = smtp.PlainAuth("", smtpCfg.Username, smtpCfg.Password, host)
+	}
+
+	// net/smtp has no context support; run it aside so cancellation still
+	// returns promptly.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(smtpCfg.Addr, auth, smtpCfg.From, ch.To, msg.Bytes())
+	}()
+	select {
+	case err := <-done:
+		var tpErr *textproto.Error
+		if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+			return permanent(err)
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var syslogSeverity = map[string]int{
+	"critical": 2,
+	"high":     3,
+	"medium":   4,
+	"low":      5,
+	"info":     6,
+}
+
+const syslogFacilityLocal0 = 16
+
+// sendSyslog writes an RFC 5424 message to udp://host:port or
+// tcp://host:port (TCP uses octet-counting framing).
+func (d *Dispatcher) sendSyslog(ctx context.Context, n Notification, ch ChannelConfig) error {
+	u, err := url.Parse(ch.Address)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return permanent(fmt.Errorf("invalid syslog address %q", ch.Address))
+	}
+	text, err := render("syslog", ch.Template, n)
+	if err != nil {
+		return err
+	}
+
+	sev, ok := syslogSeverity[n.Alert.Severity]
+	if !ok {
+		sev = 4
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	line := fmt.Sprintf("<%d>1 %s %s cybershield - alert - %s",
+		syslogFacilityLocal0*8+sev, time.Now().UTC().Format(time.RFC3339Nano), hostname,
+		strings.ReplaceAll(text, "\n", " "))
+
+	dialer := net.Dialer{Timeout: d.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, u.Scheme, u.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(d.cfg.Timeout))
+
+	if u.Scheme == "tcp" {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	_, err = conn.Write([]byte(line))
+	return err
+}
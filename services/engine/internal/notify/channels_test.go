@@ -0,0 +1,307 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/notify"
+)
+
+func dispatchOne(t *testing.T, cfg notify.Config, ch notify.ChannelConfig) notify.Delivery {
+	t.Helper()
+	rules := notify.StaticRules{{ID: "r1", OrgID: testOrg, Name: "SOC", SeverityThreshold: "low", Enabled: true,
+		Channels: []notify.ChannelConfig{ch}}}
+	got := notify.New(rules, nil, cfg).Dispatch(context.Background(), testAlert("critical"))
+	if len(got) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(got))
+	}
+	return got[0]
+}
+
+func TestSlackChannel(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	del := dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "slack", URL: srv.URL})
+	if del.Status != notify.StatusSent {
+		t.Fatalf("delivery failed: %s", del.Error)
+	}
+	text, _ := rec.last(t)["text"].(string)
+	if !strings.Contains(text, "[CRITICAL] Port Scan Detected") || !strings.Contains(text, "203.0.113.7") {
+		t.Errorf("unexpected slack text %q", text)
+	}
+	if del.Target != strings.TrimPrefix(srv.URL, "http://") {
+		t.Errorf("expected target to be the host only, got %q", del.Target)
+	}
+}
+
+func TestSlackCustomTemplate(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "slack", URL: srv.URL,
+		Template: `{{.Rule.Name}}: {{lower .Alert.Title}}`})
+	if text := rec.last(t)["text"]; text != "SOC: port scan detected" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
+
+func TestBadTemplateFailsWithoutRetry(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	del := dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "slack", URL: srv.URL, Template: `{{.Alert.Nope}}`})
+	if del.Status != notify.StatusFailed || del.Attempts != 1 || rec.calls.Load() != 0 {
+		t.Errorf("expected permanent template failure, got %+v after %d calls", del, rec.calls.Load())
+	}
+}
+
+func TestTeamsChannel(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "teams", URL: srv.URL})
+	body := rec.last(t)
+	if body["@type"] != "MessageCard" || body["title"] != "[CRITICAL] Port Scan Detected" {
+		t.Errorf("unexpected teams card %v", body)
+	}
+	if body["themeColor"] != "8B0000" {
+		t.Errorf("expected critical color, got %v", body["themeColor"])
+	}
+}
+
+func TestPagerDutyChannel(t *testing.T) {
+	rec := &recorder{status: []int{202}}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	cfg := fastConfig()
+	cfg.PagerDutyURL = srv.URL
+	del := dispatchOne(t, cfg, notify.ChannelConfig{Type: "pagerduty", RoutingKey: "R0UT1NG"})
+	if del.Status != notify.StatusSent {
+		t.Fatalf("delivery failed: %s", del.Error)
+	}
+	if del.Target != "pagerduty" {
+		t.Errorf("expected routing key kept out of the log, got %q", del.Target)
+	}
+
+	body := rec.last(t)
+	if body["routing_key"] != "R0UT1NG" || body["event_action"] != "trigger" {
+		t.Errorf("unexpected event %v", body)
+	}
+	if body["dedup_key"] != testOrg+":abc123" {
+		t.Errorf("expected fingerprint dedup key, got %v", body["dedup_key"])
+	}
+	payload := body["payload"].(map[string]interface{})
+	if payload["severity"] != "critical" || payload["summary"] != "[CRITICAL] Port Scan Detected" {
+		t.Errorf("unexpected payload %v", payload)
+	}
+}
+
+func TestPagerDutyRequiresRoutingKey(t *testing.T) {
+	del := dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "pagerduty"})
+	if del.Status != notify.StatusFailed || del.Attempts != 1 {
+		t.Errorf("expected immediate failure, got %+v", del)
+	}
+}
+
+func TestWebhookChannel(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "webhook", URL: srv.URL})
+	body := rec.last(t)
+	alert, _ := body["alert"].(map[string]interface{})
+	if body["rule"] != "SOC" || alert["title"] != "Port Scan Detected" {
+		t.Errorf("unexpected webhook body %v", body)
+	}
+
+	dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "webhook", URL: srv.URL,
+		Template: `{"id":"{{.Alert.ID}}","sev":"{{.Alert.Severity}}"}`})
+	if body := rec.last(t); body["sev"] != "critical" {
+		t.Errorf("unexpected templated body %v", body)
+	}
+}
+
+// smtpStub is a minimal SMTP server that accepts one message per session.
+type smtpStub struct {
+	ln       net.Listener
+	messages chan string
+	rcpts    chan []string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln, messages: make(chan string, 4), rcpts: make(chan []string, 4)}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpStub) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(conn)
+	}
+}
+
+func (s *smtpStub) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 stub ESMTP")
+	var rcpts []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 stub")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			rcpts = append(rcpts, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.messages <- msg.String()
+			s.rcpts <- rcpts
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestEmailChannel(t *testing.T) {
+	stub := newSMTPStub(t)
+	cfg := fastConfig()
+	cfg.SMTP = notify.SMTPConfig{Addr: stub.ln.Addr().String(), From: "shield@example.com"}
+
+	del := dispatchOne(t, cfg, notify.ChannelConfig{Type: "email", To: []string{"soc@example.com", "oncall@example.com"}})
+	if del.Status != notify.StatusSent {
+		t.Fatalf("delivery failed: %s", del.Error)
+	}
+
+	select {
+	case msg := <-stub.messages:
+		if !strings.Contains(msg, "Subject: [CyberShield CRITICAL] Port Scan Detected") {
+			t.Errorf("missing subject in %q", msg)
+		}
+		if !strings.Contains(msg, "Matched rule: SOC") || !strings.Contains(msg, "Category:  port_scan") {
+			t.Errorf("unexpected body %q", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+	}
+	if rcpts := <-stub.rcpts; len(rcpts) != 2 || rcpts[0] != "soc@example.com" {
+		t.Errorf("unexpected recipients %v", rcpts)
+	}
+}
+
+func TestEmailRequiresSMTP(t *testing.T) {
+	del := dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "email", To: []string{"soc@example.com"}})
+	if del.Status != notify.StatusFailed || del.Attempts != 1 {
+		t.Errorf("expected immediate failure without smtp, got %+v", del)
+	}
+}
+
+func TestSyslogUDPChannel(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	del := dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "syslog", Address: "udp://" + pc.LocalAddr().String()})
+	if del.Status != notify.StatusSent {
+		t.Fatalf("delivery failed: %s", del.Error)
+	}
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// local0 (16) * 8 + crit (2)
+	if !strings.HasPrefix(msg, "<130>1 ") {
+		t.Errorf("unexpected priority in %q", msg)
+	}
+	if !strings.Contains(msg, `title="Port Scan Detected"`) || !strings.Contains(msg, "cybershield - alert") {
+		t.Errorf("unexpected syslog message %q", msg)
+	}
+}
+
+func TestSyslogTCPChannel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 2048)
+		n, _ := conn.Read(buf)
+		received <- string(buf[:n])
+	}()
+
+	del := dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "syslog", Address: "tcp://" + ln.Addr().String()})
+	if del.Status != notify.StatusSent {
+		t.Fatalf("delivery failed: %s", del.Error)
+	}
+	msg := <-received
+	length, rest, _ := strings.Cut(msg, " ")
+	if length == "" || !strings.HasPrefix(rest, "<130>1 ") {
+		t.Errorf("expected octet-counted frame, got %q", msg)
+	}
+}
+
+func TestSyslogRejectsBadAddress(t *testing.T) {
+	del := dispatchOne(t, fastConfig(), notify.ChannelConfig{Type: "syslog", Address: "localhost:514"})
+	if del.Status != notify.StatusFailed || del.Attempts != 1 {
+		t.Errorf("expected immediate failure, got %+v", del)
+	}
+}
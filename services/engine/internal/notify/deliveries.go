@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	StatusSent   = "sent"
+	StatusFailed = "failed"
+)
+
+// Delivery is one attempt-series to one channel, as written to the
+// delivery log.
+type Delivery struct {
+	OrgID    string
+	AlertID  string
+	RuleID   string
+	Channel  string
+	Target   string
+	Status   string
+	Attempts int
+	Error    string
+	At       time.Time
+}
+
+type DeliveryLog interface {
+	Record(ctx context.Context, d Delivery) error
+}
+
+// MemoryLog keeps the most recent deliveries in process.
+type MemoryLog struct {
+	mu    sync.Mutex
+	items []Delivery
+	max   int
+}
+
+func NewMemoryLog(max int) *MemoryLog {
+	if max <= 0 {
+		max = 1000
+	}
+	return &MemoryLog{max: max}
+}
+
+func (m *MemoryLog) Record(ctx context.Context, d Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = append(m.items, d)
+	if len(m.items) > m.max {
+		m.items = m.items[len(m.items)-m.max:]
+	}
+	return nil
+}
+
+func (m *MemoryLog) Deliveries() []Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Delivery(nil), m.items...)
+}
+
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// PGLog writes deliveries to the notification_deliveries table.
+type PGLog struct {
+	db Execer
+}
+
+func NewPGLog(db Execer) *PGLog {
+	return &PGLog{db: db}
+}
+
+func (p *PGLog) Record(ctx context.Context, d Delivery) error {
+	orgID, err := uuid.Parse(d.OrgID)
+	if err != nil {
+		return nil
+	}
+	alertID, err := uuid.Parse(d.AlertID)
+	if err != nil {
+		return nil
+	}
+	var ruleID *uuid.UUID
+	if id, err := uuid.Parse(d.RuleID); err == nil {
+		ruleID = &id
+	}
+	var errText *string
+	if d.Error != "" {
+		errText = &d.Error
+	}
+
+	_, err = p.db.Exec(ctx,
+		`INSERT INTO notification_deliveries
+			(org_id, alert_id, rule_id, channel, target, status, attempts, error, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		orgID, alertID, ruleID, d.Channel, d.Target, d.Status, d.Attempts, errText, d.At,
+	)
+	if err != nil {
+		return fmt.Errorf("insert delivery: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+)
+
+// Rule mirrors a row of the alert_rules table: alerts at or above
+// SeverityThreshold for the org are sent to every channel.
+type Rule struct {
+	ID                string
+	OrgID             string
+	Name              string
+	SeverityThreshold string
+	Channels          []ChannelConfig
+	Enabled           bool
+}
+
+// ChannelConfig is one entry of alert_rules.channels. Which fields apply
+// depends on Type; Template and Subject override the channel's default
+// text/template.
+type ChannelConfig struct {
+	Type       string            `json:"type"`
+	URL        string            `json:"url,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	RoutingKey string            `json:"routing_key,omitempty"`
+	To         []string          `json:"to,omitempty"`
+	Address    string            `json:"address,omitempty"`
+	Template   string            `json:"template,omitempty"`
+	Subject    string            `json:"subject,omitempty"`
+}
+
+// Notification is the data every channel template is rendered with.
+type Notification struct {
+	Alert alerts.Alert
+	Rule  Rule
+}
+
+var severityRank = map[string]int{
+	"info":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+func (r Rule) Matches(alert alerts.Alert) bool {
+	if !r.Enabled {
+		return false
+	}
+	if r.OrgID != "" && r.OrgID != alert.OrgID {
+		return false
+	}
+	threshold, ok := severityRank[r.SeverityThreshold]
+	if !ok {
+		threshold = severityRank["medium"]
+	}
+	got, ok := severityRank[alert.Severity]
+	return ok && got >= threshold
+}
+
+type SMTPConfig struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+type Config struct {
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Timeout      time.Duration
+	Workers      int
+	SMTP         SMTPConfig
+	PagerDutyURL string
+	// GlobalRules apply to every org in addition to the org's own rules.
+	GlobalRules []Rule
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:  4,
+		BaseBackoff:  2 * time.Second,
+		MaxBackoff:   time.Minute,
+		Timeout:      10 * time.Second,
+		Workers:      4,
+		PagerDutyURL: "https://events.pagerduty.com/v2/enqueue",
+	}
+}
+
+// permanentError marks a failure that retrying cannot fix, such as a 4xx
+// response or a template that does not render.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error { return &permanentError{err} }
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+type Dispatcher struct {
+	rules      RuleSource
+	deliveries DeliveryLog
+	cfg        Config
+	client     *http.Client
+	senders    map[string]sender
+}
+
+func New(rules RuleSource, deliveries DeliveryLog, cfg Config) *Dispatcher {
+	def := DefaultConfig()
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = def.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = def.Timeout
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.PagerDutyURL == "" {
+		cfg.PagerDutyURL = def.PagerDutyURL
+	}
+	if deliveries == nil {
+		deliveries = NewMemoryLog(0)
+	}
+
+	d := &Dispatcher{
+		rules:      rules,
+		deliveries: deliveries,
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+	}
+	d.senders = map[string]sender{
+		"webhook":   d.sendWebhook,
+		"slack":     d.sendSlack,
+		"teams":     d.sendTeams,
+		"pagerduty": d.sendPagerDuty,
+		"email":     d.sendEmail,
+		"syslog":    d.sendSyslog,
+	}
+	return d
+}
+
+// Run dispatches alerts from ch until it closes or ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, ch <-chan alerts.Alert) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case alert, ok := <-ch:
+					if !ok {
+						return
+					}
+					d.Dispatch(ctx, alert)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Dispatch sends the alert to every channel of every matching rule and
+// returns the recorded deliveries.
+func (d *Dispatcher) Dispatch(ctx context.Context, alert alerts.Alert) []Delivery {
+	var rules []Rule
+	if d.rules != nil {
+		orgRules, err := d.rules.Rules(ctx, alert.OrgID)
+		if err != nil {
+			log.Printf("notify: load rules for org %s: %v", alert.OrgID, err)
+		}
+		rules = append(rules, orgRules...)
+	}
+	rules = append(rules, d.cfg.GlobalRules...)
+
+	var (
+		mu      sync.Mutex
+		results []Delivery
+		wg      sync.WaitGroup
+	)
+	for _, rule := range rules {
+		if !rule.Matches(alert) {
+			continue
+		}
+		for _, ch := range rule.Channels {
+			wg.Add(1)
+			go func(rule Rule, ch ChannelConfig) {
+				defer wg.Done()
+				del := d.deliver(ctx, Notification{Alert: alert, Rule: rule}, ch, d.cfg.MaxAttempts)
+				if err := d.deliveries.Record(ctx, del); err != nil {
+					log.Printf("notify: record delivery: %v", err)
+				}
+				mu.Lock()
+				results = append(results, del)
+				mu.Unlock()
+			}(rule, ch)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// NotifyRule sends the alert through every channel of one of the org's
+// enabled rules, whatever the rule's threshold, as a playbook step asks.
+// It fails if the rule is unknown or any channel did not deliver.
+func (d *Dispatcher) NotifyRule(ctx context.Context, alert alerts.Alert, ruleID string) ([]Delivery, error) {
+	if d.rules == nil {
+		return nil, errors.New("no alert rules are configured")
+	}
+	rules, err := d.rules.Rules(ctx, alert.OrgID)
+	if err != nil && len(rules) == 0 {
+		return nil, err
+	}
+	var rule *Rule
+	for i := range rules {
+		if rules[i].ID == ruleID {
+			rule = &rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return nil, fmt.Errorf("alert rule %s not found or disabled", ruleID)
+	}
+
+	results := make([]Delivery, len(rule.Channels))
+	var wg sync.WaitGroup
+	for i, ch := range rule.Channels {
+		wg.Add(1)
+		go func(i int, ch ChannelConfig) {
+			defer wg.Done()
+			results[i] = d.deliver(ctx, Notification{Alert: alert, Rule: *rule}, ch, d.cfg.MaxAttempts)
+			if err := d.deliveries.Record(ctx, results[i]); err != nil {
+				log.Printf("notify: record delivery: %v", err)
+			}
+		}(i, ch)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, del := range results {
+		if del.Status != StatusSent {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d channels failed", failed, len(results))
+	}
+	return results, nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, n Notification, ch ChannelConfig, maxAttempts int) Delivery {
+	del := Delivery{
+		OrgID:   n.Alert.OrgID,
+		AlertID: n.Alert.ID,
+		RuleID:  n.Rule.ID,
+		Channel: ch.Type,
+		Target:  ch.target(),
+	}
+
+	send, ok := d.senders[ch.Type]
+	if !ok {
+		del.Status = StatusFailed
+		del.Error = fmt.Sprintf("unknown channel type %q", ch.Type)
+		del.At = time.Now()
+		return del
+	}
+
+	backoff := d.cfg.BaseBackoff
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		del.Attempts = attempt
+		err = send(ctx, n, ch)
+		if err == nil || isPermanent(err) || attempt == maxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(backoff):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+		if backoff > d.cfg.MaxBackoff {
+			backoff = d.cfg.MaxBackoff
+		}
+	}
+
+	del.At = time.Now()
+	if err != nil {
+		del.Status = StatusFailed
+		del.Error = err.Error()
+		log.Printf("notify: %s delivery for alert %s failed after %d attempts: %v", ch.Type, n.Alert.ID, del.Attempts, err)
+	} else {
+		del.Status = StatusSent
+	}
+	return del
+}
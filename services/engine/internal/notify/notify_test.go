@@ -0,0 +1,276 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/notify"
+)
+
+const testOrg = "7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10"
+
+func testAlert(severity string) alerts.Alert {
+	return alerts.Alert{
+		ID:          "3f0d3c4a-1b2c-4d5e-8f90-a1b2c3d4e5f6",
+		OrgID:       testOrg,
+		AgentID:     "agent-1",
+		Title:       "Port Scan Detected",
+		Description: "42 ports probed from 203.0.113.7",
+		Severity:    severity,
+		Category:    "port_scan",
+		Source:      "network",
+		RiskScore:   8.5,
+		Fingerprint: "abc123",
+		CreatedAt:   time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	bodies [][]byte
+	status []int
+	calls  atomic.Int32
+}
+
+// handler replies with the queued statuses in order, then 200.
+func (r *recorder) handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		n := int(r.calls.Add(1))
+		r.mu.Lock()
+		r.bodies = append(r.bodies, body)
+		code := http.StatusOK
+		if n <= len(r.status) {
+			code = r.status[n-1]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(code)
+	}
+}
+
+func (r *recorder) last(t *testing.T) map[string]interface{} {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.bodies) == 0 {
+		t.Fatal("no requests received")
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(r.bodies[len(r.bodies)-1], &v); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	return v
+}
+
+func fastConfig() notify.Config {
+	cfg := notify.DefaultConfig()
+	cfg.BaseBackoff = time.Millisecond
+	cfg.MaxBackoff = 5 * time.Millisecond
+	cfg.Timeout = 2 * time.Second
+	return cfg
+}
+
+func TestRuleMatchesSeverityThreshold(t *testing.T) {
+	r := notify.Rule{OrgID: testOrg, SeverityThreshold: "high", Enabled: true}
+	cases := map[string]bool{"medium": false, "high": true, "critical": true, "bogus": false}
+	for sev, want := range cases {
+		if got := r.Matches(testAlert(sev)); got != want {
+			t.Errorf("severity %s: got %v, want %v", sev, got, want)
+		}
+	}
+
+	other := testAlert("critical")
+	other.OrgID = "another-org"
+	if r.Matches(other) {
+		t.Error("expected rule to be scoped to its org")
+	}
+	r.Enabled = false
+	if r.Matches(testAlert("critical")) {
+		t.Error("expected disabled rule not to match")
+	}
+}
+
+func TestDispatchFansOutToMatchingRules(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	rules := notify.StaticRules{
+		{ID: "r1", OrgID: testOrg, Name: "high", SeverityThreshold: "high", Enabled: true,
+			Channels: []notify.ChannelConfig{{Type: "slack", URL: srv.URL}, {Type: "webhook", URL: srv.URL}}},
+		{ID: "r2", OrgID: testOrg, Name: "critical only", SeverityThreshold: "critical", Enabled: true,
+			Channels: []notify.ChannelConfig{{Type: "slack", URL: srv.URL}}},
+	}
+	deliveries := notify.NewMemoryLog(0)
+	d := notify.New(rules, deliveries, fastConfig())
+
+	got := d.Dispatch(context.Background(), testAlert("high"))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(got))
+	}
+	if rec.calls.Load() != 2 {
+		t.Errorf("expected 2 requests, got %d", rec.calls.Load())
+	}
+	logged := deliveries.Deliveries()
+	if len(logged) != 2 {
+		t.Fatalf("expected 2 logged deliveries, got %d", len(logged))
+	}
+	for _, del := range logged {
+		if del.Status != notify.StatusSent || del.Attempts != 1 || del.RuleID != "r1" {
+			t.Errorf("unexpected delivery %+v", del)
+		}
+	}
+}
+
+func TestDispatchRetriesTransientFailures(t *testing.T) {
+	rec := &recorder{status: []int{http.StatusBadGateway, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	rules := notify.StaticRules{{OrgID: testOrg, SeverityThreshold: "low", Enabled: true,
+		Channels: []notify.ChannelConfig{{Type: "slack", URL: srv.URL}}}}
+	d := notify.New(rules, nil, fastConfig())
+
+	got := d.Dispatch(context.Background(), testAlert("high"))
+	if len(got) != 1 || got[0].Status != notify.StatusSent || got[0].Attempts != 3 {
+		t.Errorf("expected success on third attempt, got %+v", got)
+	}
+}
+
+func TestDispatchGivesUpAfterMaxAttempts(t *testing.T) {
+	rec := &recorder{status: []int{500, 500, 500, 500, 500}}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	rules := notify.StaticRules{{OrgID: testOrg, SeverityThreshold: "low", Enabled: true,
+		Channels: []notify.ChannelConfig{{Type: "slack", URL: srv.URL}}}}
+	cfg := fastConfig()
+	cfg.MaxAttempts = 3
+	d := notify.New(rules, nil, cfg)
+
+	got := d.Dispatch(context.Background(), testAlert("high"))
+	if len(got) != 1 || got[0].Status != notify.StatusFailed || got[0].Attempts != 3 || got[0].Error == "" {
+		t.Errorf("expected failure after 3 attempts, got %+v", got)
+	}
+}
+
+func TestDispatchDoesNotRetryClientErrors(t *testing.T) {
+	rec := &recorder{status: []int{http.StatusNotFound}}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	rules := notify.StaticRules{{OrgID: testOrg, SeverityThreshold: "low", Enabled: true,
+		Channels: []notify.ChannelConfig{{Type: "slack", URL: srv.URL}}}}
+	d := notify.New(rules, nil, fastConfig())
+
+	got := d.Dispatch(context.Background(), testAlert("high"))
+	if len(got) != 1 || got[0].Status != notify.StatusFailed || got[0].Attempts != 1 {
+		t.Errorf("expected a single failed attempt, got %+v", got)
+	}
+}
+
+func TestDispatchUnknownChannel(t *testing.T) {
+	rules := notify.StaticRules{{OrgID: testOrg, SeverityThreshold: "low", Enabled: true,
+		Channels: []notify.ChannelConfig{{Type: "carrier_pigeon"}}}}
+	d := notify.New(rules, nil, fastConfig())
+
+	got := d.Dispatch(context.Background(), testAlert("high"))
+	if len(got) != 1 || got[0].Status != notify.StatusFailed {
+		t.Errorf("expected failed delivery for unknown channel, got %+v", got)
+	}
+}
+
+func TestDispatchGlobalRules(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	cfg := fastConfig()
+	cfg.GlobalRules = []notify.Rule{{Name: "ALERT_WEBHOOK", SeverityThreshold: "info", Enabled: true,
+		Channels: []notify.ChannelConfig{{Type: "slack", URL: srv.URL}}}}
+	d := notify.New(nil, nil, cfg)
+
+	alert := testAlert("low")
+	alert.OrgID = "default"
+	if got := d.Dispatch(context.Background(), alert); len(got) != 1 || got[0].Status != notify.StatusSent {
+		t.Errorf("expected global rule delivery, got %+v", got)
+	}
+}
+
+func TestRunDrainsChannel(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	rules := notify.StaticRules{{OrgID: testOrg, SeverityThreshold: "low", Enabled: true,
+		Channels: []notify.ChannelConfig{{Type: "webhook", URL: srv.URL}}}}
+	d := notify.New(rules, nil, fastConfig())
+
+	ch := make(chan alerts.Alert, 3)
+	for i := 0; i < 3; i++ {
+		ch <- testAlert("high")
+	}
+	close(ch)
+	d.Run(context.Background(), ch)
+
+	if rec.calls.Load() != 3 {
+		t.Errorf("expected 3 deliveries, got %d", rec.calls.Load())
+	}
+}
+
+func TestStaticRulesScopesByOrg(t *testing.T) {
+	rules := notify.StaticRules{{Name: "global"}, {Name: "mine", OrgID: testOrg}, {Name: "theirs", OrgID: "x"}}
+	got, _ := rules.Rules(context.Background(), testOrg)
+	if len(got) != 2 || got[0].Name != "global" || got[1].Name != "mine" {
+		t.Errorf("unexpected rules %+v", got)
+	}
+}
+
+func TestParseChannels(t *testing.T) {
+	channels, err := notify.ParseChannels([]byte(`[
+		{"type":"slack","url":"https://hooks.slack.com/services/T/B/X"},
+		{"type":"email","to":["soc@example.com"],"subject":"{{.Alert.Title}}"}
+	]`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(channels) != 2 || channels[1].To[0] != "soc@example.com" {
+		t.Errorf("unexpected channels %+v", channels)
+	}
+
+	if _, err := notify.ParseChannels([]byte(`[{"url":"x"}]`)); err == nil {
+		t.Error("expected error for channel without type")
+	}
+	if _, err := notify.ParseChannels([]byte(`{"type":"slack"}`)); err == nil {
+		t.Error("expected error for non-array channels")
+	}
+}
+
+func TestNotifyRuleIgnoresThreshold(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	rules := notify.StaticRules{{ID: "r1", OrgID: testOrg, SeverityThreshold: "critical", Enabled: true,
+		Channels: []notify.ChannelConfig{{Type: "webhook", URL: srv.URL}}}}
+	d := notify.New(rules, nil, fastConfig())
+
+	deliveries, err := d.NotifyRule(context.Background(), testAlert("low"), "r1")
+	if err != nil {
+		t.Fatalf("NotifyRule: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != notify.StatusSent {
+		t.Errorf("deliveries = %+v, want one sent", deliveries)
+	}
+	if _, err := d.NotifyRule(context.Background(), testAlert("low"), "missing"); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+)
+
+type RuleSource interface {
+	Rules(ctx context.Context, orgID string) ([]Rule, error)
+}
+
+// StaticRules serves a fixed rule list; rules with an empty OrgID apply to
+// every org.
+type StaticRules []Rule
+
+func (s StaticRules) Rules(ctx context.Context, orgID string) ([]Rule, error) {
+	var out []Rule
+	for _, r := range s {
+		if r.OrgID == "" || r.OrgID == orgID {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// PGRules reads enabled alert_rules per org, caching each org's rules for
+// ttl so a burst of alerts doesn't query the table for every one.
+type PGRules struct {
+	db      Querier
+	ttl     time.Duration
+	secrets *secrets.Box
+
+	mu    sync.Mutex
+	cache map[string]cachedRules
+}
+
+type cachedRules struct {
+	rules   []Rule
+	fetched time.Time
+}
+
+// NewPGRules reads rules through db; box opens the channel secrets the API
+// sealed and may be nil when no SECRETS_KEY is configured.
+func NewPGRules(db Querier, ttl time.Duration, box *secrets.Box) *PGRules {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &PGRules{db: db, ttl: ttl, secrets: box, cache: make(map[string]cachedRules)}
+}
+
+func (p *PGRules) Rules(ctx context.Context, orgID string) ([]Rule, error) {
+	if _, err := uuid.Parse(orgID); err != nil {
+		return nil, nil
+	}
+
+	p.mu.Lock()
+	c, ok := p.cache[orgID]
+	p.mu.Unlock()
+	if ok && time.Since(c.fetched) < p.ttl {
+		return c.rules, nil
+	}
+
+	rows, err := p.db.Query(ctx,
+		`SELECT id, org_id, name, severity_threshold, channels, enabled
+		 FROM alert_rules WHERE org_id = $1 AND enabled`, orgID)
+	if err != nil {
+		if ok {
+			// Serve the stale copy rather than dropping notifications
+			// while the database is unavailable.
+			return c.rules, fmt.Errorf("query alert rules: %w", err)
+		}
+		return nil, fmt.Errorf("query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var (
+			r        Rule
+			channels []byte
+		)
+		if err := rows.Scan(&r.ID, &r.OrgID, &r.Name, &r.SeverityThreshold, &channels, &r.Enabled); err != nil {
+			return nil, fmt.Errorf("scan alert rule: %w", err)
+		}
+		parsed, err := ParseChannels(channels)
+		if err == nil {
+			err = OpenChannels(p.secrets, parsed)
+		}
+		if err != nil {
+			log.Printf("notify: alert rule %s (%s) has invalid channels: %v", r.ID, r.Name, err)
+			continue
+		}
+		r.Channels = parsed
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read alert rules: %w", err)
+	}
+
+	p.mu.Lock()
+	p.cache[orgID] = cachedRules{rules: rules, fetched: time.Now()}
+	p.mu.Unlock()
+	return rules, nil
+}
+
+// ParseChannels decodes the alert_rules.channels JSON array.
+func ParseChannels(data []byte) ([]ChannelConfig, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var channels []ChannelConfig
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return nil, err
+	}
+	for i, ch := range channels {
+		if ch.Type == "" {
+			return nil, fmt.Errorf("channel %d: missing type", i)
+		}
+	}
+	return channels, nil
+}
+
+// OpenChannels decrypts the sealed secret fields of channels in place.
+func OpenChannels(box *secrets.Box, channels []ChannelConfig) error {
+	for i := range channels {
+		ch := &channels[i]
+		var err error
+		if ch.URL, err = box.Open(ch.URL); err != nil {
+			return fmt.Errorf("channel %d url: %w", i, err)
+		}
+		if ch.RoutingKey, err = box.Open(ch.RoutingKey); err != nil {
+			return fmt.Errorf("channel %d routing_key: %w", i, err)
+		}
+		if len(ch.Headers) > 0 {
+			headers := make(map[string]string, len(ch.Headers))
+			for k, v := range ch.Headers {
+				if headers[k], err = box.Open(v); err != nil {
+					return fmt.Errorf("channel %d header %s: %w", i, k, err)
+				}
+			}
+			ch.Headers = headers
+		}
+	}
+	return nil
+}
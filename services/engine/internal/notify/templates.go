@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+var defaultTemplates = map[string]string{
+	"slack": `{{if eq .Alert.Severity "critical" "high"}}:rotating_light: {{end}}*[{{upper .Alert.Severity}}] {{.Alert.Title}}*
+{{.Alert.Description}}
+Category: {{.Alert.Category}} | Source: {{.Alert.Source}} | Risk: {{printf "%.1f" .Alert.RiskScore}}{{if .Alert.AgentID}} | Agent: {{.Alert.AgentID}}{{end}}`,
+
+	"teams": `{{.Alert.Description}}<br>
+**Category:** {{.Alert.Category}} &nbsp; **Source:** {{.Alert.Source}} &nbsp; **Risk:** {{printf "%.1f" .Alert.RiskScore}}`,
+
+	"pagerduty": `[{{upper .Alert.Severity}}] {{.Alert.Title}}`,
+
+	"email": `{{.Alert.Title}}
+
+Severity:  {{.Alert.Severity}}
+Category:  {{.Alert.Category}}
+Source:    {{.Alert.Source}}
+Risk:      {{printf "%.1f" .Alert.RiskScore}}
+Agent:     {{.Alert.AgentID}}
+Seen:      {{.Alert.CreatedAt.Format "2006-01-02 15:04:05 MST"}}
+Alert ID:  {{.Alert.ID}}
+
+{{.Alert.Description}}
+
+Matched rule: {{.Rule.Name}}
+`,
+
+	"email_subject": `[CyberShield {{upper .Alert.Severity}}] {{.Alert.Title}}`,
+
+	"syslog": `severity={{.Alert.Severity}} category={{.Alert.Category}} source={{.Alert.Source}} alert_id={{.Alert.ID}} title="{{.Alert.Title}}"`,
+}
+
+// render executes the override when set and the channel default otherwise.
+// A template that fails to parse or execute is a permanent error.
+func render(name, override string, n Notification) (string, error) {
+	text := override
+	if text == "" {
+		text = defaultTemplates[name]
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", permanent(fmt.Errorf("parse %s template: %w", name, err))
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, n); err != nil {
+		return "", permanent(fmt.Errorf("render %s template: %w", name, err))
+	}
+	return buf.String(), nil
+}
+
+// ValidateTemplate reports whether a channel template override parses.
+func ValidateTemplate(text string) error {
+	_, err := template.New("check").Funcs(templateFuncs).Parse(text)
+	return err
+}
@@ -0,0 +1,99 @@
+package notify_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/notify"
+)
+
+func testRequest(t *testing.T, channels string) []byte {
+	t.Helper()
+	var req notify.TestRequest
+	req.Rule.ID = "4b8e3c1d-2f6a-4a7b-9c0d-1e2f3a4b5c6d"
+	req.Rule.OrgID = testOrg
+	req.Rule.Name = "SOC on-call"
+	req.Rule.SeverityThreshold = "high"
+	req.Rule.Channels = json.RawMessage(channels)
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestHandleTestOpensSealedSecrets(t *testing.T) {
+	rec := &recorder{status: []int{500}}
+	srv := httptest.NewServer(rec.handler())
+	defer srv.Close()
+
+	box, _ := secrets.NewBox(bytes.Repeat([]byte{3}, 32))
+	sealed, err := box.Seal(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := notify.New(nil, nil, fastConfig())
+	out := d.HandleTest(context.Background(), box, testRequest(t, `[{"type":"slack","url":"`+sealed+`"},{"type":"carrier_pigeon"}]`))
+
+	var reply notify.TestReply
+	if err := json.Unmarshal(out, &reply); err != nil {
+		t.Fatalf("decode reply: %v", err)
+	}
+	if reply.Error != "" || len(reply.Deliveries) != 2 {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+	// Test sends are not retried, so the 500 is reported as-is.
+	if del := reply.Deliveries[0]; del.Channel != "slack" || del.Status != notify.StatusFailed || del.Attempts != 1 {
+		t.Errorf("unexpected slack delivery %+v", del)
+	}
+	if reply.Deliveries[1].Status != notify.StatusFailed {
+		t.Errorf("expected unknown channel to fail, got %+v", reply.Deliveries[1])
+	}
+
+	d.HandleTest(context.Background(), box, testRequest(t, `[{"type":"slack","url":"`+sealed+`"}]`))
+	text, _ := rec.last(t)["text"].(string)
+	if !strings.Contains(text, "Test notification") || !strings.Contains(text, `"SOC on-call"`) {
+		t.Errorf("unexpected test message %q", text)
+	}
+}
+
+func TestHandleTestWithoutKey(t *testing.T) {
+	box, _ := secrets.NewBox(bytes.Repeat([]byte{3}, 32))
+	sealed, _ := box.Seal("https://hooks.slack.com/services/T/B/X")
+
+	d := notify.New(nil, nil, fastConfig())
+	var reply notify.TestReply
+	json.Unmarshal(d.HandleTest(context.Background(), nil, testRequest(t, `[{"type":"slack","url":"`+sealed+`"}]`)), &reply)
+	if reply.Error == "" || len(reply.Deliveries) != 0 {
+		t.Errorf("expected an error reply, got %+v", reply)
+	}
+}
+
+func TestOpenChannels(t *testing.T) {
+	box, _ := secrets.NewBox(bytes.Repeat([]byte{3}, 32))
+	url, _ := box.Seal("https://siem.example.com/ingest")
+	auth, _ := box.Seal("Bearer abc")
+	key, _ := box.Seal("R0UT1NG")
+
+	channels := []notify.ChannelConfig{
+		{Type: "webhook", URL: url, Headers: map[string]string{"Authorization": auth, "X-Plain": "kept"}},
+		{Type: "pagerduty", RoutingKey: key},
+		{Type: "slack", URL: "https://hooks.slack.com/plain"},
+	}
+	if err := notify.OpenChannels(box, channels); err != nil {
+		t.Fatal(err)
+	}
+	if channels[0].URL != "https://siem.example.com/ingest" || channels[0].Headers["Authorization"] != "Bearer abc" ||
+		channels[0].Headers["X-Plain"] != "kept" {
+		t.Errorf("unexpected webhook channel %+v", channels[0])
+	}
+	if channels[1].RoutingKey != "R0UT1NG" || channels[2].URL != "https://hooks.slack.com/plain" {
+		t.Errorf("unexpected channels %+v", channels[1:])
+	}
+}
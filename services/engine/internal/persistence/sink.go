@@ -0,0 +1,384 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/scoring"
+)
+
+var ErrBackpressure = errors.New("persistence: write queue full")
+
+// ErrUnavailable is returned while the database cannot take writes, so the
+// event is redelivered instead of queued behind rows that are not landing.
+var ErrUnavailable = errors.New("persistence: database unavailable")
+
+// maxRetryBackoff caps the wait between attempts to write a held batch.
+const maxRetryBackoff = 30 * time.Second
+
+type Copier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+type Config struct {
+	BatchSize      int
+	FlushInterval  time.Duration
+	QueueSize      int
+	EnqueueTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:      500,
+		FlushInterval:  2 * time.Second,
+		QueueSize:      10000,
+		EnqueueTimeout: 5 * time.Second,
+	}
+}
+
+const (
+	tableEvents       = "events"
+	tableThreatScores = "threat_scores"
+	tableMetrics      = "metrics"
+)
+
+var columns = map[string][]string{
+	tableEvents:       {"time", "org_id", "agent_id", "source", "category", "severity", "risk_score", "summary", "payload"},
+	tableThreatScores: {"time", "org_id", "score", "factors"},
+	tableMetrics:      {"time", "org_id", "agent_id", "metric_name", "metric_value", "tags"},
+}
+
+type record struct {
+	table string
+	row   []interface{}
+}
+
+type Sink struct {
+	db      Copier
+	cfg     Config
+	queue   chan record
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	written atomic.Int64
+	dropped atomic.Int64
+
+	unavailable atomic.Bool
+}
+
+func New(db Copier, cfg Config) *Sink {
+	def := DefaultConfig()
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = def.FlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+	if cfg.EnqueueTimeout <= 0 {
+		cfg.EnqueueTimeout = def.EnqueueTimeout
+	}
+	return &Sink{
+		db:    db,
+		cfg:   cfg,
+		queue: make(chan record, cfg.QueueSize),
+	}
+}
+
+func (s *Sink) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx)
+	}()
+}
+
+func (s *Sink) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Sink) run(ctx context.Context) {
+	batches := make(map[string][][]interface{})
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	// While the database is failing, a batch is kept and retried with
+	// backoff, and new writes are refused so their events are redelivered.
+	var (
+		backoff time.Duration
+		retryAt time.Time
+	)
+	flushTable := func(table string) bool {
+		rows, err := s.flush(table, batches[table])
+		if err != nil {
+			batches[table] = rows
+			backoff = min(max(2*backoff, s.cfg.FlushInterval), maxRetryBackoff)
+			retryAt = time.Now().Add(backoff)
+			s.unavailable.Store(true)
+			log.Printf("persistence: copy into %s failed, holding %d rows for %s: %v", table, len(rows), backoff, err)
+			return false
+		}
+		delete(batches, table)
+		backoff, retryAt = 0, time.Time{}
+		s.unavailable.Store(false)
+		return true
+	}
+	add := func(rec record) {
+		batches[rec.table] = append(batches[rec.table], rec.row)
+		if len(batches[rec.table]) >= s.cfg.BatchSize && !time.Now().Before(retryAt) {
+			flushTable(rec.table)
+		}
+	}
+	flushAll := func() {
+		if time.Now().Before(retryAt) {
+			return
+		}
+		for table, rows := range batches {
+			if len(rows) == 0 {
+				delete(batches, table)
+				continue
+			}
+			if !flushTable(table) {
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case rec := <-s.queue:
+					add(rec)
+				default:
+					retryAt = time.Time{}
+					flushAll()
+					for table, rows := range batches {
+						s.dropped.Add(int64(len(rows)))
+						log.Printf("persistence: stopping with the database unavailable, dropping %d %s rows", len(rows), table)
+					}
+					return
+				}
+			}
+		case rec := <-s.queue:
+			add(rec)
+		case <-ticker.C:
+			flushAll()
+		}
+	}
+}
+
+// flush copies rows into table. Rows the database rejects are dropped;
+// when it fails for any other reason (connection, timeout) the rows not
+// yet written are returned with the error, to be retried.
+func (s *Sink) flush(table string, rows [][]interface{}) ([][]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	n, err := s.db.CopyFrom(ctx, pgx.Identifier{table}, columns[table], pgx.CopyFromRows(rows))
+	if err == nil {
+		s.written.Add(n)
+		return nil, nil
+	}
+	if !isDataError(err) {
+		return rows, err
+	}
+
+	// One bad row (unknown org, oversized value) fails the whole COPY, so
+	// fall back to copying rows one at a time and drop only the offenders.
+	log.Printf("persistence: batch copy into %s failed (%d rows), retrying individually: %v", table, len(rows), err)
+	for i, row := range rows {
+		n, err := s.db.CopyFrom(ctx, pgx.Identifier{table}, columns[table], pgx.CopyFromRows([][]interface{}{row}))
+		if err != nil {
+			if !isDataError(err) {
+				return rows[i:], err
+			}
+			s.dropped.Add(1)
+			log.Printf("persistence: dropping %s row: %v", table, err)
+			continue
+		}
+		s.written.Add(n)
+	}
+	return nil, nil
+}
+
+// isDataError reports whether the database rejected the rows themselves, as
+// a data exception (class 22) or constraint violation (class 23), rather
+// than failing to take them.
+func isDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23"))
+}
+
+func (s *Sink) enqueue(rec record) error {
+	if s.unavailable.Load() {
+		return ErrUnavailable
+	}
+	select {
+	case s.queue <- rec:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(s.cfg.EnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case s.queue <- rec:
+		return nil
+	case <-timer.C:
+		return ErrBackpressure
+	}
+}
+
+// WriteEvent queues the event for the next batch. It fails with
+// ErrUnavailable while the database is not taking writes, so the event is
+// nak'd and redelivered rather than acked and lost; rows queued before the
+// outage are held and retried.
+func (s *Sink) WriteEvent(event core.Event) error {
+	orgID, ok := parseUUID(event.OrgID)
+	if !ok {
+		s.dropped.Add(1)
+		return nil
+	}
+	agentID, ok := parseUUID(event.AgentID)
+	if !ok {
+		s.dropped.Add(1)
+		return nil
+	}
+
+	t := event.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	if event.Category == "metrics" {
+		return s.writeMetrics(t, orgID, agentID, event.Payload)
+	}
+
+	payload := event.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	severity := event.Severity
+	if severity == "" {
+		severity = "info"
+	}
+
+	return s.enqueue(record{table: tableEvents, row: []interface{}{
+		t, orgID, agentID,
+		truncate(event.Source, 100), truncate(event.Category, 100), truncate(severity, 50),
+		event.RiskScore, truncate(event.Summary, 500), payload,
+	}})
+}
+
+// writeMetrics fans a host metrics sample out into one metrics row per
+// series. Samples arrive either as map[string]float64 (in-process) or as
+// decoded JSON objects.
+func (s *Sink) writeMetrics(t time.Time, orgID, agentID uuid.UUID, payload map[string]interface{}) error {
+	tags, _ := payload["tags"].(map[string]interface{})
+	if tags == nil {
+		tags = map[string]interface{}{}
+	}
+
+	values := make(map[string]float64)
+	switch m := payload["metrics"].(type) {
+	case map[string]float64:
+		values = m
+	case map[string]interface{}:
+		for name, v := range m {
+			if f, ok := v.(float64); ok {
+				values[name] = f
+			}
+		}
+	}
+
+	for name, v := range values {
+		err := s.enqueue(record{table: tableMetrics, row: []interface{}{
+			t, orgID, agentID, truncate(name, 255), v, tags,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sink) WriteThreatScore(orgID string, ts *scoring.ThreatScore) error {
+	id, ok := parseUUID(orgID)
+	if !ok || ts == nil {
+		return nil
+	}
+	factors := ts.Factors
+	if factors == nil {
+		factors = map[string]float64{}
+	}
+	t := ts.Updated
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return s.enqueue(record{table: tableThreatScores, row: []interface{}{
+		t, id, float32(ts.Score), factors,
+	}})
+}
+
+func (s *Sink) SnapshotScores(ctx context.Context, scorer *scoring.Scorer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for orgID, ts := range scorer.Snapshot() {
+				if err := s.WriteThreatScore(orgID, ts); err != nil {
+					log.Printf("persistence: threat score snapshot for %s: %v", orgID, err)
+				}
+			}
+		}
+	}
+}
+
+func (s *Sink) Written() int64 {
+	return s.written.Load()
+}
+
+func (s *Sink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *Sink) QueueDepth() int {
+	return len(s.queue)
+}
+
+func parseUUID(s string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.UUID{}, false
+	}
+	return id, true
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n])
+}
@@ -0,0 +1,297 @@
+package persistence_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/persistence"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/scoring"
+)
+
+const (
+	testOrg   = "7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10"
+	testAgent = "0b7e4c36-6d5e-4f3c-8a3b-2f0a9e6b1c22"
+)
+
+type fakeCopier struct {
+	mu      sync.Mutex
+	calls   map[string][]int
+	rows    map[string][][]interface{}
+	block   chan struct{}
+	failRow func(row []interface{}) bool
+	down    atomic.Bool
+}
+
+func newFakeCopier() *fakeCopier {
+	return &fakeCopier{
+		calls: make(map[string][]int),
+		rows:  make(map[string][][]interface{}),
+	}
+}
+
+func (f *fakeCopier) CopyFrom(ctx context.Context, table pgx.Identifier, cols []string, src pgx.CopyFromSource) (int64, error) {
+	if f.block != nil {
+		<-f.block
+	}
+	if f.down.Load() {
+		return 0, errors.New("dial tcp: connection refused")
+	}
+
+	var rows [][]interface{}
+	for src.Next() {
+		vals, err := src.Values()
+		if err != nil {
+			return 0, err
+		}
+		if len(vals) != len(cols) {
+			return 0, errors.New("column count mismatch")
+		}
+		rows = append(rows, vals)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[table[0]] = append(f.calls[table[0]], len(rows))
+	if f.failRow != nil {
+		for _, r := range rows {
+			if f.failRow(r) {
+				return 0, &pgconn.PgError{Code: "23503", Message: "foreign key violation"}
+			}
+		}
+	}
+	f.rows[table[0]] = append(f.rows[table[0]], rows...)
+	return int64(len(rows)), nil
+}
+
+func (f *fakeCopier) rowCount(table string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.rows[table])
+}
+
+func (f *fakeCopier) rowsOf(table string) [][]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]interface{}(nil), f.rows[table]...)
+}
+
+func (f *fakeCopier) callSizes(table string) []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.calls[table]...)
+}
+
+func testEvent(category string) core.Event {
+	return core.Event{
+		Time:     time.Now(),
+		OrgID:    testOrg,
+		AgentID:  testAgent,
+		Source:   "auth",
+		Category: category,
+		Severity: "medium",
+		Summary:  "test event",
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSinkFlushesOnBatchSize(t *testing.T) {
+	db := newFakeCopier()
+	sink := persistence.New(db, persistence.Config{BatchSize: 5, FlushInterval: time.Hour})
+	sink.Start(context.Background())
+	defer sink.Stop()
+
+	for i := 0; i < 10; i++ {
+		if err := sink.WriteEvent(testEvent("auth_failure")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	waitFor(t, func() bool { return db.rowCount("events") == 10 })
+	sizes := db.callSizes("events")
+	if len(sizes) != 2 || sizes[0] != 5 || sizes[1] != 5 {
+		t.Errorf("expected two batches of 5, got %v", sizes)
+	}
+}
+
+func TestSinkFlushesOnInterval(t *testing.T) {
+	db := newFakeCopier()
+	sink := persistence.New(db, persistence.Config{BatchSize: 1000, FlushInterval: 50 * time.Millisecond})
+	sink.Start(context.Background())
+	defer sink.Stop()
+
+	sink.WriteEvent(testEvent("auth_failure"))
+	sink.WriteEvent(testEvent("auth_success"))
+
+	waitFor(t, func() bool { return db.rowCount("events") == 2 })
+}
+
+func TestSinkFlushesOnStop(t *testing.T) {
+	db := newFakeCopier()
+	sink := persistence.New(db, persistence.Config{BatchSize: 1000, FlushInterval: time.Hour})
+	sink.Start(context.Background())
+
+	sink.WriteEvent(testEvent("auth_failure"))
+	sink.Stop()
+
+	if db.rowCount("events") != 1 {
+		t.Errorf("expected pending row flushed on stop, got %d", db.rowCount("events"))
+	}
+}
+
+func TestSinkBackpressure(t *testing.T) {
+	db := newFakeCopier()
+	db.block = make(chan struct{})
+	sink := persistence.New(db, persistence.Config{
+		BatchSize:      1,
+		FlushInterval:  time.Hour,
+		QueueSize:      1,
+		EnqueueTimeout: 50 * time.Millisecond,
+	})
+	sink.Start(context.Background())
+	defer func() {
+		close(db.block)
+		sink.Stop()
+	}()
+
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		err = sink.WriteEvent(testEvent("auth_failure"))
+	}
+	if !errors.Is(err, persistence.ErrBackpressure) {
+		t.Errorf("expected ErrBackpressure, got %v", err)
+	}
+}
+
+func TestSinkIsolatesBadRows(t *testing.T) {
+	db := newFakeCopier()
+	db.failRow = func(row []interface{}) bool {
+		return row[4] == "poison"
+	}
+	sink := persistence.New(db, persistence.Config{BatchSize: 3, FlushInterval: time.Hour})
+	sink.Start(context.Background())
+	defer sink.Stop()
+
+	sink.WriteEvent(testEvent("auth_failure"))
+	sink.WriteEvent(testEvent("poison"))
+	sink.WriteEvent(testEvent("auth_success"))
+
+	waitFor(t, func() bool { return db.rowCount("events") == 2 })
+	if sink.Dropped() != 1 {
+		t.Errorf("expected 1 dropped row, got %d", sink.Dropped())
+	}
+}
+
+func TestSinkHoldsBatchesWhileDatabaseIsDown(t *testing.T) {
+	db := newFakeCopier()
+	db.down.Store(true)
+	sink := persistence.New(db, persistence.Config{BatchSize: 2, FlushInterval: 20 * time.Millisecond})
+	sink.Start(context.Background())
+	defer sink.Stop()
+
+	accepted := 0
+	waitFor(t, func() bool {
+		err := sink.WriteEvent(testEvent("auth_failure"))
+		if err == nil {
+			accepted++
+		}
+		return errors.Is(err, persistence.ErrUnavailable)
+	})
+	if sink.Dropped() != 0 {
+		t.Errorf("expected no rows dropped during the outage, got %d", sink.Dropped())
+	}
+
+	db.down.Store(false)
+	waitFor(t, func() bool { return db.rowCount("events") == accepted })
+	waitFor(t, func() bool { return sink.WriteEvent(testEvent("auth_success")) == nil })
+	if sink.Dropped() != 0 {
+		t.Errorf("expected no rows dropped, got %d", sink.Dropped())
+	}
+}
+
+func TestSinkSkipsEventsWithoutValidIDs(t *testing.T) {
+	db := newFakeCopier()
+	sink := persistence.New(db, persistence.Config{BatchSize: 1, FlushInterval: time.Hour})
+	sink.Start(context.Background())
+
+	e := testEvent("auth_failure")
+	e.AgentID = "agent-1"
+	sink.WriteEvent(e)
+	sink.Stop()
+
+	if db.rowCount("events") != 0 {
+		t.Errorf("expected event with non-UUID agent to be skipped")
+	}
+	if sink.Dropped() != 1 {
+		t.Errorf("expected 1 dropped, got %d", sink.Dropped())
+	}
+}
+
+func TestSinkRoutesMetricsSamples(t *testing.T) {
+	db := newFakeCopier()
+	sink := persistence.New(db, persistence.Config{BatchSize: 100, FlushInterval: time.Hour})
+	sink.Start(context.Background())
+
+	e := testEvent("metrics")
+	e.Source = "host"
+	e.Payload = map[string]interface{}{
+		"metrics": map[string]interface{}{"cpu_percent": 12.5, "process_count": float64(210)},
+		"tags":    map[string]interface{}{"host": "web-1"},
+	}
+	sink.WriteEvent(e)
+	sink.Stop()
+
+	if db.rowCount("events") != 0 {
+		t.Errorf("expected metrics sample not to be written as an event")
+	}
+	rows := db.rowsOf("metrics")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 metric rows, got %d", len(rows))
+	}
+	values := map[interface{}]interface{}{}
+	for _, row := range rows {
+		values[row[3]] = row[4]
+	}
+	if values["cpu_percent"] != 12.5 || values["process_count"] != float64(210) {
+		t.Errorf("unexpected metric rows: %v", values)
+	}
+}
+
+func TestSinkSnapshotsThreatScores(t *testing.T) {
+	db := newFakeCopier()
+	sink := persistence.New(db, persistence.Config{BatchSize: 1, FlushInterval: time.Hour})
+	sink.Start(context.Background())
+	defer sink.Stop()
+
+	scorer := scoring.New(time.Hour)
+	scorer.Process(testEvent("auth_failure"))
+	scorer.Process(core.Event{Time: time.Now(), OrgID: "default", Severity: "high"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sink.SnapshotScores(ctx, scorer, 20*time.Millisecond)
+
+	waitFor(t, func() bool { return db.rowCount("threat_scores") >= 1 })
+	for _, row := range db.rowsOf("threat_scores") {
+		if row[1] == nil {
+			t.Error("expected org id on threat score row")
+		}
+	}
+}
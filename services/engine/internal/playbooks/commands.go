@@ -0,0 +1,126 @@
+package playbooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nats-io/nats.go"
+)
+
+// AgentCommand is the message an agent receives on its command subject.
+// The json:"-" fields are not sent to the agent; they only route and record
+// the command.
+type AgentCommand struct {
+	ID          string          `json:"id"`
+	Command     string          `json:"command"`
+	Args        json.RawMessage `json:"args,omitempty"`
+	TimeoutMS   int64           `json:"timeout_ms"`
+	RequestedBy string          `json:"requested_by,omitempty"`
+
+	OrgID       string `json:"-"`
+	AgentID     string `json:"-"`
+	ExecutionID string `json:"-"`
+}
+
+// CommandResult is the agent's reply.
+type CommandResult struct {
+	Status string          `json:"status"`
+	Output json.RawMessage `json:"output"`
+	Error  string          `json:"error"`
+}
+
+// Requester sends a request and waits for the reply, as *nats.Conn does.
+type Requester interface {
+	RequestWithContext(ctx context.Context, subject string, data []byte) (*nats.Msg, error)
+}
+
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// NATSCommands sends commands to agents over NATS request/reply. With a
+// database each command is also written to agent_commands, the same audit
+// trail commands sent through the API land in.
+type NATSCommands struct {
+	nc Requester
+	db Execer
+}
+
+// NewNATSCommands sends through nc; db may be nil.
+func NewNATSCommands(nc Requester, db Execer) *NATSCommands {
+	return &NATSCommands{nc: nc, db: db}
+}
+
+// CommandSubject is where an agent receives commands.
+func CommandSubject(orgID, agentID string) string {
+	return fmt.Sprintf("agents.%s.%s.cmd", orgID, agentID)
+}
+
+// SendCommand waits for the agent's result until ctx is done. The agent is
+// told to give up a second earlier so its own timed_out result can arrive.
+func (c *NATSCommands) SendCommand(ctx context.Context, cmd AgentCommand) (CommandResult, error) {
+	if _, err := uuid.Parse(cmd.AgentID); err != nil {
+		return CommandResult{}, fmt.Errorf("invalid agent id %q", cmd.AgentID)
+	}
+	if cmd.ID == "" {
+		cmd.ID = uuid.NewString()
+	}
+	if cmd.TimeoutMS > 2000 {
+		cmd.TimeoutMS -= 1000
+	}
+	created := time.Now()
+	if c.db != nil {
+		var execID *string
+		if cmd.ExecutionID != "" {
+			execID = &cmd.ExecutionID
+		}
+		_, err := c.db.Exec(ctx,
+			`INSERT INTO agent_commands (id, org_id, agent_id, command, args, status, timeout_ms, playbook_execution_id, created_at)
+			 VALUES ($1, $2, $3, $4, $5, 'running', $6, $7, $8)`,
+			cmd.ID, cmd.OrgID, cmd.AgentID, cmd.Command, []byte(cmd.Args), cmd.TimeoutMS, execID, created,
+		)
+		if err != nil {
+			return CommandResult{}, fmt.Errorf("record command: %w", err)
+		}
+	}
+
+	data, _ := json.Marshal(cmd)
+	msg, err := c.nc.RequestWithContext(ctx, CommandSubject(cmd.OrgID, cmd.AgentID), data)
+	var result CommandResult
+	switch {
+	case errors.Is(err, nats.ErrNoResponders):
+		result = CommandResult{Status: "failed", Error: "agent is not connected"}
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout):
+		result = CommandResult{Status: "timed_out", Error: "agent did not reply in time"}
+	case err != nil:
+		result = CommandResult{Status: "failed", Error: err.Error()}
+	default:
+		if err := json.Unmarshal(msg.Data, &result); err != nil || result.Status == "" {
+			result = CommandResult{Status: "failed", Error: "invalid reply from agent"}
+		}
+	}
+
+	if c.db != nil {
+		var output, errText interface{}
+		if len(result.Output) > 0 {
+			output = []byte(result.Output)
+		}
+		if result.Error != "" {
+			errText = result.Error
+		}
+		_, err := c.db.Exec(context.WithoutCancel(ctx),
+			`UPDATE agent_commands SET status = $1, output = $2, error = $3, completed_at = $4 WHERE id = $5`,
+			result.Status, output, errText, time.Now(), cmd.ID,
+		)
+		if err != nil {
+			log.Printf("playbooks: record result of agent command %s: %v", cmd.ID, err)
+		}
+	}
+	return result, nil
+}
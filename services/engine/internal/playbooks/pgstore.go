@@ -0,0 +1,314 @@
+package playbooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+)
+
+// DB is the subset of *pgxpool.Pool the store needs.
+type DB interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// PGStore reads playbooks from the playbooks table, caching each org's for
+// ttl, and writes executions to playbook_executions and
+// playbook_step_runs. It also serves as the Enricher and AlertUpdater.
+type PGStore struct {
+	db  DB
+	ttl time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedPlaybooks
+}
+
+type cachedPlaybooks struct {
+	playbooks []Playbook
+	fetched   time.Time
+}
+
+func NewPGStore(db DB, ttl time.Duration) *PGStore {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &PGStore{db: db, ttl: ttl, cache: make(map[string]cachedPlaybooks)}
+}
+
+func (s *PGStore) Playbooks(ctx context.Context, orgID string) ([]Playbook, error) {
+	if _, err := uuid.Parse(orgID); err != nil {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	c, ok := s.cache[orgID]
+	s.mu.Unlock()
+	if ok && time.Since(c.fetched) < s.ttl {
+		return c.playbooks, nil
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT id, org_id, name, conditions, steps, enabled
+		 FROM playbooks WHERE org_id = $1 AND enabled ORDER BY created_at`, orgID)
+	if err != nil {
+		if ok {
+			return c.playbooks, fmt.Errorf("query playbooks: %w", err)
+		}
+		return nil, fmt.Errorf("query playbooks: %w", err)
+	}
+	defer rows.Close()
+
+	var playbooks []Playbook
+	for rows.Next() {
+		var (
+			p                 Playbook
+			conditions, steps []byte
+		)
+		if err := rows.Scan(&p.ID, &p.OrgID, &p.Name, &conditions, &steps, &p.Enabled); err != nil {
+			return nil, fmt.Errorf("scan playbook: %w", err)
+		}
+		if err := json.Unmarshal(conditions, &p.Conditions); err != nil {
+			log.Printf("playbooks: playbook %s (%s) has invalid conditions: %v", p.ID, p.Name, err)
+			continue
+		}
+		if err := json.Unmarshal(steps, &p.Steps); err != nil {
+			log.Printf("playbooks: playbook %s (%s) has invalid steps: %v", p.ID, p.Name, err)
+			continue
+		}
+		playbooks = append(playbooks, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read playbooks: %w", err)
+	}
+
+	s.mu.Lock()
+	s.cache[orgID] = cachedPlaybooks{playbooks: playbooks, fetched: time.Now()}
+	s.mu.Unlock()
+	return playbooks, nil
+}
+
+func (s *PGStore) CreateExecution(ctx context.Context, e Execution) error {
+	var playbookID *string
+	if _, err := uuid.Parse(e.PlaybookID); err == nil {
+		playbookID = &e.PlaybookID
+	}
+	steps, err := json.Marshal(e.Steps)
+	if err != nil {
+		return fmt.Errorf("marshal steps: %w", err)
+	}
+	alert, err := json.Marshal(e.Alert)
+	if err != nil {
+		return fmt.Errorf("marshal alert: %w", err)
+	}
+	outputs, err := json.Marshal(e.Outputs)
+	if err != nil {
+		return fmt.Errorf("marshal outputs: %w", err)
+	}
+	_, err = s.db.Exec(ctx,
+		`INSERT INTO playbook_executions
+			(id, org_id, playbook_id, playbook_name, alert_id, status, current_step, steps, alert, outputs, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		e.ID, e.OrgID, playbookID, e.PlaybookName, e.AlertID, e.Status, e.CurrentStep,
+		steps, alert, outputs, e.CreatedAt, e.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert execution: %w", err)
+	}
+	return nil
+}
+
+func (s *PGStore) UpdateExecution(ctx context.Context, e Execution) error {
+	outputs, err := json.Marshal(e.Outputs)
+	if err != nil {
+		return fmt.Errorf("marshal outputs: %w", err)
+	}
+	var errText *string
+	if e.Error != "" {
+		errText = &e.Error
+	}
+	_, err = s.db.Exec(ctx,
+		`UPDATE playbook_executions
+		 SET status = $1, current_step = $2, outputs = $3, error = $4, updated_at = $5, completed_at = $6
+		 WHERE id = $7`,
+		e.Status, e.CurrentStep, outputs, errText, e.UpdatedAt, e.CompletedAt, e.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update execution: %w", err)
+	}
+	return nil
+}
+
+func (s *PGStore) RecordStep(ctx context.Context, r StepRun) error {
+	var output []byte
+	if r.Output != nil {
+		var err error
+		if output, err = json.Marshal(r.Output); err != nil {
+			return fmt.Errorf("marshal step output: %w", err)
+		}
+	}
+	var errText, actor *string
+	if r.Error != "" {
+		errText = &r.Error
+	}
+	if r.Actor != "" {
+		actor = &r.Actor
+	}
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO playbook_step_runs
+			(execution_id, step_index, step_name, step_type, status, output, error, actor, started_at, finished_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		r.ExecutionID, r.Index, r.Name, r.Type, r.Status, output, errText, actor, r.StartedAt, r.FinishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert step run: %w", err)
+	}
+	return nil
+}
+
+func (s *PGStore) ClaimApproval(ctx context.Context, orgID, executionID string, step int, status string) (Execution, error) {
+	if _, err := uuid.Parse(executionID); err != nil {
+		return Execution{}, ErrNotAwaitingApproval
+	}
+	var (
+		e                     Execution
+		playbookID            *string
+		steps, alert, outputs []byte
+	)
+	err := s.db.QueryRow(ctx,
+		`UPDATE playbook_executions SET status = $1, updated_at = NOW()
+		 WHERE id = $2 AND org_id = $3 AND status = 'awaiting_approval' AND current_step = $4
+		 RETURNING id, org_id, playbook_id, playbook_name, alert_id, status, current_step,
+			steps, alert, outputs, created_at, updated_at`,
+		status, executionID, orgID, step,
+	).Scan(&e.ID, &e.OrgID, &playbookID, &e.PlaybookName, &e.AlertID, &e.Status, &e.CurrentStep,
+		&steps, &alert, &outputs, &e.CreatedAt, &e.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Execution{}, ErrNotAwaitingApproval
+	}
+	if err != nil {
+		return Execution{}, fmt.Errorf("claim approval: %w", err)
+	}
+	if playbookID != nil {
+		e.PlaybookID = *playbookID
+	}
+	if err := json.Unmarshal(steps, &e.Steps); err != nil {
+		return Execution{}, fmt.Errorf("decode steps: %w", err)
+	}
+	if err := json.Unmarshal(alert, &e.Alert); err != nil {
+		return Execution{}, fmt.Errorf("decode alert: %w", err)
+	}
+	if err := json.Unmarshal(outputs, &e.Outputs); err != nil {
+		return Execution{}, fmt.Errorf("decode outputs: %w", err)
+	}
+	return e, nil
+}
+
+func (s *PGStore) SetStatus(ctx context.Context, orgID, alertID, status string) error {
+	tag, err := s.db.Exec(ctx,
+		`UPDATE alerts SET status = $1, updated_at = NOW() WHERE id = $2 AND org_id = $3`,
+		status, alertID, orgID)
+	if err != nil {
+		return fmt.Errorf("update alert status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("alert not found")
+	}
+	return nil
+}
+
+// Assign only assigns users of the alert's own org.
+func (s *PGStore) Assign(ctx context.Context, orgID, alertID, userID string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return fmt.Errorf("invalid assignee id %q", userID)
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE alerts SET assignee_id = $1, updated_at = NOW()
+		 WHERE id = $2 AND org_id = $3
+		   AND EXISTS (SELECT 1 FROM users WHERE id = $1 AND org_id = $3)`,
+		userID, alertID, orgID)
+	if err != nil {
+		return fmt.Errorf("assign alert: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("alert or assignee not found in the org")
+	}
+	return nil
+}
+
+// Enrich supports two lookups: "agent", the reporting agent's identity and
+// last heartbeat, and "related_alerts", how many other alerts the org saw
+// in the last 24 hours for the same category or agent.
+func (s *PGStore) Enrich(ctx context.Context, alert alerts.Alert, lookups []string) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(lookups))
+	for _, lookup := range lookups {
+		switch lookup {
+		case "agent":
+			if _, err := uuid.Parse(alert.AgentID); err != nil {
+				out["agent"] = nil
+				continue
+			}
+			var (
+				name, hostname, status, version string
+				lastHeartbeat                   *time.Time
+			)
+			err := s.db.QueryRow(ctx,
+				`SELECT name, hostname, status, agent_version, last_heartbeat
+				 FROM agents WHERE id = $1 AND org_id = $2`, alert.AgentID, alert.OrgID,
+			).Scan(&name, &hostname, &status, &version, &lastHeartbeat)
+			if errors.Is(err, pgx.ErrNoRows) {
+				out["agent"] = nil
+				continue
+			}
+			if err != nil {
+				return out, fmt.Errorf("look up agent: %w", err)
+			}
+			out["agent"] = map[string]interface{}{
+				"id":             alert.AgentID,
+				"name":           name,
+				"hostname":       hostname,
+				"status":         status,
+				"version":        version,
+				"last_heartbeat": lastHeartbeat,
+			}
+
+		case "related_alerts":
+			var agentID *string
+			if _, err := uuid.Parse(alert.AgentID); err == nil {
+				agentID = &alert.AgentID
+			}
+			var sameCategory, sameAgent, unresolved int
+			err := s.db.QueryRow(ctx,
+				`SELECT COUNT(*) FILTER (WHERE category = $3),
+					COUNT(*) FILTER (WHERE agent_id = $4),
+					COUNT(*) FILTER (WHERE status <> 'resolved')
+				 FROM alerts
+				 WHERE org_id = $1 AND id::text <> $2 AND created_at > NOW() - INTERVAL '24 hours'
+				   AND (category = $3 OR agent_id = $4)`,
+				alert.OrgID, alert.ID, alert.Category, agentID,
+			).Scan(&sameCategory, &sameAgent, &unresolved)
+			if err != nil {
+				return out, fmt.Errorf("count related alerts: %w", err)
+			}
+			out["related_alerts"] = map[string]interface{}{
+				"same_category": sameCategory,
+				"same_agent":    sameAgent,
+				"unresolved":    unresolved,
+			}
+
+		default:
+			return out, fmt.Errorf("unknown lookup %q", lookup)
+		}
+	}
+	return out, nil
+}
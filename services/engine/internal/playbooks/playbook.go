@@ -0,0 +1,163 @@
+// Package playbooks runs automated responses to new alerts. A playbook
+// names the alerts it applies to and an ordered list of steps; every run is
+// recorded step by step so analysts can see what was done and why.
+package playbooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+)
+
+const (
+	StepEnrich       = "enrich"
+	StepNotify       = "notify"
+	StepWebhook      = "webhook"
+	StepAgentCommand = "agent_command"
+	StepSetStatus    = "set_status"
+	StepAssign       = "assign"
+)
+
+// destructiveCommands change the agent or its host. Steps sending them
+// always wait for an analyst's approval.
+var destructiveCommands = map[string]bool{
+	"block_ip":          true,
+	"unblock_ip":        true,
+	"restart_collector": true,
+}
+
+var severityRank = map[string]int{
+	"info":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// Playbook mirrors a row of the playbooks table.
+type Playbook struct {
+	ID         string     `json:"id"`
+	OrgID      string     `json:"org_id"`
+	Name       string     `json:"name"`
+	Enabled    bool       `json:"enabled"`
+	Conditions Conditions `json:"conditions"`
+	Steps      []Step     `json:"steps"`
+}
+
+// Conditions must all hold for a playbook to run. Empty conditions match
+// every alert.
+type Conditions struct {
+	Categories  []string `json:"categories,omitempty"`
+	MinSeverity string   `json:"min_severity,omitempty"`
+	// Rules matches the correlation or sigma rule that raised the alert.
+	Rules []string `json:"rules,omitempty"`
+	// Fields maps payload paths such as "group_key.payload.src_ip" to glob
+	// patterns the value must match.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+type Step struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+	// TimeoutSeconds bounds the step; zero uses the runner's default.
+	TimeoutSeconds  int  `json:"timeout_seconds,omitempty"`
+	RequireApproval bool `json:"require_approval,omitempty"`
+	// ContinueOnError lets the playbook go on after this step fails.
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+}
+
+// NeedsApproval reports whether an analyst has to approve the step before
+// it runs.
+func (s Step) NeedsApproval() bool {
+	if s.RequireApproval {
+		return true
+	}
+	if s.Type != StepAgentCommand {
+		return false
+	}
+	var p struct {
+		Command string `json:"command"`
+	}
+	json.Unmarshal(s.Params, &p)
+	return destructiveCommands[p.Command]
+}
+
+func (p Playbook) Matches(alert alerts.Alert) bool {
+	if !p.Enabled {
+		return false
+	}
+	if p.OrgID != "" && p.OrgID != alert.OrgID {
+		return false
+	}
+	return p.Conditions.Matches(alert)
+}
+
+func (c Conditions) Matches(alert alerts.Alert) bool {
+	if len(c.Categories) > 0 && !contains(c.Categories, alert.Category) {
+		return false
+	}
+	if c.MinSeverity != "" {
+		min, ok := severityRank[c.MinSeverity]
+		if !ok {
+			min = severityRank["medium"]
+		}
+		got, ok := severityRank[alert.Severity]
+		if !ok || got < min {
+			return false
+		}
+	}
+	if len(c.Rules) > 0 {
+		rule, _ := alert.Payload["rule"].(string)
+		if !contains(c.Rules, rule) {
+			return false
+		}
+	}
+	for field, pattern := range c.Fields {
+		v, ok := Field(alert.Payload, field)
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, fmt.Sprint(v)); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Field looks up a dotted path in an alert payload. Payload keys may
+// themselves contain dots, as correlation group keys do, so at each level
+// the longest key present wins.
+func Field(payload map[string]interface{}, fieldPath string) (interface{}, bool) {
+	parts := strings.Split(fieldPath, ".")
+	var cur interface{} = payload
+	for len(parts) > 0 {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for n := len(parts); n > 0; n-- {
+			if v, ok := m[strings.Join(parts[:n], ".")]; ok {
+				cur, parts, found = v, parts[n:], true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package playbooks_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/playbooks"
+)
+
+const (
+	testOrg   = "7f1c1e0a-3a43-4a51-9b7e-4d1b5e0f7a10"
+	testAgent = "5b2a9c3e-6d7f-4a81-9b0c-1d2e3f4a5b6c"
+)
+
+func bruteForceAlert() alerts.Alert {
+	return alerts.Alert{
+		ID:       "3f0d3c4a-1b2c-4d5e-8f90-a1b2c3d4e5f6",
+		OrgID:    testOrg,
+		AgentID:  testAgent,
+		Title:    "Correlated: brute_force_attack (src_ip=203.0.113.7)",
+		Severity: "high",
+		Category: "attack",
+		Source:   "correlation",
+		Payload: map[string]interface{}{
+			"rule":      "brute_force_attack",
+			"group_key": map[string]interface{}{"payload.src_ip": "203.0.113.7"},
+		},
+	}
+}
+
+func TestConditionsMatch(t *testing.T) {
+	alert := bruteForceAlert()
+	cases := []struct {
+		name string
+		cond playbooks.Conditions
+		want bool
+	}{
+		{"empty", playbooks.Conditions{}, true},
+		{"category", playbooks.Conditions{Categories: []string{"port_scan", "attack"}}, true},
+		{"other category", playbooks.Conditions{Categories: []string{"port_scan"}}, false},
+		{"severity at minimum", playbooks.Conditions{MinSeverity: "high"}, true},
+		{"severity below minimum", playbooks.Conditions{MinSeverity: "critical"}, false},
+		{"rule", playbooks.Conditions{Rules: []string{"brute_force_attack"}}, true},
+		{"other rule", playbooks.Conditions{Rules: []string{"port_scan_with_exploit"}}, false},
+		{"field glob", playbooks.Conditions{Fields: map[string]string{"group_key.payload.src_ip": "203.0.113.*"}}, true},
+		{"field mismatch", playbooks.Conditions{Fields: map[string]string{"group_key.payload.src_ip": "10.*"}}, false},
+		{"missing field", playbooks.Conditions{Fields: map[string]string{"user": "*"}}, false},
+	}
+	for _, c := range cases {
+		if got := c.cond.Matches(alert); got != c.want {
+			t.Errorf("%s: Matches = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPlaybookMatchesOwnOrgWhenEnabled(t *testing.T) {
+	alert := bruteForceAlert()
+	p := playbooks.Playbook{OrgID: testOrg, Enabled: true}
+	if !p.Matches(alert) {
+		t.Error("enabled playbook of the alert's org should match")
+	}
+	p.Enabled = false
+	if p.Matches(alert) {
+		t.Error("disabled playbook matched")
+	}
+	p = playbooks.Playbook{OrgID: "00000000-0000-0000-0000-000000000001", Enabled: true}
+	if p.Matches(alert) {
+		t.Error("playbook of another org matched")
+	}
+}
+
+func TestField(t *testing.T) {
+	payload := map[string]interface{}{
+		"rule":      "r",
+		"group_key": map[string]interface{}{"payload.src_ip": "203.0.113.7"},
+		"nested":    map[string]interface{}{"a": map[string]interface{}{"b": 2.0}},
+	}
+	if v, ok := playbooks.Field(payload, "group_key.payload.src_ip"); !ok || v != "203.0.113.7" {
+		t.Errorf("dotted key: got %v, %v", v, ok)
+	}
+	if v, ok := playbooks.Field(payload, "nested.a.b"); !ok || v != 2.0 {
+		t.Errorf("nested: got %v, %v", v, ok)
+	}
+	if _, ok := playbooks.Field(payload, "rule.x"); ok {
+		t.Error("path through a string should not resolve")
+	}
+}
+
+func TestDestructiveStepsNeedApproval(t *testing.T) {
+	step := func(typ, params string) playbooks.Step {
+		return playbooks.Step{Type: typ, Params: json.RawMessage(params)}
+	}
+	cases := []struct {
+		step playbooks.Step
+		want bool
+	}{
+		{step("agent_command", `{"command":"block_ip"}`), true},
+		{step("agent_command", `{"command":"restart_collector"}`), true},
+		{step("agent_command", `{"command":"status"}`), false},
+		{step("set_status", `{"status":"resolved"}`), false},
+		{playbooks.Step{Type: "set_status", RequireApproval: true}, true},
+	}
+	for _, c := range cases {
+		if got := c.step.NeedsApproval(); got != c.want {
+			t.Errorf("%s %s: NeedsApproval = %v, want %v", c.step.Type, c.step.Params, got, c.want)
+		}
+	}
+}
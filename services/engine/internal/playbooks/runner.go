@@ -0,0 +1,330 @@
+package playbooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+)
+
+// ApprovalSubject is the NATS subject the API sends approvals and
+// rejections on; the request is an ApprovalRequest and the reply an
+// ApprovalReply.
+const ApprovalSubject = "playbooks.approve"
+
+type Config struct {
+	Workers   int
+	QueueSize int
+	// DefaultTimeout applies to steps without their own; no step may run
+	// longer than MaxTimeout.
+	DefaultTimeout time.Duration
+	MaxTimeout     time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:        2,
+		QueueSize:      100,
+		DefaultTimeout: 30 * time.Second,
+		MaxTimeout:     5 * time.Minute,
+	}
+}
+
+// Runner starts the playbooks matching each new alert and carries their
+// steps out in order. A step that needs approval parks the execution until
+// Approve is called for it.
+type Runner struct {
+	store   Store
+	actions Actions
+	cfg     Config
+	queue   chan alerts.Alert
+	wg      sync.WaitGroup
+}
+
+func New(store Store, actions Actions, cfg Config) *Runner {
+	def := DefaultConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+	if cfg.DefaultTimeout <= 0 {
+		cfg.DefaultTimeout = def.DefaultTimeout
+	}
+	if cfg.MaxTimeout <= 0 {
+		cfg.MaxTimeout = def.MaxTimeout
+	}
+	return &Runner{
+		store:   store,
+		actions: actions,
+		cfg:     cfg,
+		queue:   make(chan alerts.Alert, cfg.QueueSize),
+	}
+}
+
+// Trigger queues a new alert for playbook matching without blocking.
+func (r *Runner) Trigger(alert alerts.Alert) {
+	select {
+	case r.queue <- alert:
+	default:
+		log.Printf("playbooks: queue full, alert %s not matched against playbooks", alert.ID)
+	}
+}
+
+// Run processes queued alerts until ctx is cancelled, then waits for
+// executions resumed by Approve.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case alert := <-r.queue:
+					r.Start(ctx, alert)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	r.wg.Wait()
+}
+
+// Start runs every playbook that matches alert, one after another, and
+// returns the executions as they ended or paused.
+func (r *Runner) Start(ctx context.Context, alert alerts.Alert) []Execution {
+	playbooks, err := r.store.Playbooks(ctx, alert.OrgID)
+	if err != nil {
+		log.Printf("playbooks: load playbooks for org %s: %v", alert.OrgID, err)
+	}
+
+	// The execution keeps its own copy of the alert; the source events are
+	// already stored with the alert itself.
+	snapshot := alert
+	snapshot.SourceEvents = nil
+
+	var out []Execution
+	for _, p := range playbooks {
+		if !p.Matches(alert) || len(p.Steps) == 0 {
+			continue
+		}
+		now := time.Now()
+		e := Execution{
+			ID:           uuid.NewString(),
+			OrgID:        alert.OrgID,
+			PlaybookID:   p.ID,
+			PlaybookName: p.Name,
+			AlertID:      alert.ID,
+			Status:       StatusRunning,
+			Steps:        p.Steps,
+			Alert:        snapshot,
+			Outputs:      map[string]interface{}{},
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := r.store.CreateExecution(context.WithoutCancel(ctx), e); err != nil {
+			log.Printf("playbooks: record execution of %q for alert %s: %v", p.Name, alert.ID, err)
+			continue
+		}
+		log.Printf("playbooks: running %q for alert %s (execution %s)", p.Name, alert.ID, e.ID)
+		r.execute(ctx, &e, 0, false)
+		out = append(out, e)
+	}
+	return out
+}
+
+// Approve records an analyst's decision on the step an execution is
+// waiting at. An approved execution resumes in the background under ctx; a
+// rejected one ends there.
+func (r *Runner) Approve(ctx context.Context, orgID, executionID string, step int, approved bool, actor, reason string) (Execution, error) {
+	status := StatusRunning
+	if !approved {
+		status = StatusRejected
+	}
+	e, err := r.store.ClaimApproval(ctx, orgID, executionID, step, status)
+	if err != nil {
+		return Execution{}, err
+	}
+	if e.Outputs == nil {
+		e.Outputs = map[string]interface{}{}
+	}
+
+	now := time.Now()
+	run := StepRun{
+		ExecutionID: e.ID,
+		Index:       step,
+		Status:      StatusApproved,
+		Actor:       actor,
+		StartedAt:   now,
+		FinishedAt:  now,
+	}
+	if step < len(e.Steps) {
+		run.Name, run.Type = e.Steps[step].Name, e.Steps[step].Type
+	}
+	if reason != "" {
+		run.Output = map[string]interface{}{"reason": reason}
+	}
+	if !approved {
+		run.Status = StatusRejected
+		r.record(ctx, run)
+		e.Error = fmt.Sprintf("step %d (%s) rejected by %s", step+1, run.Name, actor)
+		r.finish(ctx, &e)
+		return e, nil
+	}
+	r.record(ctx, run)
+	log.Printf("playbooks: step %d of execution %s approved by %s", step+1, e.ID, actor)
+
+	resumed := e
+	resumed.Outputs = make(map[string]interface{}, len(e.Outputs))
+	for k, v := range e.Outputs {
+		resumed.Outputs[k] = v
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.execute(ctx, &resumed, step, true)
+	}()
+	return e, nil
+}
+
+type ApprovalRequest struct {
+	OrgID       string `json:"org_id"`
+	ExecutionID string `json:"execution_id"`
+	Step        int    `json:"step"`
+	Approved    bool   `json:"approved"`
+	Actor       string `json:"actor"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type ApprovalReply struct {
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HandleApproval applies the ApprovalRequest in data and returns the
+// encoded ApprovalReply.
+func (r *Runner) HandleApproval(ctx context.Context, data []byte) []byte {
+	var reply ApprovalReply
+	var req ApprovalRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		reply.Error = fmt.Sprintf("invalid approval request: %v", err)
+	} else if e, err := r.Approve(ctx, req.OrgID, req.ExecutionID, req.Step, req.Approved, req.Actor, req.Reason); err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.Status = e.Status
+	}
+	out, _ := json.Marshal(reply)
+	return out
+}
+
+// execute runs e's steps from index from. approved says the step at from
+// has already been approved.
+func (r *Runner) execute(ctx context.Context, e *Execution, from int, approved bool) {
+	for i := from; i < len(e.Steps); i++ {
+		step := e.Steps[i]
+		e.CurrentStep = i
+		if step.NeedsApproval() && !(approved && i == from) {
+			e.Status = StatusAwaitingApproval
+			r.save(ctx, e)
+			now := time.Now()
+			r.record(ctx, StepRun{
+				ExecutionID: e.ID,
+				Index:       i,
+				Name:        step.Name,
+				Type:        step.Type,
+				Status:      StatusAwaitingApproval,
+				StartedAt:   now,
+				FinishedAt:  now,
+			})
+			log.Printf("playbooks: execution %s waiting for approval of step %d (%s)", e.ID, i+1, step.Name)
+			return
+		}
+
+		run := r.runWithTimeout(ctx, e, step)
+		run.Index = i
+		r.record(ctx, run)
+		if run.Status == StatusSucceeded {
+			e.Outputs[step.Name] = run.Output
+		} else if !step.ContinueOnError {
+			e.Status = StatusFailed
+			e.Error = fmt.Sprintf("step %d (%s): %s", i+1, step.Name, run.Error)
+			r.finish(ctx, e)
+			return
+		}
+		r.save(ctx, e)
+	}
+	e.CurrentStep = len(e.Steps)
+	e.Status = StatusSucceeded
+	r.finish(ctx, e)
+}
+
+func (r *Runner) runWithTimeout(ctx context.Context, e *Execution, step Step) StepRun {
+	timeout := time.Duration(step.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = r.cfg.DefaultTimeout
+	}
+	if timeout > r.cfg.MaxTimeout {
+		timeout = r.cfg.MaxTimeout
+	}
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	run := StepRun{ExecutionID: e.ID, Name: step.Name, Type: step.Type, StartedAt: time.Now()}
+	output, err := r.runStep(stepCtx, e, step)
+	run.FinishedAt = time.Now()
+	run.Output = output
+	switch {
+	case errors.Is(stepCtx.Err(), context.DeadlineExceeded) || errors.Is(err, errTimedOut):
+		run.Status = StatusTimedOut
+		run.Error = fmt.Sprintf("step timed out after %s", timeout)
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			run.Error += ": " + err.Error()
+		}
+	case err != nil:
+		run.Status = StatusFailed
+		run.Error = err.Error()
+	default:
+		run.Status = StatusSucceeded
+	}
+	return run
+}
+
+// save, record and finish write through even once ctx is cancelled, so a
+// shutdown mid-step still leaves an accurate log.
+func (r *Runner) save(ctx context.Context, e *Execution) {
+	e.UpdatedAt = time.Now()
+	if err := r.store.UpdateExecution(context.WithoutCancel(ctx), *e); err != nil {
+		log.Printf("playbooks: save execution %s: %v", e.ID, err)
+	}
+}
+
+func (r *Runner) record(ctx context.Context, run StepRun) {
+	if err := r.store.RecordStep(context.WithoutCancel(ctx), run); err != nil {
+		log.Printf("playbooks: record step %d of execution %s: %v", run.Index+1, run.ExecutionID, err)
+	}
+}
+
+func (r *Runner) finish(ctx context.Context, e *Execution) {
+	now := time.Now()
+	e.CompletedAt = &now
+	r.save(ctx, e)
+	log.Printf("playbooks: execution %s of %q %s %s", e.ID, e.PlaybookName, e.Status, e.Error)
+}
+
+func timeUntil(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return time.Until(t)
+}
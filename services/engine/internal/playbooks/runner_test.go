@@ -0,0 +1,301 @@
+package playbooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/playbooks"
+)
+
+type fakeCommands struct {
+	mu     sync.Mutex
+	sent   []playbooks.AgentCommand
+	result playbooks.CommandResult
+	block  bool
+}
+
+func (f *fakeCommands) SendCommand(ctx context.Context, cmd playbooks.AgentCommand) (playbooks.CommandResult, error) {
+	f.mu.Lock()
+	f.sent = append(f.sent, cmd)
+	f.mu.Unlock()
+	if f.block {
+		<-ctx.Done()
+		return playbooks.CommandResult{}, ctx.Err()
+	}
+	return f.result, nil
+}
+
+func (f *fakeCommands) commands() []playbooks.AgentCommand {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]playbooks.AgentCommand(nil), f.sent...)
+}
+
+type fakeAlerts struct {
+	mu       sync.Mutex
+	status   string
+	assignee string
+}
+
+func (f *fakeAlerts) SetStatus(ctx context.Context, orgID, alertID, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+	return nil
+}
+
+func (f *fakeAlerts) Assign(ctx context.Context, orgID, alertID, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.assignee = userID
+	return nil
+}
+
+type fakeEnricher struct{}
+
+func (fakeEnricher) Enrich(ctx context.Context, alert alerts.Alert, lookups []string) (map[string]interface{}, error) {
+	return map[string]interface{}{"agent": map[string]interface{}{"hostname": "web-1"}}, nil
+}
+
+func step(name, typ, params string) playbooks.Step {
+	return playbooks.Step{Name: name, Type: typ, Params: json.RawMessage(params)}
+}
+
+func playbook(steps ...playbooks.Step) playbooks.Playbook {
+	return playbooks.Playbook{
+		ID:         "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d",
+		OrgID:      testOrg,
+		Name:       "contain brute force",
+		Enabled:    true,
+		Conditions: playbooks.Conditions{Rules: []string{"brute_force_attack"}},
+		Steps:      steps,
+	}
+}
+
+func statuses(runs []playbooks.StepRun) []string {
+	var out []string
+	for _, r := range runs {
+		out = append(out, r.Name+":"+r.Status)
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// waitFor polls the store until the execution reaches status.
+func waitFor(t *testing.T, store *playbooks.MemoryStore, id, status string) playbooks.Execution {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		e, _ := store.Execution(id)
+		if e.Status == status {
+			return e
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("execution %s is %q, want %q", id, e.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunsStepsInOrder(t *testing.T) {
+	store := playbooks.NewMemoryStore(playbook(
+		step("lookup", "enrich", `{"lookups":["agent"]}`),
+		step("ack", "set_status", `{"status":"acknowledged"}`),
+		step("owner", "assign", `{"assignee_id":"0b9a8c7d-6e5f-4a3b-9c2d-1e0f2a3b4c5d"}`),
+	))
+	updates := &fakeAlerts{}
+	r := playbooks.New(store, playbooks.Actions{Enricher: fakeEnricher{}, Alerts: updates}, playbooks.Config{})
+
+	execs := r.Start(context.Background(), bruteForceAlert())
+	if len(execs) != 1 {
+		t.Fatalf("started %d executions, want 1", len(execs))
+	}
+	e := execs[0]
+	if e.Status != playbooks.StatusSucceeded || e.CompletedAt == nil {
+		t.Fatalf("status = %q (%s), want succeeded and completed", e.Status, e.Error)
+	}
+	if _, ok := e.Outputs["lookup"]; !ok {
+		t.Errorf("outputs = %v, want the enrich output under its step name", e.Outputs)
+	}
+	if updates.status != "acknowledged" || updates.assignee != "0b9a8c7d-6e5f-4a3b-9c2d-1e0f2a3b4c5d" {
+		t.Errorf("alert updates = %q, %q", updates.status, updates.assignee)
+	}
+	want := []string{"lookup:succeeded", "ack:succeeded", "owner:succeeded"}
+	if got := statuses(store.Steps(e.ID)); !equal(got, want) {
+		t.Errorf("step log = %v, want %v", got, want)
+	}
+}
+
+func TestNonMatchingPlaybookDoesNotRun(t *testing.T) {
+	p := playbook(step("ack", "set_status", `{"status":"acknowledged"}`))
+	p.Conditions.MinSeverity = "critical"
+	r := playbooks.New(playbooks.NewMemoryStore(p), playbooks.Actions{Alerts: &fakeAlerts{}}, playbooks.Config{})
+	if execs := r.Start(context.Background(), bruteForceAlert()); len(execs) != 0 {
+		t.Errorf("started %d executions for a high alert, want 0", len(execs))
+	}
+}
+
+func TestBlockWaitsForApproval(t *testing.T) {
+	store := playbooks.NewMemoryStore(playbook(
+		step("lookup", "enrich", ``),
+		step("block", "agent_command", `{"command":"block_ip","args":{"ip":"{{field \"group_key.payload.src_ip\"}}","ttl_seconds":3600}}`),
+		step("ack", "set_status", `{"status":"acknowledged"}`),
+	))
+	cmds := &fakeCommands{result: playbooks.CommandResult{Status: "succeeded", Output: json.RawMessage(`{"ip":"203.0.113.7"}`)}}
+	updates := &fakeAlerts{}
+	r := playbooks.New(store, playbooks.Actions{Enricher: fakeEnricher{}, Commands: cmds, Alerts: updates}, playbooks.Config{})
+
+	e := r.Start(context.Background(), bruteForceAlert())[0]
+	if e.Status != playbooks.StatusAwaitingApproval || e.CurrentStep != 1 {
+		t.Fatalf("status = %q at step %d, want awaiting_approval at 1", e.Status, e.CurrentStep)
+	}
+	if len(cmds.commands()) != 0 {
+		t.Fatal("block_ip was sent before approval")
+	}
+
+	if _, err := r.Approve(context.Background(), testOrg, e.ID, 2, true, "analyst@example.com", ""); !errors.Is(err, playbooks.ErrNotAwaitingApproval) {
+		t.Errorf("approving the wrong step: err = %v, want ErrNotAwaitingApproval", err)
+	}
+	if _, err := r.Approve(context.Background(), testOrg, e.ID, 1, true, "analyst@example.com", "confirmed attacker"); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if _, err := r.Approve(context.Background(), testOrg, e.ID, 1, true, "other@example.com", ""); !errors.Is(err, playbooks.ErrNotAwaitingApproval) {
+		t.Errorf("second approval: err = %v, want ErrNotAwaitingApproval", err)
+	}
+
+	done := waitFor(t, store, e.ID, playbooks.StatusSucceeded)
+	sent := cmds.commands()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d commands, want 1", len(sent))
+	}
+	var args map[string]interface{}
+	json.Unmarshal(sent[0].Args, &args)
+	if args["ip"] != "203.0.113.7" || args["ttl_seconds"] != 3600.0 {
+		t.Errorf("args = %s, want the rendered source ip and ttl", sent[0].Args)
+	}
+	if sent[0].AgentID != testAgent || sent[0].RequestedBy != "playbook:contain brute force" || sent[0].ExecutionID != e.ID {
+		t.Errorf("command = %+v", sent[0])
+	}
+	if _, ok := done.Outputs["lookup"]; !ok {
+		t.Error("outputs from before the approval were lost")
+	}
+	want := []string{"lookup:succeeded", "block:awaiting_approval", "block:approved", "block:succeeded", "ack:succeeded"}
+	if got := statuses(store.Steps(e.ID)); !equal(got, want) {
+		t.Errorf("step log = %v, want %v", got, want)
+	}
+	if runs := store.Steps(e.ID); runs[2].Actor != "analyst@example.com" {
+		t.Errorf("approval actor = %q", runs[2].Actor)
+	}
+}
+
+func TestRejectEndsExecution(t *testing.T) {
+	store := playbooks.NewMemoryStore(playbook(
+		step("block", "agent_command", `{"command":"block_ip","args":{"ip":"203.0.113.7"}}`),
+		step("ack", "set_status", `{"status":"acknowledged"}`),
+	))
+	cmds := &fakeCommands{}
+	r := playbooks.New(store, playbooks.Actions{Commands: cmds, Alerts: &fakeAlerts{}}, playbooks.Config{})
+
+	e := r.Start(context.Background(), bruteForceAlert())[0]
+	got, err := r.Approve(context.Background(), testOrg, e.ID, 0, false, "analyst@example.com", "false positive")
+	if err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	if got.Status != playbooks.StatusRejected || got.CompletedAt == nil {
+		t.Errorf("status = %q, want rejected and completed", got.Status)
+	}
+	if len(cmds.commands()) != 0 {
+		t.Error("rejected command was sent")
+	}
+	want := []string{"block:awaiting_approval", "block:rejected"}
+	if got := statuses(store.Steps(e.ID)); !equal(got, want) {
+		t.Errorf("step log = %v, want %v", got, want)
+	}
+}
+
+func TestApprovalIsScopedToOrg(t *testing.T) {
+	store := playbooks.NewMemoryStore(playbook(step("block", "agent_command", `{"command":"block_ip"}`)))
+	r := playbooks.New(store, playbooks.Actions{Commands: &fakeCommands{}}, playbooks.Config{})
+	e := r.Start(context.Background(), bruteForceAlert())[0]
+
+	req, _ := json.Marshal(playbooks.ApprovalRequest{
+		OrgID: "00000000-0000-0000-0000-000000000001", ExecutionID: e.ID, Step: 0, Approved: true, Actor: "x",
+	})
+	var reply playbooks.ApprovalReply
+	json.Unmarshal(r.HandleApproval(context.Background(), req), &reply)
+	if reply.Error == "" {
+		t.Error("another org approved the execution")
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	store := playbooks.NewMemoryStore(playbook(step("status", "agent_command", `{"command":"status"}`)))
+	cmds := &fakeCommands{block: true}
+	r := playbooks.New(store, playbooks.Actions{Commands: cmds}, playbooks.Config{DefaultTimeout: 50 * time.Millisecond})
+
+	e := r.Start(context.Background(), bruteForceAlert())[0]
+	if e.Status != playbooks.StatusFailed {
+		t.Fatalf("status = %q, want failed", e.Status)
+	}
+	runs := store.Steps(e.ID)
+	if len(runs) != 1 || runs[0].Status != playbooks.StatusTimedOut {
+		t.Errorf("step log = %v, want one timed_out run", statuses(runs))
+	}
+}
+
+func TestContinueOnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	hook := step("ticket", "webhook", `{"url":"`+srv.URL+`"}`)
+	hook.ContinueOnError = true
+	store := playbooks.NewMemoryStore(playbook(hook, step("ack", "set_status", `{"status":"acknowledged"}`)))
+	r := playbooks.New(store, playbooks.Actions{Alerts: &fakeAlerts{}}, playbooks.Config{})
+
+	e := r.Start(context.Background(), bruteForceAlert())[0]
+	if e.Status != playbooks.StatusSucceeded {
+		t.Fatalf("status = %q (%s), want succeeded", e.Status, e.Error)
+	}
+	want := []string{"ticket:failed", "ack:succeeded"}
+	if got := statuses(store.Steps(e.ID)); !equal(got, want) {
+		t.Errorf("step log = %v, want %v", got, want)
+	}
+}
+
+func TestFailedStepStopsExecution(t *testing.T) {
+	store := playbooks.NewMemoryStore(playbook(
+		step("status", "agent_command", `{"command":"status"}`),
+		step("ack", "set_status", `{"status":"acknowledged"}`),
+	))
+	cmds := &fakeCommands{result: playbooks.CommandResult{Status: "failed", Error: "agent is not connected"}}
+	updates := &fakeAlerts{}
+	r := playbooks.New(store, playbooks.Actions{Commands: cmds, Alerts: updates}, playbooks.Config{})
+
+	e := r.Start(context.Background(), bruteForceAlert())[0]
+	if e.Status != playbooks.StatusFailed || e.CurrentStep != 0 {
+		t.Errorf("status = %q at step %d, want failed at 0", e.Status, e.CurrentStep)
+	}
+	if updates.status != "" {
+		t.Error("step after the failure ran")
+	}
+}
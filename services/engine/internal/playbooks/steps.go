@@ -0,0 +1,344 @@
+package playbooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/notify"
+)
+
+// Enricher gathers context about an alert. Lookups name what to gather,
+// such as "agent" or "related_alerts".
+type Enricher interface {
+	Enrich(ctx context.Context, alert alerts.Alert, lookups []string) (map[string]interface{}, error)
+}
+
+// Notifier sends an alert through the channels of one alert rule, as
+// notify.Dispatcher does.
+type Notifier interface {
+	NotifyRule(ctx context.Context, alert alerts.Alert, ruleID string) ([]notify.Delivery, error)
+}
+
+type CommandSender interface {
+	SendCommand(ctx context.Context, cmd AgentCommand) (CommandResult, error)
+}
+
+type AlertUpdater interface {
+	SetStatus(ctx context.Context, orgID, alertID, status string) error
+	Assign(ctx context.Context, orgID, alertID, userID string) error
+}
+
+// Actions are what steps act through. A step whose action is nil fails.
+type Actions struct {
+	Enricher Enricher
+	Notifier Notifier
+	Commands CommandSender
+	Alerts   AlertUpdater
+	// Secrets opens webhook URLs and headers the API sealed; it may be nil
+	// when no SECRETS_KEY is configured.
+	Secrets *secrets.Box
+	Client  *http.Client
+}
+
+var errTimedOut = errors.New("timed out")
+
+var validAlertStatuses = map[string]bool{
+	"open":         true,
+	"acknowledged": true,
+	"resolved":     true,
+	"escalated":    true,
+}
+
+// templateData is what step parameters are rendered with. Outputs holds
+// the output of each earlier step by step name.
+type templateData struct {
+	Alert   alerts.Alert
+	Outputs map[string]interface{}
+}
+
+func (r *Runner) runStep(ctx context.Context, e *Execution, step Step) (interface{}, error) {
+	data := templateData{Alert: e.Alert, Outputs: e.Outputs}
+	switch step.Type {
+	case StepEnrich:
+		var p struct {
+			Lookups []string `json:"lookups"`
+		}
+		if err := decodeParams(step.Params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.Lookups) == 0 {
+			p.Lookups = []string{"agent", "related_alerts"}
+		}
+		if r.actions.Enricher == nil {
+			return nil, errors.New("enrichment is not configured")
+		}
+		return r.actions.Enricher.Enrich(ctx, e.Alert, p.Lookups)
+
+	case StepNotify:
+		var p struct {
+			RuleID string `json:"rule_id"`
+		}
+		if err := decodeParams(step.Params, &p); err != nil {
+			return nil, err
+		}
+		if r.actions.Notifier == nil {
+			return nil, errors.New("notifications are not configured")
+		}
+		deliveries, err := r.actions.Notifier.NotifyRule(ctx, e.Alert, p.RuleID)
+		out := make([]map[string]interface{}, 0, len(deliveries))
+		for _, d := range deliveries {
+			out = append(out, map[string]interface{}{
+				"channel":  d.Channel,
+				"target":   d.Target,
+				"status":   d.Status,
+				"attempts": d.Attempts,
+				"error":    d.Error,
+			})
+		}
+		return map[string]interface{}{"rule_id": p.RuleID, "deliveries": out}, err
+
+	case StepWebhook:
+		return r.callWebhook(ctx, e, step)
+
+	case StepAgentCommand:
+		var p struct {
+			Command string          `json:"command"`
+			Args    json.RawMessage `json:"args"`
+			AgentID string          `json:"agent_id"`
+		}
+		if err := decodeParams(step.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.Command == "" {
+			return nil, errors.New("command is required")
+		}
+		agentID, err := render(p.AgentID, data)
+		if err != nil {
+			return nil, err
+		}
+		if agentID == "" {
+			agentID = e.Alert.AgentID
+		}
+		if agentID == "" {
+			return nil, errors.New("the alert has no agent and the step names none")
+		}
+		args, err := renderArgs(p.Args, data)
+		if err != nil {
+			return nil, err
+		}
+		if r.actions.Commands == nil {
+			return nil, errors.New("agent commands are not configured")
+		}
+		deadline, _ := ctx.Deadline()
+		result, err := r.actions.Commands.SendCommand(ctx, AgentCommand{
+			OrgID:       e.OrgID,
+			AgentID:     agentID,
+			ExecutionID: e.ID,
+			Command:     p.Command,
+			Args:        args,
+			TimeoutMS:   timeUntil(deadline).Milliseconds(),
+			RequestedBy: "playbook:" + e.PlaybookName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		out := map[string]interface{}{"agent_id": agentID, "command": p.Command, "output": result.Output}
+		switch result.Status {
+		case "succeeded":
+			return out, nil
+		case "timed_out":
+			return out, fmt.Errorf("agent %w: %s", errTimedOut, result.Error)
+		default:
+			return out, fmt.Errorf("agent reported: %s", result.Error)
+		}
+
+	case StepSetStatus:
+		var p struct {
+			Status string `json:"status"`
+		}
+		if err := decodeParams(step.Params, &p); err != nil {
+			return nil, err
+		}
+		if !validAlertStatuses[p.Status] {
+			return nil, fmt.Errorf("invalid alert status %q", p.Status)
+		}
+		if r.actions.Alerts == nil {
+			return nil, errors.New("alert updates are not configured")
+		}
+		if err := r.actions.Alerts.SetStatus(ctx, e.OrgID, e.AlertID, p.Status); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"status": p.Status}, nil
+
+	case StepAssign:
+		var p struct {
+			AssigneeID string `json:"assignee_id"`
+		}
+		if err := decodeParams(step.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.AssigneeID == "" {
+			return nil, errors.New("assignee_id is required")
+		}
+		if r.actions.Alerts == nil {
+			return nil, errors.New("alert updates are not configured")
+		}
+		if err := r.actions.Alerts.Assign(ctx, e.OrgID, e.AlertID, p.AssigneeID); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"assignee_id": p.AssigneeID}, nil
+	}
+	return nil, fmt.Errorf("unknown step type %q", step.Type)
+}
+
+// callWebhook posts the execution so far to the step's URL. Any non-2xx
+// response fails the step.
+func (r *Runner) callWebhook(ctx context.Context, e *Execution, step Step) (interface{}, error) {
+	var p struct {
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+	}
+	if err := decodeParams(step.Params, &p); err != nil {
+		return nil, err
+	}
+	url, err := r.actions.Secrets.Open(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("open url: %w", err)
+	}
+	if url == "" {
+		return nil, errors.New("url is required")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"execution_id": e.ID,
+		"playbook":     e.PlaybookName,
+		"step":         step.Name,
+		"alert":        e.Alert,
+		"outputs":      e.Outputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.Headers {
+		if v, err = r.actions.Secrets.Open(v); err != nil {
+			return nil, fmt.Errorf("open header %s: %w", k, err)
+		}
+		req.Header.Set(k, v)
+	}
+
+	client := r.actions.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	out := map[string]interface{}{"status_code": resp.StatusCode}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return out, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return out, nil
+}
+
+func decodeParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// render expands a text/template in s. Besides the usual fields it offers
+// field, which looks up a payload path of the alert.
+func render(s string, data templateData) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	funcs := template.FuncMap{
+		"field": func(path string) interface{} {
+			v, _ := Field(data.Alert.Payload, path)
+			return v
+		},
+	}
+	for k, v := range templateFuncs {
+		funcs[k] = v
+	}
+	t, err := template.New("param").Option("missingkey=zero").Funcs(funcs).Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("parse template %q: %w", s, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render template %q: %w", s, err)
+	}
+	out := buf.String()
+	if out == "<no value>" {
+		out = ""
+	}
+	return out, nil
+}
+
+// renderArgs renders every string in a JSON value, leaving the rest as is.
+func renderArgs(raw json.RawMessage, data templateData) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return json.RawMessage(`{}`), nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("invalid args: %w", err)
+	}
+	var walk func(v interface{}) (interface{}, error)
+	walk = func(v interface{}) (interface{}, error) {
+		switch x := v.(type) {
+		case string:
+			return render(x, data)
+		case map[string]interface{}:
+			for k, item := range x {
+				rendered, err := walk(item)
+				if err != nil {
+					return nil, err
+				}
+				x[k] = rendered
+			}
+		case []interface{}:
+			for i, item := range x {
+				rendered, err := walk(item)
+				if err != nil {
+					return nil, err
+				}
+				x[i] = rendered
+			}
+		}
+		return v, nil
+	}
+	v, err := walk(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,147 @@
+package playbooks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
+)
+
+const (
+	StatusRunning          = "running"
+	StatusAwaitingApproval = "awaiting_approval"
+	StatusSucceeded        = "succeeded"
+	StatusFailed           = "failed"
+	StatusTimedOut         = "timed_out"
+	StatusRejected         = "rejected"
+	StatusApproved         = "approved"
+)
+
+var ErrNotAwaitingApproval = errors.New("execution is not awaiting approval of that step")
+
+// Execution is one run of a playbook against an alert. It carries copies of
+// the steps and the alert as they were when the run started, so a run that
+// waits for approval resumes with what the approver saw.
+type Execution struct {
+	ID           string                 `json:"id"`
+	OrgID        string                 `json:"org_id"`
+	PlaybookID   string                 `json:"playbook_id"`
+	PlaybookName string                 `json:"playbook_name"`
+	AlertID      string                 `json:"alert_id"`
+	Status       string                 `json:"status"`
+	CurrentStep  int                    `json:"current_step"`
+	Steps        []Step                 `json:"steps"`
+	Alert        alerts.Alert           `json:"alert"`
+	Outputs      map[string]interface{} `json:"outputs"`
+	Error        string                 `json:"error,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	CompletedAt  *time.Time             `json:"completed_at,omitempty"`
+}
+
+// StepRun is one entry of an execution's log: a step finishing, or waiting
+// for, receiving or being refused approval.
+type StepRun struct {
+	ExecutionID string      `json:"execution_id"`
+	Index       int         `json:"step_index"`
+	Name        string      `json:"step_name"`
+	Type        string      `json:"step_type"`
+	Status      string      `json:"status"`
+	Output      interface{} `json:"output,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	// Actor is who approved or rejected the step.
+	Actor      string    `json:"actor,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type Store interface {
+	// Playbooks returns the org's enabled playbooks.
+	Playbooks(ctx context.Context, orgID string) ([]Playbook, error)
+	CreateExecution(ctx context.Context, e Execution) error
+	UpdateExecution(ctx context.Context, e Execution) error
+	RecordStep(ctx context.Context, r StepRun) error
+	// ClaimApproval moves an execution waiting at step to status, running
+	// or rejected, and returns it. Only one caller can claim a given wait;
+	// the rest get ErrNotAwaitingApproval.
+	ClaimApproval(ctx context.Context, orgID, executionID string, step int, status string) (Execution, error)
+}
+
+// MemoryStore keeps playbooks and executions in process, for tests and
+// deployments without a database.
+type MemoryStore struct {
+	mu         sync.Mutex
+	playbooks  []Playbook
+	executions map[string]Execution
+	steps      []StepRun
+}
+
+func NewMemoryStore(playbooks ...Playbook) *MemoryStore {
+	return &MemoryStore{playbooks: playbooks, executions: make(map[string]Execution)}
+}
+
+func (m *MemoryStore) Playbooks(ctx context.Context, orgID string) ([]Playbook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Playbook
+	for _, p := range m.playbooks {
+		if p.Enabled && (p.OrgID == "" || p.OrgID == orgID) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) CreateExecution(ctx context.Context, e Execution) error {
+	return m.UpdateExecution(ctx, e)
+}
+
+func (m *MemoryStore) UpdateExecution(ctx context.Context, e Execution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.executions[e.ID] = e
+	return nil
+}
+
+func (m *MemoryStore) RecordStep(ctx context.Context, r StepRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.steps = append(m.steps, r)
+	return nil
+}
+
+func (m *MemoryStore) ClaimApproval(ctx context.Context, orgID, executionID string, step int, status string) (Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.executions[executionID]
+	if !ok || e.OrgID != orgID || e.Status != StatusAwaitingApproval || e.CurrentStep != step {
+		return Execution{}, ErrNotAwaitingApproval
+	}
+	e.Status = status
+	e.UpdatedAt = time.Now()
+	m.executions[executionID] = e
+	return e, nil
+}
+
+// Execution returns the stored execution.
+func (m *MemoryStore) Execution(id string) (Execution, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.executions[id]
+	return e, ok
+}
+
+// Steps returns the step log of an execution in the order it was written.
+func (m *MemoryStore) Steps(executionID string) []StepRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []StepRun
+	for _, r := range m.steps {
+		if r.ExecutionID == executionID {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,199 @@
+package rules
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+)
+
+const RuleSet = "rules"
+
+func isRuleFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yml", ".yaml", ".json":
+		return true
+	}
+	return false
+}
+
+func ruleFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || !isRuleFile(e.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, e.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// LoadDir parses every rule file in dir. All files are checked before
+// returning, and any problems come back together as Errors. Rule names must
+// be unique across files and must not reuse a built-in rule's name, whose
+// correlation state they would otherwise share.
+func LoadDir(dir string) ([]Spec, error) {
+	files, err := ruleFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read rules dir: %w", err)
+	}
+
+	var specs []Spec
+	var errs Errors
+	seen := make(map[string]Spec)
+	builtin := make(map[string]bool)
+	for _, name := range correlation.BuiltinRuleNames() {
+		builtin[name] = true
+	}
+
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, &Error{File: path, Msg: err.Error()})
+			continue
+		}
+		parsed, err := Parse(path, data)
+		if err != nil {
+			var perrs Errors
+			if errors.As(err, &perrs) {
+				errs = append(errs, perrs...)
+			} else {
+				errs = append(errs, &Error{File: path, Msg: err.Error()})
+			}
+			continue
+		}
+		for _, spec := range parsed {
+			if builtin[spec.Name] {
+				errs = append(errs, &Error{
+					File: spec.File,
+					Line: spec.Line,
+					Msg:  fmt.Sprintf("rule name %q is already used by a built-in rule", spec.Name),
+				})
+				continue
+			}
+			if prev, dup := seen[spec.Name]; dup {
+				errs = append(errs, &Error{
+					File: spec.File,
+					Line: spec.Line,
+					Msg:  fmt.Sprintf("duplicate rule name %q (first defined at %s:%d)", spec.Name, prev.File, prev.Line),
+				})
+				continue
+			}
+			seen[spec.Name] = spec
+			specs = append(specs, spec)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return specs, nil
+}
+
+// CompileAll compiles the enabled specs.
+func CompileAll(specs []Spec) []correlation.Rule {
+	out := make([]correlation.Rule, 0, len(specs))
+	for _, s := range specs {
+		if s.Enabled {
+			out = append(out, Compile(s))
+		}
+	}
+	return out
+}
+
+// Watcher keeps a correlator's file-based rule set in sync with a directory.
+// A reload that fails validation is logged and the previous rules stay
+// active.
+type Watcher struct {
+	dir         string
+	correlator  *correlation.Correlator
+	interval    time.Duration
+	fingerprint string
+	pending     string
+}
+
+func NewWatcher(dir string, correlator *correlation.Correlator, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &Watcher{dir: dir, correlator: correlator, interval: interval}
+}
+
+// Load applies the current directory contents once.
+func (w *Watcher) Load() (int, error) {
+	fp, err := w.snapshot()
+	if err != nil {
+		return 0, err
+	}
+	specs, err := LoadDir(w.dir)
+	if err != nil {
+		return 0, err
+	}
+	compiled := CompileAll(specs)
+	w.correlator.SetRules(RuleSet, compiled)
+	w.fingerprint = fp
+	return len(compiled), nil
+}
+
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fp, err := w.snapshot()
+			if err != nil || fp == w.fingerprint {
+				w.pending = ""
+				continue
+			}
+			// Wait for the directory to look the same on two consecutive
+			// polls so a file caught mid-write isn't loaded half-empty.
+			if fp != w.pending {
+				w.pending = fp
+				continue
+			}
+			w.pending = ""
+			n, err := w.Load()
+			if err != nil {
+				log.Printf("rules: reload of %s failed, keeping previous rules:\n%v", w.dir, err)
+				w.fingerprint = fp
+				continue
+			}
+			log.Printf("rules: reloaded %d rules from %s", n, w.dir)
+		}
+	}
+}
+
+// snapshot fingerprints the rule files by name, size and mtime so polling
+// doesn't have to re-read and re-parse unchanged files.
+func (w *Watcher) snapshot() (string, error) {
+	files, err := ruleFiles(w.dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s|%d|%d\n", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
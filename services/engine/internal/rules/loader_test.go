@@ -0,0 +1,119 @@
+package rules_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/rules"
+)
+
+const webRule = `
+- name: web_probe
+  severity: medium
+  window: 5m
+  threshold: 2
+  match: {category: web_error}
+`
+
+func writeRule(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDirReportsDuplicatesAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeRule(t, filepath.Join(dir, "a.yml"), webRule)
+	writeRule(t, filepath.Join(dir, "b.yaml"), webRule)
+	writeRule(t, filepath.Join(dir, "notes.txt"), "not a rule file")
+
+	_, err := rules.LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "duplicate rule name") {
+		t.Fatalf("expected duplicate name error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "b.yaml:2") {
+		t.Errorf("expected duplicate to point at b.yaml:2, got %v", err)
+	}
+}
+
+func TestLoadDirRejectsBuiltinNames(t *testing.T) {
+	dir := t.TempDir()
+	writeRule(t, filepath.Join(dir, "a.yml"), strings.Replace(webRule, "web_probe", "brute_force_attack", 1))
+
+	_, err := rules.LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "built-in rule") || !strings.Contains(err.Error(), "a.yml:2") {
+		t.Fatalf("expected built-in name collision at a.yml:2, got %v", err)
+	}
+}
+
+func TestLoadDirExamples(t *testing.T) {
+	specs, err := rules.LoadDir("../../rules")
+	if err != nil {
+		t.Fatalf("example rules failed validation:\n%v", err)
+	}
+	if len(specs) == 0 {
+		t.Error("expected example rules")
+	}
+}
+
+func TestWatcherHotReload(t *testing.T) {
+	dir := t.TempDir()
+	writeRule(t, filepath.Join(dir, "web.yml"), webRule)
+
+	c := correlation.New(1000)
+	base := c.RuleCount()
+
+	w := rules.NewWatcher(dir, c, 10*time.Millisecond)
+	n, err := w.Load()
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 rule loaded, got %d (%v)", n, err)
+	}
+	if c.RuleCount() != base+1 {
+		t.Fatalf("expected %d rules, got %d", base+1, c.RuleCount())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	// A broken edit keeps the previous rules.
+	writeRule(t, filepath.Join(dir, "web.yml"), "- name: web_probe\n  severity: nope\n")
+	time.Sleep(100 * time.Millisecond)
+	if c.RuleCount() != base+1 {
+		t.Fatalf("expected previous rules to survive a bad reload, got %d", c.RuleCount())
+	}
+
+	writeRule(t, filepath.Join(dir, "web.yml"), webRule+`
+- name: cloud_noise
+  severity: low
+  window: 1m
+  match: {source: cloud}
+`)
+	deadline := time.Now().Add(2 * time.Second)
+	for c.RuleCount() != base+2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected reload to %d rules, got %d", base+2, c.RuleCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	now := time.Now()
+	c.Process(core.Event{Time: now, OrgID: "org-1", Category: "web_error"})
+	c.Process(core.Event{Time: now, OrgID: "org-1", Category: "web_error"})
+	found := false
+	for _, r := range c.GetResults() {
+		if r.Rule == "web_probe" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected loaded rule to fire")
+	}
+}
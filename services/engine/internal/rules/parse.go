@@ -0,0 +1,441 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+)
+
+// Error is a problem found in a rule file, pinned to the line it came from.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Msg)
+}
+
+// Errors collects every problem found while loading, so a validation run
+// reports all of them rather than stopping at the first.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var (
+	namePattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9_\-]*$`)
+	yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+)
+
+var severities = map[string]int{
+	"info":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+type Spec struct {
+	Name        string
+	Description string
+	Severity    string
+	Category    string
+	Window      time.Duration
+	Threshold   int
+	GroupBy     []string
+	Match       Matcher
+	Sequence    []Step
+	Enabled     bool
+	File        string
+	Line        int
+}
+
+type Step struct {
+	Match Matcher
+	Count int
+}
+
+type parser struct {
+	file string
+	errs Errors
+}
+
+func (p *parser) errorf(n *yaml.Node, format string, args ...interface{}) {
+	line := 0
+	if n != nil {
+		line = n.Line
+	}
+	p.errs = append(p.errs, &Error{File: p.file, Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// Parse reads rule definitions from YAML (or JSON, which is valid YAML). A
+// document is either a list of rules or a mapping with a "rules" list.
+func Parse(file string, data []byte) ([]Spec, error) {
+	p := &parser{file: file}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		msg := strings.TrimPrefix(err.Error(), "yaml: ")
+		msg = yamlLinePattern.ReplaceAllString(msg, "")
+		msg = strings.TrimLeft(msg, ": ")
+		return nil, Errors{{File: file, Line: syntaxErrorLine(data, err), Msg: "syntax error: " + msg}}
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	root := doc.Content[0]
+	var list *yaml.Node
+	switch root.Kind {
+	case yaml.SequenceNode:
+		list = root
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			key, val := root.Content[i], root.Content[i+1]
+			if key.Value != "rules" {
+				p.errorf(key, "unknown top-level key %q", key.Value)
+				continue
+			}
+			if val.Kind != yaml.SequenceNode {
+				p.errorf(val, "rules must be a list")
+				continue
+			}
+			list = val
+		}
+		if list == nil && len(p.errs) == 0 {
+			p.errorf(root, "expected a \"rules\" list")
+		}
+	default:
+		p.errorf(root, "expected a list of rules")
+	}
+
+	var specs []Spec
+	if list != nil {
+		for _, n := range list.Content {
+			if spec, ok := p.parseRule(n); ok {
+				specs = append(specs, spec)
+			}
+		}
+	}
+
+	if len(p.errs) > 0 {
+		return nil, p.errs
+	}
+	return specs, nil
+}
+
+// syntaxErrorLine finds the first line at which the document stops parsing.
+// yaml.v3 reports the line where the enclosing block started rather than
+// the offending line, which is not much help in a long rule list.
+func syntaxErrorLine(data []byte, err error) int {
+	lines := strings.SplitAfter(string(data), "\n")
+	var prefix strings.Builder
+	for i, l := range lines {
+		prefix.WriteString(l)
+		var n yaml.Node
+		if yaml.Unmarshal([]byte(prefix.String()), &n) != nil {
+			return i + 1
+		}
+	}
+	if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+	return 0
+}
+
+func (p *parser) parseRule(n *yaml.Node) (Spec, bool) {
+	spec := Spec{Threshold: 1, Enabled: true, File: p.file, Line: n.Line, Category: "custom"}
+	if n.Kind != yaml.MappingNode {
+		p.errorf(n, "rule must be a mapping")
+		return spec, false
+	}
+
+	before := len(p.errs)
+	var matchNode, seqKey, windowNode *yaml.Node
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		switch key.Value {
+		case "name":
+			spec.Name = p.scalar(val, "name")
+			if spec.Name != "" && !namePattern.MatchString(spec.Name) {
+				p.errorf(val, "invalid rule name %q: use lowercase letters, digits, '_' or '-'", spec.Name)
+			}
+		case "description":
+			spec.Description = p.scalar(val, "description")
+		case "severity":
+			spec.Severity = p.scalar(val, "severity")
+			if _, ok := severities[spec.Severity]; !ok || spec.Severity == "info" {
+				p.errorf(val, "invalid severity %q: must be low, medium, high or critical", spec.Severity)
+			}
+		case "category":
+			spec.Category = p.scalar(val, "category")
+		case "window":
+			windowNode = val
+			spec.Window = p.duration(val)
+		case "threshold":
+			spec.Threshold = p.positiveInt(val, "threshold")
+		case "group_by":
+			spec.GroupBy = p.fieldList(val)
+		case "enabled":
+			spec.Enabled = p.boolean(val, "enabled")
+		case "match":
+			matchNode = val
+			spec.Match = p.parseMatcher(val)
+		case "sequence":
+			seqKey = key
+			spec.Sequence = p.parseSequence(val)
+		default:
+			p.errorf(key, "unknown rule key %q", key.Value)
+		}
+	}
+
+	if spec.Name == "" {
+		p.errorf(n, "rule is missing a name")
+	}
+	if spec.Severity == "" {
+		p.errorf(n, "rule %q is missing a severity", spec.Name)
+	}
+	if windowNode == nil {
+		p.errorf(n, "rule %q is missing a window", spec.Name)
+	}
+	switch {
+	case matchNode == nil && seqKey == nil:
+		p.errorf(n, "rule %q needs either match or sequence", spec.Name)
+	case matchNode != nil && seqKey != nil:
+		p.errorf(seqKey, "rule %q cannot have both match and sequence", spec.Name)
+	}
+
+	return spec, len(p.errs) == before
+}
+
+func (p *parser) parseSequence(n *yaml.Node) []Step {
+	if n.Kind != yaml.SequenceNode {
+		p.errorf(n, "sequence must be a list of steps")
+		return nil
+	}
+	if len(n.Content) < 2 {
+		p.errorf(n, "sequence needs at least two steps")
+	}
+
+	steps := make([]Step, 0, len(n.Content))
+	for _, sn := range n.Content {
+		step := Step{Count: 1}
+		if sn.Kind != yaml.MappingNode {
+			p.errorf(sn, "sequence step must be a mapping")
+			continue
+		}
+		hasMatch := false
+		for i := 0; i+1 < len(sn.Content); i += 2 {
+			key, val := sn.Content[i], sn.Content[i+1]
+			switch key.Value {
+			case "match":
+				hasMatch = true
+				step.Match = p.parseMatcher(val)
+			case "count":
+				step.Count = p.positiveInt(val, "count")
+			default:
+				p.errorf(key, "unknown sequence step key %q", key.Value)
+			}
+		}
+		if !hasMatch {
+			p.errorf(sn, "sequence step is missing match")
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func (p *parser) parseMatcher(n *yaml.Node) Matcher {
+	if n.Kind != yaml.MappingNode {
+		p.errorf(n, "match must be a mapping of field to condition")
+		return nil
+	}
+	if len(n.Content) == 0 {
+		p.errorf(n, "match must have at least one field")
+	}
+
+	var m Matcher
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		if !correlation.IsField(key.Value) {
+			p.errorf(key, "unknown field %q: use source, category, severity, summary, agent_id, org_id or payload.<key>", key.Value)
+			continue
+		}
+		conds := p.parseCondition(key.Value, val)
+		for _, c := range conds {
+			m = append(m, fieldCond{field: key.Value, cond: c})
+		}
+	}
+	return m
+}
+
+func (p *parser) parseCondition(field string, n *yaml.Node) []condition {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return []condition{equals(n.Value)}
+	case yaml.SequenceNode:
+		return []condition{p.oneOf(n)}
+	case yaml.MappingNode:
+	default:
+		p.errorf(n, "invalid condition for %s", field)
+		return nil
+	}
+
+	var conds []condition
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		op := key.Value
+
+		if op == "in" {
+			conds = append(conds, p.oneOf(val))
+			continue
+		}
+		if op == "not" {
+			inner := p.parseCondition(field, val)
+			conds = append(conds, negate(inner))
+			continue
+		}
+
+		arg := p.scalar(val, op)
+		switch op {
+		case "equals":
+			conds = append(conds, equals(arg))
+		case "contains":
+			conds = append(conds, contains(arg))
+		case "prefix":
+			conds = append(conds, prefix(arg))
+		case "suffix":
+			conds = append(conds, suffix(arg))
+		case "regex":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				p.errorf(val, "invalid regex for %s: %v", field, err)
+				continue
+			}
+			conds = append(conds, matches(re))
+		case "exists":
+			want, err := strconv.ParseBool(arg)
+			if err != nil {
+				p.errorf(val, "exists must be true or false")
+				continue
+			}
+			conds = append(conds, exists(want))
+		case "gte", "gt", "lte", "lt":
+			if field == "severity" {
+				rank, ok := severities[arg]
+				if !ok {
+					p.errorf(val, "unknown severity %q", arg)
+					continue
+				}
+				conds = append(conds, severityCompare(op, rank))
+				continue
+			}
+			f, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				p.errorf(val, "%s on %s needs a number, got %q", op, field, arg)
+				continue
+			}
+			conds = append(conds, numericCompare(op, f))
+		default:
+			p.errorf(key, "unknown operator %q (supported: equals, in, not, contains, prefix, suffix, regex, exists, gte, gt, lte, lt)", op)
+		}
+	}
+	return conds
+}
+
+func (p *parser) oneOf(n *yaml.Node) condition {
+	if n.Kind != yaml.SequenceNode {
+		p.errorf(n, "expected a list of values")
+		return nil
+	}
+	values := make([]string, 0, len(n.Content))
+	for _, v := range n.Content {
+		values = append(values, p.scalar(v, "list value"))
+	}
+	return in(values)
+}
+
+func (p *parser) scalar(n *yaml.Node, what string) string {
+	if n.Kind != yaml.ScalarNode {
+		p.errorf(n, "%s must be a single value", what)
+		return ""
+	}
+	return n.Value
+}
+
+func (p *parser) boolean(n *yaml.Node, what string) bool {
+	v, err := strconv.ParseBool(p.scalar(n, what))
+	if err != nil {
+		p.errorf(n, "%s must be true or false", what)
+	}
+	return v
+}
+
+func (p *parser) positiveInt(n *yaml.Node, what string) int {
+	v, err := strconv.Atoi(p.scalar(n, what))
+	if err != nil || v < 1 {
+		p.errorf(n, "%s must be a positive integer", what)
+		return 1
+	}
+	return v
+}
+
+func (p *parser) duration(n *yaml.Node) time.Duration {
+	raw := p.scalar(n, "window")
+	d, err := parseWindow(raw)
+	if err != nil || d <= 0 {
+		p.errorf(n, "invalid window %q: use a duration such as 30s, 5m, 1h or 1d", raw)
+		return 0
+	}
+	return d
+}
+
+func parseWindow(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (p *parser) fieldList(n *yaml.Node) []string {
+	var fields []string
+	switch n.Kind {
+	case yaml.ScalarNode:
+		fields = []string{n.Value}
+	case yaml.SequenceNode:
+		for _, v := range n.Content {
+			fields = append(fields, p.scalar(v, "group_by field"))
+		}
+	default:
+		p.errorf(n, "group_by must be a field or list of fields")
+		return nil
+	}
+	for _, f := range fields {
+		if !correlation.IsField(f) {
+			p.errorf(n, "unknown group_by field %q", f)
+		}
+	}
+	return fields
+}
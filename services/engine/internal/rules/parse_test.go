@@ -0,0 +1,122 @@
+package rules_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/rules"
+)
+
+func TestParseThresholdRule(t *testing.T) {
+	src := `
+rules:
+  - name: ssh_spray
+    description: spray
+    severity: high
+    category: attack
+    window: 10m
+    threshold: 3
+    group_by: payload.src_ip
+    match:
+      category: auth_failure
+      severity: {gte: medium}
+`
+	specs, err := rules.Parse("test.yml", []byte(src))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(specs) != 1 {
+		t.Fatalf("expected 1 spec, got %d", len(specs))
+	}
+	s := specs[0]
+	if s.Name != "ssh_spray" || s.Window != 10*time.Minute || s.Threshold != 3 {
+		t.Errorf("unexpected spec: %+v", s)
+	}
+	if len(s.GroupBy) != 1 || s.GroupBy[0] != "payload.src_ip" {
+		t.Errorf("expected group_by payload.src_ip, got %v", s.GroupBy)
+	}
+	if s.Line != 3 {
+		t.Errorf("expected rule on line 3, got %d", s.Line)
+	}
+}
+
+func TestParseAcceptsJSON(t *testing.T) {
+	src := `[{"name": "j", "severity": "low", "window": "1d", "match": {"source": "cloud"}}]`
+	specs, err := rules.Parse("test.json", []byte(src))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(specs) != 1 || specs[0].Window != 24*time.Hour {
+		t.Errorf("unexpected specs: %+v", specs)
+	}
+}
+
+func TestParseReportsErrorsWithLines(t *testing.T) {
+	src := `rules:
+  - name: bad
+    severity: urgent
+    window: 5m
+    match:
+      payload.path: {regex: "("}
+      colour: red
+  - name: worse
+    severity: high
+    window: 5m
+    match: {category: x}
+    sequence:
+      - match: {category: y}
+      - match: {category: z}
+`
+	_, err := rules.Parse("bad.yml", []byte(src))
+	var errs rules.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected rules.Errors, got %v", err)
+	}
+
+	want := map[int]string{
+		3:  "invalid severity",
+		6:  "invalid regex",
+		7:  "unknown field",
+		12: "cannot have both",
+	}
+	for line, msg := range want {
+		found := false
+		for _, e := range errs {
+			if e.Line == line && strings.Contains(e.Msg, msg) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %q on line %d, got:\n%v", msg, line, err)
+		}
+	}
+}
+
+func TestParseReportsSyntaxErrorLine(t *testing.T) {
+	src := "rules:\n  - name: a\n    severity: high\n   window: 5m\n"
+	_, err := rules.Parse("syntax.yml", []byte(src))
+	var errs rules.Errors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected a single syntax error, got %v", err)
+	}
+	if errs[0].Line != 4 || !strings.Contains(errs[0].Msg, "syntax error") {
+		t.Errorf("expected syntax error on line 4, got %v", errs[0])
+	}
+	if !strings.HasPrefix(errs[0].Error(), "syntax.yml:4: ") {
+		t.Errorf("expected file:line prefix, got %q", errs[0].Error())
+	}
+}
+
+func TestParseRequiresFields(t *testing.T) {
+	_, err := rules.Parse("empty.yml", []byte("rules:\n  - description: nothing\n"))
+	if err == nil {
+		t.Fatal("expected error for incomplete rule")
+	}
+	for _, msg := range []string{"missing a name", "missing a severity", "missing a window", "needs either match or sequence"} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected %q in %v", msg, err)
+		}
+	}
+}
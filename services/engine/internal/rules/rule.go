@@ -0,0 +1,234 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+)
+
+type condition func(v interface{}, ok bool) bool
+
+type fieldCond struct {
+	field string
+	cond  condition
+}
+
+// Matcher is a conjunction of field conditions; an event matches when every
+// condition holds.
+type Matcher []fieldCond
+
+func (m Matcher) Matches(event core.Event) bool {
+	for _, fc := range m {
+		v, ok := correlation.FieldValue(event, fc.field)
+		if !fc.cond(v, ok) {
+			return false
+		}
+	}
+	return true
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func equals(want string) condition {
+	return func(v interface{}, ok bool) bool {
+		return ok && toString(v) == want
+	}
+}
+
+func in(values []string) condition {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return func(v interface{}, ok bool) bool {
+		return ok && set[toString(v)]
+	}
+}
+
+func contains(sub string) condition {
+	return func(v interface{}, ok bool) bool {
+		return ok && strings.Contains(toString(v), sub)
+	}
+}
+
+func prefix(p string) condition {
+	return func(v interface{}, ok bool) bool {
+		return ok && strings.HasPrefix(toString(v), p)
+	}
+}
+
+func suffix(s string) condition {
+	return func(v interface{}, ok bool) bool {
+		return ok && strings.HasSuffix(toString(v), s)
+	}
+}
+
+func matches(re *regexp.Regexp) condition {
+	return func(v interface{}, ok bool) bool {
+		return ok && re.MatchString(toString(v))
+	}
+}
+
+func exists(want bool) condition {
+	return func(v interface{}, ok bool) bool {
+		return ok == want
+	}
+}
+
+func negate(conds []condition) condition {
+	return func(v interface{}, ok bool) bool {
+		for _, c := range conds {
+			if c != nil && !c(v, ok) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func compare(op string, got, want float64) bool {
+	switch op {
+	case "gte":
+		return got >= want
+	case "gt":
+		return got > want
+	case "lte":
+		return got <= want
+	case "lt":
+		return got < want
+	}
+	return false
+}
+
+func severityCompare(op string, rank int) condition {
+	return func(v interface{}, ok bool) bool {
+		if !ok {
+			return false
+		}
+		got, known := severities[toString(v)]
+		return known && compare(op, float64(got), float64(rank))
+	}
+}
+
+func numericCompare(op string, want float64) condition {
+	return func(v interface{}, ok bool) bool {
+		if !ok {
+			return false
+		}
+		got, isNum := toFloat(v)
+		return isNum && compare(op, got, want)
+	}
+}
+
+// Compile turns a parsed spec into a correlation rule. Threshold rules fire
+// when at least Threshold events in the window match; sequence rules fire
+// when the steps are seen in time order. GroupBy is passed through so the
+// correlator partitions events before Match sees them, and only events that
+// match the spec (or one of its steps) are partitioned at all.
+func Compile(spec Spec) correlation.Rule {
+	var eval func(events []core.Event) bool
+	var filter func(event core.Event) bool
+	minEvents := spec.Threshold
+
+	if len(spec.Sequence) > 0 {
+		steps := spec.Sequence
+		minEvents = 0
+		for _, s := range steps {
+			minEvents += s.Count
+		}
+		eval = func(events []core.Event) bool {
+			return matchSequence(events, steps)
+		}
+		filter = func(event core.Event) bool {
+			for _, s := range steps {
+				if s.Match.Matches(event) {
+					return true
+				}
+			}
+			return false
+		}
+	} else {
+		m, threshold := spec.Match, spec.Threshold
+		eval = func(events []core.Event) bool {
+			n := 0
+			for _, e := range events {
+				if m.Matches(e) {
+					n++
+					if n >= threshold {
+						return true
+					}
+				}
+			}
+			return false
+		}
+		filter = m.Matches
+	}
+
+	return correlation.Rule{
+		Name:        spec.Name,
+		Description: spec.Description,
+		Window:      spec.Window,
+		MinEvents:   minEvents,
+		Match:       eval,
+		Severity:    spec.Severity,
+		Category:    spec.Category,
+		GroupBy:     spec.GroupBy,
+		Filter:      filter,
+	}
+}
+
+func matchSequence(events []core.Event, steps []Step) bool {
+	ordered := make([]core.Event, len(events))
+	copy(ordered, events)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Time.Before(ordered[j].Time) })
+
+	step, seen := 0, 0
+	for _, e := range ordered {
+		if !steps[step].Match.Matches(e) {
+			continue
+		}
+		seen++
+		if seen < steps[step].Count {
+			continue
+		}
+		step++
+		seen = 0
+		if step == len(steps) {
+			return true
+		}
+	}
+	return false
+}
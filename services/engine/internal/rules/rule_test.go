@@ -0,0 +1,164 @@
+package rules_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/rules"
+)
+
+func compile(t *testing.T, src string) correlation.Rule {
+	t.Helper()
+	specs, err := rules.Parse("test.yml", []byte(src))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(specs) != 1 {
+		t.Fatalf("expected 1 spec, got %d", len(specs))
+	}
+	return rules.Compile(specs[0])
+}
+
+func authFailure(ip string, at time.Time) core.Event {
+	return core.Event{
+		Time:     at,
+		OrgID:    "org-1",
+		Source:   "auth",
+		Category: "auth_failure",
+		Severity: "medium",
+		Payload:  map[string]interface{}{"src_ip": ip, "port": float64(22)},
+	}
+}
+
+func TestCompileThreshold(t *testing.T) {
+	rule := compile(t, `
+- name: failures
+  severity: high
+  window: 5m
+  threshold: 3
+  match:
+    category: auth_failure
+    payload.port: {gte: 20, lt: 25}
+`)
+	if rule.MinEvents != 3 || rule.Window != 5*time.Minute {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+
+	now := time.Now()
+	events := []core.Event{authFailure("10.0.0.1", now), authFailure("10.0.0.2", now)}
+	if rule.Match(events) {
+		t.Error("expected no match below threshold")
+	}
+	events = append(events, authFailure("10.0.0.3", now))
+	if !rule.Match(events) {
+		t.Error("expected match at threshold")
+	}
+}
+
+func TestCompileGroupBy(t *testing.T) {
+	rule := compile(t, `
+- name: failures_per_ip
+  severity: high
+  window: 5m
+  threshold: 3
+  group_by: payload.src_ip
+  match: {category: auth_failure}
+`)
+	if len(rule.GroupBy) != 1 || rule.GroupBy[0] != "payload.src_ip" {
+		t.Fatalf("expected group_by to carry through, got %v", rule.GroupBy)
+	}
+
+	c := correlation.New(1000)
+	c.SetRules(rules.RuleSet, []correlation.Rule{rule})
+
+	fired := func() []correlation.CorrelationResult {
+		var out []correlation.CorrelationResult
+		for _, r := range c.GetResults() {
+			if r.Rule == "failures_per_ip" {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+
+	now := time.Now()
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		c.Process(authFailure(ip, now))
+	}
+	if len(fired()) != 0 {
+		t.Error("expected no match when failures come from different sources")
+	}
+
+	c.Process(authFailure("10.0.0.1", now))
+	c.Process(authFailure("10.0.0.1", now))
+	results := fired()
+	if len(results) != 1 {
+		t.Fatalf("expected one match for three failures from one source, got %d", len(results))
+	}
+	if results[0].GroupKey["payload.src_ip"] != "10.0.0.1" {
+		t.Errorf("expected group key 10.0.0.1, got %v", results[0].GroupKey)
+	}
+}
+
+func TestCompileSequence(t *testing.T) {
+	rule := compile(t, `
+- name: scan_then_exploit
+  severity: critical
+  window: 10m
+  sequence:
+    - match: {category: port_scan}
+    - match: {category: suspicious_port, payload.port: [4444, 31337]}
+`)
+
+	now := time.Now()
+	scan := core.Event{Time: now, Category: "port_scan"}
+	exploit := core.Event{Time: now.Add(time.Minute), Category: "suspicious_port", Payload: map[string]interface{}{"port": float64(4444)}}
+
+	if !rule.Match([]core.Event{exploit, scan}) {
+		t.Error("expected match when scan precedes exploit in time")
+	}
+
+	exploit.Time = now.Add(-time.Minute)
+	if rule.Match([]core.Event{scan, exploit}) {
+		t.Error("expected no match when exploit precedes scan")
+	}
+}
+
+func TestMatcherOperators(t *testing.T) {
+	rule := compile(t, `
+- name: ops
+  severity: low
+  window: 1m
+  match:
+    summary: {contains: "password", prefix: "Failed"}
+    payload.user: {regex: "^adm", not: {in: [admin_ro]}}
+    payload.tty: {exists: false}
+    severity: {gte: medium, lte: high}
+`)
+
+	e := core.Event{
+		Summary:  "Failed password for admin",
+		Severity: "high",
+		Payload:  map[string]interface{}{"user": "admin"},
+	}
+	if !rule.Match([]core.Event{e}) {
+		t.Error("expected event to match all operators")
+	}
+
+	cases := map[string]func(e *core.Event){
+		"excluded user":   func(e *core.Event) { e.Payload = map[string]interface{}{"user": "admin_ro"} },
+		"severity high":   func(e *core.Event) { e.Severity = "critical" },
+		"severity low":    func(e *core.Event) { e.Severity = "low" },
+		"has tty":         func(e *core.Event) { e.Payload = map[string]interface{}{"user": "admin", "tty": "pts/0"} },
+		"summary missing": func(e *core.Event) { e.Summary = "Accepted password" },
+	}
+	for name, mutate := range cases {
+		ev := e
+		mutate(&ev)
+		if rule.Match([]core.Event{ev}) {
+			t.Errorf("%s: expected no match", name)
+		}
+	}
+}
@@ -194,6 +194,21 @@ func (s *Scorer) GetThreatScore(orgID string) *ThreatScore {
 	}
 }
 
+func (s *Scorer) Snapshot() map[string]*ThreatScore {
+	s.mu.RLock()
+	orgIDs := make([]string, 0, len(s.orgScores))
+	for orgID := range s.orgScores {
+		orgIDs = append(orgIDs, orgID)
+	}
+	s.mu.RUnlock()
+
+	result := make(map[string]*ThreatScore, len(orgIDs))
+	for _, orgID := range orgIDs {
+		result[orgID] = s.GetThreatScore(orgID)
+	}
+	return result
+}
+
 func (s *Scorer) GetThreatScoreJSON(orgID string) ([]byte, error) {
 	ts := s.GetThreatScore(orgID)
 	return json.Marshal(ts)
@@ -0,0 +1,266 @@
+package sigma
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type node interface {
+	eval(sel func(name string) bool) bool
+}
+
+type identNode struct{ name string }
+
+func (n identNode) eval(sel func(string) bool) bool { return sel(n.name) }
+
+type notNode struct{ inner node }
+
+func (n notNode) eval(sel func(string) bool) bool { return !n.inner.eval(sel) }
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(sel func(string) bool) bool {
+	return n.left.eval(sel) && n.right.eval(sel)
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(sel func(string) bool) bool {
+	return n.left.eval(sel) || n.right.eval(sel)
+}
+
+type ofNode struct {
+	all   bool
+	names []string
+}
+
+func (n ofNode) eval(sel func(string) bool) bool {
+	for _, name := range n.names {
+		matched := sel(name)
+		if n.all && !matched {
+			return false
+		}
+		if !n.all && matched {
+			return true
+		}
+	}
+	return n.all
+}
+
+type conditionParser struct {
+	tokens     []string
+	pos        int
+	selections []string
+}
+
+func tokenize(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// parseCondition parses the boolean part of a Sigma condition, resolving
+// "1 of"/"all of" patterns against the rule's selection names.
+func parseCondition(expr string, selections []string) (node, error) {
+	p := &conditionParser{tokens: tokenize(expr), selections: selections}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in condition", p.tokens[p.pos])
+	}
+	return n, nil
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *conditionParser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseNot() (node, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case tok == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return n, nil
+	case tok == ")":
+		return nil, fmt.Errorf("unexpected closing parenthesis")
+	case tok == "1" || strings.EqualFold(tok, "all") || strings.EqualFold(tok, "any"):
+		if !strings.EqualFold(p.next(), "of") {
+			return nil, fmt.Errorf("expected 'of' after %q", tok)
+		}
+		pattern := p.next()
+		if pattern == "" {
+			return nil, fmt.Errorf("expected selection pattern after '%s of'", tok)
+		}
+		names, err := p.resolve(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return ofNode{all: strings.EqualFold(tok, "all"), names: names}, nil
+	case isKeyword(tok):
+		return nil, fmt.Errorf("unexpected %q in condition", tok)
+	default:
+		for _, s := range p.selections {
+			if s == tok {
+				return identNode{tok}, nil
+			}
+		}
+		return nil, fmt.Errorf("condition references unknown selection %q", tok)
+	}
+}
+
+func (p *conditionParser) resolve(pattern string) ([]string, error) {
+	var names []string
+	for _, s := range p.selections {
+		if pattern == "them" {
+			if !strings.HasPrefix(s, "_") {
+				names = append(names, s)
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, s); ok {
+			names = append(names, s)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("pattern %q matches no selection", pattern)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func isKeyword(tok string) bool {
+	switch strings.ToLower(tok) {
+	case "and", "or", "not", "of":
+		return true
+	}
+	return false
+}
+
+type aggregation struct {
+	field   string
+	groupBy []string
+	op      string
+	value   int
+}
+
+var aggPattern = regexp.MustCompile(`^count\(\s*([\w.\-]*)\s*\)\s*(?:by\s+([\w.\-]+(?:\s*,\s*[\w.\-]+)*))?\s*(>=|<=|==|>|<|=)\s*(\d+)$`)
+
+func parseAggregation(expr string) (*aggregation, error) {
+	m := aggPattern.FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return nil, fmt.Errorf("unsupported aggregation %q: expected count([field]) [by field] <op> N", strings.TrimSpace(expr))
+	}
+	agg := &aggregation{field: m[1], op: m[3]}
+	if m[2] != "" {
+		for _, f := range strings.Split(m[2], ",") {
+			agg.groupBy = append(agg.groupBy, strings.TrimSpace(f))
+		}
+	}
+	// Events arrive one at a time, so "fewer than" can't be decided until
+	// the timeframe closes; only rising thresholds are supported.
+	if agg.op == "<" || agg.op == "<=" {
+		return nil, fmt.Errorf("aggregation operator %q is not supported", agg.op)
+	}
+	agg.value, _ = strconv.Atoi(m[4])
+	return agg, nil
+}
+
+func (a *aggregation) satisfied(n int) bool {
+	switch a.op {
+	case ">":
+		return n > a.value
+	case ">=":
+		return n >= a.value
+	default:
+		return n == a.value
+	}
+}
@@ -0,0 +1,83 @@
+package sigma_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/sigma"
+)
+
+const conditionRule = `
+title: conditions
+detection:
+  sel_user:
+    User: root
+  sel_src:
+    SourceIp|cidr: 10.0.0.0/8
+  filter_ok:
+    category: auth_success
+  condition: %s
+`
+
+func TestConditions(t *testing.T) {
+	rootInternalFail := core.Event{Category: "auth_failure", Payload: map[string]interface{}{"user": "root", "src_ip": "10.0.0.1"}}
+	rootExternalOK := core.Event{Category: "auth_success", Payload: map[string]interface{}{"user": "root", "src_ip": "8.8.8.8"}}
+	otherInternal := core.Event{Category: "auth_failure", Payload: map[string]interface{}{"user": "bob", "src_ip": "10.0.0.2"}}
+
+	cases := []struct {
+		cond  string
+		event core.Event
+		want  bool
+	}{
+		{"sel_user and sel_src", rootInternalFail, true},
+		{"sel_user and sel_src", rootExternalOK, false},
+		{"sel_user or sel_src", otherInternal, true},
+		{"sel_user and not filter_ok", rootExternalOK, false},
+		{"sel_user and not filter_ok", rootInternalFail, true},
+		{"(sel_user or sel_src) and not filter_ok", otherInternal, true},
+		{"not (sel_user or sel_src)", otherInternal, false},
+		{"1 of sel_*", otherInternal, true},
+		{"all of sel_*", otherInternal, false},
+		{"all of sel_*", rootInternalFail, true},
+		{"1 of them", rootExternalOK, true},
+		{"all of them", rootInternalFail, false},
+		{"sel_user AND NOT filter_ok", rootInternalFail, true},
+	}
+	for _, tc := range cases {
+		r := parseOne(t, fmt.Sprintf(conditionRule, tc.cond))
+		if got := r.Matches(tc.event); got != tc.want {
+			t.Errorf("%q on %v: got %v, want %v", tc.cond, tc.event.Payload, got, tc.want)
+		}
+	}
+}
+
+func TestConditionList(t *testing.T) {
+	r := parseOne(t, `
+title: t
+detection:
+  a: {User: alice}
+  b: {User: bob}
+  condition:
+    - a
+    - b
+`)
+	if !r.Matches(core.Event{Payload: map[string]interface{}{"user": "bob"}}) {
+		t.Error("expected condition list to be ORed")
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	for _, cond := range []string{
+		"sel_user and",
+		"(sel_user",
+		"sel_user)",
+		"1 of nomatch_*",
+		"all sel_user",
+		"sel_user sel_src",
+	} {
+		if _, err := sigma.Parse([]byte(fmt.Sprintf(conditionRule, cond)), nil); err == nil {
+			t.Errorf("%q: expected error", cond)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package sigma
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+)
+
+// maxAggregationEvents bounds how many events one aggregation group keeps
+// while waiting to reach its threshold.
+const maxAggregationEvents = 1000
+
+type Match struct {
+	Rule     *Rule
+	Events   []core.Event
+	GroupKey map[string]string
+	Count    int
+}
+
+type aggState struct {
+	events   []core.Event
+	groupKey map[string]string
+	lastSeen time.Time
+	window   time.Duration
+}
+
+type Evaluator struct {
+	mu        sync.Mutex
+	rules     []*Rule
+	states    map[string]*aggState
+	lastSweep time.Time
+}
+
+func NewEvaluator(rules []*Rule) *Evaluator {
+	return &Evaluator{
+		rules:     rules,
+		states:    make(map[string]*aggState),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetRules replaces the active rules and drops any pending aggregations.
+func (e *Evaluator) SetRules(rules []*Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+	e.states = make(map[string]*aggState)
+}
+
+func (e *Evaluator) RuleCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.rules)
+}
+
+// Process evaluates every rule against the event. Plain rules match on the
+// event alone; aggregation rules collect matching events per group within
+// the rule's timeframe and fire once the count condition holds.
+func (e *Evaluator) Process(event core.Event) []Match {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := event.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if time.Since(e.lastSweep) > time.Minute {
+		e.sweepLocked(time.Now())
+	}
+
+	var matches []Match
+	for _, rule := range e.rules {
+		if !rule.Matches(event) {
+			continue
+		}
+		if rule.aggregation == nil {
+			matches = append(matches, Match{Rule: rule, Events: []core.Event{event}, Count: 1})
+			continue
+		}
+		if m, ok := e.aggregateLocked(rule, event, now); ok {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+func (e *Evaluator) aggregateLocked(rule *Rule, event core.Event, now time.Time) (Match, bool) {
+	groupKey, key, ok := correlation.GroupKey(event, rule.groupFields)
+	if !ok {
+		return Match{}, false
+	}
+	stateKey := rule.key() + "\x1e" + event.OrgID + "\x1e" + key
+
+	st, ok := e.states[stateKey]
+	if !ok {
+		st = &aggState{groupKey: groupKey, window: rule.Timeframe}
+		e.states[stateKey] = st
+	}
+
+	cutoff := now.Add(-rule.Timeframe)
+	kept := st.events[:0]
+	for _, ev := range st.events {
+		if !ev.Time.Before(cutoff) {
+			kept = append(kept, ev)
+		}
+	}
+	st.events = append(kept, event)
+	if len(st.events) > maxAggregationEvents {
+		st.events = st.events[len(st.events)-maxAggregationEvents:]
+	}
+	st.lastSeen = time.Now()
+
+	n := len(st.events)
+	if rule.countField != "" {
+		n = distinctCount(st.events, rule.countField)
+	}
+	if !rule.aggregation.satisfied(n) {
+		return Match{}, false
+	}
+
+	// Start the group over so a sustained condition fires once per
+	// threshold crossing rather than on every following event.
+	delete(e.states, stateKey)
+	events := make([]core.Event, len(st.events))
+	copy(events, st.events)
+	return Match{Rule: rule, Events: events, GroupKey: st.groupKey, Count: n}, true
+}
+
+func distinctCount(events []core.Event, field string) int {
+	seen := make(map[string]bool)
+	for _, ev := range events {
+		v, ok := correlation.FieldValue(ev, field)
+		if !ok {
+			continue
+		}
+		seen[fmt.Sprint(v)] = true
+	}
+	return len(seen)
+}
+
+// Sweep drops aggregation groups that have seen nothing within their
+// timeframe. Process calls it periodically.
+func (e *Evaluator) Sweep() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sweepLocked(time.Now())
+}
+
+func (e *Evaluator) sweepLocked(now time.Time) {
+	for k, st := range e.states {
+		if now.Sub(st.lastSeen) > st.window {
+			delete(e.states, k)
+		}
+	}
+	e.lastSweep = now
+}
+
+func (e *Evaluator) PendingGroups() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.states)
+}
+
+// LoadDir parses every .yml/.yaml file in dir. Rules from files that parse
+// cleanly are returned even when other files fail; the failures come back
+// joined in the error.
+func LoadDir(dir string, m *Mapping) ([]*Rule, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read sigma dir: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if entry.IsDir() || strings.HasPrefix(name, ".") || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+
+	var rules []*Rule
+	var errs []error
+	seen := make(map[string]string)
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		parsed, err := Parse(data, m)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		for _, r := range parsed {
+			if prev, dup := seen[r.key()]; dup {
+				errs = append(errs, fmt.Errorf("%s: duplicate sigma rule %q (first defined in %s)", path, r.key(), prev))
+				continue
+			}
+			seen[r.key()] = path
+			rules = append(rules, r)
+		}
+	}
+	return rules, errors.Join(errs...)
+}
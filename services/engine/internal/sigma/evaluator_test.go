@@ -0,0 +1,186 @@
+package sigma_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/sigma"
+)
+
+func failure(ip, user string, at time.Time) core.Event {
+	return core.Event{
+		Time:     at,
+		OrgID:    "org-1",
+		Source:   "auth",
+		Category: "auth_failure",
+		Payload:  map[string]interface{}{"src_ip": ip, "user": user},
+	}
+}
+
+func TestEvaluatorSimpleMatch(t *testing.T) {
+	r := parseOne(t, `
+title: root login failure
+detection:
+  sel: {category: auth_failure, User: root}
+  condition: sel
+`)
+	ev := sigma.NewEvaluator([]*sigma.Rule{r})
+
+	if got := ev.Process(failure("10.0.0.1", "bob", time.Now())); len(got) != 0 {
+		t.Errorf("expected no match, got %d", len(got))
+	}
+	got := ev.Process(failure("10.0.0.1", "root", time.Now()))
+	if len(got) != 1 || got[0].Rule != r || got[0].Count != 1 {
+		t.Fatalf("expected one match, got %+v", got)
+	}
+}
+
+func TestEvaluatorCountByGroup(t *testing.T) {
+	r := parseOne(t, `
+title: brute force
+detection:
+  sel: {category: auth_failure}
+  timeframe: 5m
+  condition: sel | count() by SourceIp >= 3
+`)
+	ev := sigma.NewEvaluator([]*sigma.Rule{r})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if m := ev.Process(failure("10.0.0.1", "root", now)); len(m) != 0 {
+			t.Fatalf("fired early on event %d", i)
+		}
+		if m := ev.Process(failure("10.0.0.2", "root", now)); len(m) != 0 {
+			t.Fatalf("fired early for second source on event %d", i)
+		}
+	}
+
+	m := ev.Process(failure("10.0.0.1", "root", now))
+	if len(m) != 1 {
+		t.Fatalf("expected match on third event from same source, got %d", len(m))
+	}
+	if m[0].GroupKey["payload.src_ip"] != "10.0.0.1" || m[0].Count != 3 || len(m[0].Events) != 3 {
+		t.Errorf("unexpected match %+v", m[0])
+	}
+
+	if m := ev.Process(failure("10.0.0.1", "root", now)); len(m) != 0 {
+		t.Error("expected group to reset after firing")
+	}
+}
+
+func TestEvaluatorTimeframe(t *testing.T) {
+	r := parseOne(t, `
+title: brute force
+detection:
+  sel: {category: auth_failure}
+  timeframe: 1m
+  condition: sel | count() >= 2
+`)
+	ev := sigma.NewEvaluator([]*sigma.Rule{r})
+	now := time.Now()
+
+	ev.Process(failure("10.0.0.1", "root", now.Add(-5*time.Minute)))
+	if m := ev.Process(failure("10.0.0.1", "root", now)); len(m) != 0 {
+		t.Error("expected events outside the timeframe not to count")
+	}
+	if m := ev.Process(failure("10.0.0.1", "root", now.Add(time.Second))); len(m) != 1 {
+		t.Error("expected match for two events inside the timeframe")
+	}
+}
+
+func TestEvaluatorDistinctCount(t *testing.T) {
+	r := parseOne(t, `
+title: spraying
+detection:
+  sel: {category: auth_failure}
+  condition: sel | count(User) by SourceIp > 2
+`)
+	ev := sigma.NewEvaluator([]*sigma.Rule{r})
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		if m := ev.Process(failure("10.0.0.1", "root", now)); len(m) != 0 {
+			t.Fatal("repeated user should not count as distinct")
+		}
+	}
+	ev.Process(failure("10.0.0.1", "alice", now))
+	m := ev.Process(failure("10.0.0.1", "bob", now))
+	if len(m) != 1 || m[0].Count != 3 {
+		t.Fatalf("expected match on third distinct user, got %+v", m)
+	}
+}
+
+func TestEvaluatorSeparatesOrgs(t *testing.T) {
+	r := parseOne(t, `
+title: t
+detection:
+  sel: {category: auth_failure}
+  condition: sel | count() >= 2
+`)
+	ev := sigma.NewEvaluator([]*sigma.Rule{r})
+
+	a := failure("10.0.0.1", "root", time.Now())
+	b := a
+	b.OrgID = "org-2"
+	ev.Process(a)
+	if m := ev.Process(b); len(m) != 0 {
+		t.Error("expected counts to be kept per org")
+	}
+}
+
+func TestEvaluatorSweep(t *testing.T) {
+	r := parseOne(t, `
+title: t
+detection:
+  sel: {category: auth_failure}
+  timeframe: 10ms
+  condition: sel | count() by SourceIp >= 100
+`)
+	ev := sigma.NewEvaluator([]*sigma.Rule{r})
+	for i := 0; i < 3; i++ {
+		ev.Process(failure(fmt.Sprintf("10.0.0.%d", i), "root", time.Now()))
+	}
+	if ev.PendingGroups() != 3 {
+		t.Fatalf("expected 3 pending groups, got %d", ev.PendingGroups())
+	}
+	time.Sleep(20 * time.Millisecond)
+	ev.Sweep()
+	if ev.PendingGroups() != 0 {
+		t.Errorf("expected stale groups swept, got %d", ev.PendingGroups())
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("good.yml", "title: good\nid: g1\ndetection:\n  sel: {User: root}\n  condition: sel\n")
+	write("bad.yaml", "title: bad\ndetection:\n  sel: {User: root}\n  condition: missing\n")
+	write("later.yml", "title: dup\nid: g1\ndetection:\n  sel: {User: x}\n  condition: sel\n")
+	write("notes.txt", "not a rule")
+
+	rules, err := sigma.LoadDir(dir, nil)
+	if err == nil {
+		t.Error("expected errors for bad and duplicate rules")
+	}
+	if len(rules) != 1 || rules[0].Title != "good" {
+		t.Errorf("expected only the good rule, got %d", len(rules))
+	}
+}
+
+func TestShippedRulesParse(t *testing.T) {
+	rules, err := sigma.LoadDir("../../sigma", sigma.DefaultMapping())
+	if err != nil {
+		t.Fatalf("shipped sigma rules failed to load: %v", err)
+	}
+	if len(rules) == 0 {
+		t.Error("expected shipped sigma rules")
+	}
+}
@@ -0,0 +1,109 @@
+package sigma
+
+import (
+	"strings"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+)
+
+type Logsource struct {
+	Product  string `yaml:"product"`
+	Service  string `yaml:"service"`
+	Category string `yaml:"category"`
+}
+
+// LogsourceMapping ties a Sigma logsource to the event sources it covers.
+// Empty fields act as wildcards; Sources lists allowed core.Event sources.
+type LogsourceMapping struct {
+	Product  string
+	Service  string
+	Category string
+	Sources  []string
+}
+
+func (m LogsourceMapping) matches(ls Logsource) bool {
+	if m.Product == "" && m.Service == "" && m.Category == "" {
+		return false
+	}
+	return (m.Product == "" || strings.EqualFold(m.Product, ls.Product)) &&
+		(m.Service == "" || strings.EqualFold(m.Service, ls.Service)) &&
+		(m.Category == "" || strings.EqualFold(m.Category, ls.Category))
+}
+
+// Mapping translates Sigma field names and logsources onto our events.
+// Fields not listed fall through to payload.<name>.
+type Mapping struct {
+	Fields     map[string]string
+	Logsources []LogsourceMapping
+	Keywords   []string
+}
+
+func DefaultMapping() *Mapping {
+	return &Mapping{
+		Fields: map[string]string{
+			"SourceIp":        "payload.src_ip",
+			"src_ip":          "payload.src_ip",
+			"sourceIPAddress": "payload.src_ip",
+			"ClientIP":        "payload.src_ip",
+			"SourcePort":      "payload.src_port",
+			"DestinationIp":   "payload.dst_ip",
+			"dst_ip":          "payload.dst_ip",
+			"DestinationPort": "payload.dst_port",
+			"dst_port":        "payload.dst_port",
+			"Protocol":        "payload.protocol",
+			"User":            "payload.user",
+			"TargetUserName":  "payload.user",
+			"SubjectUserName": "payload.user",
+			"c-ip":            "payload.remote_addr",
+			"cs-method":       "payload.method",
+			"cs-uri-stem":     "payload.path",
+			"c-uri":           "payload.path",
+			"sc-status":       "payload.status",
+			"Hostname":        "payload.hostname",
+			"Image":           "payload.exe",
+			"CommandLine":     "payload.cmdline",
+			"ProcessId":       "payload.pid",
+			"message":         "summary",
+		},
+		Logsources: []LogsourceMapping{
+			{Product: "linux", Service: "auth", Sources: []string{"auth"}},
+			{Product: "linux", Service: "sshd", Sources: []string{"auth"}},
+			{Product: "linux", Service: "syslog", Sources: []string{"syslog"}},
+			{Service: "sshd", Sources: []string{"auth"}},
+			{Service: "auth", Sources: []string{"auth"}},
+			{Category: "webserver", Sources: []string{"nginx"}},
+			{Product: "nginx", Sources: []string{"nginx"}},
+			{Category: "network_connection", Sources: []string{"network"}},
+			{Category: "firewall", Sources: []string{"network"}},
+			{Product: "aws", Sources: []string{"cloud"}},
+			{Product: "gcp", Sources: []string{"cloud"}},
+			{Product: "azure", Sources: []string{"cloud"}},
+			{Product: "linux", Sources: []string{"auth", "syslog", "host", "network"}},
+		},
+		Keywords: []string{"summary", "payload.raw", "payload.message"},
+	}
+}
+
+func (m *Mapping) field(name string) string {
+	if mapped, ok := m.Fields[name]; ok {
+		return mapped
+	}
+	if correlation.IsField(name) {
+		return name
+	}
+	return "payload." + name
+}
+
+// sources returns the event sources for a logsource. ok is false when the
+// logsource is set but nothing maps it, so the rule cannot be evaluated.
+func (m *Mapping) sources(ls Logsource) ([]string, bool) {
+	if ls.Product == "" && ls.Service == "" && ls.Category == "" {
+		return nil, true
+	}
+	for _, lm := range m.Logsources {
+		if lm.matches(ls) {
+			return lm.Sources, true
+		}
+	}
+	return nil, false
+}
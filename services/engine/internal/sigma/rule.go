@@ -0,0 +1,520 @@
+package sigma
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+)
+
+const defaultTimeframe = time.Hour
+
+type Rule struct {
+	ID          string
+	Title       string
+	Description string
+	Status      string
+	Level       string
+	Tags        []string
+	Logsource   Logsource
+	Timeframe   time.Duration
+
+	sources     map[string]bool
+	selections  map[string]selection
+	condition   node
+	aggregation *aggregation
+	countField  string
+	groupFields []string
+}
+
+type ruleDoc struct {
+	ID          string                 `yaml:"id"`
+	Title       string                 `yaml:"title"`
+	Description string                 `yaml:"description"`
+	Status      string                 `yaml:"status"`
+	Level       string                 `yaml:"level"`
+	Tags        []string               `yaml:"tags"`
+	Logsource   Logsource              `yaml:"logsource"`
+	Detection   map[string]interface{} `yaml:"detection"`
+}
+
+// Parse reads one or more Sigma rules (YAML documents separated by ---)
+// and compiles them against the field mapping.
+func Parse(data []byte, m *Mapping) ([]*Rule, error) {
+	if m == nil {
+		m = DefaultMapping()
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var rules []*Rule
+	for {
+		var doc ruleDoc
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sigma: %w", err)
+		}
+		if doc.Title == "" && doc.Detection == nil {
+			continue
+		}
+		rule, err := compile(doc, m)
+		if err != nil {
+			name := doc.Title
+			if name == "" {
+				name = doc.ID
+			}
+			return nil, fmt.Errorf("sigma rule %q: %w", name, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func compile(doc ruleDoc, m *Mapping) (*Rule, error) {
+	if doc.Title == "" {
+		return nil, errors.New("missing title")
+	}
+	if len(doc.Detection) == 0 {
+		return nil, errors.New("missing detection")
+	}
+
+	rule := &Rule{
+		ID:          doc.ID,
+		Title:       doc.Title,
+		Description: doc.Description,
+		Status:      doc.Status,
+		Level:       strings.ToLower(doc.Level),
+		Tags:        doc.Tags,
+		Logsource:   doc.Logsource,
+		Timeframe:   defaultTimeframe,
+		selections:  make(map[string]selection),
+	}
+	if rule.Level == "" {
+		rule.Level = "medium"
+	}
+
+	sources, ok := m.sources(doc.Logsource)
+	if !ok {
+		return nil, fmt.Errorf("unsupported logsource %+v", doc.Logsource)
+	}
+	if len(sources) > 0 {
+		rule.sources = make(map[string]bool, len(sources))
+		for _, s := range sources {
+			rule.sources[s] = true
+		}
+	}
+
+	var condition interface{}
+	for name, def := range doc.Detection {
+		switch name {
+		case "condition":
+			condition = def
+			continue
+		case "timeframe":
+			tf, err := parseTimeframe(fmt.Sprint(def))
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeframe %v", def)
+			}
+			rule.Timeframe = tf
+			continue
+		}
+		sel, err := compileSelection(def, m)
+		if err != nil {
+			return nil, fmt.Errorf("selection %s: %w", name, err)
+		}
+		rule.selections[name] = sel
+	}
+
+	names := make([]string, 0, len(rule.selections))
+	for name := range rule.selections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// A list of conditions means any of them.
+	var exprs []string
+	switch c := condition.(type) {
+	case string:
+		exprs = []string{c}
+	case []interface{}:
+		for _, v := range c {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("condition list must contain strings")
+			}
+			exprs = append(exprs, s)
+		}
+	case nil:
+		return nil, errors.New("missing condition")
+	default:
+		return nil, errors.New("condition must be a string or list of strings")
+	}
+
+	for _, expr := range exprs {
+		boolPart, aggPart, hasAgg := strings.Cut(expr, "|")
+		n, err := parseCondition(boolPart, names)
+		if err != nil {
+			return nil, err
+		}
+		if hasAgg {
+			if len(exprs) > 1 {
+				return nil, errors.New("aggregations cannot be combined with a condition list")
+			}
+			agg, err := parseAggregation(aggPart)
+			if err != nil {
+				return nil, err
+			}
+			rule.aggregation = agg
+			if agg.field != "" {
+				rule.countField = m.field(agg.field)
+			}
+			for _, g := range agg.groupBy {
+				rule.groupFields = append(rule.groupFields, m.field(g))
+			}
+		}
+		if rule.condition == nil {
+			rule.condition = n
+		} else {
+			rule.condition = orNode{rule.condition, n}
+		}
+	}
+
+	return rule, nil
+}
+
+func parseTimeframe(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.New("invalid timeframe")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.New("invalid timeframe")
+	}
+	return d, nil
+}
+
+// Matches reports whether a single event satisfies the rule's logsource and
+// boolean condition. Aggregation is handled by the Evaluator.
+func (r *Rule) Matches(event core.Event) bool {
+	if r.sources != nil && !r.sources[event.Source] {
+		return false
+	}
+	cache := make(map[string]bool, len(r.selections))
+	return r.condition.eval(func(name string) bool {
+		if v, ok := cache[name]; ok {
+			return v
+		}
+		v := r.selections[name].matches(event)
+		cache[name] = v
+		return v
+	})
+}
+
+func (r *Rule) key() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.Title
+}
+
+// selection is a disjunction of field maps (a list of maps in Sigma), or a
+// keyword search when the selection is a plain list of strings.
+type selection struct {
+	alternatives [][]fieldMatcher
+}
+
+func (s selection) matches(event core.Event) bool {
+	for _, alt := range s.alternatives {
+		all := true
+		for _, fm := range alt {
+			if !fm.matches(event) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+type valueMatcher func(s string) bool
+
+type fieldMatcher struct {
+	fields []string
+	values []valueMatcher
+	all    bool
+	exists *bool
+	null   bool
+}
+
+func (fm fieldMatcher) matches(event core.Event) bool {
+	var candidates []string
+	found := false
+	for _, f := range fm.fields {
+		v, ok := correlation.FieldValue(event, f)
+		if !ok {
+			continue
+		}
+		found = true
+		candidates = append(candidates, stringValues(v)...)
+	}
+
+	if fm.exists != nil {
+		return found == *fm.exists
+	}
+	if fm.null {
+		return !found || (len(candidates) == 1 && candidates[0] == "")
+	}
+	if !found {
+		return false
+	}
+
+	if fm.all {
+		for _, vm := range fm.values {
+			if !anyMatch(vm, candidates) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, vm := range fm.values {
+		if anyMatch(vm, candidates) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyMatch(vm valueMatcher, candidates []string) bool {
+	for _, c := range candidates {
+		if vm(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringValues(v interface{}) []string {
+	switch t := v.(type) {
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			out = append(out, stringValues(item)...)
+		}
+		return out
+	case []string:
+		return t
+	case string:
+		return []string{t}
+	case float64:
+		return []string{strconv.FormatFloat(t, 'f', -1, 64)}
+	case float32:
+		return []string{strconv.FormatFloat(float64(t), 'f', -1, 32)}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func compileSelection(def interface{}, m *Mapping) (selection, error) {
+	switch d := def.(type) {
+	case map[string]interface{}:
+		alt, err := compileFieldMap(d, m)
+		if err != nil {
+			return selection{}, err
+		}
+		return selection{alternatives: [][]fieldMatcher{alt}}, nil
+	case []interface{}:
+		var sel selection
+		var keywords []interface{}
+		for _, item := range d {
+			if fields, ok := item.(map[string]interface{}); ok {
+				alt, err := compileFieldMap(fields, m)
+				if err != nil {
+					return selection{}, err
+				}
+				sel.alternatives = append(sel.alternatives, alt)
+				continue
+			}
+			keywords = append(keywords, item)
+		}
+		if len(keywords) > 0 {
+			fm, err := compileField(m.Keywords, []string{"contains"}, keywords)
+			if err != nil {
+				return selection{}, err
+			}
+			sel.alternatives = append(sel.alternatives, []fieldMatcher{fm})
+		}
+		return sel, nil
+	default:
+		return selection{}, fmt.Errorf("expected a map or list, got %T", def)
+	}
+}
+
+func compileFieldMap(fields map[string]interface{}, m *Mapping) ([]fieldMatcher, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matchers := make([]fieldMatcher, 0, len(fields))
+	for _, name := range names {
+		parts := strings.Split(name, "|")
+		var target []string
+		if parts[0] == "" || parts[0] == "keywords" {
+			target = m.Keywords
+		} else {
+			target = []string{m.field(parts[0])}
+		}
+
+		raw := fields[name]
+		var values []interface{}
+		if list, ok := raw.([]interface{}); ok {
+			values = list
+		} else {
+			values = []interface{}{raw}
+		}
+
+		fm, err := compileField(target, parts[1:], values)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		matchers = append(matchers, fm)
+	}
+	return matchers, nil
+}
+
+func compileField(fields []string, modifiers []string, values []interface{}) (fieldMatcher, error) {
+	fm := fieldMatcher{fields: fields}
+
+	kind := ""
+	cased := false
+	for _, mod := range modifiers {
+		switch mod {
+		case "contains", "startswith", "endswith", "re", "cidr":
+			if kind != "" {
+				return fm, fmt.Errorf("modifiers %s and %s cannot be combined", kind, mod)
+			}
+			kind = mod
+		case "all":
+			fm.all = true
+		case "cased":
+			cased = true
+		case "exists":
+			kind = mod
+		default:
+			return fm, fmt.Errorf("unsupported modifier %q", mod)
+		}
+	}
+
+	if kind == "exists" {
+		if len(values) != 1 {
+			return fm, errors.New("exists takes a single true/false value")
+		}
+		want, ok := values[0].(bool)
+		if !ok {
+			return fm, errors.New("exists takes true or false")
+		}
+		fm.exists = &want
+		return fm, nil
+	}
+
+	if len(values) == 1 && values[0] == nil {
+		fm.null = true
+		return fm, nil
+	}
+
+	for _, v := range values {
+		if v == nil {
+			return fm, errors.New("null cannot be mixed with other values")
+		}
+		s := stringValues(v)[0]
+
+		var vm valueMatcher
+		switch kind {
+		case "re":
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return fm, fmt.Errorf("invalid regex %q: %w", s, err)
+			}
+			vm = re.MatchString
+		case "cidr":
+			_, network, err := net.ParseCIDR(s)
+			if err != nil {
+				return fm, fmt.Errorf("invalid cidr %q", s)
+			}
+			vm = func(candidate string) bool {
+				ip := net.ParseIP(candidate)
+				return ip != nil && network.Contains(ip)
+			}
+		default:
+			pattern := s
+			switch kind {
+			case "contains":
+				pattern = "*" + s + "*"
+			case "startswith":
+				pattern = s + "*"
+			case "endswith":
+				pattern = "*" + s
+			}
+			re, err := globRegexp(pattern, cased)
+			if err != nil {
+				return fm, err
+			}
+			vm = re.MatchString
+		}
+		fm.values = append(fm.values, vm)
+	}
+	return fm, nil
+}
+
+// globRegexp converts a Sigma value with * and ? wildcards (escaped with a
+// backslash) into an anchored regexp. Matching is case-insensitive unless
+// the cased modifier is set.
+func globRegexp(pattern string, cased bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if !cased {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			b.WriteString("(?s:.*)")
+		case r == '?':
+			b.WriteString("(?s:.)")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		b.WriteString(`\\`)
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
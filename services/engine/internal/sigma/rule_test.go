@@ -0,0 +1,224 @@
+package sigma_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/sigma"
+)
+
+func parseOne(t *testing.T, doc string) *sigma.Rule {
+	t.Helper()
+	rules, err := sigma.Parse([]byte(doc), nil)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("expected 1 rule, got %d", len(rules))
+	}
+	return rules[0]
+}
+
+func TestParseMetadata(t *testing.T) {
+	r := parseOne(t, `
+title: Test Rule
+id: abc-123
+level: High
+tags: [attack.t1110, attack.credential_access]
+logsource:
+  product: linux
+  service: sshd
+detection:
+  selection:
+    category: auth_failure
+  condition: selection
+`)
+	if r.Title != "Test Rule" || r.ID != "abc-123" {
+		t.Errorf("unexpected metadata %q %q", r.Title, r.ID)
+	}
+	if r.Level != "high" {
+		t.Errorf("expected lowercased level, got %q", r.Level)
+	}
+	if len(r.Tags) != 2 || r.Tags[0] != "attack.t1110" {
+		t.Errorf("unexpected tags %v", r.Tags)
+	}
+}
+
+func TestRuleLogsourceRestrictsSource(t *testing.T) {
+	r := parseOne(t, `
+title: sshd
+logsource: {product: linux, service: sshd}
+detection:
+  selection: {category: auth_failure}
+  condition: selection
+`)
+	if !r.Matches(core.Event{Source: "auth", Category: "auth_failure"}) {
+		t.Error("expected auth event to match")
+	}
+	if r.Matches(core.Event{Source: "nginx", Category: "auth_failure"}) {
+		t.Error("expected nginx event to be filtered by logsource")
+	}
+}
+
+func TestParseUnknownLogsource(t *testing.T) {
+	_, err := sigma.Parse([]byte(`
+title: windows
+logsource: {product: windows, service: security}
+detection:
+  selection: {EventID: 4625}
+  condition: selection
+`), nil)
+	if err == nil || !strings.Contains(err.Error(), "logsource") {
+		t.Errorf("expected logsource error, got %v", err)
+	}
+}
+
+func TestModifiers(t *testing.T) {
+	cases := []struct {
+		name  string
+		field string
+		value string
+		event map[string]interface{}
+		want  bool
+	}{
+		{"plain case-insensitive", "User", "'ROOT'", map[string]interface{}{"user": "root"}, true},
+		{"wildcard", "cs-uri-stem", "'/admin/*'", map[string]interface{}{"path": "/admin/login"}, true},
+		{"wildcard miss", "cs-uri-stem", "'/admin/*'", map[string]interface{}{"path": "/public"}, false},
+		{"contains", "cs-uri-stem|contains", "'../'", map[string]interface{}{"path": "/a/../etc/passwd"}, true},
+		{"startswith", "cs-uri-stem|startswith", "'/wp-'", map[string]interface{}{"path": "/wp-login.php"}, true},
+		{"endswith", "cs-uri-stem|endswith", "'.php'", map[string]interface{}{"path": "/index.html"}, false},
+		{"re", "User|re", "'^adm[0-9]+$'", map[string]interface{}{"user": "adm42"}, true},
+		{"re is case sensitive", "User|re", "'^adm$'", map[string]interface{}{"user": "ADM"}, false},
+		{"cidr", "SourceIp|cidr", "'10.0.0.0/8'", map[string]interface{}{"src_ip": "10.1.2.3"}, true},
+		{"cidr miss", "SourceIp|cidr", "'10.0.0.0/8'", map[string]interface{}{"src_ip": "192.168.1.1"}, false},
+		{"cidr non-ip", "SourceIp|cidr", "'10.0.0.0/8'", map[string]interface{}{"src_ip": "host"}, false},
+		{"numeric", "sc-status", "404", map[string]interface{}{"status": float64(404)}, true},
+		{"list field any", "tags", "'b'", map[string]interface{}{"tags": []interface{}{"a", "b"}}, true},
+		{"missing field", "User", "'root'", map[string]interface{}{}, false},
+		{"null missing", "User", "null", map[string]interface{}{}, true},
+		{"exists", "User|exists", "true", map[string]interface{}{"user": "x"}, true},
+		{"cased", "User|cased", "'Root'", map[string]interface{}{"user": "root"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := parseOne(t, "title: t\ndetection:\n  sel:\n    "+tc.field+": "+tc.value+"\n  condition: sel\n")
+			got := r.Matches(core.Event{Payload: tc.event})
+			if got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValueListIsOrAllModifierIsAnd(t *testing.T) {
+	anyOf := parseOne(t, `
+title: t
+detection:
+  sel:
+    CommandLine|contains: [wget, curl]
+  condition: sel
+`)
+	allOf := parseOne(t, `
+title: t
+detection:
+  sel:
+    CommandLine|contains|all: [wget, chmod]
+  condition: sel
+`)
+	e := core.Event{Payload: map[string]interface{}{"cmdline": "curl http://x | sh"}}
+	if !anyOf.Matches(e) {
+		t.Error("expected list values to be ORed")
+	}
+	if allOf.Matches(e) {
+		t.Error("expected |all to require every value")
+	}
+	e.Payload["cmdline"] = "wget x && chmod +x x"
+	if !allOf.Matches(e) {
+		t.Error("expected |all to match when all values present")
+	}
+}
+
+func TestListOfMapsIsOr(t *testing.T) {
+	r := parseOne(t, `
+title: t
+detection:
+  sel:
+    - User: root
+    - User: admin
+      SourceIp|cidr: 10.0.0.0/8
+  condition: sel
+`)
+	if !r.Matches(core.Event{Payload: map[string]interface{}{"user": "root"}}) {
+		t.Error("expected first alternative to match")
+	}
+	if r.Matches(core.Event{Payload: map[string]interface{}{"user": "admin", "src_ip": "1.2.3.4"}}) {
+		t.Error("expected second alternative to require both fields")
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	r := parseOne(t, `
+title: t
+detection:
+  keywords:
+    - 'segfault'
+    - 'kernel panic'
+  condition: keywords
+`)
+	if !r.Matches(core.Event{Summary: "Kernel panic - not syncing"}) {
+		t.Error("expected keyword match on summary")
+	}
+	if !r.Matches(core.Event{Payload: map[string]interface{}{"raw": "app[12]: segfault at 0"}}) {
+		t.Error("expected keyword match on raw payload")
+	}
+	if r.Matches(core.Event{Summary: "all fine"}) {
+		t.Error("unexpected keyword match")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"missing condition":   "title: t\ndetection:\n  sel: {User: x}\n",
+		"unknown selection":   "title: t\ndetection:\n  sel: {User: x}\n  condition: other\n",
+		"unknown modifier":    "title: t\ndetection:\n  sel: {User|base64offset: x}\n  condition: sel\n",
+		"bad regex":           "title: t\ndetection:\n  sel: {User|re: '('}\n  condition: sel\n",
+		"bad cidr":            "title: t\ndetection:\n  sel: {SourceIp|cidr: nope}\n  condition: sel\n",
+		"bad aggregation":     "title: t\ndetection:\n  sel: {User: x}\n  condition: sel | max(x) > 3\n",
+		"falling aggregation": "title: t\ndetection:\n  sel: {User: x}\n  condition: sel | count() < 3\n",
+		"missing title":       "detection:\n  sel: {User: x}\n  condition: sel\n",
+	}
+	for name, doc := range cases {
+		if _, err := sigma.Parse([]byte(doc), nil); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParseMultipleDocuments(t *testing.T) {
+	rules, err := sigma.Parse([]byte(`
+title: one
+detection: {sel: {User: a}, condition: sel}
+---
+title: two
+detection: {sel: {User: b}, condition: sel}
+`), nil)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(rules) != 2 || rules[1].Title != "two" {
+		t.Errorf("expected two rules, got %d", len(rules))
+	}
+}
+
+func TestCustomFieldMapping(t *testing.T) {
+	m := sigma.DefaultMapping()
+	m.Fields["EventType"] = "category"
+	rules, err := sigma.Parse([]byte("title: t\ndetection:\n  sel: {EventType: port_scan}\n  condition: sel\n"), m)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !rules[0].Matches(core.Event{Category: "port_scan"}) {
+		t.Error("expected mapped field to match category")
+	}
+}
@@ -2,22 +2,35 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/LuminaryxApp/Cybersecurity-Shield/pkg/secrets"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/alerts"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/config"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/core"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/correlation"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/geoip"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/intel"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/notify"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/persistence"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/playbooks"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/rules"
 	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/scoring"
+	"github.com/LuminaryxApp/Cybersecurity-Shield/services/engine/internal/sigma"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nats-io/nats.go"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate-rules" {
+		os.Exit(validateRules(os.Args[2:]))
+	}
+
 	cfg := config.Load()
 
 	opts := []nats.Option{}
@@ -44,15 +57,126 @@ func main() {
 
 	engine := core.New(nc, db)
 
+	delivery := core.DefaultDeliveryConfig()
+	delivery.Stream = cfg.EventsStream
+	delivery.Consumer = cfg.EventsConsumer
+	delivery.DeadLetterSubject = cfg.EventsDeadLetter
+	delivery.MaxDeliver = cfg.EventsMaxDeliver
+	delivery.AckWait = cfg.EventsAckWait
+	delivery.RedeliveryDelay = cfg.EventsRedeliveryDelay
+	engine.SetDelivery(delivery)
+
 	correlator := correlation.New(10000)
 	scorer := scoring.New(parseDuration(cfg.ScoringWindow))
-	alertGen := alerts.NewAlertGenerator(cfg.APIURL, cfg.AlertWebhook, 5.0)
+	alertGen := alerts.NewAlertGenerator(cfg.APIURL, 5.0)
+	alertGen.SetAPIToken(cfg.APIServiceToken)
+	if db != nil {
+		alertGen.SetStore(alerts.NewPGStore(db))
+	}
+
+	notifyCfg := notify.DefaultConfig()
+	notifyCfg.MaxAttempts = cfg.NotifyMaxAttempts
+	notifyCfg.BaseBackoff = cfg.NotifyBackoff
+	notifyCfg.PagerDutyURL = cfg.PagerDutyURL
+	notifyCfg.SMTP = notify.SMTPConfig{
+		Addr:     cfg.SMTPAddr,
+		From:     cfg.SMTPFrom,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+	}
+	if cfg.AlertWebhook != "" {
+		notifyCfg.GlobalRules = append(notifyCfg.GlobalRules, notify.Rule{
+			Name:              "ALERT_WEBHOOK",
+			SeverityThreshold: "info",
+			Channels:          []notify.ChannelConfig{{Type: "slack", URL: cfg.AlertWebhook}},
+			Enabled:           true,
+		})
+	}
+	secretsKey, err := secrets.ParseKey(cfg.SecretsKey)
+	if err != nil {
+		log.Fatalf("invalid SECRETS_KEY: %v", err)
+	}
+	box, err := secrets.NewBox(secretsKey)
+	if err != nil {
+		log.Fatalf("invalid SECRETS_KEY: %v", err)
+	}
+
+	var dispatcher *notify.Dispatcher
+	if db != nil {
+		dispatcher = notify.New(notify.NewPGRules(db, cfg.NotifyRulesTTL, box), notify.NewPGLog(db), notifyCfg)
+	} else {
+		dispatcher = notify.New(nil, nil, notifyCfg)
+	}
+
+	// Playbooks and their execution log live in the database.
+	var runner *playbooks.Runner
+	if db != nil {
+		store := playbooks.NewPGStore(db, cfg.PlaybooksTTL)
+		runner = playbooks.New(store, playbooks.Actions{
+			Enricher: store,
+			Notifier: dispatcher,
+			Commands: playbooks.NewNATSCommands(nc, db),
+			Alerts:   store,
+			Secrets:  box,
+		}, playbooks.Config{
+			Workers:        cfg.PlaybookWorkers,
+			DefaultTimeout: cfg.PlaybookStepTimeout,
+			MaxTimeout:     cfg.PlaybookMaxStepTimeout,
+		})
+		alertGen.SetPlaybooks(runner)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Threat intel tags events before any pipeline sees them, so rules,
+	// scoring and alerts all get the raised severity.
+	if _, err := os.Stat(cfg.IntelFeeds); err == nil {
+		feeds, err := intel.LoadFeeds(cfg.IntelFeeds)
+		if err != nil {
+			log.Printf("warning: some intel feeds in %s were skipped:\n%v", cfg.IntelFeeds, err)
+		}
+		log.Printf("loaded %d intel feeds from %s", len(feeds), cfg.IntelFeeds)
+
+		store := intel.NewStore()
+		go intel.NewFetcher(store, feeds).Run(ctx)
+		matcher := intel.NewMatcher(store)
+		engine.RegisterEnricher("threat_intel", func(event *core.Event) error {
+			if event.Category == "metrics" {
+				return nil
+			}
+			return matcher.Enrich(event)
+		})
+	}
+
+	geoDB := geoip.NewDB()
+	geoWatcher := geoip.NewWatcher(geoDB, cfg.GeoIPCityDB, cfg.GeoIPASNDB, cfg.GeoIPReloadInterval)
+	n, err := geoWatcher.Load()
+	if err != nil {
+		log.Printf("warning: failed to load a geoip database: %v", err)
+	}
+	log.Printf("loaded %d geoip databases", n)
+	// Databases installed after startup are picked up by the watcher; until
+	// then the enricher still flags private and reserved addresses.
+	go geoWatcher.Run(ctx)
+	engine.RegisterEnricher("geoip", func(event *core.Event) error {
+		if event.Category == "metrics" {
+			return nil
+		}
+		return geoDB.Enrich(event)
+	})
 
 	engine.RegisterPipeline("correlation", func(event core.Event) error {
+		if event.Category == "metrics" {
+			return nil
+		}
 		return correlator.Process(event)
 	})
 
 	engine.RegisterPipeline("scoring", func(event core.Event) error {
+		if event.Category == "metrics" {
+			return nil
+		}
 		return scorer.Process(event)
 	})
 
@@ -60,15 +184,96 @@ func main() {
 		return alertGen.ProcessEvent(event)
 	})
 
+	if _, err := os.Stat(cfg.RulesDir); err == nil {
+		watcher := rules.NewWatcher(cfg.RulesDir, correlator, cfg.RulesReloadInterval)
+		n, err := watcher.Load()
+		if err != nil {
+			log.Printf("warning: failed to load rules from %s:\n%v", cfg.RulesDir, err)
+		} else {
+			log.Printf("loaded %d rules from %s", n, cfg.RulesDir)
+		}
+		go watcher.Run(ctx)
+	}
+
+	if _, err := os.Stat(cfg.SigmaDir); err == nil {
+		sigmaRules, err := sigma.LoadDir(cfg.SigmaDir, sigma.DefaultMapping())
+		if err != nil {
+			log.Printf("warning: some sigma rules in %s were skipped:\n%v", cfg.SigmaDir, err)
+		}
+		log.Printf("loaded %d sigma rules from %s", len(sigmaRules), cfg.SigmaDir)
+
+		evaluator := sigma.NewEvaluator(sigmaRules)
+		engine.RegisterPipeline("sigma", func(event core.Event) error {
+			if event.Category == "metrics" {
+				return nil
+			}
+			for _, m := range evaluator.Process(event) {
+				alertGen.ProcessSigma(m)
+			}
+			return nil
+		})
+	}
+
+	var sink *persistence.Sink
+	if db != nil {
+		sink = persistence.New(db, persistence.Config{
+			BatchSize:     cfg.PersistBatchSize,
+			FlushInterval: cfg.PersistFlushInterval,
+			QueueSize:     cfg.PersistQueueSize,
+		})
+		sink.Start(ctx)
+
+		engine.RegisterPipeline("persistence", func(event core.Event) error {
+			if event.RiskScore == 0 {
+				event.RiskScore = float32(scorer.ScoreEvent(event))
+			}
+			return sink.WriteEvent(event)
+		})
+
+		go sink.SnapshotScores(ctx, scorer, cfg.ScoreSnapshotInterval)
+	}
+
+	go dispatcher.Run(ctx, alertGen.Alerts())
+
+	if _, err := nc.Subscribe(notify.TestSubject, func(msg *nats.Msg) {
+		go func() {
+			msg.Respond(dispatcher.HandleTest(ctx, box, msg.Data))
+		}()
+	}); err != nil {
+		log.Printf("warning: failed to subscribe to %s: %v", notify.TestSubject, err)
+	}
+
+	if _, err := nc.Subscribe(alerts.IngestSubject, func(msg *nats.Msg) {
+		go func() {
+			msg.Respond(alertGen.HandleIngest(msg.Data))
+		}()
+	}); err != nil {
+		log.Printf("warning: failed to subscribe to %s: %v", alerts.IngestSubject, err)
+	}
+
+	playbooksDone := make(chan struct{})
+	if runner != nil {
+		go func() {
+			runner.Run(ctx)
+			close(playbooksDone)
+		}()
+		if _, err := nc.Subscribe(playbooks.ApprovalSubject, func(msg *nats.Msg) {
+			go func() {
+				msg.Respond(runner.HandleApproval(ctx, msg.Data))
+			}()
+		}); err != nil {
+			log.Printf("warning: failed to subscribe to %s: %v", playbooks.ApprovalSubject, err)
+		}
+	} else {
+		close(playbooksDone)
+	}
+
 	go func() {
 		for result := range correlator.Results() {
 			alertGen.ProcessCorrelation(result)
 		}
 	}()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	if err := engine.Start(ctx); err != nil {
 		log.Fatalf("failed to start engine: %v", err)
 	}
@@ -81,6 +286,31 @@ func main() {
 
 	log.Println("shutting down engine...")
 	engine.Stop()
+	cancel()
+	<-playbooksDone
+	if sink != nil {
+		sink.Stop()
+	}
+}
+
+func validateRules(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: engine validate-rules DIR")
+		return 2
+	}
+	specs, err := rules.LoadDir(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	enabled := 0
+	for _, s := range specs {
+		if s.Enabled {
+			enabled++
+		}
+	}
+	fmt.Printf("%d rules OK (%d enabled)\n", len(specs), enabled)
+	return 0
 }
 
 func parseDuration(s string) time.Duration {